@@ -0,0 +1,290 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/abanoub-fathy/bebo-gallery/config"
+	"github.com/abanoub-fathy/bebo-gallery/model"
+	"github.com/abanoub-fathy/bebo-gallery/pkg/rand"
+	"github.com/abanoub-fathy/bebo-gallery/pkg/tus"
+)
+
+// uploadsMaxAge is how long the resumable uploads
+// are kept before the gc removes them
+const uploadsMaxAge = 24 * time.Hour
+
+// migrateCommand runs: migrate up|down|status
+func migrateCommand(cfg *config.Config, args []string) error {
+	if len(args) == 0 {
+		return errors.New("expected up, down or status")
+	}
+
+	fs := flag.NewFlagSet("migrate "+args[0], flag.ExitOnError)
+	dryRun := fs.Bool("dry-run", false, "print the sql instead of running it")
+
+	service, err := model.NewService(cfg)
+	if err != nil {
+		return err
+	}
+	defer service.Close()
+
+	migrator, err := service.Migrator()
+	if err != nil {
+		return err
+	}
+	migrator.Log = os.Stdout
+
+	ctx := context.Background()
+	switch args[0] {
+	case "up":
+		fs.Parse(args[1:])
+		migrator.DryRun = *dryRun
+
+		applied, err := migrator.Up(ctx)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("%v migrations applied\n", len(applied))
+
+		// the images uploaded before they had records are
+		// not shown until the records are added
+		recorded, err := service.RecordMissingImages(*dryRun)
+		if err != nil && !*dryRun {
+			return err
+		}
+		if err == nil {
+			action := "added"
+			if *dryRun {
+				action = "would be added"
+			}
+			fmt.Printf("%v missing image records %v\n", recorded, action)
+		}
+	case "down":
+		steps := fs.Int("steps", 1, "number of migrations to roll back, 0 rolls back all of them")
+		fs.Parse(args[1:])
+		migrator.DryRun = *dryRun
+
+		if err := guardProduction(cfg, "migrate down"); err != nil && !*dryRun {
+			return err
+		}
+		rolledBack, err := migrator.Down(ctx, *steps)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("%v migrations rolled back\n", len(rolledBack))
+	case "status":
+		statuses, err := migrator.Status(ctx)
+		if err != nil {
+			return err
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(w, "VERSION\tNAME\tAPPLIED AT")
+		for _, status := range statuses {
+			appliedAt := "pending"
+			if status.Applied {
+				appliedAt = status.AppliedAt.Format(time.RFC3339)
+			}
+			fmt.Fprintf(w, "%v\t%v\t%v\n", status.Version, status.Name, appliedAt)
+		}
+		return w.Flush()
+	default:
+		return fmt.Errorf("unknown migrate command %q", args[0])
+	}
+	return nil
+}
+
+// resetDBCommand drops all the tables and re-creates them
+func resetDBCommand(cfg *config.Config, args []string) error {
+	fs := flag.NewFlagSet("reset-db", flag.ExitOnError)
+	yes := fs.Bool("yes", false, "confirm deleting all the data")
+	fs.Parse(args)
+
+	if err := guardProduction(cfg, "reset-db"); err != nil {
+		return err
+	}
+	if !*yes {
+		return errors.New("this deletes all the data, pass -yes to confirm")
+	}
+
+	service, err := model.NewService(cfg)
+	if err != nil {
+		return err
+	}
+	defer service.Close()
+
+	if err := service.ResetDB(); err != nil {
+		return err
+	}
+	fmt.Println("database is reset")
+	return nil
+}
+
+// userCommand runs: user create|disable|set-password
+func userCommand(cfg *config.Config, args []string) error {
+	if len(args) == 0 {
+		return errors.New("expected create, disable or set-password")
+	}
+
+	fs := flag.NewFlagSet("user "+args[0], flag.ExitOnError)
+	email := fs.String("email", "", "email address of the user")
+
+	service, err := model.NewService(cfg)
+	if err != nil {
+		return err
+	}
+	defer service.Close()
+
+	switch args[0] {
+	case "create":
+		firstName := fs.String("first-name", "", "first name of the user")
+		lastName := fs.String("last-name", "", "last name of the user")
+		password := fs.String("password", "", "password of the user")
+		fs.Parse(args[1:])
+
+		user := &model.User{
+			FirstName: *firstName,
+			LastName:  *lastName,
+			Email:     *email,
+			Password:  *password,
+		}
+		if err := service.UserService.CreateUser(user); err != nil {
+			return err
+		}
+		fmt.Printf("user %v is created with id %v\n", user.Email, user.ID)
+	case "disable":
+		fs.Parse(args[1:])
+
+		user, err := service.UserService.FindByEmail(*email)
+		if err != nil {
+			return err
+		}
+		// the current sessions of the user are logged out too
+		if _, err := service.UserService.DisableUser(user.ID.String()); err != nil {
+			return err
+		}
+		fmt.Printf("user %v is disabled\n", user.Email)
+	case "set-password":
+		password := fs.String("password", "", "the new password of the user")
+		fs.Parse(args[1:])
+
+		user, err := service.UserService.FindByEmail(*email)
+		if err != nil {
+			return err
+		}
+		if _, err := service.UserService.FindAndUpdateByID(user.ID.String(), map[string]interface{}{"password": *password}); err != nil {
+			return err
+		}
+		fmt.Printf("password of user %v is changed\n", user.Email)
+	default:
+		return fmt.Errorf("unknown user command %q", args[0])
+	}
+	return nil
+}
+
+// gcCommand removes the orphan images and the expired tokens
+func gcCommand(cfg *config.Config, args []string) error {
+	fs := flag.NewFlagSet("gc", flag.ExitOnError)
+	dryRun := fs.Bool("dry-run", false, "only report what would be removed")
+	fs.Parse(args)
+
+	service, err := model.NewService(cfg)
+	if err != nil {
+		return err
+	}
+	defer service.Close()
+
+	report, err := service.CollectGarbage(*dryRun)
+	if err != nil {
+		return err
+	}
+
+	// the abandoned uploads and the info of the
+	// finished ones are removed after a day
+	uploads := tus.NewFileStore(cfg.Storage.UploadsDir)
+	expiredUploads, err := uploads.Expired(time.Now().Add(-uploadsMaxAge))
+	if err != nil {
+		return err
+	}
+	if !*dryRun {
+		for _, id := range expiredUploads {
+			if err := uploads.Delete(id); err != nil && err != tus.ErrNotFound {
+				return err
+			}
+		}
+	}
+
+	action := "removed"
+	if *dryRun {
+		action = "would be removed"
+	}
+	for _, galleryID := range report.OrphanImageDirs {
+		fmt.Printf("images of gallery %v %v\n", galleryID, action)
+	}
+	fmt.Printf("%v orphan image dirs, %v expired reset tokens, %v expired login tokens and %v expired uploads %v\n", len(report.OrphanImageDirs), report.ExpiredResetTokens, report.ExpiredLoginTokens, len(expiredUploads), action)
+	if report.RecordedImages > 0 {
+		recordAction := "added"
+		if *dryRun {
+			recordAction = "would be added"
+		}
+		fmt.Printf("%v records of the image files without records %v\n", report.RecordedImages, recordAction)
+	}
+	return nil
+}
+
+// rotateKeysCommand prints new secret keys for the config and
+// logs out all the users. the keys are not written anywhere
+// because the config can come from a file, the environment
+// or the flags
+func rotateKeysCommand(cfg *config.Config, args []string) error {
+	fs := flag.NewFlagSet("rotate-keys", flag.ExitOnError)
+	dryRun := fs.Bool("dry-run", false, "print the new keys without logging out the users")
+	fs.Parse(args)
+
+	hashSecretKey, err := rand.RandString(32)
+	if err != nil {
+		return err
+	}
+	// the csrf key has to be 32 bytes long
+	// and 24 random bytes are 32 in base64
+	csrfKey, err := rand.RandString(24)
+	if err != nil {
+		return err
+	}
+
+	service, err := model.NewService(cfg)
+	if err != nil {
+		return err
+	}
+	defer service.Close()
+
+	loggedOut, err := service.RotateRememberTokens(*dryRun)
+	if err != nil {
+		return err
+	}
+	action := "are logged out"
+	if *dryRun {
+		action = "would be logged out"
+	}
+	fmt.Printf("%v users %v\n\n", loggedOut, action)
+
+	fmt.Println("set the new keys in the config and restart the server:")
+	fmt.Printf("HASH_SECRET_KEY=%v\nCSRF_KEY=%v\n\n", hashSecretKey, csrfKey)
+	fmt.Println("the share links, the access tokens, the oauth tokens and the reset")
+	fmt.Println("password and login links made with the old hash key stop working")
+	return nil
+}
+
+// guardProduction refuses running the destructive
+// commands against the production environment
+func guardProduction(cfg *config.Config, name string) error {
+	if cfg.IsProductionEnv {
+		return fmt.Errorf("%v is not allowed in production", name)
+	}
+	return nil
+}
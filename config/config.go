@@ -1,115 +1,448 @@
 package config
 
 import (
+	"flag"
 	"fmt"
 	"os"
-	"strconv"
+	"path/filepath"
+	"regexp"
+	"strings"
 
+	"github.com/BurntSushi/toml"
 	"github.com/joho/godotenv"
+	"gopkg.in/yaml.v3"
 )
 
-// Configurations represents the app configurations including Env varaibles
-type Configurations struct {
-	Port            int
-	HashSecretKey   string
-	DatabaseURI     string
-	CSRFKey         string
-	EmailAPIKey     string
-	IsProductionEnv bool
+// Config represents the app configurations. it is built by Load
+// from the defaults, an optional config file, the environment
+// variables and the command line flags in that order so every
+// layer overrides the one before it
+type Config struct {
+	Port            int        `yaml:"port" toml:"port"`
+	IsProductionEnv bool       `yaml:"production" toml:"production"`
+	Database        Database   `yaml:"database" toml:"database"`
+	Storage         Storage    `yaml:"storage" toml:"storage"`
+	Mail            Mail       `yaml:"mail" toml:"mail"`
+	Security        Security   `yaml:"security" toml:"security"`
+	Limits          Limits     `yaml:"limits" toml:"limits"`
+	RateLimits      RateLimits `yaml:"rate_limits" toml:"rate_limits"`
+	Passwords       Passwords  `yaml:"passwords" toml:"passwords"`
+
+	// OIDC lists the OpenID Connect providers users can
+	// log in with. they are set only by the config file
+	OIDC []OIDCProvider `yaml:"oidc" toml:"oidc"`
 }
 
-// AppConfig is the configurations for the app you should load the config
-// package and this varaibale will be populated for you with all the
-// configs and environment vars
-var AppConfig Configurations
+// Database holds the database connection settings
+type Database struct {
+	URI          string `yaml:"uri" toml:"uri"`
+	MaxOpenConns int    `yaml:"max_open_conns" toml:"max_open_conns"`
+	MaxIdleConns int    `yaml:"max_idle_conns" toml:"max_idle_conns"`
+}
 
-func init() {
-	loadEnvFile()
-	configs, err := newConfigurations()
-	if err != nil {
-		panic(err)
-	}
-	AppConfig = *configs
+// Storage holds the settings of where the uploaded files live
+type Storage struct {
+	// ImagesDir is the directory the images are saved into
+	// and served from under the /images/ path
+	ImagesDir string `yaml:"images_dir" toml:"images_dir"`
+
+	// UploadsDir is the directory the partial resumable
+	// uploads are kept in until they are finished
+	UploadsDir string `yaml:"uploads_dir" toml:"uploads_dir"`
 }
 
-// loadEnvFile is responsible for loading the env variable file
-func loadEnvFile() error {
-	return godotenv.Load()
+// Mail holds the settings of the email client
+type Mail struct {
+	APIKey      string `yaml:"api_key" toml:"api_key"`
+	FromName    string `yaml:"from_name" toml:"from_name"`
+	FromAddress string `yaml:"from_address" toml:"from_address"`
+
+	// BaseURL is the public url of the app used
+	// to build the links we send inside emails
+	BaseURL string `yaml:"base_url" toml:"base_url"`
 }
 
-// NewConfigurations is the constructor for creating Configurations struct
-// that you can use across the whole app
-func newConfigurations() (*Configurations, error) {
-	port, err := intEnvVariable("PORT")
-	if err != nil {
-		return nil, err
+// Security holds the secret keys of the app
+type Security struct {
+	HashSecretKey string `yaml:"hash_secret_key" toml:"hash_secret_key"`
+	CSRFKey       string `yaml:"csrf_key" toml:"csrf_key"`
+}
+
+// Limits holds the size limits applied to the requests
+type Limits struct {
+	// MaxFormMemory is the max bytes of a multipart form
+	// kept in memory the rest is stored in temp files
+	MaxFormMemory int64 `yaml:"max_form_memory" toml:"max_form_memory"`
+
+	// MaxUploadBytes is the max size of a single upload request
+	MaxUploadBytes int64 `yaml:"max_upload_bytes" toml:"max_upload_bytes"`
+
+	// MaxImportBytes is the max size of an uploaded zip archive
+	MaxImportBytes int64 `yaml:"max_import_bytes" toml:"max_import_bytes"`
+
+	// MaxImportFiles is the max number of files in a zip archive
+	MaxImportFiles int `yaml:"max_import_files" toml:"max_import_files"`
+
+	// MaxImportUnpackedBytes is the max size of all the
+	// files of a zip archive after they are unpacked
+	MaxImportUnpackedBytes int64 `yaml:"max_import_unpacked_bytes" toml:"max_import_unpacked_bytes"`
+}
+
+// Passwords holds the policy the passwords of the users should follow
+type Passwords struct {
+	MinLength int `yaml:"min_length" toml:"min_length"`
+
+	// MinEntropy is the min estimated strength of the passwords in bits
+	MinEntropy int `yaml:"min_entropy" toml:"min_entropy"`
+
+	// BreachedFile is an optional file of the SHA-1 hashes of the
+	// breached passwords sorted by hash like the pwned passwords
+	// downloads. every line is HASH:COUNT
+	BreachedFile string `yaml:"breached_file" toml:"breached_file"`
+
+	// Hash is the algorithm of the new hashes. it is argon2id or
+	// bcrypt. the hashes made with another algorithm or older
+	// params are upgraded when the users log in
+	Hash          string `yaml:"hash" toml:"hash"`
+	BcryptCost    int    `yaml:"bcrypt_cost" toml:"bcrypt_cost"`
+	Argon2Memory  int    `yaml:"argon2_memory" toml:"argon2_memory"`
+	Argon2Time    int    `yaml:"argon2_time" toml:"argon2_time"`
+	Argon2Threads int    `yaml:"argon2_threads" toml:"argon2_threads"`
+
+	// Pepper is an optional secret key mixed into the passwords
+	// before they are hashed so the hashes leaked from the
+	// database can not be cracked without it. the passwords
+	// hashed with it can not be verified once it is removed
+	Pepper string `yaml:"pepper" toml:"pepper"`
+}
+
+// RateLimits holds the limits of the requests every
+// client can make to the routes in a window of time
+type RateLimits struct {
+	// Store is where the limits are counted. it is memory or
+	// database. the database store shares the limits between
+	// all the replicas of the app
+	Store string `yaml:"store" toml:"store"`
+
+	// API is applied to every request of the json api
+	API RateLimit `yaml:"api" toml:"api"`
+
+	// Uploads is applied to the image uploads of the
+	// api and the website together
+	Uploads RateLimit `yaml:"uploads" toml:"uploads"`
+}
+
+// RateLimit is the policy of a rate limited route
+type RateLimit struct {
+	// Algorithm is token_bucket or sliding_window
+	Algorithm string `yaml:"algorithm" toml:"algorithm"`
+
+	// Limit is the number of requests allowed in the
+	// window. the route is not limited if it is 0
+	Limit int `yaml:"limit" toml:"limit"`
+
+	// WindowSeconds is the length of the window
+	WindowSeconds int `yaml:"window_seconds" toml:"window_seconds"`
+}
+
+// OIDCProvider holds the settings of an OpenID Connect provider
+type OIDCProvider struct {
+	// Name is used in the login urls: /auth/<name>/login
+	Name string `yaml:"name" toml:"name"`
+
+	// DisplayName is shown on the login buttons
+	DisplayName string `yaml:"display_name" toml:"display_name"`
+
+	// Issuer is the issuer url. the provider endpoints are read
+	// from <issuer>/.well-known/openid-configuration
+	Issuer string `yaml:"issuer" toml:"issuer"`
+
+	ClientID     string `yaml:"client_id" toml:"client_id"`
+	ClientSecret string `yaml:"client_secret" toml:"client_secret"`
+
+	// Scopes are requested in addition to openid
+	// it defaults to email and profile
+	Scopes []string `yaml:"scopes" toml:"scopes"`
+}
+
+// Default returns the configurations used when
+// nothing else overrides them
+func Default() *Config {
+	return &Config{
+		Port: 3000,
+		Database: Database{
+			MaxOpenConns: 25,
+			MaxIdleConns: 5,
+		},
+		Storage: Storage{
+			ImagesDir:  "images",
+			UploadsDir: "uploads",
+		},
+		Mail: Mail{
+			FromName:    "Abanoub CEO",
+			FromAddress: "logybyvy@lyft.live",
+			BaseURL:     "http://localhost:3000",
+		},
+		Limits: Limits{
+			MaxFormMemory:          30 << 20,
+			MaxUploadBytes:         200 << 20,
+			MaxImportBytes:         2 << 30,
+			MaxImportFiles:         1000,
+			MaxImportUnpackedBytes: 4 << 30,
+		},
+		Passwords: Passwords{
+			MinLength:     8,
+			MinEntropy:    40,
+			Hash:          "argon2id",
+			BcryptCost:    10,
+			Argon2Memory:  64 * 1024,
+			Argon2Time:    3,
+			Argon2Threads: 4,
+		},
+		RateLimits: RateLimits{
+			Store: "memory",
+			API: RateLimit{
+				Algorithm:     "token_bucket",
+				Limit:         300,
+				WindowSeconds: 60,
+			},
+			Uploads: RateLimit{
+				Algorithm:     "sliding_window",
+				Limit:         60,
+				WindowSeconds: 3600,
+			},
+		},
 	}
-	hashSecretKey, err := stringEnvVariable("HASH_SECRET_KEY")
-	if err != nil {
-		return nil, err
+}
+
+// Load is used to build the app configurations.
+//
+// it registers the config flags on fs and parses args with it
+// so the caller can read the remaining arguments from fs.Args()
+//
+// the config file is taken from the -config flag or the CONFIG_FILE
+// env variable and it can be a .yaml, .yml or .toml file
+//
+// if the configurations are not valid the returned error
+// is a *ValidationError listing every problem found
+func Load(fs *flag.FlagSet, args []string) (*Config, error) {
+	// the .env file is optional
+	godotenv.Load()
+
+	cfg := Default()
+	settings := cfg.settings()
+
+	configFile := fs.String("config", os.Getenv("CONFIG_FILE"), "path to a yaml or toml config file")
+	flagValues := make(map[string]*settingFlag, len(settings))
+	for _, s := range settings {
+		flagValues[s.flag] = &settingFlag{isBool: s.isBool()}
+		fs.Var(flagValues[s.flag], s.flag, s.usage)
 	}
-	databaseURI, err := stringEnvVariable("DATABASE_URI")
-	if err != nil {
+	if err := fs.Parse(args); err != nil {
 		return nil, err
 	}
-	csrfKey, err := stringEnvVariable("CSRF_KEY")
-	if err != nil {
-		return nil, err
+
+	problems := []string{}
+
+	if *configFile != "" {
+		if err := loadFile(*configFile, cfg); err != nil {
+			problems = append(problems, err.Error())
+		}
 	}
-	emailAPIKey, err := stringEnvVariable("EMAIL_API_KEY")
-	if err != nil {
-		return nil, err
+
+	// override with env variables
+	for _, s := range settings {
+		val, found := os.LookupEnv(s.env)
+		if !found {
+			continue
+		}
+		if err := s.set(val); err != nil {
+			problems = append(problems, fmt.Sprintf("env variable %v: %v", s.env, err))
+		}
 	}
-	isProductionEnv, err := boolEnvVariable("IS_PRODUCTION_ENV")
-	if err != nil {
-		return nil, err
+
+	// override with the flags set explicitly
+	setFlags := map[string]bool{}
+	fs.Visit(func(f *flag.Flag) { setFlags[f.Name] = true })
+	for _, s := range settings {
+		if !setFlags[s.flag] {
+			continue
+		}
+		if err := s.set(flagValues[s.flag].val); err != nil {
+			problems = append(problems, fmt.Sprintf("flag -%v: %v", s.flag, err))
+		}
 	}
 
-	return &Configurations{
-		Port:            port,
-		HashSecretKey:   hashSecretKey,
-		DatabaseURI:     databaseURI,
-		CSRFKey:         csrfKey,
-		EmailAPIKey:     emailAPIKey,
-		IsProductionEnv: isProductionEnv,
-	}, nil
+	problems = append(problems, cfg.problems()...)
+	if len(problems) > 0 {
+		return nil, &ValidationError{Problems: problems}
+	}
+
+	return cfg, nil
 }
 
-func stringEnvVariable(name string) (string, error) {
-	val, found := os.LookupEnv(name)
-	if !found {
-		return "", fmt.Errorf("env variable %v not found", name)
-	}
-	if val == "" {
-		return "", fmt.Errorf("env variable %v can not be empty", name)
+// Validate checks the configurations and returns
+// a *ValidationError listing every problem found
+func (cfg *Config) Validate() error {
+	if problems := cfg.problems(); len(problems) > 0 {
+		return &ValidationError{Problems: problems}
 	}
-	return val, nil
+	return nil
 }
 
-func intEnvVariable(name string) (int, error) {
-	strVal, err := stringEnvVariable(name)
-	if err != nil {
-		return 0, err
+func (cfg *Config) problems() []string {
+	problems := []string{}
+	if cfg.Port < 1 || cfg.Port > 65535 {
+		problems = append(problems, fmt.Sprintf("port %v is out of range", cfg.Port))
+	}
+	if cfg.Database.URI == "" {
+		problems = append(problems, "database uri is required")
+	}
+	if cfg.Database.MaxOpenConns < 0 || cfg.Database.MaxIdleConns < 0 {
+		problems = append(problems, "database connections limits can not be negative")
+	}
+	if cfg.Storage.ImagesDir == "" {
+		problems = append(problems, "storage images dir is required")
+	}
+	if cfg.Storage.UploadsDir == "" {
+		problems = append(problems, "storage uploads dir is required")
+	}
+	if cfg.IsProductionEnv && cfg.Mail.APIKey == "" {
+		problems = append(problems, "mail api key is required in production")
+	}
+	if cfg.Mail.BaseURL == "" {
+		problems = append(problems, "mail base url is required")
+	}
+	if cfg.Security.HashSecretKey == "" {
+		problems = append(problems, "security hash secret key is required")
+	}
+	if cfg.Security.CSRFKey == "" {
+		problems = append(problems, "security csrf key is required")
+	}
+	if cfg.Limits.MaxFormMemory <= 0 {
+		problems = append(problems, "limits max form memory should be positive")
+	}
+	if cfg.Limits.MaxUploadBytes <= 0 {
+		problems = append(problems, "limits max upload bytes should be positive")
+	}
+	if cfg.Limits.MaxImportBytes <= 0 || cfg.Limits.MaxImportFiles <= 0 || cfg.Limits.MaxImportUnpackedBytes <= 0 {
+		problems = append(problems, "limits max import bytes, files and unpacked bytes should be positive")
+	}
+	if cfg.Passwords.MinLength < 8 {
+		problems = append(problems, "passwords min length should be at least 8")
+	}
+	if cfg.Passwords.MinEntropy < 0 {
+		problems = append(problems, "passwords min entropy can not be negative")
+	}
+	if cfg.Passwords.Hash != "argon2id" && cfg.Passwords.Hash != "bcrypt" {
+		problems = append(problems, fmt.Sprintf("passwords hash %q should be argon2id or bcrypt", cfg.Passwords.Hash))
+	}
+	if cfg.Passwords.BcryptCost < 4 || cfg.Passwords.BcryptCost > 31 {
+		problems = append(problems, "passwords bcrypt cost should be between 4 and 31")
+	}
+	if cfg.Passwords.Argon2Time < 1 {
+		problems = append(problems, "passwords argon2 time should be positive")
+	}
+	if cfg.Passwords.Argon2Threads < 1 || cfg.Passwords.Argon2Threads > 255 {
+		problems = append(problems, "passwords argon2 threads should be between 1 and 255")
 	}
+	if cfg.Passwords.Argon2Memory < 8*cfg.Passwords.Argon2Threads {
+		problems = append(problems, "passwords argon2 memory should be at least 8 KiB per thread")
+	}
+	if cfg.RateLimits.Store != "memory" && cfg.RateLimits.Store != "database" {
+		problems = append(problems, fmt.Sprintf("rate limits store %q should be memory or database", cfg.RateLimits.Store))
+	}
+	problems = append(problems, cfg.RateLimits.API.problems("api")...)
+	problems = append(problems, cfg.RateLimits.Uploads.problems("uploads")...)
 
-	// convert the value to int
-	intVal, err := strconv.Atoi(strVal)
-	if err != nil {
-		return 0, err
+	names := map[string]bool{}
+	for i, provider := range cfg.OIDC {
+		if !oidcNameRegex.MatchString(provider.Name) {
+			problems = append(problems, fmt.Sprintf("oidc provider %v name should be lowercase letters, digits or dashes", i+1))
+		} else if names[provider.Name] {
+			problems = append(problems, fmt.Sprintf("oidc provider name %v is used more than once", provider.Name))
+		}
+		names[provider.Name] = true
+
+		if provider.Issuer == "" {
+			problems = append(problems, fmt.Sprintf("oidc provider %v issuer is required", provider.Name))
+		}
+		if provider.ClientID == "" {
+			problems = append(problems, fmt.Sprintf("oidc provider %v client id is required", provider.Name))
+		}
+	}
+	return problems
+}
+
+func (rl RateLimit) problems(route string) []string {
+	problems := []string{}
+	if rl.Algorithm != "token_bucket" && rl.Algorithm != "sliding_window" {
+		problems = append(problems, fmt.Sprintf("rate limits %v algorithm %q should be token_bucket or sliding_window", route, rl.Algorithm))
+	}
+	if rl.Limit < 0 {
+		problems = append(problems, fmt.Sprintf("rate limits %v limit can not be negative", route))
+	}
+	if rl.Limit > 0 && rl.WindowSeconds <= 0 {
+		problems = append(problems, fmt.Sprintf("rate limits %v window seconds should be positive", route))
 	}
-	return intVal, nil
+	return problems
+}
+
+var oidcNameRegex = regexp.MustCompile(`^[a-z0-9-]+$`)
+
+// ValidationError is returned by Load and Validate
+// it contains all the problems of the configurations
+type ValidationError struct {
+	Problems []string
 }
 
-func boolEnvVariable(name string) (bool, error) {
-	strVal, err := stringEnvVariable(name)
+func (e *ValidationError) Error() string {
+	return "config: " + strings.Join(e.Problems, "; ")
+}
+
+// loadFile is responsible for loading the config file into cfg
+// the format is chosen by the file extension
+func loadFile(path string, cfg *Config) error {
+	content, err := os.ReadFile(path)
 	if err != nil {
-		return false, err
+		return err
 	}
 
-	// convert the value to int
-	boolVal, err := strconv.ParseBool(strVal)
+	switch ext := strings.ToLower(filepath.Ext(path)); ext {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(content, cfg)
+	case ".toml":
+		err = toml.Unmarshal(content, cfg)
+	default:
+		return fmt.Errorf("unsupported config file extension %q", ext)
+	}
 	if err != nil {
-		return false, err
+		return fmt.Errorf("could not parse %v: %w", path, err)
+	}
+	return nil
+}
+
+// settingFlag is a flag.Value that keeps the raw string
+// so the flags are applied after the file and the env
+// variables and only when they are set explicitly
+type settingFlag struct {
+	val    string
+	isBool bool
+}
+
+func (f *settingFlag) String() string {
+	if f == nil {
+		return ""
 	}
-	return boolVal, nil
+	return f.val
+}
+
+func (f *settingFlag) Set(val string) error {
+	f.val = val
+	return nil
+}
+
+// IsBoolFlag lets the bool flags be passed without a value
+func (f *settingFlag) IsBoolFlag() bool {
+	return f.isBool
 }
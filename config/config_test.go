@@ -0,0 +1,132 @@
+package config_test
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/abanoub-fathy/bebo-gallery/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writeFile(t *testing.T, name, content string) string {
+	path := filepath.Join(t.TempDir(), name)
+	require.NoError(t, os.WriteFile(path, []byte(content), 0644))
+	return path
+}
+
+func TestLoadLayers(t *testing.T) {
+	path := writeFile(t, "app.yaml", `
+port: 4000
+database:
+  uri: postgres://from-file
+security:
+  hash_secret_key: file-hash-key
+  csrf_key: file-csrf-key
+`)
+	t.Setenv("DATABASE_URI", "postgres://from-env")
+	t.Setenv("PORT", "5000")
+
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	cfg, err := config.Load(fs, []string{"-config", path, "-port", "6000", "serve"})
+	require.NoError(t, err)
+
+	assert.Equal(t, 6000, cfg.Port, "flags should override env variables")
+	assert.Equal(t, "postgres://from-env", cfg.Database.URI, "env variables should override the file")
+	assert.Equal(t, "file-hash-key", cfg.Security.HashSecretKey)
+	assert.Equal(t, "images", cfg.Storage.ImagesDir, "defaults should be kept")
+	assert.Equal(t, []string{"serve"}, fs.Args())
+}
+
+func TestLoadTOML(t *testing.T) {
+	path := writeFile(t, "app.toml", `
+production = true
+
+[database]
+uri = "postgres://from-toml"
+
+[mail]
+api_key = "key"
+
+[security]
+hash_secret_key = "hash"
+csrf_key = "csrf"
+`)
+
+	cfg, err := config.Load(flag.NewFlagSet("test", flag.ContinueOnError), []string{"-config", path})
+	require.NoError(t, err)
+	assert.True(t, cfg.IsProductionEnv)
+	assert.Equal(t, "postgres://from-toml", cfg.Database.URI)
+}
+
+func TestLoadReportsAllProblems(t *testing.T) {
+	t.Setenv("PORT", "not-a-number")
+
+	_, err := config.Load(flag.NewFlagSet("test", flag.ContinueOnError), []string{"-production"})
+	require.Error(t, err)
+
+	validationErr, ok := err.(*config.ValidationError)
+	require.True(t, ok, "the error should be a *config.ValidationError")
+	assert.Contains(t, validationErr.Problems, `env variable PORT: "not-a-number" is not a valid integer`)
+	assert.Contains(t, validationErr.Problems, "database uri is required")
+	assert.Contains(t, validationErr.Problems, "mail api key is required in production")
+	assert.Contains(t, validationErr.Problems, "security hash secret key is required")
+	assert.Contains(t, validationErr.Problems, "security csrf key is required")
+}
+
+func TestLoadOIDCProviders(t *testing.T) {
+	path := writeFile(t, "app.yaml", `
+database:
+  uri: postgres://from-file
+security:
+  hash_secret_key: hash
+  csrf_key: csrf
+oidc:
+  - name: corporate
+    display_name: Corporate Account
+    issuer: https://idp.example.com
+    client_id: bebo-gallery
+  - name: corporate
+    issuer: https://other.example.com
+`)
+
+	_, err := config.Load(flag.NewFlagSet("test", flag.ContinueOnError), []string{"-config", path})
+	require.Error(t, err)
+
+	validationErr, ok := err.(*config.ValidationError)
+	require.True(t, ok, "the error should be a *config.ValidationError")
+	assert.Equal(t, []string{
+		"oidc provider name corporate is used more than once",
+		"oidc provider corporate client id is required",
+	}, validationErr.Problems)
+}
+
+func TestLoadRateLimits(t *testing.T) {
+	path := writeFile(t, "app.yaml", `
+database:
+  uri: postgres://from-file
+security:
+  hash_secret_key: hash
+  csrf_key: csrf
+rate_limits:
+  api:
+    algorithm: fixed_window
+  uploads:
+    limit: 10
+    window_seconds: 0
+`)
+	t.Setenv("RATE_LIMITS_STORE", "redis")
+
+	_, err := config.Load(flag.NewFlagSet("test", flag.ContinueOnError), []string{"-config", path})
+	require.Error(t, err)
+
+	validationErr, ok := err.(*config.ValidationError)
+	require.True(t, ok, "the error should be a *config.ValidationError")
+	assert.Equal(t, []string{
+		`rate limits store "redis" should be memory or database`,
+		`rate limits api algorithm "fixed_window" should be token_bucket or sliding_window`,
+		"rate limits uploads window seconds should be positive",
+	}, validationErr.Problems)
+}
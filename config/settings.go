@@ -0,0 +1,84 @@
+package config
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// setting describes a single configuration value
+// and where it can be overridden from
+type setting struct {
+	env   string
+	flag  string
+	usage string
+	dst   interface{}
+}
+
+// settings returns the settings of cfg that can be
+// overridden by the env variables and the flags
+func (cfg *Config) settings() []setting {
+	return []setting{
+		{"PORT", "port", "port the server listens on", &cfg.Port},
+		{"IS_PRODUCTION_ENV", "production", "run in production mode", &cfg.IsProductionEnv},
+		{"DATABASE_URI", "database-uri", "database connection uri", &cfg.Database.URI},
+		{"DATABASE_MAX_OPEN_CONNS", "database-max-open-conns", "max open database connections", &cfg.Database.MaxOpenConns},
+		{"DATABASE_MAX_IDLE_CONNS", "database-max-idle-conns", "max idle database connections", &cfg.Database.MaxIdleConns},
+		{"STORAGE_IMAGES_DIR", "storage-images-dir", "directory the images are stored in", &cfg.Storage.ImagesDir},
+		{"STORAGE_UPLOADS_DIR", "storage-uploads-dir", "directory the partial resumable uploads are kept in", &cfg.Storage.UploadsDir},
+		{"EMAIL_API_KEY", "mail-api-key", "sendgrid api key", &cfg.Mail.APIKey},
+		{"MAIL_FROM_NAME", "mail-from-name", "name the emails are sent from", &cfg.Mail.FromName},
+		{"MAIL_FROM_ADDRESS", "mail-from-address", "address the emails are sent from", &cfg.Mail.FromAddress},
+		{"MAIL_BASE_URL", "mail-base-url", "public url of the app used inside emails", &cfg.Mail.BaseURL},
+		{"HASH_SECRET_KEY", "hash-secret-key", "secret key used to hash the tokens", &cfg.Security.HashSecretKey},
+		{"CSRF_KEY", "csrf-key", "secret key used for the csrf protection", &cfg.Security.CSRFKey},
+		{"LIMITS_MAX_FORM_MEMORY", "limits-max-form-memory", "max bytes of a multipart form kept in memory", &cfg.Limits.MaxFormMemory},
+		{"LIMITS_MAX_UPLOAD_BYTES", "limits-max-upload-bytes", "max bytes of a single upload request", &cfg.Limits.MaxUploadBytes},
+		{"LIMITS_MAX_IMPORT_BYTES", "limits-max-import-bytes", "max bytes of an uploaded zip archive", &cfg.Limits.MaxImportBytes},
+		{"LIMITS_MAX_IMPORT_FILES", "limits-max-import-files", "max files in an uploaded zip archive", &cfg.Limits.MaxImportFiles},
+		{"LIMITS_MAX_IMPORT_UNPACKED_BYTES", "limits-max-import-unpacked-bytes", "max bytes of the unpacked files of a zip archive", &cfg.Limits.MaxImportUnpackedBytes},
+		{"PASSWORDS_MIN_LENGTH", "passwords-min-length", "min length of the passwords", &cfg.Passwords.MinLength},
+		{"PASSWORDS_MIN_ENTROPY", "passwords-min-entropy", "min estimated strength of the passwords in bits", &cfg.Passwords.MinEntropy},
+		{"PASSWORDS_BREACHED_FILE", "passwords-breached-file", "sorted file of the SHA-1 hashes of the breached passwords", &cfg.Passwords.BreachedFile},
+		{"PASSWORDS_HASH", "passwords-hash", "algorithm of the new password hashes: argon2id or bcrypt", &cfg.Passwords.Hash},
+		{"PASSWORDS_BCRYPT_COST", "passwords-bcrypt-cost", "cost of the bcrypt password hashes", &cfg.Passwords.BcryptCost},
+		{"PASSWORDS_ARGON2_MEMORY", "passwords-argon2-memory", "memory in KiB of the argon2id password hashes", &cfg.Passwords.Argon2Memory},
+		{"PASSWORDS_ARGON2_TIME", "passwords-argon2-time", "iterations of the argon2id password hashes", &cfg.Passwords.Argon2Time},
+		{"PASSWORDS_ARGON2_THREADS", "passwords-argon2-threads", "threads of the argon2id password hashes", &cfg.Passwords.Argon2Threads},
+		{"PASSWORDS_PEPPER", "passwords-pepper", "secret key mixed into the passwords before hashing", &cfg.Passwords.Pepper},
+		{"RATE_LIMITS_STORE", "rate-limits-store", "where the rate limits are counted: memory or database", &cfg.RateLimits.Store},
+	}
+}
+
+func (s setting) isBool() bool {
+	_, ok := s.dst.(*bool)
+	return ok
+}
+
+// set converts val to the type of the setting and assigns it
+func (s setting) set(val string) error {
+	switch dst := s.dst.(type) {
+	case *string:
+		*dst = val
+	case *int:
+		intVal, err := strconv.Atoi(val)
+		if err != nil {
+			return fmt.Errorf("%q is not a valid integer", val)
+		}
+		*dst = intVal
+	case *int64:
+		intVal, err := strconv.ParseInt(val, 10, 64)
+		if err != nil {
+			return fmt.Errorf("%q is not a valid integer", val)
+		}
+		*dst = intVal
+	case *bool:
+		boolVal, err := strconv.ParseBool(val)
+		if err != nil {
+			return fmt.Errorf("%q is not a valid boolean", val)
+		}
+		*dst = boolVal
+	default:
+		return fmt.Errorf("unsupported setting type %T", dst)
+	}
+	return nil
+}
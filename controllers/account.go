@@ -0,0 +1,171 @@
+package controllers
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/abanoub-fathy/bebo-gallery/model"
+	"github.com/abanoub-fathy/bebo-gallery/pkg/context"
+	"github.com/abanoub-fathy/bebo-gallery/utils"
+	"github.com/abanoub-fathy/bebo-gallery/views"
+	"github.com/gorilla/mux"
+	uuid "github.com/satori/go.uuid"
+)
+
+const ViewAccountEndpoint = "view_account"
+
+type Account struct {
+	AccountView        *views.View
+	AccessTokenService model.AccessTokenService
+	IdentityService    model.IdentityService
+	router             *mux.Router
+
+	// LoginProviders are the OpenID Connect providers
+	// the user can connect to the account
+	LoginProviders []LoginProvider
+}
+
+// NewAccount return a pointer to Account type which can be used
+// as a receiver to call the account handler functions
+func NewAccount(accessTokenService model.AccessTokenService, identityService model.IdentityService, muxRouter *mux.Router) *Account {
+	return &Account{
+		AccountView:        views.NewView("base", "user/account"),
+		AccessTokenService: accessTokenService,
+		IdentityService:    identityService,
+		router:             muxRouter,
+	}
+}
+
+// accountData is the data of the account page
+type accountData struct {
+	// Tokens are the personal access tokens and Apps
+	// are the tokens issued to the OAuth apps
+	Tokens []*model.AccessToken
+	Apps   []*model.AccessToken
+
+	// NewToken is the token just created. it is shown
+	// only once because only its hash is stored
+	NewToken *model.AccessToken
+
+	Form accessTokenForm
+
+	// Identities are the connected provider accounts and
+	// Providers are the providers that are not connected
+	Identities []*model.Identity
+	Providers  []LoginProvider
+}
+
+type accessTokenForm struct {
+	Name string `schema:"name"`
+	// Scope is one of read, write or admin
+	Scope string `schema:"scope"`
+	// ExpiresInDays is the number of days the token is
+	// valid for. the token never expires if it is 0
+	ExpiresInDays int `schema:"expiresInDays"`
+}
+
+// [GET] /account
+func (a *Account) ShowAccountPage(w http.ResponseWriter, r *http.Request) {
+	a.render(w, r, &accountData{}, nil)
+}
+
+// [POST] /account/tokens
+func (a *Account) CreateAccessToken(w http.ResponseWriter, r *http.Request) {
+	data := &accountData{}
+
+	// Parse the form
+	if err := utils.ParseForm(r, &data.Form); err != nil {
+		a.render(w, r, data, err)
+		return
+	}
+
+	// get user from ctx
+	user := context.UserValue(r.Context())
+
+	token := &model.AccessToken{
+		UserID: user.ID,
+		Name:   data.Form.Name,
+		Scope:  data.Form.Scope,
+	}
+	if data.Form.ExpiresInDays > 0 {
+		expiresAt := time.Now().AddDate(0, 0, data.Form.ExpiresInDays)
+		token.ExpiresAt = &expiresAt
+	}
+
+	if err := a.AccessTokenService.Create(token); err != nil {
+		a.render(w, r, data, err)
+		return
+	}
+
+	// the token is rendered instead of redirecting
+	// so it is not kept anywhere after this response
+	data.NewToken = token
+	data.Form = accessTokenForm{}
+	a.render(w, r, data, nil)
+}
+
+// [POST] /account/tokens/{tokenID}/revoke
+func (a *Account) RevokeAccessToken(w http.ResponseWriter, r *http.Request) {
+	// get user from ctx
+	user := context.UserValue(r.Context())
+
+	tokenID := uuid.FromStringOrNil(mux.Vars(r)["tokenID"])
+	if err := a.AccessTokenService.Revoke(user.ID, tokenID); err != nil {
+		a.render(w, r, &accountData{}, err)
+		return
+	}
+
+	url, err := a.router.Get(ViewAccountEndpoint).URL()
+	if err != nil {
+		http.Redirect(w, r, "/", http.StatusInternalServerError)
+		return
+	}
+	views.RedirectWithAlert(w, r, url.String(), http.StatusFound, views.Alert{
+		Level:   views.AlertLevelSuccess,
+		Message: "the token is revoked",
+	})
+}
+
+// render renders the account page with the tokens of the user
+// and the alert of err if it is not nil
+func (a *Account) render(w http.ResponseWriter, r *http.Request, data *accountData, err error) {
+	params := views.Params{
+		Data: data,
+	}
+	if err != nil {
+		params.SetAlert(err)
+	}
+
+	// get user from ctx
+	user := context.UserValue(r.Context())
+
+	tokens, findErr := a.AccessTokenService.FindByUserID(user.ID)
+	if findErr != nil {
+		params.SetAlert(findErr)
+	}
+	for _, token := range tokens {
+		if token.IsOAuth() {
+			data.Apps = append(data.Apps, token)
+		} else {
+			data.Tokens = append(data.Tokens, token)
+		}
+	}
+
+	identities, findErr := a.IdentityService.FindByUserID(user.ID)
+	if findErr != nil {
+		params.SetAlert(findErr)
+	}
+	data.Identities = identities
+
+	connected := map[string]bool{}
+	for _, identity := range identities {
+		connected[identity.Provider] = true
+	}
+	for _, provider := range a.LoginProviders {
+		if !connected[provider.Name] {
+			data.Providers = append(data.Providers, provider)
+		}
+	}
+
+	a.AccountView.Render(w, r, params)
+}
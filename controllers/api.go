@@ -0,0 +1,910 @@
+package controllers
+
+import (
+	_ "embed"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/abanoub-fathy/bebo-gallery/config"
+	"github.com/abanoub-fathy/bebo-gallery/model"
+	"github.com/abanoub-fathy/bebo-gallery/pkg/context"
+	"github.com/abanoub-fathy/bebo-gallery/pkg/tus"
+	"github.com/abanoub-fathy/bebo-gallery/utils"
+	"github.com/abanoub-fathy/bebo-gallery/views"
+	"github.com/gorilla/csrf"
+	"github.com/gorilla/mux"
+	uuid "github.com/satori/go.uuid"
+)
+
+const (
+	// API_DEFAULT_PER_PAGE is the page size used
+	// when the per_page param is not set
+	API_DEFAULT_PER_PAGE = 20
+
+	// API_MAX_PER_PAGE is the max page size
+	API_MAX_PER_PAGE = 100
+)
+
+// openAPISpec is the OpenAPI document of the api
+//
+//go:embed openapi.yaml
+var openAPISpec []byte
+
+// API contains the handlers of the versioned json api
+type API struct {
+	GalleryService     model.GalleryService
+	ImageService       model.ImageService
+	TagService         model.TagService
+	SearchService      model.SearchService
+	AccessTokenService model.AccessTokenService
+	limits             config.Limits
+
+	// Uploads keeps the partial resumable uploads
+	Uploads *tus.FileStore
+}
+
+// NewAPI return a pointer to API type which can be used
+// as a receiver to call the api handler functions
+func NewAPI(galleryService model.GalleryService, imageService model.ImageService, tagService model.TagService, searchService model.SearchService, accessTokenService model.AccessTokenService, limits config.Limits) *API {
+	return &API{
+		GalleryService:     galleryService,
+		ImageService:       imageService,
+		TagService:         tagService,
+		SearchService:      searchService,
+		AccessTokenService: accessTokenService,
+		limits:             limits,
+	}
+}
+
+// APIError is the body of every api error response
+type APIError struct {
+	Error APIErrorDetails `json:"error"`
+}
+
+// APIErrorDetails describes the api error
+type APIErrorDetails struct {
+	// Code is a stable snake case code the clients can check
+	Code string `json:"code"`
+
+	// Message is a human readable message of the error
+	Message string `json:"message"`
+}
+
+type userJSON struct {
+	ID        string `json:"id"`
+	Handle    string `json:"handle"`
+	FirstName string `json:"first_name"`
+	LastName  string `json:"last_name"`
+	Email     string `json:"email"`
+}
+
+type galleryJSON struct {
+	ID           string      `json:"id"`
+	Title        string      `json:"title"`
+	Description  string      `json:"description"`
+	UserID       string      `json:"user_id"`
+	CoverImageID *string     `json:"cover_image_id"`
+	Tags         []string    `json:"tags"`
+	Public       bool        `json:"public"`
+	PublishedAt  *time.Time  `json:"published_at"`
+	CreatedAt    time.Time   `json:"created_at"`
+	UpdatedAt    time.Time   `json:"updated_at"`
+	Images       []imageJSON `json:"images,omitempty"`
+}
+
+type imageJSON struct {
+	ID       string   `json:"id"`
+	FileName string   `json:"file_name"`
+	URL      string   `json:"url"`
+	Position int      `json:"position"`
+	Title    string   `json:"title"`
+	Caption  string   `json:"caption"`
+	AltText  string   `json:"alt_text"`
+	Camera   string   `json:"camera"`
+	Tags     []string `json:"tags"`
+}
+
+type accessTokenJSON struct {
+	ID         string     `json:"id"`
+	Name       string     `json:"name"`
+	Scope      string     `json:"scope"`
+	CreatedAt  time.Time  `json:"created_at"`
+	ExpiresAt  *time.Time `json:"expires_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+}
+
+type pagination struct {
+	Page    int `json:"page"`
+	PerPage int `json:"per_page"`
+	Total   int `json:"total"`
+}
+
+type listResponse struct {
+	Data       interface{} `json:"data"`
+	Pagination pagination  `json:"pagination"`
+}
+
+type galleryRequest struct {
+	Title string `json:"title"`
+
+	// Description is not changed if it is not sent
+	Description *string `json:"description"`
+
+	// CoverImageID is not changed if it is not sent
+	// and the cover is unset if it is empty
+	CoverImageID *string `json:"cover_image_id"`
+
+	// Tags replace the tags of the gallery if they are sent
+	Tags *[]string `json:"tags"`
+
+	// Public publishes or unlists the gallery if it is sent
+	Public *bool `json:"public"`
+}
+
+// tagImagesRequest adds and removes the tags of the images
+type tagImagesRequest struct {
+	ImageIDs []string `json:"image_ids"`
+	Add      []string `json:"add"`
+	Remove   []string `json:"remove"`
+}
+
+// tagJSON lists the galleries and the images with the tag
+type tagJSON struct {
+	Tag       string        `json:"tag"`
+	Galleries []galleryJSON `json:"galleries"`
+	Images    []imageJSON   `json:"images"`
+}
+
+// searchJSON lists the galleries and the images found by a search
+type searchJSON struct {
+	Galleries []galleryJSON `json:"galleries"`
+	Images    []imageJSON   `json:"images"`
+}
+
+// imageRequest changes the details of the image of the ID
+// the details that are not sent are not changed
+type imageRequest struct {
+	ID      string  `json:"id"`
+	Title   *string `json:"title"`
+	Caption *string `json:"caption"`
+	AltText *string `json:"alt_text"`
+}
+
+type reorderRequest struct {
+	ImageIDs []string `json:"image_ids"`
+}
+
+func newUserJSON(user *model.User) userJSON {
+	return userJSON{
+		ID:        user.ID.String(),
+		Handle:    user.Handle,
+		FirstName: user.FirstName,
+		LastName:  user.LastName,
+		Email:     user.Email,
+	}
+}
+
+func newGalleryJSON(gallery *model.Gallery) galleryJSON {
+	galleryData := galleryJSON{
+		ID:          gallery.ID.String(),
+		Title:       gallery.Title,
+		Description: gallery.Description,
+		UserID:      gallery.UserID.String(),
+		Public:      gallery.Public(),
+		PublishedAt: gallery.PublishedAt,
+		CreatedAt:   gallery.CreatedAt,
+		UpdatedAt:   gallery.UpdatedAt,
+	}
+	galleryData.Tags = tagsJSON(gallery.Tags)
+	if gallery.CoverImageID != nil {
+		coverImageID := gallery.CoverImageID.String()
+		galleryData.CoverImageID = &coverImageID
+	}
+	for _, image := range gallery.Images {
+		galleryData.Images = append(galleryData.Images, newImageJSON(image))
+	}
+	return galleryData
+}
+
+func newImageJSON(image model.Image) imageJSON {
+	return imageJSON{
+		ID:       image.ID.String(),
+		FileName: image.FileName,
+		URL:      image.Path(),
+		Position: image.Position,
+		Title:    image.Title,
+		Caption:  image.Caption,
+		AltText:  image.AltText,
+		Camera:   image.Camera,
+		Tags:     tagsJSON(image.Tags),
+	}
+}
+
+// tagsJSON returns the tags as an empty list instead of null
+func tagsJSON(tags []string) []string {
+	if tags == nil {
+		return []string{}
+	}
+	return tags
+}
+
+func newAccessTokenJSON(token *model.AccessToken) accessTokenJSON {
+	return accessTokenJSON{
+		ID:         token.ID.String(),
+		Name:       token.Name,
+		Scope:      token.Scope,
+		CreatedAt:  token.CreatedAt,
+		ExpiresAt:  token.ExpiresAt,
+		LastUsedAt: token.LastUsedAt,
+	}
+}
+
+// [GET] /api/v1/openapi.yaml
+func (api *API) OpenAPISpec(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/yaml")
+	w.Write(openAPISpec)
+}
+
+// [GET] /api/v1/me
+//
+// the response has the X-CSRF-Token header that should be sent
+// back with the unsafe requests authenticated by the cookie
+func (api *API) Me(w http.ResponseWriter, r *http.Request) {
+	user := context.UserValue(r.Context())
+	w.Header().Set("X-CSRF-Token", csrf.Token(r))
+	writeJSON(w, http.StatusOK, newUserJSON(user))
+}
+
+// [GET] /api/v1/galleries
+func (api *API) ListGalleries(w http.ResponseWriter, r *http.Request) {
+	user := context.UserValue(r.Context())
+
+	page, perPage, err := pageParams(r)
+	if err != nil {
+		WriteJSONError(w, http.StatusBadRequest, "invalid_pagination", err.Error())
+		return
+	}
+
+	galleries, err := api.GalleryService.FindByUserID(user.ID)
+	if err != nil {
+		writeAPIError(w, err)
+		return
+	}
+
+	pageGalleries := []*model.Gallery{}
+	for i := (page - 1) * perPage; i < len(galleries) && i < page*perPage; i++ {
+		pageGalleries = append(pageGalleries, galleries[i])
+	}
+	if err := api.TagService.LoadGalleryTags(pageGalleries...); err != nil {
+		writeAPIError(w, err)
+		return
+	}
+
+	data := []galleryJSON{}
+	for _, gallery := range pageGalleries {
+		data = append(data, newGalleryJSON(gallery))
+	}
+
+	writeJSON(w, http.StatusOK, listResponse{
+		Data: data,
+		Pagination: pagination{
+			Page:    page,
+			PerPage: perPage,
+			Total:   len(galleries),
+		},
+	})
+}
+
+// [POST] /api/v1/galleries
+func (api *API) CreateGallery(w http.ResponseWriter, r *http.Request) {
+	user := context.UserValue(r.Context())
+
+	var body galleryRequest
+	if !readJSON(w, r, &body) {
+		return
+	}
+
+	tags, ok := requestTags(w, body.Tags)
+	if !ok {
+		return
+	}
+
+	gallery := &model.Gallery{
+		Title:  body.Title,
+		UserID: user.ID,
+		Tags:   tags,
+	}
+	if body.Description != nil {
+		gallery.Description = *body.Description
+	}
+	if body.Public != nil {
+		gallery.SetPublic(*body.Public)
+	}
+	if err := api.GalleryService.CreateGallery(gallery); err != nil {
+		writeAPIError(w, err)
+		return
+	}
+	if err := api.TagService.SetGalleryTags(gallery.ID, tags); err != nil {
+		writeAPIError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, newGalleryJSON(gallery))
+}
+
+// [GET] /api/v1/galleries/{galleryID}
+func (api *API) GetGallery(w http.ResponseWriter, r *http.Request) {
+	gallery, ok := api.findGallery(w, r, false)
+	if !ok {
+		return
+	}
+
+	images, err := api.ImageService.GetImagesByGalleryID(gallery.ID)
+	if err != nil {
+		writeAPIError(w, err)
+		return
+	}
+	gallery.Images = images
+	if err := api.loadTags(gallery); err != nil {
+		writeAPIError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, newGalleryJSON(gallery))
+}
+
+// [PATCH] /api/v1/galleries/{galleryID}
+func (api *API) UpdateGallery(w http.ResponseWriter, r *http.Request) {
+	gallery, ok := api.findGallery(w, r, true)
+	if !ok {
+		return
+	}
+
+	var body galleryRequest
+	if !readJSON(w, r, &body) {
+		return
+	}
+
+	tags, ok := requestTags(w, body.Tags)
+	if !ok {
+		return
+	}
+
+	gallery.Title = body.Title
+	if body.Description != nil {
+		gallery.Description = *body.Description
+	}
+	if body.Public != nil {
+		gallery.SetPublic(*body.Public)
+	}
+	switch {
+	case body.CoverImageID == nil:
+	case *body.CoverImageID == "":
+		gallery.CoverImageID = nil
+	default:
+		image, err := api.ImageService.FindImageByID(gallery.ID, uuid.FromStringOrNil(*body.CoverImageID))
+		if err != nil {
+			writeAPIError(w, err)
+			return
+		}
+		gallery.CoverImageID = &image.ID
+	}
+	if err := api.GalleryService.Update(gallery); err != nil {
+		writeAPIError(w, err)
+		return
+	}
+	if body.Tags != nil {
+		if err := api.TagService.SetGalleryTags(gallery.ID, tags); err != nil {
+			writeAPIError(w, err)
+			return
+		}
+	}
+	if err := api.TagService.LoadGalleryTags(gallery); err != nil {
+		writeAPIError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, newGalleryJSON(gallery))
+}
+
+// [DELETE] /api/v1/galleries/{galleryID}
+func (api *API) DeleteGallery(w http.ResponseWriter, r *http.Request) {
+	gallery, ok := api.findGallery(w, r, true)
+	if !ok {
+		return
+	}
+
+	if err := api.GalleryService.Delete(gallery); err != nil {
+		writeAPIError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// [GET] /api/v1/galleries/{galleryID}/images
+func (api *API) ListImages(w http.ResponseWriter, r *http.Request) {
+	gallery, ok := api.findGallery(w, r, false)
+	if !ok {
+		return
+	}
+
+	page, perPage, err := pageParams(r)
+	if err != nil {
+		WriteJSONError(w, http.StatusBadRequest, "invalid_pagination", err.Error())
+		return
+	}
+
+	images, err := api.ImageService.GetImagesByGalleryID(gallery.ID)
+	if err != nil {
+		writeAPIError(w, err)
+		return
+	}
+	if err := api.TagService.LoadImageTags(images); err != nil {
+		writeAPIError(w, err)
+		return
+	}
+
+	data := []imageJSON{}
+	for i := (page - 1) * perPage; i < len(images) && i < page*perPage; i++ {
+		data = append(data, newImageJSON(images[i]))
+	}
+
+	writeJSON(w, http.StatusOK, listResponse{
+		Data: data,
+		Pagination: pagination{
+			Page:    page,
+			PerPage: perPage,
+			Total:   len(images),
+		},
+	})
+}
+
+// [POST] /api/v1/galleries/{galleryID}/images
+//
+// the images are sent in the images field of a multipart form
+func (api *API) UploadImages(w http.ResponseWriter, r *http.Request) {
+	gallery, ok := api.findGallery(w, r, true)
+	if !ok {
+		return
+	}
+
+	images, err := createImages(w, r, api.ImageService, api.limits, gallery.ID)
+	if err != nil {
+		WriteJSONError(w, http.StatusBadRequest, "invalid_upload", err.Error())
+		return
+	}
+
+	data := []imageJSON{}
+	for _, image := range images {
+		data = append(data, newImageJSON(image))
+	}
+	writeJSON(w, http.StatusCreated, data)
+}
+
+// [PATCH] /api/v1/galleries/{galleryID}/images
+//
+// the body is a list of the changes of the images. all the
+// images are updated or none of them
+func (api *API) UpdateImages(w http.ResponseWriter, r *http.Request) {
+	gallery, ok := api.findGallery(w, r, true)
+	if !ok {
+		return
+	}
+
+	var body []imageRequest
+	if !readJSON(w, r, &body) {
+		return
+	}
+
+	images, err := api.ImageService.GetImagesByGalleryID(gallery.ID)
+	if err != nil {
+		writeAPIError(w, err)
+		return
+	}
+	byID := map[string]*model.Image{}
+	for i := range images {
+		byID[images[i].ID.String()] = &images[i]
+	}
+
+	updates := []model.Image{}
+	for _, change := range body {
+		image, found := byID[uuid.FromStringOrNil(change.ID).String()]
+		if !found {
+			writeAPIError(w, model.ErrNotFound)
+			return
+		}
+		if change.Title != nil {
+			image.Title = *change.Title
+		}
+		if change.Caption != nil {
+			image.Caption = *change.Caption
+		}
+		if change.AltText != nil {
+			image.AltText = *change.AltText
+		}
+		updates = append(updates, *image)
+	}
+	if err := api.ImageService.UpdateImages(gallery.ID, updates); err != nil {
+		writeAPIError(w, err)
+		return
+	}
+	if err := api.TagService.LoadImageTags(updates); err != nil {
+		writeAPIError(w, err)
+		return
+	}
+
+	data := []imageJSON{}
+	for _, image := range updates {
+		data = append(data, newImageJSON(image))
+	}
+	writeJSON(w, http.StatusOK, data)
+}
+
+// [POST] /api/v1/galleries/{galleryID}/images/tags
+//
+// the tags of add are added to all the images and then
+// the tags of remove are removed from them
+func (api *API) TagImages(w http.ResponseWriter, r *http.Request) {
+	gallery, ok := api.findGallery(w, r, true)
+	if !ok {
+		return
+	}
+
+	var body tagImagesRequest
+	if !readJSON(w, r, &body) {
+		return
+	}
+
+	imageIDs := make([]uuid.UUID, len(body.ImageIDs))
+	for i, id := range body.ImageIDs {
+		imageIDs[i] = uuid.FromStringOrNil(id)
+	}
+	err := api.TagService.AddImageTags(gallery.ID, imageIDs, body.Add)
+	if err == nil {
+		err = api.TagService.RemoveImageTags(gallery.ID, imageIDs, body.Remove)
+	}
+	if err != nil {
+		writeAPIError(w, err)
+		return
+	}
+
+	images := []model.Image{}
+	for _, imageID := range imageIDs {
+		image, err := api.ImageService.FindImageByID(gallery.ID, imageID)
+		if err != nil {
+			writeAPIError(w, err)
+			return
+		}
+		images = append(images, *image)
+	}
+	if err := api.TagService.LoadImageTags(images); err != nil {
+		writeAPIError(w, err)
+		return
+	}
+
+	data := []imageJSON{}
+	for _, image := range images {
+		data = append(data, newImageJSON(image))
+	}
+	writeJSON(w, http.StatusOK, data)
+}
+
+// [GET] /api/v1/tags?q=prefix
+//
+// returns the tags of the user starting with q
+// to autocomplete the tags
+func (api *API) SuggestTags(w http.ResponseWriter, r *http.Request) {
+	user := context.UserValue(r.Context())
+
+	tags, err := api.TagService.SuggestTags(user.ID, r.URL.Query().Get("q"), 10)
+	if err != nil {
+		writeAPIError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string][]string{"data": tags})
+}
+
+// [GET] /api/v1/tags/{tag}
+func (api *API) GetTag(w http.ResponseWriter, r *http.Request) {
+	tag, err := model.NormalizeTag(mux.Vars(r)["tag"])
+	if err != nil {
+		writeAPIError(w, model.ErrNotFound)
+		return
+	}
+
+	viewerID := viewerID(context.UserValue(r.Context()))
+	galleries, err := api.TagService.FindGalleriesByTag(tag, viewerID)
+	if err == nil {
+		err = api.TagService.LoadGalleryTags(galleries...)
+	}
+	if err != nil {
+		writeAPIError(w, err)
+		return
+	}
+	images, err := api.TagService.FindImagesByTag(tag, viewerID)
+	if err == nil {
+		err = api.TagService.LoadImageTags(images)
+	}
+	if err != nil {
+		writeAPIError(w, err)
+		return
+	}
+
+	data := tagJSON{Tag: tag, Galleries: []galleryJSON{}, Images: []imageJSON{}}
+	for _, gallery := range galleries {
+		data.Galleries = append(data.Galleries, newGalleryJSON(gallery))
+	}
+	for _, image := range images {
+		data.Images = append(data.Images, newImageJSON(image))
+	}
+	writeJSON(w, http.StatusOK, data)
+}
+
+// [GET] /api/v1/search
+//
+// the params are q, owner which is "me" or a user id, from
+// and to which are dates like 2006-01-02 and limit
+func (api *API) Search(w http.ResponseWriter, r *http.Request) {
+	var form searchForm
+	if err := utils.ParseURLParams(r, &form); err != nil {
+		WriteJSONError(w, http.StatusBadRequest, "invalid_search", err.Error())
+		return
+	}
+	query, err := form.searchQuery(context.UserValue(r.Context()))
+	if err != nil {
+		WriteJSONError(w, http.StatusBadRequest, "invalid_search", err.Error())
+		return
+	}
+
+	galleries, err := api.SearchService.SearchGalleries(query)
+	if err == nil {
+		err = api.TagService.LoadGalleryTags(galleries...)
+	}
+	if err != nil {
+		writeAPIError(w, err)
+		return
+	}
+	images, err := api.SearchService.SearchImages(query)
+	if err == nil {
+		err = api.TagService.LoadImageTags(images)
+	}
+	if err != nil {
+		writeAPIError(w, err)
+		return
+	}
+
+	data := searchJSON{Galleries: []galleryJSON{}, Images: []imageJSON{}}
+	for _, gallery := range galleries {
+		data.Galleries = append(data.Galleries, newGalleryJSON(gallery))
+	}
+	for _, image := range images {
+		data.Images = append(data.Images, newImageJSON(image))
+	}
+	writeJSON(w, http.StatusOK, data)
+}
+
+// [PUT] /api/v1/galleries/{galleryID}/images/order
+//
+// the body lists the ids of all the images of the gallery in
+// their new order. the images are reordered all together or
+// not at all
+func (api *API) ReorderImages(w http.ResponseWriter, r *http.Request) {
+	gallery, ok := api.findGallery(w, r, true)
+	if !ok {
+		return
+	}
+
+	var body reorderRequest
+	if !readJSON(w, r, &body) {
+		return
+	}
+
+	imageIDs := make([]uuid.UUID, len(body.ImageIDs))
+	for i, id := range body.ImageIDs {
+		imageIDs[i] = uuid.FromStringOrNil(id)
+	}
+	if err := api.ImageService.ReorderImages(gallery.ID, imageIDs); err != nil {
+		writeAPIError(w, err)
+		return
+	}
+
+	images, err := api.ImageService.GetImagesByGalleryID(gallery.ID)
+	if err == nil {
+		err = api.TagService.LoadImageTags(images)
+	}
+	if err != nil {
+		writeAPIError(w, err)
+		return
+	}
+	data := []imageJSON{}
+	for _, image := range images {
+		data = append(data, newImageJSON(image))
+	}
+	writeJSON(w, http.StatusOK, data)
+}
+
+// [DELETE] /api/v1/galleries/{galleryID}/images/{fileName}
+func (api *API) DeleteImage(w http.ResponseWriter, r *http.Request) {
+	gallery, ok := api.findGallery(w, r, true)
+	if !ok {
+		return
+	}
+
+	image := model.Image{
+		GalleryID: gallery.ID,
+		FileName:  mux.Vars(r)["fileName"],
+	}
+	if err := api.ImageService.DeleteImage(&image); err != nil {
+		writeAPIError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// [GET] /api/v1/tokens
+//
+// the tokens are created only from the account page
+// so the response never contains the token itself
+func (api *API) ListAccessTokens(w http.ResponseWriter, r *http.Request) {
+	user := context.UserValue(r.Context())
+
+	tokens, err := api.AccessTokenService.FindByUserID(user.ID)
+	if err != nil {
+		writeAPIError(w, err)
+		return
+	}
+
+	data := []accessTokenJSON{}
+	for _, token := range tokens {
+		data = append(data, newAccessTokenJSON(token))
+	}
+	writeJSON(w, http.StatusOK, data)
+}
+
+// [DELETE] /api/v1/tokens/{tokenID}
+func (api *API) RevokeAccessToken(w http.ResponseWriter, r *http.Request) {
+	user := context.UserValue(r.Context())
+
+	tokenID := uuid.FromStringOrNil(mux.Vars(r)["tokenID"])
+	if err := api.AccessTokenService.Revoke(user.ID, tokenID); err != nil {
+		writeAPIError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// loadTags sets the tags of the gallery and its images
+func (api *API) loadTags(gallery *model.Gallery) error {
+	if err := api.TagService.LoadGalleryTags(gallery); err != nil {
+		return err
+	}
+	return api.TagService.LoadImageTags(gallery.Images)
+}
+
+// requestTags normalizes the tags of a gallery request. it writes
+// the error and returns false if they are not valid
+func requestTags(w http.ResponseWriter, tags *[]string) ([]string, bool) {
+	if tags == nil {
+		return nil, true
+	}
+	normalized, err := model.NormalizeTags(*tags)
+	if err == nil && len(normalized) > model.MaxTags {
+		err = model.ErrTooManyTags
+	}
+	if err != nil {
+		writeAPIError(w, err)
+		return nil, false
+	}
+	return normalized, true
+}
+
+// findGallery fetches the gallery of the galleryID url variable
+// and writes the error response if it is not found or if
+// mustOwn is true and the user does not own it
+func (api *API) findGallery(w http.ResponseWriter, r *http.Request, mustOwn bool) (*model.Gallery, bool) {
+	gallery, err := api.GalleryService.FindByID(mux.Vars(r)["galleryID"])
+	if err != nil {
+		writeAPIError(w, err)
+		return nil, false
+	}
+
+	// the gallery of other users is reported as not found
+	// if it should be owned or if it is unlisted
+	user := context.UserValue(r.Context())
+	if mustOwn && !uuid.Equal(user.ID, gallery.UserID) || !gallery.ListedFor(user.ID) {
+		writeAPIError(w, model.ErrNotFound)
+		return nil, false
+	}
+
+	return gallery, true
+}
+
+// pageParams reads the page and per_page query params
+func pageParams(r *http.Request) (int, int, error) {
+	page, perPage := 1, API_DEFAULT_PER_PAGE
+	query := r.URL.Query()
+
+	if val := query.Get("page"); val != "" {
+		n, err := strconv.Atoi(val)
+		if err != nil || n < 1 {
+			return 0, 0, errInvalidParam("page")
+		}
+		page = n
+	}
+	if val := query.Get("per_page"); val != "" {
+		n, err := strconv.Atoi(val)
+		if err != nil || n < 1 || n > API_MAX_PER_PAGE {
+			return 0, 0, errInvalidParam("per_page")
+		}
+		perPage = n
+	}
+	return page, perPage, nil
+}
+
+type errInvalidParam string
+
+func (e errInvalidParam) Error() string {
+	return string(e) + " param is not valid"
+}
+
+// readJSON decodes the request body into dst and writes
+// the error response if it is not valid json
+func readJSON(w http.ResponseWriter, r *http.Request, dst interface{}) bool {
+	decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<20))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(dst); err != nil {
+		WriteJSONError(w, http.StatusBadRequest, "invalid_json", "request body is not valid json: "+err.Error())
+		return false
+	}
+	return true
+}
+
+func writeJSON(w http.ResponseWriter, status int, data interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(data); err != nil {
+		log.Println("error while writing json response", err)
+	}
+}
+
+// WriteJSONError writes a json api error response
+// with the code and the message of the error
+func WriteJSONError(w http.ResponseWriter, status int, code, message string) {
+	writeJSON(w, status, APIError{
+		Error: APIErrorDetails{
+			Code:    code,
+			Message: message,
+		},
+	})
+}
+
+// writeAPIError writes the json error response of err
+//
+// the public errors are shown to the client with their code
+// and the other errors are logged and reported as internal
+func writeAPIError(w http.ResponseWriter, err error) {
+	pErr, ok := err.(interface {
+		views.PublicError
+		Code() string
+	})
+	if !ok {
+		log.Println(err)
+		WriteJSONError(w, http.StatusInternalServerError, "internal_error", views.ErrMsgGeneric)
+		return
+	}
+
+	status := http.StatusUnprocessableEntity
+	switch err {
+	case model.ErrNotFound, model.ErrInvalidID:
+		status = http.StatusNotFound
+	case model.ErrInvalidToken, model.ErrAccessTokenExpired:
+		status = http.StatusUnauthorized
+	}
+	WriteJSONError(w, status, pErr.Code(), pErr.PublicErrMsg())
+}
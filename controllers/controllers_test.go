@@ -0,0 +1,91 @@
+package controllers_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/abanoub-fathy/bebo-gallery/config"
+	"github.com/abanoub-fathy/bebo-gallery/model"
+	"github.com/abanoub-fathy/bebo-gallery/pkg/context"
+	"github.com/abanoub-fathy/bebo-gallery/pkg/email"
+	"github.com/sendgrid/rest"
+	"github.com/sendgrid/sendgrid-go/helpers/mail"
+)
+
+func TestMain(m *testing.M) {
+	// the views are parsed relative to the root of the repo
+	if err := os.Chdir(".."); err != nil {
+		panic(err)
+	}
+	os.Exit(m.Run())
+}
+
+// mailRecorder is an email.Client that keeps the sent messages
+type mailRecorder struct {
+	mu       sync.Mutex
+	messages []*mail.SGMailV3
+}
+
+func (m *mailRecorder) Send(message *mail.SGMailV3) (*rest.Response, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.messages = append(m.messages, message)
+	return &rest.Response{StatusCode: http.StatusAccepted}, nil
+}
+
+func (m *mailRecorder) sentTo(address string) []*mail.SGMailV3 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	sent := []*mail.SGMailV3{}
+	for _, message := range m.messages {
+		if message.Personalizations[0].To[0].Address == address {
+			sent = append(sent, message)
+		}
+	}
+	return sent
+}
+
+func newMailer() (*email.Mailer, *mailRecorder) {
+	recorder := &mailRecorder{}
+	mailer := email.NewClient(config.Default().Mail)
+	mailer.Client = recorder
+	return mailer, recorder
+}
+
+func newMemoryService() *model.Service {
+	return model.NewMemoryService("test-hash-secret-key")
+}
+
+func createUser(t *testing.T, service *model.Service, emailAddress string) *model.User {
+	user := &model.User{
+		FirstName: "Abanoub",
+		LastName:  "Fathy",
+		Email:     emailAddress,
+		Password:  "12212154554554asdsa",
+	}
+	if err := service.UserService.CreateUser(user); err != nil {
+		t.Fatal(err)
+	}
+	return user
+}
+
+// postForm creates a form POST request
+// if user is not nil it is set in the request context
+func postForm(target string, values url.Values, user *model.User) *http.Request {
+	r := httptest.NewRequest(http.MethodPost, target, strings.NewReader(values.Encode()))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	return withUser(r, user)
+}
+
+func withUser(r *http.Request, user *model.User) *http.Request {
+	if user == nil {
+		return r
+	}
+	return r.WithContext(context.WithUser(r.Context(), user))
+}
@@ -0,0 +1,221 @@
+package controllers
+
+import (
+	"archive/zip"
+	"context"
+	"encoding/csv"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"strings"
+	"unicode"
+
+	"github.com/abanoub-fathy/bebo-gallery/model"
+	userctx "github.com/abanoub-fathy/bebo-gallery/pkg/context"
+	"github.com/abanoub-fathy/bebo-gallery/views"
+	"github.com/gorilla/mux"
+	uuid "github.com/satori/go.uuid"
+)
+
+// manifestName is the name of the captions manifest in the zip
+const manifestName = "captions.csv"
+
+// canDownload tells if the user can download the images of the
+// gallery. the owner can always download them and the others
+// when the gallery is public or they have a share link of the
+// gallery that allows the downloads. the link is nil if the
+// gallery is not opened by a share link
+func canDownload(user *model.User, gallery *model.Gallery, link *model.ShareLink) bool {
+	if user != nil && uuid.Equal(user.ID, gallery.UserID) {
+		return true
+	}
+	return gallery.Public() || (link != nil && link.AllowDownload)
+}
+
+// [GET] /galleries/{galleryID}/download
+//
+// the zip of the images is written straight to the response
+// so it starts at once and it is never stored. the images
+// param selects the images and all the images are downloaded
+// if it is not sent. the share param is the token of the
+// share link the gallery is opened with
+func (g *Gallery) DownloadImages(w http.ResponseWriter, r *http.Request) {
+	gallery, err := g.GalleryService.FindByID(mux.Vars(r)["galleryID"])
+	if err != nil || !canDownload(userctx.UserValue(r.Context()), gallery, g.shareLink(r, gallery)) {
+		http.Redirect(w, r, "/notFound", http.StatusPermanentRedirect)
+		return
+	}
+
+	images, err := g.downloadSelection(gallery, r.URL.Query()["images"])
+	if err != nil {
+		downloadFailed(w, r, gallery, err.Error())
+		return
+	}
+	if len(images) == 0 {
+		downloadFailed(w, r, gallery, "There are no images to download")
+		return
+	}
+	if err := g.TagService.LoadImageTags(images); err != nil {
+		log.Println("could not load the image tags", err)
+	}
+
+	// the size is unknown before the zip is written so
+	// the response has no content length
+	name := downloadName(gallery.Title)
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": name + ".zip"}))
+	w.WriteHeader(http.StatusOK)
+
+	if err := writeZip(r.Context(), w, g.ImageService, name, images); err != nil {
+		// the status is sent so the client gets a cut zip
+		log.Println("the zip of the gallery is not complete", gallery.ID, err)
+	}
+}
+
+// downloadFailed redirects back to the gallery with the message
+func downloadFailed(w http.ResponseWriter, r *http.Request, gallery *model.Gallery, message string) {
+	views.RedirectWithAlert(w, r, "/galleries/"+gallery.ID.String(), http.StatusFound, views.Alert{
+		Level:   views.AlertLevelError,
+		Message: message,
+	})
+}
+
+// downloadSelection returns the images of the gallery with the
+// ids in their order in the gallery. all the images are
+// returned if the ids are empty
+func (g *Gallery) downloadSelection(gallery *model.Gallery, ids []string) ([]model.Image, error) {
+	images, err := g.ImageService.GetImagesByGalleryID(gallery.ID)
+	if err != nil || len(ids) == 0 {
+		return images, err
+	}
+
+	selected := map[uuid.UUID]bool{}
+	for _, id := range ids {
+		imageID, err := uuid.FromString(id)
+		if err != nil {
+			return nil, errInvalidParam("images")
+		}
+		selected[imageID] = true
+	}
+
+	found := []model.Image{}
+	for _, image := range images {
+		if selected[image.ID] {
+			found = append(found, image)
+		}
+	}
+	if len(found) != len(selected) {
+		return nil, errInvalidParam("images")
+	}
+	return found, nil
+}
+
+// writeZip writes the images under the dir and the captions
+// manifest to the writer. the images are stored without
+// compression since they are compressed already. it stops
+// when the context is done
+func writeZip(ctx context.Context, w io.Writer, imageService model.ImageService, dir string, images []model.Image) error {
+	archive := zip.NewWriter(w)
+
+	written := []model.Image{}
+	for i := range images {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		err := writeZipImage(ctx, archive, imageService, dir, &images[i])
+		if err == model.ErrNotFound {
+			// the files deleted while downloading are skipped
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		written = append(written, images[i])
+	}
+
+	manifest, err := archive.Create(manifestName)
+	if err != nil {
+		return err
+	}
+	if err := writeManifest(manifest, dir, written); err != nil {
+		return err
+	}
+	return archive.Close()
+}
+
+// writeZipImage copies the image to the zip
+func writeZipImage(ctx context.Context, archive *zip.Writer, imageService model.ImageService, dir string, image *model.Image) error {
+	file, err := imageService.Open(image)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	header := &zip.FileHeader{
+		Name:     dir + "/" + image.FileName,
+		Method:   zip.Store,
+		Modified: image.UpdatedAt,
+	}
+	entry, err := archive.CreateHeader(header)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(entry, contextReader{ctx: ctx, r: file})
+	return err
+}
+
+// writeManifest writes the details of the images as csv
+func writeManifest(w io.Writer, dir string, images []model.Image) error {
+	manifest := csv.NewWriter(w)
+	manifest.Write([]string{"file", "title", "caption", "alt_text", "tags"})
+	for _, image := range images {
+		manifest.Write([]string{
+			dir + "/" + image.FileName,
+			image.Title,
+			image.Caption,
+			image.AltText,
+			strings.Join(image.Tags, " "),
+		})
+	}
+	manifest.Flush()
+	return manifest.Error()
+}
+
+// contextReader stops reading when the context is done
+// so the big images are not copied to a closed request
+type contextReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (cr contextReader) Read(p []byte) (int, error) {
+	if err := cr.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return cr.r.Read(p)
+}
+
+// downloadName returns the name of the zip made from the title
+// of the gallery. it has only the letters, the digits and the
+// dashes so it is a valid file name on every system
+func downloadName(title string) string {
+	var b strings.Builder
+	dash := false
+	for _, r := range strings.ToLower(title) {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			if dash && b.Len() > 0 {
+				b.WriteRune('-')
+			}
+			b.WriteRune(r)
+			dash = false
+			continue
+		}
+		dash = true
+	}
+	if b.Len() == 0 {
+		return "gallery"
+	}
+	return b.String()
+}
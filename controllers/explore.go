@@ -0,0 +1,167 @@
+package controllers
+
+import (
+	"log"
+	"net/http"
+	"net/url"
+
+	"github.com/abanoub-fathy/bebo-gallery/model"
+	"github.com/abanoub-fathy/bebo-gallery/utils"
+	"github.com/abanoub-fathy/bebo-gallery/views"
+	"github.com/gorilla/mux"
+	uuid "github.com/satori/go.uuid"
+)
+
+// exploreLimit is the number of the galleries of a feed page
+const exploreLimit = 24
+
+// Explore contains the handlers of the public pages
+// that list the public galleries
+type Explore struct {
+	HomeView       *views.View
+	ProfileView    *views.View
+	UserService    model.UserService
+	GalleryService model.GalleryService
+	ImageService   model.ImageService
+	TagService     model.TagService
+}
+
+// NewExplore return a pointer to Explore type which can be used
+// as a receiver to call the handler functions
+func NewExplore(userService model.UserService, galleryService model.GalleryService, imageService model.ImageService, tagService model.TagService) *Explore {
+	return &Explore{
+		HomeView:       views.NewView("base", "static/home"),
+		ProfileView:    views.NewView("base", "user/profile"),
+		UserService:    userService,
+		GalleryService: galleryService,
+		ImageService:   imageService,
+		TagService:     tagService,
+	}
+}
+
+// exploreForm is the query of the feed pages
+type exploreForm struct {
+	Cursor string `schema:"cursor"`
+}
+
+// explorePage is the data of the explore feed
+type explorePage struct {
+	Galleries []*model.Gallery
+
+	// Owners are the owners of the galleries by their ids
+	Owners map[uuid.UUID]*model.User
+
+	// NextURL is empty if it is the last page
+	NextURL string
+}
+
+// profilePage is the data of the profile of a user
+type profilePage struct {
+	Profile   *model.User
+	Galleries []*model.Gallery
+	NextURL   string
+}
+
+// [GET] /
+//
+// the home page is the feed of the recently published galleries
+func (e *Explore) Home(w http.ResponseWriter, r *http.Request) {
+	params := views.Params{}
+	page := explorePage{Owners: map[uuid.UUID]*model.User{}}
+	params.Data = &page
+
+	listing, err := e.listPublic(r, uuid.Nil)
+	if err != nil {
+		params.SetAlert(err)
+		e.HomeView.Render(w, r, params)
+		return
+	}
+	page.NextURL = listing.NextURL
+
+	// the galleries of the disabled users are not shown
+	for _, gallery := range listing.Galleries {
+		owner, found := page.Owners[gallery.UserID]
+		if !found {
+			owner, err = e.UserService.FindByID(gallery.UserID.String())
+			if err != nil {
+				log.Println("could not find the owner of the gallery", err)
+				owner = nil
+			}
+			page.Owners[gallery.UserID] = owner
+		}
+		if owner != nil && !owner.Disabled {
+			page.Galleries = append(page.Galleries, gallery)
+		}
+	}
+
+	e.HomeView.Render(w, r, params)
+}
+
+// [GET] /u/{handle}
+//
+// the profile lists the public galleries of the user
+func (e *Explore) Profile(w http.ResponseWriter, r *http.Request) {
+	user, err := e.UserService.FindByHandle(mux.Vars(r)["handle"])
+	if err != nil || user.Disabled {
+		http.Redirect(w, r, "/notFound", http.StatusPermanentRedirect)
+		return
+	}
+
+	params := views.Params{}
+	page := profilePage{Profile: user}
+	params.Data = &page
+
+	listing, err := e.listPublic(r, user.ID)
+	if err != nil {
+		params.SetAlert(err)
+		e.ProfileView.Render(w, r, params)
+		return
+	}
+	page.Galleries, page.NextURL = listing.Galleries, listing.NextURL
+
+	e.ProfileView.Render(w, r, params)
+}
+
+// viewerID returns the id of the user or nil for the visitors
+// so the unlisted galleries are listed only for their owner
+func viewerID(user *model.User) uuid.UUID {
+	if user == nil {
+		return uuid.Nil
+	}
+	return user.ID
+}
+
+// publicListing is a page of the public galleries
+type publicListing struct {
+	Galleries []*model.Gallery
+	NextURL   string
+}
+
+// listPublic returns the page of the public galleries of the
+// cursor in the url. the galleries of all the users are
+// listed if the user id is nil
+func (e *Explore) listPublic(r *http.Request, userID uuid.UUID) (*publicListing, error) {
+	var form exploreForm
+	if err := utils.ParseURLParams(r, &form); err != nil {
+		return nil, err
+	}
+
+	page, err := e.GalleryService.ListGalleries(&model.GalleryListQuery{
+		UserID: userID,
+		Sort:   model.GallerySortPublished,
+		Limit:  exploreLimit,
+		Cursor: form.Cursor,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	loadCovers(e.ImageService, page.Galleries)
+	e.TagService.LoadGalleryTags(page.Galleries...)
+
+	listing := &publicListing{Galleries: page.Galleries}
+	if page.NextCursor != "" {
+		listing.NextURL = r.URL.Path + "?" + url.Values{"cursor": {page.NextCursor}}.Encode()
+	}
+	return listing, nil
+}
@@ -0,0 +1,84 @@
+package controllers_test
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/abanoub-fathy/bebo-gallery/controllers"
+	"github.com/abanoub-fathy/bebo-gallery/model"
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newExploreController(service *model.Service) *mux.Router {
+	r := mux.NewRouter()
+	exploreController := controllers.NewExplore(service.UserService, service.GalleryService, service.ImageService, service.TagService)
+	r.HandleFunc("/", exploreController.Home).Methods("GET")
+	r.HandleFunc("/u/{handle}", exploreController.Profile).Methods("GET")
+	return r
+}
+
+// publishGallery creates a public gallery with an image
+func publishGallery(t *testing.T, service *model.Service, user *model.User, title string) *model.Gallery {
+	gallery := &model.Gallery{Title: title, UserID: user.ID}
+	gallery.SetPublic(true)
+	require.NoError(t, service.GalleryService.CreateGallery(gallery))
+	_, err := service.ImageService.CreateImage(io.NopCloser(strings.NewReader(title)), gallery.ID, "cover.jpg")
+	require.NoError(t, err)
+	return gallery
+}
+
+func TestExplore(t *testing.T) {
+	service := newMemoryService()
+	user := createUser(t, service, "aop4ever@gmail.com")
+	disabled := createUser(t, service, "disabled@gmail.com")
+	public := publishGallery(t, service, user, "Wedding")
+	createGallery(t, service, user, "Private Party")
+	publishGallery(t, service, disabled, "Hidden Trip")
+	_, err := service.UserService.FindAndUpdateByID(disabled.ID.String(), map[string]interface{}{"disabled": true})
+	require.NoError(t, err)
+	r := newExploreController(service)
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+	body := w.Body.String()
+	assert.Contains(t, body, `href="/galleries/`+public.ID.String()+`"`)
+	assert.Contains(t, body, "/images/galleries/"+public.ID.String()+"/cover.jpg")
+	assert.Contains(t, body, `href="/u/aop4ever"`)
+	assert.NotContains(t, body, "Private Party")
+	assert.NotContains(t, body, "Hidden Trip")
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/?cursor=nope", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), model.ErrCursorInvalid.PublicErrMsg())
+}
+
+func TestProfile(t *testing.T) {
+	service := newMemoryService()
+	user := createUser(t, service, "aop4ever@gmail.com")
+	disabled := createUser(t, service, "disabled@gmail.com")
+	publishGallery(t, service, user, "Wedding")
+	createGallery(t, service, user, "Private Party")
+	_, err := service.UserService.FindAndUpdateByID(disabled.ID.String(), map[string]interface{}{"disabled": true})
+	require.NoError(t, err)
+	r := newExploreController(service)
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/u/AOP4EVER", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), "@aop4ever")
+	assert.Contains(t, w.Body.String(), "Wedding")
+	assert.NotContains(t, w.Body.String(), "Private Party")
+
+	for _, handle := range []string{"nobody", "disabled"} {
+		w = httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/u/"+handle, nil))
+		assert.Equal(t, "/notFound", w.Header().Get("Location"), handle)
+	}
+}
@@ -1,11 +1,19 @@
 package controllers
 
 import (
+	"bytes"
 	"fmt"
+	"io"
+	"log"
 	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
 
+	"github.com/abanoub-fathy/bebo-gallery/config"
 	"github.com/abanoub-fathy/bebo-gallery/model"
 	"github.com/abanoub-fathy/bebo-gallery/pkg/context"
+	"github.com/abanoub-fathy/bebo-gallery/pkg/zipimport"
 	"github.com/abanoub-fathy/bebo-gallery/utils"
 	"github.com/abanoub-fathy/bebo-gallery/views"
 	"github.com/gorilla/mux"
@@ -19,31 +27,45 @@ const (
 	EditGalleryPageEndpoint   = "edit_gallery_page_end_point"
 )
 
-const (
-	PARSE_FORM_MAX_MEMORY = 30 << 20
-)
-
 type Gallery struct {
 	ShowGalleryView       *views.View
 	ShowUserGalleriesView *views.View
 	CreateGalleryView     *views.View
 	EditGalleryView       *views.View
+	EditImagesView        *views.View
+	TagView               *views.View
+	ImageView             *views.View
+	ImportView            *views.View
+	ShareView             *views.View
 	GalleryService        model.GalleryService
 	ImageService          model.ImageService
+	TagService            model.TagService
+	ShareLinkService      model.ShareLinkService
 	router                *mux.Router
+	limits                config.Limits
+	importer              *zipimport.Importer
 }
 
 // NewGallery return a pointer to Gallery type which can be used
 // as a receiver to call the handler functions
-func NewGallery(galleryService model.GalleryService, imageService model.ImageService, muxRouter *mux.Router) *Gallery {
+func NewGallery(galleryService model.GalleryService, imageService model.ImageService, tagService model.TagService, shareLinkService model.ShareLinkService, muxRouter *mux.Router, limits config.Limits) *Gallery {
 	return &Gallery{
 		ShowGalleryView:       views.NewView("base", "gallery/gallery"),
 		ShowUserGalleriesView: views.NewView("base", "gallery/user_galleries"),
 		CreateGalleryView:     views.NewView("base", "gallery/new"),
 		EditGalleryView:       views.NewView("base", "gallery/edit"),
+		EditImagesView:        views.NewView("base", "gallery/images"),
+		TagView:               views.NewView("base", "gallery/tag"),
+		ImageView:             views.NewView("base", "gallery/image"),
+		ImportView:            views.NewView("base", "gallery/import"),
+		ShareView:             views.NewView("base", "gallery/share"),
 		GalleryService:        galleryService,
 		ImageService:          imageService,
+		TagService:            tagService,
+		ShareLinkService:      shareLinkService,
 		router:                muxRouter,
+		limits:                limits,
+		importer:              newImporter(limits),
 	}
 }
 
@@ -51,42 +73,333 @@ func (g *Gallery) ViewGallery(w http.ResponseWriter, r *http.Request) {
 	// get gallery id
 	galleryID := mux.Vars(r)["galleryID"]
 
-	// fetch gallery by id
+	// fetch gallery by id. the unlisted galleries of the
+	// other users are not found without a share link
 	gallery, err := g.GalleryService.FindByID(galleryID)
-	if err != nil {
+	var link *model.ShareLink
+	if err == nil {
+		link = g.shareLink(r, gallery)
+	}
+	user := context.UserValue(r.Context())
+	if err != nil || !canView(user, gallery, link) {
 		// redirect user to not found
 		http.Redirect(w, r, "/notFound", http.StatusPermanentRedirect)
 		return
 	}
 
-	// fetch gallery images
-	gallery.Images, _ = g.ImageService.GetImagesByGalleryID(gallery.ID)
+	// fetch a page of the gallery images and the tags
+	page := galleryPage{
+		Gallery:      gallery,
+		ImagesCursor: r.URL.Query().Get("images"),
+		CanDownload:  canDownload(user, gallery, link),
+	}
+	if link != nil {
+		page.ShareToken = r.URL.Query().Get(shareParam)
+	}
+	imagePage, err := g.ImageService.ListImages(gallery.ID, page.ImagesCursor, model.DefaultImagePageLimit)
+	if err != nil {
+		params := views.Params{Data: page}
+		params.SetAlert(err)
+		g.ShowGalleryView.Render(w, r, params)
+		return
+	}
+	gallery.Images = imagePage.Images
+	page.NextImagesCursor = imagePage.NextCursor
+	g.loadTags(gallery)
 
 	// render the gallery
 	err = g.ShowGalleryView.Render(w, r, views.Params{
-		Data: gallery,
+		Data: page,
 	})
 	if err != nil {
 		fmt.Println("err while rendering gallery", err)
 	}
 }
 
+// canView tells if the user can see the gallery. the public
+// galleries are seen by everyone and the unlisted ones only by
+// their owner and the people with one of their share links. the
+// link is nil if the gallery is not opened by a share link
+func canView(user *model.User, gallery *model.Gallery, link *model.ShareLink) bool {
+	if user != nil && uuid.Equal(user.ID, gallery.UserID) {
+		return true
+	}
+	return gallery.Public() || link != nil
+}
+
+// galleryPage is the data of the gallery page
+type galleryPage struct {
+	*model.Gallery
+
+	// ImagesCursor is the cursor of the shown images
+	// it is empty for the first page of the images
+	ImagesCursor string
+
+	// NextImagesCursor is empty if it is the last page
+	NextImagesCursor string
+
+	// CanDownload tells if the user can download the images
+	CanDownload bool
+
+	// ShareToken is the token of the share link the gallery is
+	// opened with. it is sent with the downloads and the links
+	// to the image pages
+	ShareToken string
+}
+
+// the intervals of the slideshow in seconds
+const (
+	defaultSlideshowInterval = 5
+	maxSlideshowInterval     = 60
+)
+
+// slideshowIntervals are the choices of the slideshow interval
+var slideshowIntervals = []int{2, 3, 5, 10, 20, 30}
+
+// imageForm is the query of the image page
+type imageForm struct {
+	// Slideshow is the interval of the slideshow in seconds. the
+	// slideshow starts when the page is opened if it is set
+	Slideshow int `schema:"slideshow"`
+}
+
+// imagePage is the data of the image page
+type imagePage struct {
+	Gallery *model.Gallery
+	Image   *model.Image
+
+	// Prev and Next are the neighbours of the
+	// image. they are nil at the ends
+	Prev *model.Image
+	Next *model.Image
+
+	// Playing tells if the slideshow starts when the page is opened
+	Playing bool
+
+	// Interval is the interval of the slideshow in
+	// seconds and Intervals are its choices
+	Interval  int
+	Intervals []int
+	// ShareToken is the token of the share link the image is
+	// opened with. it is sent with the links to the other pages
+	ShareToken string
+}
+
+// [GET] /galleries/{galleryID}/images/{imageID}
+//
+// the page of the image is linked to the pages of its neighbours
+// and the viewer script moves between them without reloading
+func (g *Gallery) ViewImage(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	gallery, err := g.GalleryService.FindByID(vars["galleryID"])
+	if err != nil {
+		http.Redirect(w, r, "/notFound", http.StatusPermanentRedirect)
+		return
+	}
+	link := g.shareLink(r, gallery)
+	if !canView(context.UserValue(r.Context()), gallery, link) {
+		http.Redirect(w, r, "/notFound", http.StatusPermanentRedirect)
+		return
+	}
+	imageID, err := uuid.FromString(vars["imageID"])
+	if err != nil {
+		http.Redirect(w, r, "/notFound", http.StatusPermanentRedirect)
+		return
+	}
+	image, err := g.ImageService.FindImageByID(gallery.ID, imageID)
+	if err != nil {
+		http.Redirect(w, r, "/notFound", http.StatusPermanentRedirect)
+		return
+	}
+
+	images := []model.Image{*image}
+	if err := g.TagService.LoadImageTags(images); err != nil {
+		log.Println("could not load the image tags", err)
+	}
+	page := imagePage{Gallery: gallery, Image: &images[0], Interval: defaultSlideshowInterval}
+	if link != nil {
+		page.ShareToken = r.URL.Query().Get(shareParam)
+	}
+	page.Prev, page.Next, err = g.ImageService.FindNeighbours(image)
+	if err != nil {
+		log.Println("could not find the neighbours of the image", err)
+	}
+
+	// the invalid intervals do not start the slideshow
+	var form imageForm
+	if err := utils.ParseURLParams(r, &form); err == nil && form.Slideshow > 0 {
+		page.Playing = true
+		page.Interval = form.Slideshow
+		if page.Interval > maxSlideshowInterval {
+			page.Interval = maxSlideshowInterval
+		}
+	}
+	page.Intervals = withInterval(slideshowIntervals, page.Interval)
+
+	g.ImageView.Render(w, r, views.Params{
+		Data: page,
+	})
+}
+
+// [GET] /images/galleries/{galleryID}/{fileName}
+//
+// the originals are served only to the users who can see the
+// gallery. the share param is the token of the share link the
+// gallery is opened with
+func (g *Gallery) ServeImage(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	gallery, err := g.GalleryService.FindByID(vars["galleryID"])
+	if err != nil || !canView(context.UserValue(r.Context()), gallery, g.shareLink(r, gallery)) {
+		http.NotFound(w, r)
+		return
+	}
+
+	// the files without records are not served
+	image, err := g.ImageService.FindImageByFileName(gallery.ID, vars["fileName"])
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	file, err := g.ImageService.Open(image)
+	if err == model.ErrNotFound {
+		http.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		log.Println("could not open the image", image.ID, err)
+		http.Error(w, "could not open the image", http.StatusInternalServerError)
+		return
+	}
+	defer file.Close()
+
+	// the ranges need a seeker
+	content, ok := file.(io.ReadSeeker)
+	if !ok {
+		data, err := io.ReadAll(file)
+		if err != nil {
+			log.Println("could not read the image", image.ID, err)
+			http.Error(w, "could not read the image", http.StatusInternalServerError)
+			return
+		}
+		content = bytes.NewReader(data)
+	}
+
+	// the shared caches keep only the images of the public galleries
+	if !gallery.Public() {
+		w.Header().Set("Cache-Control", "private")
+	}
+	http.ServeContent(w, r, image.FileName, image.UpdatedAt, content)
+}
+
+// withInterval returns the intervals with the interval in their order
+func withInterval(intervals []int, interval int) []int {
+	for _, i := range intervals {
+		if i == interval {
+			return intervals
+		}
+	}
+	result := append([]int{interval}, intervals...)
+	sort.Ints(result)
+	return result
+}
+
+// galleriesForm is the query of the galleries listing
+type galleriesForm struct {
+	// Sort is one of the model gallery sorts
+	Sort string `schema:"sort"`
+
+	// Order is asc or desc. the default order
+	// of the sort is used if it is empty
+	Order string `schema:"order"`
+
+	Title  string `schema:"q"`
+	Tag    string `schema:"tag"`
+	Limit  int    `schema:"limit"`
+	Cursor string `schema:"cursor"`
+}
+
+// listQuery returns the model listing query of the form
+func (form *galleriesForm) listQuery(userID uuid.UUID) (*model.GalleryListQuery, error) {
+	query := &model.GalleryListQuery{
+		UserID: userID,
+		Sort:   form.Sort,
+		Title:  form.Title,
+		Tag:    form.Tag,
+		Limit:  form.Limit,
+		Cursor: form.Cursor,
+	}
+	switch form.Order {
+	case "":
+	case "asc", "desc":
+		ascending := form.Order == "asc"
+		query.Ascending = &ascending
+	default:
+		return nil, errInvalidParam("order")
+	}
+	return query, nil
+}
+
+// nextURL returns the url of the page after the cursor
+func (form galleriesForm) nextURL(path, cursor string) string {
+	values := url.Values{}
+	for key, value := range map[string]string{"sort": form.Sort, "order": form.Order, "q": form.Title, "tag": form.Tag, "cursor": cursor} {
+		if value != "" {
+			values.Set(key, value)
+		}
+	}
+	if form.Limit > 0 {
+		values.Set("limit", strconv.Itoa(form.Limit))
+	}
+	return path + "?" + values.Encode()
+}
+
+// galleriesPage is the data of the galleries listing
+type galleriesPage struct {
+	Form      galleriesForm
+	Galleries []*model.Gallery
+
+	// NextURL is the url of the next page
+	// it is empty if it is the last page
+	NextURL string
+}
+
 func (g *Gallery) ShowUserGalleriesPage(w http.ResponseWriter, r *http.Request) {
 	// get user from conext
 	user := context.UserValue(r.Context())
 
-	// get the galleries of the user
-	galleries, err := g.GalleryService.FindByUserID(user.ID)
+	// the galleries of the user are sorted and
+	// filtered by the params of the url
+	page := galleriesPage{}
+	params := views.Params{Data: &page}
+	if err := utils.ParseURLParams(r, &page.Form); err != nil {
+		params.SetAlert(err)
+		g.ShowUserGalleriesView.Render(w, r, params)
+		return
+	}
+	query, err := page.Form.listQuery(user.ID)
 	if err != nil {
-		http.Error(w, "could not get galleries by used id", http.StatusInternalServerError)
+		params.SetAlertWithErrMsg(err.Error())
+		g.ShowUserGalleriesView.Render(w, r, params)
 		return
 	}
 
-	// render user galleries page
-	params := views.Params{
-		Data: galleries,
+	// get a page of the galleries of the user
+	listing, err := g.GalleryService.ListGalleries(query)
+	if err != nil {
+		params.SetAlert(err)
+		g.ShowUserGalleriesView.Render(w, r, params)
+		return
+	}
+	page.Galleries = listing.Galleries
+	if listing.NextCursor != "" {
+		page.NextURL = page.Form.nextURL(r.URL.Path, listing.NextCursor)
 	}
 
+	loadCovers(g.ImageService, page.Galleries)
+	g.TagService.LoadGalleryTags(page.Galleries...)
+
+	// render user galleries page
+
 	if err = g.ShowUserGalleriesView.Render(w, r, params); err != nil {
 		http.Error(w, "could not show your galleries", http.StatusInternalServerError)
 		return
@@ -115,8 +428,9 @@ func (g *Gallery) EditGalleryPage(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// fetch gallery images
+	// fetch gallery images and tags
 	gallery.Images, _ = g.ImageService.GetImagesByGalleryID(gallery.ID)
+	g.loadTags(gallery)
 
 	// render the gallery
 	err = g.EditGalleryView.Render(w, r, views.Params{
@@ -152,8 +466,8 @@ func (g *Gallery) EditGallery(w http.ResponseWriter, r *http.Request) {
 	// define view params data
 	params := views.Params{}
 
-	// define createGalleryForm
-	var form createGalleryForm
+	// define editGalleryForm
+	var form editGalleryForm
 
 	// Parse the form
 	if err := utils.ParseForm(r, &form); err != nil {
@@ -162,10 +476,16 @@ func (g *Gallery) EditGallery(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// update the gallery
+	// update the gallery and its tags
 	gallery.Title = form.Title
+	gallery.Description = form.Description
+	gallery.Tags = model.ParseTags(form.Tags)
+	gallery.SetPublic(form.Public)
 
 	err = g.GalleryService.Update(gallery)
+	if err == nil {
+		err = g.TagService.SetGalleryTags(gallery.ID, gallery.Tags)
+	}
 	if err != nil {
 		params.SetAlert(err)
 		params.Data = gallery
@@ -209,33 +529,13 @@ func (g *Gallery) UploadImage(w http.ResponseWriter, r *http.Request) {
 		Data: gallery,
 	}
 
-	// parse multipart gallery
-	if err = r.ParseMultipartForm(PARSE_FORM_MAX_MEMORY); err != nil {
+	// save the uploaded images
+	if _, err = createImages(w, r, g.ImageService, g.limits, gallery.ID); err != nil {
 		params.SetAlert(err)
 		g.EditGalleryView.Render(w, r, params)
 		return
 	}
 
-	fileHeaders := r.MultipartForm.File["images"]
-
-	for _, f := range fileHeaders {
-		// open the file
-		file, err := f.Open()
-		if err != nil {
-			params.SetAlert(err)
-			g.EditGalleryView.Render(w, r, params)
-			return
-		}
-		defer file.Close()
-
-		err = g.ImageService.CreateImage(file, gallery.ID, f.Filename)
-		if err != nil {
-			params.SetAlert(err)
-			g.EditGalleryView.Render(w, r, params)
-			return
-		}
-	}
-
 	// redirect user to show gallery page
 	url, err := g.router.Get(EditGalleryPageEndpoint).URL("galleryID", gallery.ID.String())
 	if err != nil {
@@ -272,7 +572,7 @@ func (g *Gallery) DeleteImage(w http.ResponseWriter, r *http.Request) {
 
 	// define image
 	image := model.Image{
-		GalleryID: galleryID,
+		GalleryID: gallery.ID,
 		FileName:  fileName,
 	}
 
@@ -295,8 +595,357 @@ func (g *Gallery) DeleteImage(w http.ResponseWriter, r *http.Request) {
 	http.Redirect(w, r, url.String(), http.StatusFound)
 }
 
+type tagImagesForm struct {
+	ImageIDs []string `schema:"imageIDs"`
+	Tags     string   `schema:"tags"`
+
+	// Action is add or remove
+	Action string `schema:"action"`
+}
+
+// TagImages adds the tags to the selected images
+// or removes the tags from them
+func (g *Gallery) TagImages(w http.ResponseWriter, r *http.Request) {
+	gallery, ok := g.findOwnGallery(w, r)
+	if !ok {
+		return
+	}
+
+	// define view params data
+	params := views.Params{
+		Data: gallery,
+	}
+
+	var form tagImagesForm
+	err := utils.ParseForm(r, &form)
+	if err == nil {
+		imageIDs := make([]uuid.UUID, len(form.ImageIDs))
+		for i, id := range form.ImageIDs {
+			imageIDs[i] = uuid.FromStringOrNil(id)
+		}
+
+		if form.Action == "remove" {
+			err = g.TagService.RemoveImageTags(gallery.ID, imageIDs, model.ParseTags(form.Tags))
+		} else {
+			err = g.TagService.AddImageTags(gallery.ID, imageIDs, model.ParseTags(form.Tags))
+		}
+	}
+	if err != nil {
+		gallery.Images, _ = g.ImageService.GetImagesByGalleryID(gallery.ID)
+		g.loadTags(gallery)
+		params.SetAlert(err)
+		g.EditGalleryView.Render(w, r, params)
+		return
+	}
+
+	g.redirectToEditPage(w, r, gallery)
+}
+
+// tagPage is the data of the tag page
+type tagPage struct {
+	Tag       string
+	Galleries []*model.Gallery
+	Images    []model.Image
+}
+
+// ViewTag shows the galleries and the images with the tag
+func (g *Gallery) ViewTag(w http.ResponseWriter, r *http.Request) {
+	tag, err := model.NormalizeTag(mux.Vars(r)["tag"])
+	if err != nil {
+		http.Redirect(w, r, "/notFound", http.StatusPermanentRedirect)
+		return
+	}
+
+	page := tagPage{Tag: tag}
+	viewerID := viewerID(context.UserValue(r.Context()))
+	page.Galleries, err = g.TagService.FindGalleriesByTag(tag, viewerID)
+	if err == nil {
+		page.Images, err = g.TagService.FindImagesByTag(tag, viewerID)
+	}
+	if err != nil {
+		params := views.Params{}
+		params.SetAlert(err)
+		g.TagView.Render(w, r, params)
+		return
+	}
+
+	loadCovers(g.ImageService, page.Galleries)
+	g.TagService.LoadGalleryTags(page.Galleries...)
+	g.TagService.LoadImageTags(page.Images)
+
+	g.TagView.Render(w, r, views.Params{
+		Data: page,
+	})
+}
+
+// loadCovers sets the images of the galleries to their cover
+// images only so the listings do not load all the images
+func loadCovers(imageService model.ImageService, galleries []*model.Gallery) {
+	for _, gallery := range galleries {
+		if gallery.CoverImageID != nil {
+			if image, err := imageService.FindImageByID(gallery.ID, *gallery.CoverImageID); err == nil {
+				gallery.Images = []model.Image{*image}
+				continue
+			}
+		}
+		if page, err := imageService.ListImages(gallery.ID, "", 1); err == nil {
+			gallery.Images = page.Images
+		}
+	}
+}
+
+// loadTags sets the tags of the gallery and its images
+func (g *Gallery) loadTags(gallery *model.Gallery) {
+	if err := g.TagService.LoadGalleryTags(gallery); err != nil {
+		log.Println("could not load the gallery tags", err)
+	}
+	if err := g.TagService.LoadImageTags(gallery.Images); err != nil {
+		log.Println("could not load the image tags", err)
+	}
+}
+
+type coverForm struct {
+	ImageID string `schema:"imageID"`
+}
+
+// SetCover sets the image shown as the thumbnail of the gallery
+func (g *Gallery) SetCover(w http.ResponseWriter, r *http.Request) {
+	gallery, ok := g.findOwnGallery(w, r)
+	if !ok {
+		return
+	}
+
+	// define view params data
+	params := views.Params{
+		Data: gallery,
+	}
+
+	var form coverForm
+	if err := utils.ParseForm(r, &form); err != nil {
+		params.SetAlert(err)
+		g.EditGalleryView.Render(w, r, params)
+		return
+	}
+
+	// the cover should be an image of the gallery
+	image, err := g.ImageService.FindImageByID(gallery.ID, uuid.FromStringOrNil(form.ImageID))
+	if err == nil {
+		gallery.CoverImageID = &image.ID
+		err = g.GalleryService.Update(gallery)
+	}
+	if err != nil {
+		gallery.Images, _ = g.ImageService.GetImagesByGalleryID(gallery.ID)
+		params.SetAlert(err)
+		g.EditGalleryView.Render(w, r, params)
+		return
+	}
+
+	g.redirectToEditPage(w, r, gallery)
+}
+
+// EditImagesPage shows the details of all the images
+// of the gallery to edit them together
+func (g *Gallery) EditImagesPage(w http.ResponseWriter, r *http.Request) {
+	gallery, ok := g.findOwnGallery(w, r)
+	if !ok {
+		return
+	}
+
+	gallery.Images, _ = g.ImageService.GetImagesByGalleryID(gallery.ID)
+	g.EditImagesView.Render(w, r, views.Params{
+		Data: gallery,
+	})
+}
+
+type imageDetailsForm struct {
+	ImageIDs []string `schema:"imageIDs"`
+	Titles   []string `schema:"titles"`
+	Captions []string `schema:"captions"`
+	AltTexts []string `schema:"altTexts"`
+}
+
+// UpdateImages updates the title, caption and alt text of the
+// images of the form. it is used by the form of every image on
+// the edit page and by the bulk edit page
+func (g *Gallery) UpdateImages(w http.ResponseWriter, r *http.Request) {
+	gallery, ok := g.findOwnGallery(w, r)
+	if !ok {
+		return
+	}
+
+	// define view params data
+	params := views.Params{
+		Data: gallery,
+	}
+
+	var form imageDetailsForm
+	if err := utils.ParseForm(r, &form); err != nil {
+		gallery.Images, _ = g.ImageService.GetImagesByGalleryID(gallery.ID)
+		params.SetAlert(err)
+		g.EditImagesView.Render(w, r, params)
+		return
+	}
+
+	n := len(form.ImageIDs)
+	if len(form.Titles) != n || len(form.Captions) != n || len(form.AltTexts) != n {
+		gallery.Images, _ = g.ImageService.GetImagesByGalleryID(gallery.ID)
+		params.SetAlertWithErrMsg("the details of the images are not complete")
+		g.EditImagesView.Render(w, r, params)
+		return
+	}
+
+	images := make([]model.Image, n)
+	for i := range images {
+		images[i] = model.Image{
+			Base:    model.Base{ID: uuid.FromStringOrNil(form.ImageIDs[i])},
+			Title:   form.Titles[i],
+			Caption: form.Captions[i],
+			AltText: form.AltTexts[i],
+		}
+	}
+
+	if err := g.ImageService.UpdateImages(gallery.ID, images); err != nil {
+		// show the entered details again with the error
+		gallery.Images, _ = g.ImageService.GetImagesByGalleryID(gallery.ID)
+		for i := range gallery.Images {
+			for _, image := range images {
+				if uuid.Equal(gallery.Images[i].ID, image.ID) {
+					gallery.Images[i].Title = image.Title
+					gallery.Images[i].Caption = image.Caption
+					gallery.Images[i].AltText = image.AltText
+				}
+			}
+		}
+		params.SetAlert(err)
+		g.EditImagesView.Render(w, r, params)
+		return
+	}
+
+	g.redirectToEditPage(w, r, gallery)
+}
+
+type reorderForm struct {
+	ImageIDs  []string `schema:"imageIDs"`
+	Positions []int    `schema:"positions"`
+}
+
+// ReorderImages orders the images of the gallery by the positions
+// entered for them. the images with the same position keep the
+// order they had
+func (g *Gallery) ReorderImages(w http.ResponseWriter, r *http.Request) {
+	gallery, ok := g.findOwnGallery(w, r)
+	if !ok {
+		return
+	}
+
+	// define view params data
+	params := views.Params{
+		Data: gallery,
+	}
+
+	var form reorderForm
+	err := utils.ParseForm(r, &form)
+	if err == nil && len(form.ImageIDs) != len(form.Positions) {
+		err = model.ErrImageOrderInvalid
+	}
+	if err == nil {
+		order := make([]int, len(form.ImageIDs))
+		for i := range order {
+			order[i] = i
+		}
+		sort.SliceStable(order, func(i, j int) bool {
+			return form.Positions[order[i]] < form.Positions[order[j]]
+		})
+
+		imageIDs := make([]uuid.UUID, len(order))
+		for i, index := range order {
+			imageIDs[i] = uuid.FromStringOrNil(form.ImageIDs[index])
+		}
+		err = g.ImageService.ReorderImages(gallery.ID, imageIDs)
+	}
+	if err != nil {
+		gallery.Images, _ = g.ImageService.GetImagesByGalleryID(gallery.ID)
+		params.SetAlert(err)
+		g.EditGalleryView.Render(w, r, params)
+		return
+	}
+
+	g.redirectToEditPage(w, r, gallery)
+}
+
+// findOwnGallery returns the gallery of the galleryID route
+// variable if it is owned by the user in the ctx. otherwise
+// it redirects to the not found page
+func (g *Gallery) findOwnGallery(w http.ResponseWriter, r *http.Request) (*model.Gallery, bool) {
+	gallery, err := g.GalleryService.FindByID(mux.Vars(r)["galleryID"])
+	if err != nil {
+		http.Redirect(w, r, "/notFound", http.StatusPermanentRedirect)
+		return nil, false
+	}
+
+	user := context.UserValue(r.Context())
+	if !uuid.Equal(user.ID, gallery.UserID) {
+		http.Redirect(w, r, "/notFound", http.StatusPermanentRedirect)
+		return nil, false
+	}
+	return gallery, true
+}
+
+// redirectToEditPage redirects to the edit page of the gallery
+func (g *Gallery) redirectToEditPage(w http.ResponseWriter, r *http.Request, gallery *model.Gallery) {
+	url, err := g.router.Get(EditGalleryPageEndpoint).URL("galleryID", gallery.ID.String())
+	if err != nil {
+		http.Redirect(w, r, "/", http.StatusInternalServerError)
+		return
+	}
+	http.Redirect(w, r, url.String(), http.StatusFound)
+}
+
+// createImages saves the files of the images field in the
+// multipart form to the gallery and returns their images
+func createImages(w http.ResponseWriter, r *http.Request, imageService model.ImageService, limits config.Limits, galleryID uuid.UUID) ([]model.Image, error) {
+	// limit the size of the upload request
+	r.Body = http.MaxBytesReader(w, r.Body, limits.MaxUploadBytes)
+
+	// parse multipart gallery
+	if err := r.ParseMultipartForm(limits.MaxFormMemory); err != nil {
+		return nil, err
+	}
+
+	images := []model.Image{}
+	for _, f := range r.MultipartForm.File["images"] {
+		// open the file
+		file, err := f.Open()
+		if err != nil {
+			return nil, err
+		}
+
+		// the image service closes the file
+		image, err := imageService.CreateImage(file, galleryID, f.Filename)
+		if err != nil {
+			return nil, err
+		}
+		images = append(images, *image)
+	}
+
+	return images, nil
+}
+
+type editGalleryForm struct {
+	Title       string `schema:"title"`
+	Description string `schema:"description"`
+
+	// Tags are separated by commas
+	Tags string `schema:"tags"`
+
+	// Public is the checkbox that publishes the gallery
+	Public bool `schema:"public"`
+}
+
 type createGalleryForm struct {
-	Title string `schema:"title"`
+	Title       string `schema:"title"`
+	Description string `schema:"description"`
+	Public      bool   `schema:"public"`
 }
 
 func (g *Gallery) CreateNewGallery(w http.ResponseWriter, r *http.Request) {
@@ -320,9 +969,11 @@ func (g *Gallery) CreateNewGallery(w http.ResponseWriter, r *http.Request) {
 	user := context.UserValue(r.Context())
 
 	gallery := &model.Gallery{
-		Title:  form.Title,
-		UserID: user.ID,
+		Title:       form.Title,
+		Description: form.Description,
+		UserID:      user.ID,
 	}
+	gallery.SetPublic(form.Public)
 
 	err := g.GalleryService.CreateGallery(gallery)
 	if err != nil {
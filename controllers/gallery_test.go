@@ -0,0 +1,597 @@
+package controllers_test
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/abanoub-fathy/bebo-gallery/config"
+	"github.com/abanoub-fathy/bebo-gallery/controllers"
+	"github.com/abanoub-fathy/bebo-gallery/model"
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newGalleryController(service *model.Service) *mux.Router {
+	r := mux.NewRouter()
+	galleryController := controllers.NewGallery(service.GalleryService, service.ImageService, service.TagService, service.ShareLinkService, r, config.Default().Limits)
+
+	r.HandleFunc("/galleries/{galleryID}", galleryController.ViewGallery).Methods("GET").Name(controllers.ViewGalleryEndpoint)
+	r.HandleFunc("/galleries", galleryController.CreateNewGallery).Methods("POST")
+	r.HandleFunc("/galleries", galleryController.ShowUserGalleriesPage).Methods("GET").Name(controllers.ViewGalleriesEndpoint)
+	r.HandleFunc("/galleries/{galleryID}/edit", galleryController.EditGalleryPage).Methods("GET").Name(controllers.EditGalleryPageEndpoint)
+	r.HandleFunc("/galleries/{galleryID}/edit", galleryController.EditGallery).Methods("POST")
+	r.HandleFunc("/galleries/{galleryID}/images", galleryController.UploadImage).Methods("POST")
+	r.HandleFunc("/galleries/{galleryID}/import", galleryController.ImportImages).Methods("POST")
+	r.HandleFunc("/galleries/{galleryID}/imports/{jobID}", galleryController.ImportProgress).Methods("GET")
+	r.HandleFunc("/galleries/{galleryID}/images/details", galleryController.EditImagesPage).Methods("GET")
+	r.HandleFunc("/galleries/{galleryID}/images/details", galleryController.UpdateImages).Methods("POST")
+	r.HandleFunc("/galleries/{galleryID}/images/{imageID:[0-9a-fA-F-]{36}}", galleryController.ViewImage).Methods("GET")
+	r.HandleFunc("/galleries/{galleryID}/download", galleryController.DownloadImages).Methods("GET")
+	r.HandleFunc("/images/galleries/{galleryID}/{fileName}", galleryController.ServeImage).Methods("GET")
+	r.HandleFunc("/galleries/{galleryID}/images/tags", galleryController.TagImages).Methods("POST")
+	r.HandleFunc("/galleries/{galleryID}/images/order", galleryController.ReorderImages).Methods("POST")
+	r.HandleFunc("/galleries/{galleryID}/cover", galleryController.SetCover).Methods("POST")
+	r.HandleFunc("/galleries/{galleryID}/images/{fileName}/delete", galleryController.DeleteImage).Methods("POST")
+	r.HandleFunc("/galleries/{galleryID}/delete", galleryController.DeleteGallery).Methods("POST")
+	r.HandleFunc("/galleries/{galleryID}/share", galleryController.SharePage).Methods("GET")
+	r.HandleFunc("/galleries/{galleryID}/share", galleryController.CreateShareLink).Methods("POST")
+	r.HandleFunc("/galleries/{galleryID}/share/{linkID}/delete", galleryController.DeleteShareLink).Methods("POST")
+	r.HandleFunc("/tags/{tag}", galleryController.ViewTag).Methods("GET")
+	return r
+}
+
+func createGallery(t *testing.T, service *model.Service, user *model.User, title string) *model.Gallery {
+	gallery := &model.Gallery{Title: title, UserID: user.ID}
+	require.NoError(t, service.GalleryService.CreateGallery(gallery))
+	return gallery
+}
+
+func TestCreateNewGallery(t *testing.T) {
+	service := newMemoryService()
+	user := createUser(t, service, "aop4ever@gmail.com")
+	r := newGalleryController(service)
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, postForm("/galleries", url.Values{"title": {""}}, user))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), model.ErrGalleryTitleRequired.PublicErrMsg())
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, postForm("/galleries", url.Values{"title": {"Wedding"}}, user))
+	assert.Equal(t, http.StatusFound, w.Code)
+	assert.Equal(t, "/galleries", w.Header().Get("Location"))
+
+	galleries, err := service.GalleryService.FindByUserID(user.ID)
+	require.NoError(t, err)
+	require.Len(t, galleries, 1)
+	assert.Equal(t, "Wedding", galleries[0].Title)
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, withUser(httptest.NewRequest(http.MethodGet, "/galleries", nil), user))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), "Wedding")
+}
+
+func TestViewGallery(t *testing.T) {
+	service := newMemoryService()
+	user := createUser(t, service, "aop4ever@gmail.com")
+	gallery := createGallery(t, service, user, "Wedding")
+	r := newGalleryController(service)
+
+	// the unlisted gallery is seen only by its owner
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, withUser(httptest.NewRequest(http.MethodGet, "/galleries/"+gallery.ID.String(), nil), user))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), "Wedding")
+
+	other := createUser(t, service, "other@gmail.com")
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, withUser(httptest.NewRequest(http.MethodGet, "/galleries/"+gallery.ID.String(), nil), other))
+	assert.Equal(t, "/notFound", w.Header().Get("Location"))
+
+	gallery.SetPublic(true)
+	require.NoError(t, service.GalleryService.Update(gallery))
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/galleries/"+gallery.ID.String(), nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), "Wedding")
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/galleries/not-an-id", nil))
+	assert.Equal(t, http.StatusPermanentRedirect, w.Code)
+	assert.Equal(t, "/notFound", w.Header().Get("Location"))
+}
+
+func TestEditGalleryRequiresOwner(t *testing.T) {
+	service := newMemoryService()
+	owner := createUser(t, service, "owner@gmail.com")
+	other := createUser(t, service, "other@gmail.com")
+	gallery := createGallery(t, service, owner, "Wedding")
+	r := newGalleryController(service)
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, postForm("/galleries/"+gallery.ID.String()+"/edit", url.Values{"title": {"Hacked"}}, other))
+	assert.Equal(t, "/notFound", w.Header().Get("Location"))
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, postForm("/galleries/"+gallery.ID.String()+"/edit", url.Values{"title": {"Our Wedding"}}, owner))
+	assert.Equal(t, http.StatusFound, w.Code)
+
+	found, err := service.GalleryService.FindByID(gallery.ID.String())
+	require.NoError(t, err)
+	assert.Equal(t, "Our Wedding", found.Title)
+}
+
+func TestUploadAndDeleteImage(t *testing.T) {
+	service := newMemoryService()
+	user := createUser(t, service, "aop4ever@gmail.com")
+	gallery := createGallery(t, service, user, "Wedding")
+	r := newGalleryController(service)
+
+	body := &bytes.Buffer{}
+	form := multipart.NewWriter(body)
+	part, err := form.CreateFormFile("images", "first.jpg")
+	require.NoError(t, err)
+	io.Copy(part, strings.NewReader("image content"))
+	require.NoError(t, form.Close())
+
+	req := httptest.NewRequest(http.MethodPost, "/galleries/"+gallery.ID.String()+"/images", body)
+	req.Header.Set("Content-Type", form.FormDataContentType())
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, withUser(req, user))
+	require.Equal(t, http.StatusFound, w.Code)
+
+	images, err := service.ImageService.GetImagesByGalleryID(gallery.ID)
+	require.NoError(t, err)
+	require.Len(t, images, 1)
+	assert.Equal(t, "first.jpg", images[0].FileName)
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, postForm("/galleries/"+gallery.ID.String()+"/images/first.jpg/delete", nil, user))
+	require.Equal(t, http.StatusFound, w.Code)
+
+	images, err = service.ImageService.GetImagesByGalleryID(gallery.ID)
+	require.NoError(t, err)
+	assert.Empty(t, images)
+}
+
+func TestReorderImagesAndSetCover(t *testing.T) {
+	service := newMemoryService()
+	user := createUser(t, service, "aop4ever@gmail.com")
+	gallery := createGallery(t, service, user, "Wedding")
+	r := newGalleryController(service)
+
+	ids := []string{}
+	for _, name := range []string{"a.jpg", "b.jpg", "c.jpg"} {
+		image, err := service.ImageService.CreateImage(io.NopCloser(strings.NewReader(name)), gallery.ID, name)
+		require.NoError(t, err)
+		ids = append(ids, image.ID.String())
+	}
+
+	// the images with the same position keep their order
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, postForm("/galleries/"+gallery.ID.String()+"/images/order", url.Values{
+		"imageIDs":  ids,
+		"positions": {"2", "1", "1"},
+	}, user))
+	require.Equal(t, http.StatusFound, w.Code)
+
+	images, err := service.ImageService.GetImagesByGalleryID(gallery.ID)
+	require.NoError(t, err)
+	require.Len(t, images, 3)
+	assert.Equal(t, "b.jpg", images[0].FileName)
+	assert.Equal(t, "c.jpg", images[1].FileName)
+	assert.Equal(t, "a.jpg", images[2].FileName)
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, postForm("/galleries/"+gallery.ID.String()+"/cover", url.Values{"imageID": {ids[2]}}, user))
+	require.Equal(t, http.StatusFound, w.Code)
+
+	found, err := service.GalleryService.FindByID(gallery.ID.String())
+	require.NoError(t, err)
+	require.NotNil(t, found.CoverImageID)
+	assert.Equal(t, ids[2], found.CoverImageID.String())
+
+	// only the owner can change the cover
+	other := createUser(t, service, "other@gmail.com")
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, postForm("/galleries/"+gallery.ID.String()+"/cover", url.Values{"imageID": {ids[0]}}, other))
+	assert.NotEqual(t, http.StatusFound, w.Code)
+}
+
+func TestUpdateImageDetails(t *testing.T) {
+	service := newMemoryService()
+	user := createUser(t, service, "aop4ever@gmail.com")
+	gallery := createGallery(t, service, user, "Wedding")
+	r := newGalleryController(service)
+
+	ids := []string{}
+	for _, name := range []string{"a.jpg", "b.jpg"} {
+		image, err := service.ImageService.CreateImage(io.NopCloser(strings.NewReader(name)), gallery.ID, name)
+		require.NoError(t, err)
+		ids = append(ids, image.ID.String())
+	}
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, postForm("/galleries/"+gallery.ID.String()+"/images/details", url.Values{
+		"imageIDs": ids,
+		"titles":   {"First dance", ""},
+		"captions": {"The *best* night", ""},
+		"altTexts": {"", "The cake"},
+	}, user))
+	require.Equal(t, http.StatusFound, w.Code)
+
+	images, err := service.ImageService.GetImagesByGalleryID(gallery.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "First dance", images[0].Title)
+	assert.Equal(t, "The *best* night", images[0].Caption)
+	assert.Equal(t, "The cake", images[1].AltText)
+
+	// the gallery shows the details
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, withUser(httptest.NewRequest(http.MethodGet, "/galleries/"+gallery.ID.String(), nil), user))
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `alt="First dance"`)
+	assert.Contains(t, w.Body.String(), `alt="The cake"`)
+	assert.Contains(t, w.Body.String(), "The <em>best</em> night")
+
+	// the bulk edit page shows the entered details with the error
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, postForm("/galleries/"+gallery.ID.String()+"/images/details", url.Values{
+		"imageIDs": {ids[0]},
+		"titles":   {strings.Repeat("a", model.MaxImageTitleLength+1)},
+		"captions": {"New caption"},
+		"altTexts": {""},
+	}, user))
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), "New caption")
+
+	images, err = service.ImageService.GetImagesByGalleryID(gallery.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "First dance", images[0].Title)
+}
+
+func TestTags(t *testing.T) {
+	service := newMemoryService()
+	user := createUser(t, service, "aop4ever@gmail.com")
+	gallery := createGallery(t, service, user, "Wedding")
+	r := newGalleryController(service)
+
+	ids := []string{}
+	for _, name := range []string{"a.jpg", "b.jpg", "c.jpg"} {
+		image, err := service.ImageService.CreateImage(io.NopCloser(strings.NewReader(name)), gallery.ID, name)
+		require.NoError(t, err)
+		ids = append(ids, image.ID.String())
+	}
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, postForm("/galleries/"+gallery.ID.String()+"/edit", url.Values{
+		"title":  {"Wedding"},
+		"tags":   {"Family, #Summer Party"},
+		"public": {"true"},
+	}, user))
+	require.Equal(t, http.StatusFound, w.Code)
+
+	// tag the selected images
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, postForm("/galleries/"+gallery.ID.String()+"/images/tags", url.Values{
+		"imageIDs": {ids[0], ids[1]},
+		"tags":     {"Cake, dance"},
+		"action":   {"add"},
+	}, user))
+	require.Equal(t, http.StatusFound, w.Code)
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, postForm("/galleries/"+gallery.ID.String()+"/images/tags", url.Values{
+		"imageIDs": {ids[1]},
+		"tags":     {"cake"},
+		"action":   {"remove"},
+	}, user))
+	require.Equal(t, http.StatusFound, w.Code)
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, withUser(httptest.NewRequest(http.MethodGet, "/galleries/"+gallery.ID.String()+"/edit", nil), user))
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `value="family, summer-party"`)
+
+	// the tag page lists the galleries and the images with the tag
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/tags/Cake", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), "/a.jpg")
+	assert.NotContains(t, w.Body.String(), "/b.jpg")
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/tags/summer-party", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `href="/galleries/`+gallery.ID.String()+`"`)
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/galleries/"+gallery.ID.String(), nil))
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `href="/tags/dance"`)
+
+	// the unlisted galleries are listed only for their owner
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, postForm("/galleries/"+gallery.ID.String()+"/edit", url.Values{
+		"title": {"Wedding"},
+		"tags":  {"Family, #Summer Party"},
+	}, user))
+	require.Equal(t, http.StatusFound, w.Code)
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/tags/cake", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.NotContains(t, w.Body.String(), "/a.jpg")
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/tags/summer-party", nil))
+	assert.NotContains(t, w.Body.String(), `href="/galleries/`+gallery.ID.String()+`"`)
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, withUser(httptest.NewRequest(http.MethodGet, "/tags/summer-party", nil), user))
+	assert.Contains(t, w.Body.String(), `href="/galleries/`+gallery.ID.String()+`"`)
+
+	// the tags are checked
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, postForm("/galleries/"+gallery.ID.String()+"/images/tags", url.Values{
+		"imageIDs": {ids[2]},
+		"tags":     {"not/valid"},
+		"action":   {"add"},
+	}, user))
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), model.ErrTagInvalid.PublicErrMsg())
+}
+
+func TestDeleteGallery(t *testing.T) {
+	service := newMemoryService()
+	user := createUser(t, service, "aop4ever@gmail.com")
+	gallery := createGallery(t, service, user, "Wedding")
+	r := newGalleryController(service)
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, postForm("/galleries/"+gallery.ID.String()+"/delete", nil, user))
+	assert.Equal(t, http.StatusFound, w.Code)
+
+	_, err := service.GalleryService.FindByID(gallery.ID.String())
+	assert.Equal(t, model.ErrNotFound, err)
+}
+
+func TestListGalleries(t *testing.T) {
+	service := newMemoryService()
+	user := createUser(t, service, "aop4ever@gmail.com")
+	other := createUser(t, service, "other@gmail.com")
+	for _, title := range []string{"Banana", "Apple", "Cherry"} {
+		createGallery(t, service, user, title)
+	}
+	createGallery(t, service, other, "Avocado")
+	r := newGalleryController(service)
+
+	// the pages follow the next links until the last one
+	titles := []string{}
+	target := "/galleries?sort=title&limit=2"
+	for target != "" {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, withUser(httptest.NewRequest(http.MethodGet, target, nil), user))
+		require.Equal(t, http.StatusOK, w.Code)
+		body := w.Body.String()
+		for _, title := range []string{"Apple", "Banana", "Cherry"} {
+			if strings.Contains(body, title) {
+				titles = append(titles, title)
+			}
+		}
+		assert.NotContains(t, body, "Avocado")
+
+		target = ""
+		if i := strings.Index(body, `data-load-more`); i >= 0 {
+			start := strings.LastIndex(body[:i], `href="`) + len(`href="`)
+			target = strings.ReplaceAll(body[start:strings.Index(body[start:], `"`)+start], "&amp;", "&")
+		}
+	}
+	assert.Equal(t, []string{"Apple", "Banana", "Cherry"}, titles)
+
+	// the filters
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, withUser(httptest.NewRequest(http.MethodGet, "/galleries?q=an", nil), user))
+	assert.Contains(t, w.Body.String(), "Banana")
+	assert.NotContains(t, w.Body.String(), "Apple")
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, withUser(httptest.NewRequest(http.MethodGet, "/galleries?sort=views", nil), user))
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), model.ErrGallerySortInvalid.PublicErrMsg())
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, withUser(httptest.NewRequest(http.MethodGet, "/galleries?order=up", nil), user))
+	assert.Contains(t, w.Body.String(), "order param is not valid")
+}
+
+func TestViewGalleryImagePages(t *testing.T) {
+	service := newMemoryService()
+	user := createUser(t, service, "aop4ever@gmail.com")
+	gallery := createGallery(t, service, user, "Wedding")
+	gallery.SetPublic(true)
+	require.NoError(t, service.GalleryService.Update(gallery))
+	for i := 0; i <= model.DefaultImagePageLimit; i++ {
+		name := fmt.Sprintf("%03d.jpg", i)
+		_, err := service.ImageService.CreateImage(io.NopCloser(strings.NewReader(name)), gallery.ID, name)
+		require.NoError(t, err)
+	}
+	r := newGalleryController(service)
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/galleries/"+gallery.ID.String(), nil))
+	require.Equal(t, http.StatusOK, w.Code)
+	body := w.Body.String()
+	assert.Contains(t, body, "/000.jpg")
+	assert.NotContains(t, body, fmt.Sprintf("/%03d.jpg", model.DefaultImagePageLimit))
+	assert.NotContains(t, body, "First page")
+
+	start := strings.Index(body, "?images=") + len("?images=")
+	require.Greater(t, start, len("?images="))
+	cursor := body[start : strings.Index(body[start:], `"`)+start]
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/galleries/"+gallery.ID.String()+"?images="+cursor, nil))
+	require.Equal(t, http.StatusOK, w.Code)
+	body = w.Body.String()
+	assert.Contains(t, body, fmt.Sprintf("/%03d.jpg", model.DefaultImagePageLimit))
+	assert.NotContains(t, body, "/000.jpg")
+	assert.Contains(t, body, "First page")
+	assert.NotContains(t, body, "Next page")
+}
+
+func TestViewImage(t *testing.T) {
+	service := newMemoryService()
+	user := createUser(t, service, "aop4ever@gmail.com")
+	gallery := createGallery(t, service, user, "Wedding")
+	gallery.SetPublic(true)
+	require.NoError(t, service.GalleryService.Update(gallery))
+	for _, name := range []string{"a.jpg", "b.jpg", "c.jpg"} {
+		_, err := service.ImageService.CreateImage(io.NopCloser(strings.NewReader(name)), gallery.ID, name)
+		require.NoError(t, err)
+	}
+	images, err := service.ImageService.GetImagesByGalleryID(gallery.ID)
+	require.NoError(t, err)
+	r := newGalleryController(service)
+	imagePath := func(image model.Image) string {
+		return "/galleries/" + gallery.ID.String() + "/images/" + image.ID.String()
+	}
+
+	// the gallery links to the image pages
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/galleries/"+gallery.ID.String(), nil))
+	assert.Contains(t, w.Body.String(), `href="`+imagePath(images[1])+`"`)
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, imagePath(images[1]), nil))
+	require.Equal(t, http.StatusOK, w.Code)
+	body := w.Body.String()
+	assert.Contains(t, body, `src="`+images[1].Path()+`"`)
+	assert.Contains(t, body, `href="`+imagePath(images[0])+`" rel="prev"`)
+	assert.Contains(t, body, `href="`+imagePath(images[2])+`" rel="next"`)
+	assert.Contains(t, body, `<link rel="prefetch" href="`+images[2].Path()+`">`)
+	assert.NotContains(t, body, "data-playing")
+
+	// the first image has no previous image
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, imagePath(images[0]), nil))
+	assert.NotContains(t, w.Body.String(), `rel="prev"`)
+
+	// the slideshow is deep linked with its interval
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, imagePath(images[0])+"?slideshow=7", nil))
+	body = w.Body.String()
+	assert.Contains(t, body, `data-interval="7"`)
+	assert.Contains(t, body, "data-playing")
+	assert.Contains(t, body, `<option value="7" selected>`)
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, imagePath(images[0])+"?slideshow=fast", nil))
+	assert.NotContains(t, w.Body.String(), "data-playing")
+
+	// the images of the other galleries are not found
+	other := createGallery(t, service, user, "Party")
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, withUser(httptest.NewRequest(http.MethodGet, "/galleries/"+other.ID.String()+"/images/"+images[0].ID.String(), nil), user))
+	assert.Equal(t, "/notFound", w.Header().Get("Location"))
+
+	// the images of the unlisted galleries are seen only by the owner
+	image, err := service.ImageService.CreateImage(io.NopCloser(strings.NewReader("d.jpg")), other.ID, "d.jpg")
+	require.NoError(t, err)
+	otherPath := "/galleries/" + other.ID.String() + "/images/" + image.ID.String()
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, withUser(httptest.NewRequest(http.MethodGet, otherPath, nil), user))
+	assert.Equal(t, http.StatusOK, w.Code)
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, otherPath, nil))
+	assert.Equal(t, "/notFound", w.Header().Get("Location"))
+}
+
+// readZip returns the contents of the files of the zip by name
+func readZip(t *testing.T, data []byte) map[string]string {
+	archive, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	require.NoError(t, err)
+	files := map[string]string{}
+	for _, file := range archive.File {
+		reader, err := file.Open()
+		require.NoError(t, err)
+		content, err := io.ReadAll(reader)
+		require.NoError(t, err)
+		files[file.Name] = string(content)
+	}
+	return files
+}
+
+func TestDownloadImages(t *testing.T) {
+	service := newMemoryService()
+	owner := createUser(t, service, "owner@gmail.com")
+	other := createUser(t, service, "other@gmail.com")
+	gallery := createGallery(t, service, owner, "Our Wedding!")
+	for _, name := range []string{"a.jpg", "b.jpg", "c.jpg"} {
+		_, err := service.ImageService.CreateImage(io.NopCloser(strings.NewReader("content of "+name)), gallery.ID, name)
+		require.NoError(t, err)
+	}
+	images, err := service.ImageService.GetImagesByGalleryID(gallery.ID)
+	require.NoError(t, err)
+	images[1].Caption = "the \"cake\", at last"
+	require.NoError(t, service.ImageService.UpdateImages(gallery.ID, images[1:2]))
+	r := newGalleryController(service)
+	downloadPath := "/galleries/" + gallery.ID.String() + "/download"
+
+	// the owner downloads all the images and the manifest
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, withUser(httptest.NewRequest(http.MethodGet, downloadPath, nil), owner))
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "application/zip", w.Header().Get("Content-Type"))
+	assert.Equal(t, `attachment; filename=our-wedding.zip`, w.Header().Get("Content-Disposition"))
+	files := readZip(t, w.Body.Bytes())
+	assert.Len(t, files, 4)
+	assert.Equal(t, "content of b.jpg", files["our-wedding/b.jpg"])
+	assert.Contains(t, files["captions.csv"], `our-wedding/b.jpg,,"the ""cake"", at last",,`)
+
+	// the selected images
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, withUser(httptest.NewRequest(http.MethodGet, downloadPath+"?images="+images[2].ID.String()+"&images="+images[0].ID.String(), nil), owner))
+	files = readZip(t, w.Body.Bytes())
+	assert.Len(t, files, 3)
+	assert.Contains(t, files, "our-wedding/a.jpg")
+	assert.Contains(t, files, "our-wedding/c.jpg")
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, withUser(httptest.NewRequest(http.MethodGet, downloadPath+"?images=nope", nil), owner))
+	assert.Equal(t, http.StatusFound, w.Code)
+	assert.Equal(t, "/galleries/"+gallery.ID.String(), w.Header().Get("Location"))
+
+	// the other users can download only the public galleries
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, withUser(httptest.NewRequest(http.MethodGet, downloadPath, nil), other))
+	assert.Equal(t, "/notFound", w.Header().Get("Location"))
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/galleries/"+gallery.ID.String(), nil))
+	assert.NotContains(t, w.Body.String(), "Download all")
+
+	gallery.SetPublic(true)
+	require.NoError(t, service.GalleryService.Update(gallery))
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, downloadPath, nil))
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Len(t, readZip(t, w.Body.Bytes()), 4)
+
+	// the zip stops when the request is canceled
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, downloadPath, nil).WithContext(ctx))
+	_, err = zip.NewReader(bytes.NewReader(w.Body.Bytes()), int64(w.Body.Len()))
+	assert.Error(t, err)
+}
@@ -0,0 +1,179 @@
+package controllers
+
+import (
+	"io"
+	"log"
+	"net/http"
+	"os"
+
+	"github.com/abanoub-fathy/bebo-gallery/config"
+	"github.com/abanoub-fathy/bebo-gallery/model"
+	"github.com/abanoub-fathy/bebo-gallery/pkg/context"
+	"github.com/abanoub-fathy/bebo-gallery/pkg/zipimport"
+	"github.com/abanoub-fathy/bebo-gallery/views"
+	"github.com/gorilla/mux"
+	uuid "github.com/satori/go.uuid"
+)
+
+const (
+	// importWorkers is the number of the imports
+	// that run at the same time
+	importWorkers = 2
+
+	// importMaxRatio is the max compression ratio of the images.
+	// the images are compressed already so the higher ratios
+	// are the zip bombs
+	importMaxRatio = 100
+)
+
+// newImporter returns the importer of the zip archives
+func newImporter(limits config.Limits) *zipimport.Importer {
+	return zipimport.NewImporter(zipimport.Limits{
+		MaxFiles:      limits.MaxImportFiles,
+		MaxFileBytes:  limits.MaxUploadBytes,
+		MaxTotalBytes: limits.MaxImportUnpackedBytes,
+		MaxRatio:      importMaxRatio,
+	}, importWorkers)
+}
+
+// importPage is the data of the progress page of an import
+type importPage struct {
+	Gallery  *model.Gallery
+	Progress zipimport.Progress
+}
+
+// [POST] /galleries/{galleryID}/import
+//
+// the zip archive is saved to a temp file and its images are
+// added to the gallery in the background. the user is sent to
+// the progress page of the import
+func (g *Gallery) ImportImages(w http.ResponseWriter, r *http.Request) {
+	gallery, err := g.GalleryService.FindByID(mux.Vars(r)["galleryID"])
+	if err != nil {
+		http.Redirect(w, r, "/notFound", http.StatusPermanentRedirect)
+		return
+	}
+
+	// check that the user own the gallery
+	user := context.UserValue(r.Context())
+	if !uuid.Equal(user.ID, gallery.UserID) {
+		http.Redirect(w, r, "/notFound", http.StatusPermanentRedirect)
+		return
+	}
+
+	params := views.Params{
+		Data: gallery,
+	}
+
+	name, err := saveArchive(w, r, g.limits)
+	if err == errInvalidParam("archive") {
+		params.SetAlertWithErrMsg("Choose the zip archive to import")
+		g.EditGalleryView.Render(w, r, params)
+		return
+	}
+	if err != nil {
+		params.SetAlert(err)
+		g.EditGalleryView.Render(w, r, params)
+		return
+	}
+
+	images, err := g.ImageService.GetImagesByGalleryID(gallery.ID)
+	if err != nil {
+		os.Remove(name)
+		params.SetAlert(err)
+		g.EditGalleryView.Render(w, r, params)
+		return
+	}
+	existing := map[string]bool{}
+	for _, image := range images {
+		existing[image.FileName] = true
+	}
+
+	job, err := g.importer.Start(name, user.ID.String(), gallery.ID.String(), g.importImage(gallery.ID, existing))
+	switch err {
+	case nil:
+	case zipimport.ErrNotZip, zipimport.ErrTooManyFiles, zipimport.ErrTooLarge:
+		params.SetAlertWithErrMsg(err.Error())
+		g.EditGalleryView.Render(w, r, params)
+		return
+	default:
+		params.SetAlert(err)
+		g.EditGalleryView.Render(w, r, params)
+		return
+	}
+
+	http.Redirect(w, r, "/galleries/"+gallery.ID.String()+"/imports/"+job.ID, http.StatusFound)
+}
+
+// [GET] /galleries/{galleryID}/imports/{jobID}
+//
+// the page reloads itself until the import is done. only the
+// user who started the import can see it
+func (g *Gallery) ImportProgress(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	user := context.UserValue(r.Context())
+
+	job, found := g.importer.Find(vars["jobID"])
+	if !found || job.Owner != user.ID.String() || job.Target != vars["galleryID"] {
+		http.Redirect(w, r, "/notFound", http.StatusPermanentRedirect)
+		return
+	}
+	gallery, err := g.GalleryService.FindByID(job.Target)
+	if err != nil {
+		http.Redirect(w, r, "/notFound", http.StatusPermanentRedirect)
+		return
+	}
+
+	g.ImportView.Render(w, r, views.Params{
+		Data: importPage{Gallery: gallery, Progress: job.Progress()},
+	})
+}
+
+// importImage returns the func that adds the files of the archive
+// to the gallery. the image service replaces a file only when it
+// is copied whole so the existing images are never cut. the file
+// of a new image is removed if its record is not added
+func (g *Gallery) importImage(galleryID uuid.UUID, existing map[string]bool) zipimport.ImportFunc {
+	return func(name string, r io.Reader) error {
+		_, err := g.ImageService.CreateImage(io.NopCloser(r), galleryID, name)
+		if err == nil {
+			return nil
+		}
+
+		log.Println("could not import the image", galleryID, name, err)
+		if !existing[name] {
+			g.ImageService.DeleteImage(&model.Image{GalleryID: galleryID, FileName: name})
+		}
+		return err
+	}
+}
+
+// saveArchive copies the archive file of the multipart form to a
+// temp file and returns its name. the zip is read from its end
+// so it can not be unpacked while it is uploaded
+func saveArchive(w http.ResponseWriter, r *http.Request, limits config.Limits) (string, error) {
+	r.Body = http.MaxBytesReader(w, r.Body, limits.MaxImportBytes)
+	if err := r.ParseMultipartForm(limits.MaxFormMemory); err != nil {
+		return "", err
+	}
+
+	file, _, err := r.FormFile("archive")
+	if err != nil {
+		return "", errInvalidParam("archive")
+	}
+	defer file.Close()
+
+	archive, err := os.CreateTemp("", "bebo-import-*.zip")
+	if err != nil {
+		return "", err
+	}
+	_, err = io.Copy(archive, file)
+	if closeErr := archive.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(archive.Name())
+		return "", err
+	}
+	return archive.Name(), nil
+}
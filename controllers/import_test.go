@@ -0,0 +1,122 @@
+package controllers_test
+
+import (
+	"archive/zip"
+	"bytes"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/abanoub-fathy/bebo-gallery/model"
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// importRequest returns the upload of the archive to the gallery
+func importRequest(t *testing.T, gallery *model.Gallery, user *model.User, archive []byte) *http.Request {
+	body := &bytes.Buffer{}
+	form := multipart.NewWriter(body)
+	if archive != nil {
+		part, err := form.CreateFormFile("archive", "photos.zip")
+		require.NoError(t, err)
+		part.Write(archive)
+	}
+	require.NoError(t, form.Close())
+
+	req := httptest.NewRequest(http.MethodPost, "/galleries/"+gallery.ID.String()+"/import", body)
+	req.Header.Set("Content-Type", form.FormDataContentType())
+	return withUser(req, user)
+}
+
+// waitForImport opens the progress page until the import is done
+func waitForImport(t *testing.T, r *mux.Router, progressURL string, user *model.User) string {
+	for i := 0; i < 100; i++ {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, withUser(httptest.NewRequest(http.MethodGet, progressURL, nil), user))
+		require.Equal(t, http.StatusOK, w.Code)
+		if strings.Contains(w.Body.String(), "The import is done.") {
+			return w.Body.String()
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	t.Fatal("the import did not finish")
+	return ""
+}
+
+func TestImportImages(t *testing.T) {
+	service := newMemoryService()
+	user := createUser(t, service, "aop4ever@gmail.com")
+	other := createUser(t, service, "other@gmail.com")
+	gallery := createGallery(t, service, user, "Wedding")
+	r := newGalleryController(service)
+
+	var archive bytes.Buffer
+	zw := zip.NewWriter(&archive)
+	for _, file := range []struct{ name, body string }{
+		{"wedding/first.jpg", "first image"},
+		{"wedding/second.png", "second image"},
+		{"../escape.jpg", "evil"},
+		{"wedding/notes.txt", "notes"},
+	} {
+		entry, err := zw.CreateHeader(&zip.FileHeader{Name: file.name, Method: zip.Store})
+		require.NoError(t, err)
+		io.WriteString(entry, file.body)
+	}
+	require.NoError(t, zw.Close())
+
+	// only the owner can import
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, importRequest(t, gallery, other, archive.Bytes()))
+	assert.Equal(t, "/notFound", w.Header().Get("Location"))
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, importRequest(t, gallery, user, archive.Bytes()))
+	require.Equal(t, http.StatusFound, w.Code)
+	progressURL := w.Header().Get("Location")
+	require.True(t, strings.HasPrefix(progressURL, "/galleries/"+gallery.ID.String()+"/imports/"), progressURL)
+
+	page := waitForImport(t, r, progressURL, user)
+	assert.Contains(t, page, "4 of 4 files checked: 2 accepted and 2 rejected.")
+	assert.Contains(t, page, "<td>../escape.jpg</td><td>the path is outside of the archive</td>")
+	assert.Contains(t, page, "<td>wedding/notes.txt</td><td>it is not an image</td>")
+	assert.NotContains(t, page, `http-equiv="refresh"`)
+
+	images, err := service.ImageService.GetImagesByGalleryID(gallery.ID)
+	require.NoError(t, err)
+	require.Equal(t, []string{"first.jpg", "second.png"}, []string{images[0].FileName, images[1].FileName})
+	file, err := service.ImageService.Open(&images[0])
+	require.NoError(t, err)
+	body, _ := io.ReadAll(file)
+	file.Close()
+	assert.Equal(t, "first image", string(body))
+
+	// the progress is seen only by the user who started it
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, withUser(httptest.NewRequest(http.MethodGet, progressURL, nil), other))
+	assert.Equal(t, "/notFound", w.Header().Get("Location"))
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, withUser(httptest.NewRequest(http.MethodGet, "/galleries/"+gallery.ID.String()+"/imports/unknown", nil), user))
+	assert.Equal(t, "/notFound", w.Header().Get("Location"))
+}
+
+func TestImportImagesRejectsArchive(t *testing.T) {
+	service := newMemoryService()
+	user := createUser(t, service, "aop4ever@gmail.com")
+	gallery := createGallery(t, service, user, "Wedding")
+	r := newGalleryController(service)
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, importRequest(t, gallery, user, []byte("not a zip")))
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), "the file is not a zip archive")
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, importRequest(t, gallery, user, nil))
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), "Choose the zip archive to import")
+}
@@ -0,0 +1,97 @@
+package controllers
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/abanoub-fathy/bebo-gallery/pkg/ratelimit"
+	"github.com/abanoub-fathy/bebo-gallery/views"
+)
+
+// the actions throttled by the loginGuard. every action
+// has its own failures so asking for a reset password
+// email does not lock the login of the account
+const (
+	guardActionLogin          = "login"
+	guardActionForgetPassword = "forget_password"
+	guardActionResetPassword  = "reset_password"
+)
+
+// loginGuard throttles the failed attempts of the login, the
+// forget password and the reset password forms per account
+// and per ip. the attempts are delayed more after every
+// failure until the account or the ip is locked for a while
+type loginGuard struct {
+	accounts *ratelimit.Backoff
+	ips      *ratelimit.Backoff
+}
+
+func newLoginGuard() *loginGuard {
+	return &loginGuard{
+		accounts: ratelimit.NewBackoff(3, time.Second, time.Minute, 10, 15*time.Minute, time.Hour),
+		ips:      ratelimit.NewBackoff(20, time.Second, time.Minute, 100, time.Hour, time.Hour),
+	}
+}
+
+// reserve checks the attempt and records it as a failure at once
+// so the attempts sent at the same time can not all pass before
+// their failures are recorded. it returns how long the attempt
+// has to wait and nothing is recorded if it is not 0. locked is
+// true if the failure locked the account of the email. the email
+// can be empty if the attempt is not of an account
+func (g *loginGuard) reserve(r *http.Request, action, email string) (wait time.Duration, locked bool) {
+	ipKey := action + ":" + ClientIP(r)
+	if wait, _ := g.ips.Reserve(ipKey); wait > 0 {
+		return wait, false
+	}
+	if email == "" {
+		return 0, false
+	}
+
+	wait, locked = g.accounts.Reserve(action + ":" + normalizeEmail(email))
+	if wait > 0 {
+		// the attempt is not made so it is not a failure of the ip
+		g.ips.Forgive(ipKey)
+	}
+	return wait, locked
+}
+
+// forgive removes the failure recorded by reserve
+// for an attempt that failed for another reason
+func (g *loginGuard) forgive(r *http.Request, action, email string) {
+	g.ips.Forgive(action + ":" + ClientIP(r))
+	if email != "" {
+		g.accounts.Forgive(action + ":" + normalizeEmail(email))
+	}
+}
+
+// succeed removes the failure recorded by reserve and forgets the
+// failures of the account. the other failures of the ip are kept
+// so one valid account can not reset them
+func (g *loginGuard) succeed(r *http.Request, action, email string) {
+	g.ips.Forgive(action + ":" + ClientIP(r))
+	if email != "" {
+		g.accounts.Reset(action + ":" + normalizeEmail(email))
+	}
+}
+
+// renderThrottled renders the view with the time to wait
+// before the next attempt and the too many requests status
+func renderThrottled(w http.ResponseWriter, r *http.Request, view *views.View, params views.Params, wait time.Duration) {
+	seconds := int(math.Ceil(wait.Seconds()))
+	params.SetAlertWithErrMsg(fmt.Sprintf("Too many attempts. Please try again in %v", time.Duration(seconds)*time.Second))
+
+	w.Header().Set("Content-Type", "text/html")
+	w.Header().Set("Retry-After", strconv.Itoa(seconds))
+	w.WriteHeader(http.StatusTooManyRequests)
+	view.Render(w, r, params)
+}
+
+// normalizeEmail returns the email as it is stored
+func normalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
@@ -0,0 +1,557 @@
+package controllers
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"log"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/abanoub-fathy/bebo-gallery/model"
+	"github.com/abanoub-fathy/bebo-gallery/pkg/context"
+	"github.com/abanoub-fathy/bebo-gallery/pkg/oidc"
+	"github.com/abanoub-fathy/bebo-gallery/utils"
+	"github.com/abanoub-fathy/bebo-gallery/views"
+	"github.com/gorilla/mux"
+	uuid "github.com/satori/go.uuid"
+)
+
+const ViewOAuthAppsEndpoint = "view_oauth_apps"
+
+// the error codes of RFC 6749
+const (
+	oauthErrInvalidRequest          = "invalid_request"
+	oauthErrInvalidClient           = "invalid_client"
+	oauthErrInvalidGrant            = "invalid_grant"
+	oauthErrInvalidScope            = "invalid_scope"
+	oauthErrAccessDenied            = "access_denied"
+	oauthErrUnsupportedGrantType    = "unsupported_grant_type"
+	oauthErrUnsupportedResponseType = "unsupported_response_type"
+	oauthErrServerError             = "server_error"
+)
+
+// OAuth is the OAuth2 authorization server of the third party
+// apps. the apps use the authorization code flow with PKCE to
+// get access tokens of the users for the json api
+type OAuth struct {
+	AppsView    *views.View
+	ConsentView *views.View
+	Service     *model.Service
+	router      *mux.Router
+}
+
+// NewOAuth return a pointer to OAuth type which can be used
+// as a receiver to call the OAuth handler functions
+func NewOAuth(service *model.Service, muxRouter *mux.Router) *OAuth {
+	return &OAuth{
+		AppsView:    views.NewView("base", "oauth/apps"),
+		ConsentView: views.NewView("base", "oauth/consent"),
+		Service:     service,
+		router:      muxRouter,
+	}
+}
+
+// appsData is the data of the apps page
+type appsData struct {
+	Apps []*model.OAuthClient
+
+	// NewApp is the app just registered. it is shown
+	// only once because only the hash of its secret is stored
+	NewApp *model.OAuthClient
+
+	Form appForm
+}
+
+type appForm struct {
+	Name string `schema:"name"`
+	// RedirectURIs are separated by new lines
+	RedirectURIs string `schema:"redirectURIs"`
+	// Confidential apps run on a server and can keep a secret
+	Confidential bool `schema:"confidential"`
+}
+
+// [GET] /oauth/apps
+func (o *OAuth) ShowAppsPage(w http.ResponseWriter, r *http.Request) {
+	o.renderApps(w, r, &appsData{}, nil)
+}
+
+// [POST] /oauth/apps
+func (o *OAuth) CreateApp(w http.ResponseWriter, r *http.Request) {
+	data := &appsData{}
+
+	// Parse the form
+	if err := utils.ParseForm(r, &data.Form); err != nil {
+		o.renderApps(w, r, data, err)
+		return
+	}
+
+	// get user from ctx
+	user := context.UserValue(r.Context())
+
+	app := &model.OAuthClient{
+		UserID:       user.ID,
+		Name:         data.Form.Name,
+		RedirectURIs: data.Form.RedirectURIs,
+		Confidential: data.Form.Confidential,
+	}
+	if err := o.Service.OAuthService.CreateClient(app); err != nil {
+		o.renderApps(w, r, data, err)
+		return
+	}
+
+	data.NewApp = app
+	data.Form = appForm{}
+	o.renderApps(w, r, data, nil)
+}
+
+// [POST] /oauth/apps/{appID}/delete
+//
+// deleting the app revokes all the tokens issued to it
+func (o *OAuth) DeleteApp(w http.ResponseWriter, r *http.Request) {
+	// get user from ctx
+	user := context.UserValue(r.Context())
+
+	appID := uuid.FromStringOrNil(mux.Vars(r)["appID"])
+	if err := o.Service.OAuthService.DeleteClient(user.ID, appID); err != nil {
+		o.renderApps(w, r, &appsData{}, err)
+		return
+	}
+
+	url, err := o.router.Get(ViewOAuthAppsEndpoint).URL()
+	if err != nil {
+		http.Redirect(w, r, "/", http.StatusInternalServerError)
+		return
+	}
+	views.RedirectWithAlert(w, r, url.String(), http.StatusFound, views.Alert{
+		Level:   views.AlertLevelSuccess,
+		Message: "the app is deleted",
+	})
+}
+
+// renderApps renders the apps page with the apps of the user
+// and the alert of err if it is not nil
+func (o *OAuth) renderApps(w http.ResponseWriter, r *http.Request, data *appsData, err error) {
+	params := views.Params{
+		Data: data,
+	}
+	if err != nil {
+		params.SetAlert(err)
+	}
+
+	// get user from ctx
+	user := context.UserValue(r.Context())
+
+	apps, findErr := o.Service.OAuthService.FindClientsByUserID(user.ID)
+	if findErr != nil {
+		params.SetAlert(findErr)
+	}
+	data.Apps = apps
+
+	o.AppsView.Render(w, r, params)
+}
+
+// authorizeRequest is the request of the app
+// to access the account of the user
+type authorizeRequest struct {
+	ResponseType        string `schema:"response_type"`
+	ClientID            string `schema:"client_id"`
+	RedirectURI         string `schema:"redirect_uri"`
+	Scope               string `schema:"scope"`
+	State               string `schema:"state"`
+	CodeChallenge       string `schema:"code_challenge"`
+	CodeChallengeMethod string `schema:"code_challenge_method"`
+
+	// Approve is set by the consent form
+	Approve string `schema:"approve"`
+}
+
+// consentData is the data of the consent page
+type consentData struct {
+	App     *model.OAuthClient
+	Request authorizeRequest
+
+	// CanWrite tells if the app asks for the write scope
+	CanWrite bool
+}
+
+// [GET] /oauth/authorize
+//
+// the user is asked to approve or deny the request of the app
+func (o *OAuth) Authorize(w http.ResponseWriter, r *http.Request) {
+	req := authorizeRequest{}
+	if err := utils.ParseURLParams(r, &req); err != nil {
+		o.renderConsentError(w, r, "the authorization request is not valid")
+		return
+	}
+
+	app, scope, ok := o.validateAuthorizeRequest(w, r, &req)
+	if !ok {
+		return
+	}
+
+	o.ConsentView.Render(w, r, views.Params{
+		Data: &consentData{
+			App:      app,
+			Request:  req,
+			CanWrite: scope == model.ScopeWrite,
+		},
+	})
+}
+
+// [POST] /oauth/authorize
+//
+// the consent form posts the request back with the decision of
+// the user. the app gets a code it exchanges for the tokens
+func (o *OAuth) Approve(w http.ResponseWriter, r *http.Request) {
+	req := authorizeRequest{}
+	if err := utils.ParseForm(r, &req); err != nil {
+		o.renderConsentError(w, r, "the authorization request is not valid")
+		return
+	}
+
+	app, scope, ok := o.validateAuthorizeRequest(w, r, &req)
+	if !ok {
+		return
+	}
+
+	if req.Approve != "yes" {
+		redirectWithOAuthError(w, r, &req, oauthErrAccessDenied, "the user denied the request")
+		return
+	}
+
+	// get user from ctx
+	user := context.UserValue(r.Context())
+
+	code := &model.OAuthCode{
+		ClientID:      app.ID,
+		UserID:        user.ID,
+		Scope:         scope,
+		RedirectURI:   req.RedirectURI,
+		CodeChallenge: req.CodeChallenge,
+	}
+	if err := o.Service.OAuthService.CreateCode(code); err != nil {
+		log.Println(err)
+		redirectWithOAuthError(w, r, &req, oauthErrServerError, "")
+		return
+	}
+
+	query := url.Values{}
+	query.Set("code", code.Code)
+	if req.State != "" {
+		query.Set("state", req.State)
+	}
+	http.Redirect(w, r, appendQuery(req.RedirectURI, query), http.StatusFound)
+}
+
+// validateAuthorizeRequest returns the app and the scope of the request
+//
+// the errors of the app or the redirect uri are shown to the
+// user because redirecting to an unknown uri is not safe. the
+// other errors are sent to the app at the redirect uri
+func (o *OAuth) validateAuthorizeRequest(w http.ResponseWriter, r *http.Request, req *authorizeRequest) (*model.OAuthClient, string, bool) {
+	app, err := o.Service.OAuthService.FindClientByClientID(req.ClientID)
+	if err != nil {
+		o.renderConsentError(w, r, "the app is not registered")
+		return nil, "", false
+	}
+
+	// the redirect uri is always required so the token
+	// request can be checked against it
+	if !app.AllowsRedirectURI(req.RedirectURI) {
+		o.renderConsentError(w, r, "the redirect uri is not registered for the app")
+		return nil, "", false
+	}
+
+	if req.ResponseType != "code" {
+		redirectWithOAuthError(w, r, req, oauthErrUnsupportedResponseType, "only the code response type is supported")
+		return nil, "", false
+	}
+
+	// every app should use PKCE because the public
+	// apps can not keep a secret
+	if req.CodeChallenge == "" || req.CodeChallengeMethod != "S256" {
+		redirectWithOAuthError(w, r, req, oauthErrInvalidRequest, "a S256 code challenge is required")
+		return nil, "", false
+	}
+
+	scope, err := model.ParseOAuthScope(req.Scope)
+	if err != nil {
+		redirectWithOAuthError(w, r, req, oauthErrInvalidScope, "the scope should be read or write")
+		return nil, "", false
+	}
+
+	return app, scope, true
+}
+
+// renderConsentError renders the consent page with the error only
+func (o *OAuth) renderConsentError(w http.ResponseWriter, r *http.Request, message string) {
+	w.Header().Set("Content-Type", "text/html")
+	w.WriteHeader(http.StatusBadRequest)
+	o.ConsentView.Render(w, r, views.Params{
+		Alert: views.NewAlert(views.AlertLevelError, message),
+	})
+}
+
+// redirectWithOAuthError sends the error to the app at the redirect uri
+func redirectWithOAuthError(w http.ResponseWriter, r *http.Request, req *authorizeRequest, code, description string) {
+	query := url.Values{}
+	query.Set("error", code)
+	if description != "" {
+		query.Set("error_description", description)
+	}
+	if req.State != "" {
+		query.Set("state", req.State)
+	}
+	http.Redirect(w, r, appendQuery(req.RedirectURI, query), http.StatusFound)
+}
+
+// appendQuery adds the query to the query of the uri
+func appendQuery(uri string, query url.Values) string {
+	u, err := url.Parse(uri)
+	if err != nil {
+		return uri
+	}
+	values := u.Query()
+	for key := range query {
+		values.Set(key, query.Get(key))
+	}
+	u.RawQuery = values.Encode()
+	return u.String()
+}
+
+// tokenResponse is the response of the token endpoint
+type tokenResponse struct {
+	AccessToken  string `json:"access_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int    `json:"expires_in"`
+	RefreshToken string `json:"refresh_token"`
+	Scope        string `json:"scope"`
+}
+
+// [POST] /oauth/token
+//
+// the apps exchange the code or the refresh token for new tokens
+func (o *OAuth) Token(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		writeOAuthError(w, http.StatusBadRequest, oauthErrInvalidRequest, "the request body is not valid")
+		return
+	}
+
+	app, ok := o.authenticateApp(w, r)
+	if !ok {
+		return
+	}
+
+	var token *model.AccessToken
+	var err error
+	switch r.PostForm.Get("grant_type") {
+	case "authorization_code":
+		token, err = o.exchangeCode(app, r.PostForm)
+	case "refresh_token":
+		token, err = o.Service.RefreshOAuthToken(app, r.PostForm.Get("refresh_token"))
+	default:
+		writeOAuthError(w, http.StatusBadRequest, oauthErrUnsupportedGrantType, "the grant type should be authorization_code or refresh_token")
+		return
+	}
+
+	switch err {
+	case nil:
+	case model.ErrNotFound, model.ErrInvalidToken, model.ErrAccessTokenExpired, model.ErrUserDisabled:
+		writeOAuthError(w, http.StatusBadRequest, oauthErrInvalidGrant, "the grant is not valid or expired")
+		return
+	default:
+		log.Println(err)
+		writeOAuthError(w, http.StatusInternalServerError, oauthErrServerError, "")
+		return
+	}
+
+	writeOAuthJSON(w, http.StatusOK, tokenResponse{
+		AccessToken:  token.Token,
+		TokenType:    "Bearer",
+		ExpiresIn:    int(time.Until(*token.ExpiresAt).Seconds()),
+		RefreshToken: token.RefreshToken,
+		Scope:        token.Scope,
+	})
+}
+
+// exchangeCode issues the tokens of the code
+// if the app proves it started the flow
+func (o *OAuth) exchangeCode(app *model.OAuthClient, form url.Values) (*model.AccessToken, error) {
+	code, err := o.Service.OAuthService.ConsumeCode(form.Get("code"))
+	if err != nil {
+		return nil, err
+	}
+
+	challenge := oidc.S256Challenge(form.Get("code_verifier"))
+	switch {
+	case !uuid.Equal(code.ClientID, app.ID),
+		code.RedirectURI != form.Get("redirect_uri"),
+		subtle.ConstantTimeCompare([]byte(challenge), []byte(code.CodeChallenge)) != 1:
+		return nil, model.ErrInvalidToken
+	}
+
+	user, err := o.Service.UserService.FindByID(code.UserID.String())
+	if err != nil {
+		return nil, err
+	}
+	if user.Disabled {
+		return nil, model.ErrUserDisabled
+	}
+
+	return o.Service.IssueOAuthToken(app, code.UserID, code.Scope)
+}
+
+// [POST] /oauth/revoke
+//
+// the apps revoke their access or refresh tokens as in RFC 7009.
+// the response is always ok so the apps can not probe the tokens
+func (o *OAuth) Revoke(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		writeOAuthError(w, http.StatusBadRequest, oauthErrInvalidRequest, "the request body is not valid")
+		return
+	}
+
+	app, ok := o.authenticateApp(w, r)
+	if !ok {
+		return
+	}
+
+	if token := o.findAppToken(app, r.PostForm.Get("token")); token != nil {
+		if err := o.Service.AccessTokenService.Revoke(token.UserID, token.ID); err != nil && err != model.ErrNotFound {
+			log.Println(err)
+			writeOAuthError(w, http.StatusServiceUnavailable, oauthErrServerError, "")
+			return
+		}
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// introspectionResponse is the response of the
+// introspection endpoint as in RFC 7662
+type introspectionResponse struct {
+	Active    bool   `json:"active"`
+	Scope     string `json:"scope,omitempty"`
+	ClientID  string `json:"client_id,omitempty"`
+	Subject   string `json:"sub,omitempty"`
+	TokenType string `json:"token_type,omitempty"`
+	ExpiresAt int64  `json:"exp,omitempty"`
+	IssuedAt  int64  `json:"iat,omitempty"`
+}
+
+// [POST] /oauth/introspect
+//
+// the apps can check only their own tokens
+func (o *OAuth) Introspect(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		writeOAuthError(w, http.StatusBadRequest, oauthErrInvalidRequest, "the request body is not valid")
+		return
+	}
+
+	app, ok := o.authenticateApp(w, r)
+	if !ok {
+		return
+	}
+
+	raw := r.PostForm.Get("token")
+	token := o.findAppToken(app, raw)
+	if token == nil {
+		writeOAuthJSON(w, http.StatusOK, introspectionResponse{})
+		return
+	}
+
+	user, err := o.Service.UserService.FindByID(token.UserID.String())
+	if err != nil || user.Disabled {
+		writeOAuthJSON(w, http.StatusOK, introspectionResponse{})
+		return
+	}
+
+	response := introspectionResponse{
+		Active:    true,
+		Scope:     token.Scope,
+		ClientID:  app.ClientID,
+		Subject:   token.UserID.String(),
+		TokenType: "access_token",
+		ExpiresAt: token.ExpiresAt.Unix(),
+		IssuedAt:  token.CreatedAt.Unix(),
+	}
+	if raw == token.RefreshToken {
+		response.TokenType = "refresh_token"
+		response.ExpiresAt = token.CreatedAt.Add(model.RefreshTokenDuration).Unix()
+	}
+	writeOAuthJSON(w, http.StatusOK, response)
+}
+
+// findAppToken returns the token of the access or the refresh
+// token if it is valid and issued to the app. the RefreshToken
+// field is set to raw if it is a refresh token
+func (o *OAuth) findAppToken(app *model.OAuthClient, raw string) *model.AccessToken {
+	token, err := o.Service.AccessTokenService.FindByToken(raw)
+	if err != nil {
+		token, err = o.Service.AccessTokenService.FindByRefreshToken(raw)
+		if err != nil {
+			return nil
+		}
+		token.RefreshToken = raw
+	}
+
+	if token.ClientID == nil || !uuid.Equal(*token.ClientID, app.ID) {
+		return nil
+	}
+	return token
+}
+
+// authenticateApp returns the app of the request. the app sends
+// its id and secret with basic auth or in the form. the public
+// apps send only their id
+func (o *OAuth) authenticateApp(w http.ResponseWriter, r *http.Request) (*model.OAuthClient, bool) {
+	clientID, secret, found := r.BasicAuth()
+	if found {
+		// the credentials are form encoded as in RFC 6749
+		clientID, _ = url.QueryUnescape(clientID)
+		secret, _ = url.QueryUnescape(secret)
+	} else {
+		clientID = r.PostForm.Get("client_id")
+		secret = r.PostForm.Get("client_secret")
+	}
+
+	app, err := o.Service.OAuthService.AuthenticateClient(clientID, secret)
+	switch err {
+	case nil:
+		return app, true
+	case model.ErrOAuthClientInvalid:
+		if found {
+			w.Header().Set("WWW-Authenticate", `Basic realm="oauth"`)
+		}
+		writeOAuthError(w, http.StatusUnauthorized, oauthErrInvalidClient, "the client authentication failed")
+	default:
+		log.Println(err)
+		writeOAuthError(w, http.StatusInternalServerError, oauthErrServerError, "")
+	}
+	return nil, false
+}
+
+// oauthError is the error response of RFC 6749
+type oauthError struct {
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description,omitempty"`
+}
+
+func writeOAuthError(w http.ResponseWriter, status int, code, description string) {
+	writeOAuthJSON(w, status, oauthError{
+		Error:            code,
+		ErrorDescription: description,
+	})
+}
+
+// writeOAuthJSON writes the json response. the responses
+// have tokens so they should never be cached
+func writeOAuthJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Pragma", "no-cache")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Println(err)
+	}
+}
@@ -0,0 +1,358 @@
+package controllers
+
+import (
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/abanoub-fathy/bebo-gallery/config"
+	"github.com/abanoub-fathy/bebo-gallery/model"
+	"github.com/abanoub-fathy/bebo-gallery/pkg/context"
+	"github.com/abanoub-fathy/bebo-gallery/pkg/hash"
+	"github.com/abanoub-fathy/bebo-gallery/pkg/oidc"
+	"github.com/abanoub-fathy/bebo-gallery/pkg/rand"
+	"github.com/abanoub-fathy/bebo-gallery/views"
+	"github.com/gorilla/mux"
+	uuid "github.com/satori/go.uuid"
+)
+
+const (
+	// oidcFlowCookie keeps the state, the nonce and the PKCE
+	// verifier of the login between the redirects
+	oidcFlowCookie = "oidc_flow"
+
+	// oidcFlowDuration is how long the user has to
+	// log in at the provider
+	oidcFlowDuration = 10 * time.Minute
+)
+
+var errInvalidOIDCFlow = errors.New("oidc flow cookie is not valid")
+
+// LoginProvider is an OpenID Connect provider
+// shown on the login and the account pages
+type LoginProvider struct {
+	Name        string
+	DisplayName string
+}
+
+type oidcProvider struct {
+	LoginProvider
+	client *oidc.Client
+}
+
+type OIDC struct {
+	Service      *model.Service
+	providers    []*oidcProvider
+	hasher       *hash.Hasher
+	secureCookie bool
+	router       *mux.Router
+}
+
+// NewOIDC return a pointer to OIDC type which can be used
+// as a receiver to call the OpenID Connect login handlers
+// of the providers in cfg
+func NewOIDC(service *model.Service, cfg *config.Config, muxRouter *mux.Router) *OIDC {
+	o := &OIDC{
+		Service:      service,
+		hasher:       hash.NewHasher(cfg.Security.HashSecretKey),
+		secureCookie: cfg.IsProductionEnv,
+		router:       muxRouter,
+	}
+
+	for _, provider := range cfg.OIDC {
+		scopes := provider.Scopes
+		if len(scopes) == 0 {
+			scopes = []string{"email", "profile"}
+		}
+		displayName := provider.DisplayName
+		if displayName == "" {
+			displayName = provider.Name
+		}
+
+		o.providers = append(o.providers, &oidcProvider{
+			LoginProvider: LoginProvider{
+				Name:        provider.Name,
+				DisplayName: displayName,
+			},
+			client: oidc.NewClient(oidc.Config{
+				Issuer:       provider.Issuer,
+				ClientID:     provider.ClientID,
+				ClientSecret: provider.ClientSecret,
+				RedirectURL:  strings.TrimSuffix(cfg.Mail.BaseURL, "/") + "/auth/" + provider.Name + "/callback",
+				Scopes:       scopes,
+			}),
+		})
+	}
+
+	return o
+}
+
+// LoginProviders returns the configured providers
+func (o *OIDC) LoginProviders() []LoginProvider {
+	providers := make([]LoginProvider, len(o.providers))
+	for i, provider := range o.providers {
+		providers[i] = provider.LoginProvider
+	}
+	return providers
+}
+
+func (o *OIDC) provider(name string) *oidcProvider {
+	for _, provider := range o.providers {
+		if provider.Name == name {
+			return provider
+		}
+	}
+	return nil
+}
+
+// oidcFlow is kept in the signed flow cookie
+type oidcFlow struct {
+	Provider  string    `json:"provider"`
+	State     string    `json:"state"`
+	Nonce     string    `json:"nonce"`
+	Verifier  string    `json:"verifier"`
+	ExpiresAt time.Time `json:"expires_at"`
+
+	// ConnectUserID is set when a logged in user connects
+	// the provider to the account instead of logging in
+	ConnectUserID uuid.UUID `json:"connect_user_id"`
+}
+
+// [GET] /auth/{provider}/login
+//
+// if the user is logged in the provider account is
+// connected to the user instead
+func (o *OIDC) Login(w http.ResponseWriter, r *http.Request) {
+	provider := o.provider(mux.Vars(r)["provider"])
+	if provider == nil {
+		http.Redirect(w, r, "/notFound", http.StatusFound)
+		return
+	}
+
+	flow := oidcFlow{
+		Provider:  provider.Name,
+		ExpiresAt: time.Now().Add(oidcFlowDuration),
+	}
+	if user := context.UserValue(r.Context()); user != nil {
+		flow.ConnectUserID = user.ID
+	}
+
+	var err error
+	if flow.State, err = rand.RandString(32); err != nil {
+		o.fail(w, r, provider, err)
+		return
+	}
+	if flow.Nonce, err = rand.RandString(32); err != nil {
+		o.fail(w, r, provider, err)
+		return
+	}
+	if flow.Verifier, err = oidc.NewVerifier(); err != nil {
+		o.fail(w, r, provider, err)
+		return
+	}
+
+	authURL, err := provider.client.AuthCodeURL(r.Context(), flow.State, flow.Nonce, oidc.S256Challenge(flow.Verifier))
+	if err != nil {
+		o.fail(w, r, provider, err)
+		return
+	}
+
+	if err := o.setFlowCookie(w, flow); err != nil {
+		o.fail(w, r, provider, err)
+		return
+	}
+	http.Redirect(w, r, authURL, http.StatusFound)
+}
+
+// [GET] /auth/{provider}/callback
+func (o *OIDC) Callback(w http.ResponseWriter, r *http.Request) {
+	provider := o.provider(mux.Vars(r)["provider"])
+	if provider == nil {
+		http.Redirect(w, r, "/notFound", http.StatusFound)
+		return
+	}
+
+	// the flow can be used only once
+	flow, err := o.flowCookie(r)
+	o.clearFlowCookie(w)
+	if err != nil {
+		o.fail(w, r, provider, err)
+		return
+	}
+
+	query := r.URL.Query()
+	switch {
+	case flow.Provider != provider.Name || time.Now().After(flow.ExpiresAt):
+		o.fail(w, r, provider, errInvalidOIDCFlow)
+		return
+	case subtle.ConstantTimeCompare([]byte(query.Get("state")), []byte(flow.State)) != 1:
+		o.fail(w, r, provider, errors.New("oidc state does not match"))
+		return
+	case query.Get("error") != "":
+		o.fail(w, r, provider, errors.New("oidc provider error: "+query.Get("error")+" "+query.Get("error_description")))
+		return
+	}
+
+	token, err := provider.client.Exchange(r.Context(), query.Get("code"), flow.Verifier)
+	if err != nil {
+		o.fail(w, r, provider, err)
+		return
+	}
+	claims, err := provider.client.Verify(r.Context(), token.IDToken, flow.Nonce)
+	if err != nil {
+		o.fail(w, r, provider, err)
+		return
+	}
+
+	account := model.ExternalAccount{
+		Provider:      provider.Name,
+		Subject:       claims.Subject,
+		Email:         claims.Email,
+		EmailVerified: claims.EmailVerified,
+		FirstName:     claims.GivenName,
+		LastName:      claims.FamilyName,
+	}
+	if account.FirstName == "" && account.LastName == "" {
+		account.FirstName = claims.Name
+	}
+
+	if !uuid.Equal(flow.ConnectUserID, uuid.Nil) {
+		o.connect(w, r, provider, flow.ConnectUserID, account)
+		return
+	}
+
+	user, err := o.Service.AuthenticateExternalAccount(account)
+	if err != nil {
+		o.fail(w, r, provider, err)
+		return
+	}
+
+	// set remember token to user
+	if err := o.Service.UserService.SaveNewRemeberToken(user); err != nil {
+		o.fail(w, r, provider, err)
+		return
+	}
+
+	// set remeber token in the cookie
+	setRemeberTokenToCookie(w, user, DEFAULT_TOKEN_VALID_DURATION)
+
+	// redirect to galleries page
+	url, err := o.router.Get(ViewGalleriesEndpoint).URL()
+	if err != nil {
+		log.Println(err)
+		http.Redirect(w, r, "/", http.StatusInternalServerError)
+		return
+	}
+	views.RedirectWithAlert(w, r, url.String(), http.StatusFound, *views.NewAlert(views.AlertLevelSuccess, "welcome back"))
+}
+
+// connect links the account to the logged in user
+func (o *OIDC) connect(w http.ResponseWriter, r *http.Request, provider *oidcProvider, userID uuid.UUID, account model.ExternalAccount) {
+	// the user who started the flow should be the one finishing it
+	user := context.UserValue(r.Context())
+	if user == nil || !uuid.Equal(user.ID, userID) {
+		o.fail(w, r, provider, errInvalidOIDCFlow)
+		return
+	}
+
+	if err := o.Service.ConnectExternalAccount(user, account); err != nil {
+		o.fail(w, r, provider, err)
+		return
+	}
+
+	views.RedirectWithAlert(w, r, "/account", http.StatusFound, *views.NewAlert(views.AlertLevelSuccess, provider.DisplayName+" is connected"))
+}
+
+// [POST] /account/identities/{identityID}/disconnect
+func (o *OIDC) Disconnect(w http.ResponseWriter, r *http.Request) {
+	// get user from ctx
+	user := context.UserValue(r.Context())
+
+	alert := *views.NewAlert(views.AlertLevelSuccess, "the provider is disconnected")
+	identityID := uuid.FromStringOrNil(mux.Vars(r)["identityID"])
+	if err := o.Service.IdentityService.Delete(user.ID, identityID); err != nil {
+		params := views.Params{}
+		params.SetAlert(err)
+		alert = *params.Alert
+	}
+
+	views.RedirectWithAlert(w, r, "/account", http.StatusFound, alert)
+}
+
+// fail logs the error and redirects the user to the
+// login page or the account page if the user is logged in
+func (o *OIDC) fail(w http.ResponseWriter, r *http.Request, provider *oidcProvider, err error) {
+	log.Printf("oidc login with %v failed: %v", provider.Name, err)
+
+	message := "could not sign in with " + provider.DisplayName + ". please try again"
+	if pErr, ok := err.(views.PublicError); ok {
+		message = pErr.PublicErrMsg()
+	}
+
+	path := "/login"
+	if context.UserValue(r.Context()) != nil {
+		path = "/account"
+	}
+	views.RedirectWithAlert(w, r, path, http.StatusFound, *views.NewAlert(views.AlertLevelError, message))
+}
+
+// setFlowCookie stores the flow in a cookie signed by the hasher
+func (o *OIDC) setFlowCookie(w http.ResponseWriter, flow oidcFlow) error {
+	content, err := json.Marshal(flow)
+	if err != nil {
+		return err
+	}
+	payload := base64.RawURLEncoding.EncodeToString(content)
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     oidcFlowCookie,
+		Path:     "/auth/",
+		Value:    payload + "." + o.hasher.HashByHMAC(payload),
+		MaxAge:   int(oidcFlowDuration.Seconds()),
+		HttpOnly: true,
+		Secure:   o.secureCookie,
+		// the callback is a top level navigation from
+		// the provider so the lax cookies are sent
+		SameSite: http.SameSiteLaxMode,
+	})
+	return nil
+}
+
+// flowCookie returns the flow of the cookie if its signature is valid
+func (o *OIDC) flowCookie(r *http.Request) (*oidcFlow, error) {
+	cookie, err := r.Cookie(oidcFlowCookie)
+	if err != nil {
+		return nil, errInvalidOIDCFlow
+	}
+
+	payload, signature, found := strings.Cut(cookie.Value, ".")
+	if !found || subtle.ConstantTimeCompare([]byte(signature), []byte(o.hasher.HashByHMAC(payload))) != 1 {
+		return nil, errInvalidOIDCFlow
+	}
+
+	content, err := base64.RawURLEncoding.DecodeString(payload)
+	if err != nil {
+		return nil, errInvalidOIDCFlow
+	}
+	flow := &oidcFlow{}
+	if err := json.Unmarshal(content, flow); err != nil {
+		return nil, errInvalidOIDCFlow
+	}
+	return flow, nil
+}
+
+func (o *OIDC) clearFlowCookie(w http.ResponseWriter) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     oidcFlowCookie,
+		Path:     "/auth/",
+		Value:    "",
+		MaxAge:   -1,
+		HttpOnly: true,
+		Secure:   o.secureCookie,
+	})
+}
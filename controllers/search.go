@@ -0,0 +1,143 @@
+package controllers
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/abanoub-fathy/bebo-gallery/model"
+	"github.com/abanoub-fathy/bebo-gallery/pkg/context"
+	"github.com/abanoub-fathy/bebo-gallery/utils"
+	"github.com/abanoub-fathy/bebo-gallery/views"
+	uuid "github.com/satori/go.uuid"
+)
+
+// searchDateLayout is the layout of the from and to dates
+const searchDateLayout = "2006-01-02"
+
+// Search contains the handlers of the search page
+type Search struct {
+	SearchView    *views.View
+	SearchService model.SearchService
+	ImageService  model.ImageService
+	TagService    model.TagService
+}
+
+// NewSearch return a pointer to Search type which can be used
+// as a receiver to call the handler functions
+func NewSearch(searchService model.SearchService, imageService model.ImageService, tagService model.TagService) *Search {
+	return &Search{
+		SearchView:    views.NewView("base", "gallery/search"),
+		SearchService: searchService,
+		ImageService:  imageService,
+		TagService:    tagService,
+	}
+}
+
+// searchForm is the query of the search page and the search api
+type searchForm struct {
+	Query string `schema:"q"`
+
+	// Owner is "me" or the id of the user
+	// the galleries of every user are searched if it is empty
+	Owner string `schema:"owner"`
+
+	// From and To are the first and the last days
+	// of the results formatted like 2006-01-02
+	From string `schema:"from"`
+	To   string `schema:"to"`
+
+	Limit int `schema:"limit"`
+}
+
+// searchQuery returns the model query of the form. the user
+// is used for the owner "me" and it can be nil
+func (form *searchForm) searchQuery(user *model.User) (*model.SearchQuery, error) {
+	query := &model.SearchQuery{Text: form.Query, Limit: form.Limit}
+	if user != nil {
+		query.ViewerID = user.ID
+	}
+
+	switch form.Owner {
+	case "":
+	case "me":
+		if user == nil {
+			return nil, errInvalidParam("owner")
+		}
+		query.OwnerID = user.ID
+	default:
+		ownerID, err := uuid.FromString(form.Owner)
+		if err != nil {
+			return nil, errInvalidParam("owner")
+		}
+		query.OwnerID = ownerID
+	}
+
+	if form.From != "" {
+		from, err := time.Parse(searchDateLayout, form.From)
+		if err != nil {
+			return nil, errInvalidParam("from")
+		}
+		query.From = from
+	}
+	// the whole last day is included
+	if form.To != "" {
+		to, err := time.Parse(searchDateLayout, form.To)
+		if err != nil {
+			return nil, errInvalidParam("to")
+		}
+		query.To = to.AddDate(0, 0, 1)
+	}
+	return query, nil
+}
+
+// searchPage is the data of the search page
+type searchPage struct {
+	Form      searchForm
+	Searched  bool
+	Galleries []*model.Gallery
+	Images    []model.Image
+}
+
+// [GET] /search
+//
+// the page has only the search form when the query is empty
+func (s *Search) SearchPage(w http.ResponseWriter, r *http.Request) {
+	params := views.Params{}
+	page := searchPage{}
+	params.Data = &page
+
+	if err := utils.ParseURLParams(r, &page.Form); err != nil {
+		params.SetAlert(err)
+		s.SearchView.Render(w, r, params)
+		return
+	}
+	if strings.TrimSpace(page.Form.Query) == "" {
+		s.SearchView.Render(w, r, params)
+		return
+	}
+
+	query, err := page.Form.searchQuery(context.UserValue(r.Context()))
+	if err != nil {
+		params.SetAlertWithErrMsg(err.Error())
+		s.SearchView.Render(w, r, params)
+		return
+	}
+
+	page.Galleries, err = s.SearchService.SearchGalleries(query)
+	if err == nil {
+		page.Images, err = s.SearchService.SearchImages(query)
+	}
+	if err != nil {
+		params.SetAlert(err)
+		s.SearchView.Render(w, r, params)
+		return
+	}
+	page.Searched = true
+
+	loadCovers(s.ImageService, page.Galleries)
+	s.TagService.LoadGalleryTags(page.Galleries...)
+	s.TagService.LoadImageTags(page.Images)
+
+	s.SearchView.Render(w, r, params)
+}
@@ -0,0 +1,84 @@
+package controllers_test
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/abanoub-fathy/bebo-gallery/controllers"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSearch(t *testing.T) {
+	service := newMemoryService()
+	user := createUser(t, service, "aop4ever@gmail.com")
+	other := createUser(t, service, "other@gmail.com")
+	gallery := createGallery(t, service, user, "Wedding")
+	createGallery(t, service, other, "Beach Wedding")
+	_, err := service.ImageService.CreateImage(io.NopCloser(strings.NewReader("cake")), gallery.ID, "cake_cutting.jpg")
+	require.NoError(t, err)
+
+	r := newGalleryController(service)
+	searchController := controllers.NewSearch(service.SearchService, service.ImageService, service.TagService)
+	r.HandleFunc("/search", searchController.SearchPage).Methods("GET")
+
+	// the description is searched
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, postForm("/galleries/"+gallery.ID.String()+"/edit", url.Values{
+		"title":       {"Wedding"},
+		"description": {"the day at the **old church**"},
+		"public":      {"true"},
+	}, user))
+	require.Equal(t, http.StatusFound, w.Code)
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/galleries/"+gallery.ID.String(), nil))
+	assert.Contains(t, w.Body.String(), "<strong>old church</strong>")
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/search?q=church", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `href="/galleries/`+gallery.ID.String()+`"`)
+	assert.Contains(t, w.Body.String(), "No images match the search.")
+
+	// the images are found by their file names
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/search?q=cake", nil))
+	assert.Contains(t, w.Body.String(), "/cake_cutting.jpg")
+
+	// the owner filter
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, withUser(httptest.NewRequest(http.MethodGet, "/search?q=wedding&owner=me", nil), user))
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `href="/galleries/`+gallery.ID.String()+`"`)
+	assert.NotContains(t, w.Body.String(), "Beach Wedding")
+
+	// the unlisted galleries are found only by their owner
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/search?q=wedding", nil))
+	assert.Contains(t, w.Body.String(), `href="/galleries/`+gallery.ID.String()+`"`)
+	assert.NotContains(t, w.Body.String(), "Beach Wedding")
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, withUser(httptest.NewRequest(http.MethodGet, "/search?q=wedding", nil), other))
+	assert.Contains(t, w.Body.String(), "Beach Wedding")
+
+	// the date filters include the whole last day
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/search?q=wedding&from=2000-01-01&to=2000-12-31", nil))
+	assert.Contains(t, w.Body.String(), "No galleries match the search.")
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/search?q=wedding&to=yesterday", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), "to param is not valid")
+
+	// the empty search shows only the form
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/search", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.NotContains(t, w.Body.String(), "No galleries match the search.")
+}
@@ -0,0 +1,121 @@
+package controllers
+
+import (
+	"net/http"
+	"net/url"
+
+	"github.com/abanoub-fathy/bebo-gallery/model"
+	"github.com/abanoub-fathy/bebo-gallery/utils"
+	"github.com/abanoub-fathy/bebo-gallery/views"
+	"github.com/gorilla/mux"
+	uuid "github.com/satori/go.uuid"
+)
+
+// shareParam is the url param of the share link token
+const shareParam = "share"
+
+// sharePage is the data of the share links page
+type sharePage struct {
+	Gallery *model.Gallery
+	Links   []*model.ShareLink
+
+	// NewURL is the url of the link just created. it is
+	// shown only once because only its hash is stored
+	NewURL string
+}
+
+type shareLinkForm struct {
+	// AllowDownload lets the people with the link
+	// download the images of the gallery
+	AllowDownload bool `schema:"allowDownload"`
+}
+
+// [GET] /galleries/{galleryID}/share
+func (g *Gallery) SharePage(w http.ResponseWriter, r *http.Request) {
+	gallery, ok := g.findOwnGallery(w, r)
+	if !ok {
+		return
+	}
+	g.renderSharePage(w, r, &sharePage{Gallery: gallery}, nil)
+}
+
+// [POST] /galleries/{galleryID}/share
+func (g *Gallery) CreateShareLink(w http.ResponseWriter, r *http.Request) {
+	gallery, ok := g.findOwnGallery(w, r)
+	if !ok {
+		return
+	}
+	page := &sharePage{Gallery: gallery}
+
+	var form shareLinkForm
+	if err := utils.ParseForm(r, &form); err != nil {
+		g.renderSharePage(w, r, page, err)
+		return
+	}
+
+	link := &model.ShareLink{GalleryID: gallery.ID, AllowDownload: form.AllowDownload}
+	if err := g.ShareLinkService.Create(link); err != nil {
+		g.renderSharePage(w, r, page, err)
+		return
+	}
+
+	// the link is rendered instead of redirecting
+	// so it is not kept anywhere after this response
+	page.NewURL = shareURL(gallery, link.Token)
+	g.renderSharePage(w, r, page, nil)
+}
+
+// [POST] /galleries/{galleryID}/share/{linkID}/delete
+func (g *Gallery) DeleteShareLink(w http.ResponseWriter, r *http.Request) {
+	gallery, ok := g.findOwnGallery(w, r)
+	if !ok {
+		return
+	}
+
+	linkID := uuid.FromStringOrNil(mux.Vars(r)["linkID"])
+	if err := g.ShareLinkService.Delete(gallery.ID, linkID); err != nil {
+		g.renderSharePage(w, r, &sharePage{Gallery: gallery}, err)
+		return
+	}
+
+	views.RedirectWithAlert(w, r, "/galleries/"+gallery.ID.String()+"/share", http.StatusFound, views.Alert{
+		Level:   views.AlertLevelSuccess,
+		Message: "the link is deleted and it does not work anymore",
+	})
+}
+
+// renderSharePage renders the page with the links of the
+// gallery and the alert of err if it is not nil
+func (g *Gallery) renderSharePage(w http.ResponseWriter, r *http.Request, page *sharePage, err error) {
+	params := views.Params{Data: page}
+	if err != nil {
+		params.SetAlert(err)
+	}
+
+	links, findErr := g.ShareLinkService.FindByGalleryID(page.Gallery.ID)
+	if findErr != nil {
+		params.SetAlert(findErr)
+	}
+	page.Links = links
+
+	g.ShareView.Render(w, r, params)
+}
+
+// shareLink returns the share link of the share param of the
+// request. it is nil if the param is not sent or not valid
+func (g *Gallery) shareLink(r *http.Request, gallery *model.Gallery) *model.ShareLink {
+	token := r.URL.Query().Get(shareParam)
+	if token == "" {
+		return nil
+	}
+	link, err := g.ShareLinkService.FindByToken(gallery.ID, token)
+	if err != nil {
+		return nil
+	}
+	return link
+}
+
+// shareURL returns the path of the gallery page with the token
+func shareURL(gallery *model.Gallery, token string) string {
+	return "/galleries/" + gallery.ID.String() + "?" + url.Values{shareParam: {token}}.Encode()
+}
@@ -0,0 +1,134 @@
+package controllers_test
+
+import (
+	"html"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/abanoub-fathy/bebo-gallery/model"
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var newShareLinkRegex = regexp.MustCompile(`<a id="newShareLink" href="([^"]+)">`)
+
+// createShareLink creates a link from the share page and returns its token
+func createShareLink(t *testing.T, r *mux.Router, gallery *model.Gallery, user *model.User, allowDownload bool) string {
+	form := url.Values{}
+	if allowDownload {
+		form.Set("allowDownload", "true")
+	}
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, postForm("/galleries/"+gallery.ID.String()+"/share", form, user))
+	require.Equal(t, http.StatusOK, w.Code)
+
+	matches := newShareLinkRegex.FindStringSubmatch(w.Body.String())
+	require.NotNil(t, matches, "the share page should show the new link")
+	link, err := url.Parse(html.UnescapeString(matches[1]))
+	require.NoError(t, err)
+	require.Equal(t, "/galleries/"+gallery.ID.String(), link.Path)
+	return link.Query().Get("share")
+}
+
+func TestShareLinks(t *testing.T) {
+	service := newMemoryService()
+	owner := createUser(t, service, "owner@gmail.com")
+	other := createUser(t, service, "other@gmail.com")
+	gallery := createGallery(t, service, owner, "Wedding")
+	_, err := service.ImageService.CreateImage(io.NopCloser(strings.NewReader("cake")), gallery.ID, "cake.jpg")
+	require.NoError(t, err)
+	r := newGalleryController(service)
+	galleryPath := "/galleries/" + gallery.ID.String()
+
+	// only the owner manages the links
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, withUser(httptest.NewRequest(http.MethodGet, galleryPath+"/share", nil), other))
+	assert.Equal(t, "/notFound", w.Header().Get("Location"))
+
+	downloads := createShareLink(t, r, gallery, owner, true)
+	viewOnly := createShareLink(t, r, gallery, owner, false)
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, withUser(httptest.NewRequest(http.MethodGet, galleryPath+"/share", nil), owner))
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), "<td>allowed</td>")
+	assert.Contains(t, w.Body.String(), "<td>not allowed</td>")
+	assert.NotContains(t, w.Body.String(), "newShareLink")
+
+	// the link that allows the downloads shows the download buttons
+	// and the download sends the token of the link
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, galleryPath+"?share="+url.QueryEscape(downloads), nil))
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), "Download all")
+	assert.Contains(t, w.Body.String(), `<input type="hidden" name="share"`)
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, galleryPath+"/download?share="+url.QueryEscape(downloads), nil))
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "cake", readZip(t, w.Body.Bytes())["wedding/cake.jpg"])
+
+	// every link shows the gallery and its originals
+	imagePath := "/images/galleries/" + gallery.ID.String() + "/cake.jpg"
+	for _, token := range []string{downloads, viewOnly} {
+		w = httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, galleryPath+"?share="+url.QueryEscape(token), nil))
+		require.Equal(t, http.StatusOK, w.Code)
+		assert.Contains(t, w.Body.String(), `src="`+imagePath+"?share=")
+
+		w = httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, imagePath+"?share="+url.QueryEscape(token), nil))
+		require.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "cake", w.Body.String())
+		assert.Equal(t, "private", w.Header().Get("Cache-Control"))
+	}
+
+	// the unknown tokens do not show the gallery or its originals
+	for _, token := range []string{"unknown", ""} {
+		w = httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, galleryPath+"?share="+url.QueryEscape(token), nil))
+		assert.Equal(t, "/notFound", w.Header().Get("Location"), token)
+
+		w = httptest.NewRecorder()
+		r.ServeHTTP(w, withUser(httptest.NewRequest(http.MethodGet, imagePath+"?share="+url.QueryEscape(token), nil), other))
+		assert.Equal(t, http.StatusNotFound, w.Code, token)
+	}
+
+	// the other links and the unknown tokens do not allow the downloads
+	for _, token := range []string{viewOnly, "unknown", ""} {
+		w = httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, galleryPath+"?share="+url.QueryEscape(token), nil))
+		assert.NotContains(t, w.Body.String(), "Download all", token)
+
+		w = httptest.NewRecorder()
+		r.ServeHTTP(w, withUser(httptest.NewRequest(http.MethodGet, galleryPath+"/download?share="+url.QueryEscape(token), nil), other))
+		assert.Equal(t, "/notFound", w.Header().Get("Location"), token)
+	}
+
+	// the deleted links do not work anymore
+	links, err := service.ShareLinkService.FindByGalleryID(gallery.ID)
+	require.NoError(t, err)
+	require.Len(t, links, 2)
+	for _, link := range links {
+		w = httptest.NewRecorder()
+		r.ServeHTTP(w, postForm(galleryPath+"/share/"+link.ID.String()+"/delete", url.Values{}, other))
+		assert.Equal(t, "/notFound", w.Header().Get("Location"))
+
+		w = httptest.NewRecorder()
+		r.ServeHTTP(w, postForm(galleryPath+"/share/"+link.ID.String()+"/delete", url.Values{}, owner))
+		require.Equal(t, http.StatusFound, w.Code)
+	}
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, galleryPath+"/download?share="+url.QueryEscape(downloads), nil))
+	assert.Equal(t, "/notFound", w.Header().Get("Location"))
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, imagePath+"?share="+url.QueryEscape(downloads), nil))
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
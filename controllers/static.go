@@ -4,7 +4,6 @@ import "github.com/abanoub-fathy/bebo-gallery/views"
 
 // Static type contains the static views
 type Static struct {
-	Home     *views.View
 	Contact  *views.View
 	NotFound *views.View
 }
@@ -13,7 +12,6 @@ type Static struct {
 // all static pages hard coded inside it
 func NewStatic() *Static {
 	return &Static{
-		Home:     views.NewView("base", "static/home"),
 		Contact:  views.NewView("base", "static/contact"),
 		NotFound: views.NewView("base", "static/notFound"),
 	}
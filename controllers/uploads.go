@@ -0,0 +1,255 @@
+package controllers
+
+import (
+	"net/http"
+	"path/filepath"
+	"strconv"
+
+	"github.com/abanoub-fathy/bebo-gallery/model"
+	"github.com/abanoub-fathy/bebo-gallery/pkg/context"
+	"github.com/abanoub-fathy/bebo-gallery/pkg/tus"
+	"github.com/gorilla/mux"
+	uuid "github.com/satori/go.uuid"
+)
+
+// tusContentType is the content type of the chunks
+const tusContentType = "application/offset+octet-stream"
+
+// the uploads follow the tus 1.0 protocol with the creation and
+// the termination extensions so the big images are sent in chunks
+// and resumed after the connection is cut. the image is created
+// when the last chunk is received
+
+// [OPTIONS] /api/v1/galleries/{galleryID}/uploads
+//
+// the features of the server are found without authentication
+func (api *API) UploadOptions(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Tus-Resumable", tus.Version)
+	w.Header().Set("Tus-Version", tus.Version)
+	w.Header().Set("Tus-Extension", tus.Extensions)
+	w.Header().Set("Tus-Max-Size", strconv.FormatInt(api.limits.MaxUploadBytes, 10))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// [POST] /api/v1/galleries/{galleryID}/uploads
+//
+// the Upload-Length header is the size of the image and the
+// filename key of the Upload-Metadata header is its name
+func (api *API) CreateUpload(w http.ResponseWriter, r *http.Request) {
+	if !checkTusVersion(w, r) {
+		return
+	}
+	gallery, ok := api.findGallery(w, r, true)
+	if !ok {
+		return
+	}
+
+	length, err := strconv.ParseInt(r.Header.Get("Upload-Length"), 10, 64)
+	if err != nil || length < 1 {
+		WriteJSONError(w, http.StatusBadRequest, "invalid_upload", "the Upload-Length header should be a positive number")
+		return
+	}
+	if length > api.limits.MaxUploadBytes {
+		WriteJSONError(w, http.StatusRequestEntityTooLarge, "upload_too_large", "the upload is larger than Tus-Max-Size")
+		return
+	}
+
+	metadata, err := tus.ParseMetadata(r.Header.Get("Upload-Metadata"))
+	if err != nil {
+		WriteJSONError(w, http.StatusBadRequest, "invalid_upload", "the Upload-Metadata header is not valid")
+		return
+	}
+	fileName := uploadFileName(metadata)
+	if fileName == "" {
+		WriteJSONError(w, http.StatusBadRequest, "invalid_upload", "the Upload-Metadata header should have the filename")
+		return
+	}
+	metadata["filename"] = fileName
+
+	upload := &tus.Upload{
+		Owner:    context.UserValue(r.Context()).ID.String(),
+		Target:   gallery.ID.String(),
+		Length:   length,
+		Metadata: metadata,
+	}
+	if err := api.Uploads.Create(upload); err != nil {
+		writeAPIError(w, err)
+		return
+	}
+
+	w.Header().Set("Location", r.URL.Path+"/"+upload.ID)
+	w.WriteHeader(http.StatusCreated)
+}
+
+// [HEAD] /api/v1/galleries/{galleryID}/uploads/{uploadID}
+//
+// the Upload-Offset header is where the next chunk starts
+func (api *API) UploadOffset(w http.ResponseWriter, r *http.Request) {
+	if !checkTusVersion(w, r) {
+		return
+	}
+	upload, ok := api.findUpload(w, r)
+	if !ok {
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	writeUploadHeaders(w, upload)
+	w.Header().Set("Upload-Length", strconv.FormatInt(upload.Length, 10))
+	w.WriteHeader(http.StatusOK)
+}
+
+// [PATCH] /api/v1/galleries/{galleryID}/uploads/{uploadID}
+//
+// the chunk is appended if the Upload-Offset header is the offset
+// of the upload. the bytes received before the connection is cut
+// are kept so the client can ask for the offset and resume
+func (api *API) WriteUpload(w http.ResponseWriter, r *http.Request) {
+	if !checkTusVersion(w, r) {
+		return
+	}
+	if r.Header.Get("Content-Type") != tusContentType {
+		WriteJSONError(w, http.StatusUnsupportedMediaType, "invalid_upload", "the Content-Type header should be "+tusContentType)
+		return
+	}
+	offset, err := strconv.ParseInt(r.Header.Get("Upload-Offset"), 10, 64)
+	if err != nil || offset < 0 {
+		WriteJSONError(w, http.StatusBadRequest, "invalid_upload", "the Upload-Offset header should be a number")
+		return
+	}
+
+	upload, ok := api.findUpload(w, r)
+	if !ok {
+		return
+	}
+	if r.ContentLength > upload.Length-offset {
+		WriteJSONError(w, http.StatusRequestEntityTooLarge, "upload_too_large", "the chunk ends after the Upload-Length")
+		return
+	}
+
+	// the finished upload is sent again when the
+	// client lost the response of the last chunk
+	if upload.Result != "" && offset == upload.Length {
+		writeUploadHeaders(w, upload)
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	upload, err = api.Uploads.Write(upload.ID, offset, r.Body)
+	if err == tus.ErrOffsetMismatch {
+		w.Header().Set("Upload-Offset", strconv.FormatInt(upload.Offset, 10))
+		WriteJSONError(w, http.StatusConflict, "offset_mismatch", "the Upload-Offset header should be "+strconv.FormatInt(upload.Offset, 10))
+		return
+	}
+	if err != nil {
+		writeAPIError(w, err)
+		return
+	}
+
+	if upload.Done() {
+		if err := api.finishUpload(upload); err != nil {
+			// the client finishes it by sending an empty last chunk
+			writeAPIError(w, err)
+			return
+		}
+	}
+
+	writeUploadHeaders(w, upload)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// [DELETE] /api/v1/galleries/{galleryID}/uploads/{uploadID}
+//
+// the received bytes are removed. the image of a
+// finished upload is not deleted
+func (api *API) TerminateUpload(w http.ResponseWriter, r *http.Request) {
+	if !checkTusVersion(w, r) {
+		return
+	}
+	upload, ok := api.findUpload(w, r)
+	if !ok {
+		return
+	}
+
+	if err := api.Uploads.Delete(upload.ID); err != nil && err != tus.ErrNotFound {
+		writeAPIError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// finishUpload creates the image of the upload and removes its bytes
+func (api *API) finishUpload(upload *tus.Upload) error {
+	galleryID, err := uuid.FromString(upload.Target)
+	if err != nil {
+		return err
+	}
+	file, err := api.Uploads.Open(upload.ID)
+	if err != nil {
+		return err
+	}
+
+	// the image service closes the file
+	image, err := api.ImageService.CreateImage(file, galleryID, upload.Metadata["filename"])
+	if err != nil {
+		return err
+	}
+	return api.Uploads.Finish(upload, image.ID.String())
+}
+
+// findUpload fetches the upload of the uploadID url variable and
+// writes the error response if it is not an upload of the user
+// to the gallery. the gallery is checked so the uploads to the
+// deleted galleries are not found
+func (api *API) findUpload(w http.ResponseWriter, r *http.Request) (*tus.Upload, bool) {
+	gallery, ok := api.findGallery(w, r, true)
+	if !ok {
+		return nil, false
+	}
+
+	upload, err := api.Uploads.Find(mux.Vars(r)["uploadID"])
+	if err == tus.ErrNotFound || (err == nil && (upload.Owner != gallery.UserID.String() || upload.Target != gallery.ID.String())) {
+		writeAPIError(w, model.ErrNotFound)
+		return nil, false
+	}
+	if err != nil {
+		writeAPIError(w, err)
+		return nil, false
+	}
+	return upload, true
+}
+
+// checkTusVersion writes the error response if the client
+// does not speak the version of the protocol of the server
+func checkTusVersion(w http.ResponseWriter, r *http.Request) bool {
+	if r.Header.Get("Tus-Resumable") != tus.Version {
+		w.Header().Set("Tus-Version", tus.Version)
+		WriteJSONError(w, http.StatusPreconditionFailed, "unsupported_version", "the Tus-Resumable header should be "+tus.Version)
+		return false
+	}
+	w.Header().Set("Tus-Resumable", tus.Version)
+	return true
+}
+
+// writeUploadHeaders writes the offset of the upload and the
+// id of its image when it is finished
+func writeUploadHeaders(w http.ResponseWriter, upload *tus.Upload) {
+	w.Header().Set("Upload-Offset", strconv.FormatInt(upload.Offset, 10))
+	if upload.Result != "" {
+		w.Header().Set("Upload-Image-ID", upload.Result)
+	}
+}
+
+// uploadFileName returns the base name of the file from the
+// filename key of the metadata or the name key some clients use
+func uploadFileName(metadata map[string]string) string {
+	name := metadata["filename"]
+	if name == "" {
+		name = metadata["name"]
+	}
+	name = filepath.Base(filepath.Clean("/" + name))
+	if name == "/" || name == "." {
+		return ""
+	}
+	return name
+}
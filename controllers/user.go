@@ -2,12 +2,14 @@ package controllers
 
 import (
 	"log"
+	"net"
 	"net/http"
 	"time"
 
 	"github.com/abanoub-fathy/bebo-gallery/model"
 	"github.com/abanoub-fathy/bebo-gallery/pkg/context"
 	"github.com/abanoub-fathy/bebo-gallery/pkg/email"
+	"github.com/abanoub-fathy/bebo-gallery/pkg/ratelimit"
 	"github.com/abanoub-fathy/bebo-gallery/utils"
 	"github.com/abanoub-fathy/bebo-gallery/views"
 	"github.com/gorilla/mux"
@@ -15,14 +17,35 @@ import (
 
 const DEFAULT_TOKEN_VALID_DURATION = time.Hour * 120
 
+// the limits of the login links requests. the links are limited
+// per email so nobody can flood the inbox of a user and per ip
+// so nobody can probe many emails
+const (
+	loginLinksPerEmail = 3
+	loginLinksPerIP    = 10
+	loginLinksWindow   = 15 * time.Minute
+)
+
 type User struct {
 	SignUpView         *views.View
 	LogInView          *views.View
 	ForgetPasswordView *views.View
 	ResetPasswordView  *views.View
+	LoginLinkView      *views.View
 	UserService        model.UserService
 	router             *mux.Router
 	EmailClient        *email.Mailer
+
+	// LoginProviders are the OpenID Connect providers
+	// shown on the login page
+	LoginProviders []LoginProvider
+
+	// the limiters of the login links requests
+	loginLinkEmailLimiter *ratelimit.Limiter
+	loginLinkIPLimiter    *ratelimit.Limiter
+
+	// guard throttles the login and the reset password attempts
+	guard *loginGuard
 }
 
 // NewUser return a pointer to User type which can be used
@@ -33,9 +56,14 @@ func NewUser(userService model.UserService, muxRouter *mux.Router, emailClient *
 		LogInView:          views.NewView("base", "user/login"),
 		ForgetPasswordView: views.NewView("base", "user/password_forget"),
 		ResetPasswordView:  views.NewView("base", "user/password_reset"),
+		LoginLinkView:      views.NewView("base", "user/login_link"),
 		router:             muxRouter,
 		UserService:        userService,
 		EmailClient:        emailClient,
+
+		loginLinkEmailLimiter: ratelimit.New(loginLinksPerEmail, loginLinksWindow),
+		loginLinkIPLimiter:    ratelimit.New(loginLinksPerIP, loginLinksWindow),
+		guard:                 newLoginGuard(),
 	}
 }
 
@@ -44,6 +72,9 @@ type SignUpForm struct {
 	LastName  string `schema:"lastName,required"`
 	Email     string `schema:"email,required"`
 	Password  string `schema:"password,required"`
+
+	// Handle is made from the email if it is empty
+	Handle string `schema:"handle"`
 }
 
 func (u *User) NewUser(w http.ResponseWriter, r *http.Request) {
@@ -81,6 +112,7 @@ func (u *User) CreateNewUser(w http.ResponseWriter, r *http.Request) {
 		LastName:  form.LastName,
 		Email:     form.Email,
 		Password:  form.Password,
+		Handle:    form.Handle,
 	}
 
 	if err := u.UserService.CreateUser(user); err != nil {
@@ -132,6 +164,15 @@ func (u *User) Logout(w http.ResponseWriter, r *http.Request) {
 type LoginForm struct {
 	Email    string `schema:"email,required"`
 	Password string `schema:"password,required"`
+
+	Providers []LoginProvider `schema:"-"`
+}
+
+// [GET] /login
+func (u *User) LoginPage(w http.ResponseWriter, r *http.Request) {
+	u.LogInView.Render(w, r, views.Params{
+		Data: LoginForm{Providers: u.LoginProviders},
+	})
 }
 
 // Login is a handler func that will receive data from login Form
@@ -142,7 +183,7 @@ func (u *User) Login(w http.ResponseWriter, r *http.Request) {
 	params := views.Params{}
 
 	// define loginForm
-	form := LoginForm{}
+	form := LoginForm{Providers: u.LoginProviders}
 
 	// set the form struct to parms' Data
 	params.Data = &form
@@ -154,21 +195,150 @@ func (u *User) Login(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// the unknown emails are throttled like the registered ones
+	// so they look the same. the attempt is counted as a failure
+	// before it is checked so the parallel attempts are throttled
+	wait, locked := u.guard.reserve(r, guardActionLogin, form.Email)
+	if wait > 0 {
+		renderThrottled(w, r, u.LogInView, params, wait)
+		return
+	}
+
 	// authenticate user
 	user, err := u.UserService.AuthenticateUser(form.Email, form.Password)
 	if err != nil {
 		switch err {
-		case model.ErrEmailNotValidFormat, model.ErrPasswordNotCorrect:
-			params.SetAlert(err)
-		case model.ErrNotFound:
-			params.SetAlertWithErrMsg("Email address is not found")
+		case model.ErrEmailNotValidFormat, model.ErrPasswordNotCorrect, model.ErrNotFound:
+			if locked {
+				go u.sendAccountLockedEmail(form.Email)
+			}
+			params.SetAlert(model.ErrInvalidCredentials)
 		default:
+			u.guard.forgive(r, guardActionLogin, form.Email)
 			params.SetAlert(err)
 		}
 		// render login page with alert
 		u.LogInView.Render(w, r, params)
 		return
 	}
+	u.guard.succeed(r, guardActionLogin, form.Email)
+
+	// set remember token to user
+	if err := u.UserService.SaveNewRemeberToken(user); err != nil {
+		params.SetAlert(err)
+		u.LogInView.Render(w, r, params)
+		return
+	}
+
+	// set remeber token in the cookie
+	setRemeberTokenToCookie(w, user, DEFAULT_TOKEN_VALID_DURATION)
+
+	// redirect to galleries page
+	url, err := u.router.Get(ViewGalleriesEndpoint).URL()
+	if err != nil {
+		log.Println(err)
+		http.Redirect(w, r, "/", http.StatusInternalServerError)
+		return
+	}
+	views.RedirectWithAlert(w, r, url.String(), http.StatusFound, *views.NewAlert(views.AlertLevelSuccess, "welcome back"))
+}
+
+type LoginLinkForm struct {
+	Email string `schema:"email"`
+}
+
+// [POST] /login/link
+//
+// the response is the same whether the email is registered
+// or not so the form can not be used to find the users
+func (u *User) SendLoginLink(w http.ResponseWriter, r *http.Request) {
+	// define params
+	params := views.Params{}
+
+	// define loginForm
+	form := LoginForm{Providers: u.LoginProviders}
+
+	// set the form struct to parms' Data
+	params.Data = &form
+
+	// Parse the form
+	var linkForm LoginLinkForm
+	if err := utils.ParseForm(r, &linkForm); err != nil {
+		params.SetAlert(err)
+		u.LogInView.Render(w, r, params)
+		return
+	}
+	form.Email = linkForm.Email
+
+	emailAllowed, _ := u.loginLinkEmailLimiter.Allow(normalizeEmail(linkForm.Email))
+	ipAllowed, _ := u.loginLinkIPLimiter.Allow(ClientIP(r))
+	if !emailAllowed || !ipAllowed {
+		params.SetAlertWithErrMsg("too many login links are requested. please try again later")
+		w.Header().Set("Content-Type", "text/html")
+		w.WriteHeader(http.StatusTooManyRequests)
+		u.LogInView.Render(w, r, params)
+		return
+	}
+
+	user, token, err := u.UserService.IntiateLoginLink(linkForm.Email)
+	switch err {
+	case nil:
+		// the email is sent in the background so the response
+		// takes the same time for the unknown emails
+		go u.EmailClient.SendLoginLinkEmail(*user, token)
+	case model.ErrNotFound, model.ErrUserDisabled, model.ErrEmailNotValidFormat:
+	default:
+		log.Println(err)
+	}
+
+	alert := *views.NewAlert(views.AlertLevelSuccess, "If the email is registered a login link is sent to it. The link is valid for 15 minutes")
+	views.RedirectWithAlert(w, r, "/login", http.StatusFound, alert)
+}
+
+type LoginLinkConfirmForm struct {
+	Token string `schema:"token"`
+}
+
+// [GET] /login/link
+//
+// the link in the email shows a page that confirms the login
+// the token is not used here because the email scanners open
+// the links before the user does
+func (u *User) LoginLinkPage(w http.ResponseWriter, r *http.Request) {
+	form := LoginLinkConfirmForm{}
+	params := views.Params{
+		Data: &form,
+	}
+	if err := utils.ParseURLParams(r, &form); err != nil {
+		params.SetAlert(err)
+	}
+	u.LoginLinkView.Render(w, r, params)
+}
+
+// [POST] /login/link/confirm
+//
+// the confirmed link logs the user in like Login
+func (u *User) LoginWithLink(w http.ResponseWriter, r *http.Request) {
+	params := views.Params{
+		Data: LoginForm{Providers: u.LoginProviders},
+	}
+
+	var form LoginLinkConfirmForm
+	if err := utils.ParseForm(r, &form); err != nil {
+		params.SetAlert(err)
+		u.LogInView.Render(w, r, params)
+		return
+	}
+
+	user, err := u.UserService.CompleteLoginLink(form.Token)
+	if err != nil {
+		if err != model.ErrInvalidToken {
+			log.Println(err)
+		}
+		params.SetAlertWithErrMsg("the login link is invalid or expired. please request a new one")
+		u.LogInView.Render(w, r, params)
+		return
+	}
 
 	// set remember token to user
 	if err := u.UserService.SaveNewRemeberToken(user); err != nil {
@@ -221,25 +391,37 @@ func (u *User) ForgetPassword(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	user, err := u.UserService.FindByEmail(form.Email)
-	if err != nil {
-		params.SetAlert(err)
-		u.ForgetPasswordView.Render(w, r, params)
+	// every request is counted as a failure
+	// so the emails can not be flooded
+	if wait, _ := u.guard.reserve(r, guardActionForgetPassword, form.Email); wait > 0 {
+		renderThrottled(w, r, u.ForgetPasswordView, params, wait)
 		return
 	}
 
-	token, err := u.UserService.IntiateResetPassword(form.Email)
-	if err != nil {
+	// the response is the same whether the email is
+	// registered or not so the form can not find the users
+	user, err := u.UserService.FindByEmail(form.Email)
+	switch err {
+	case nil:
+		token, err := u.UserService.IntiateResetPassword(user.Email)
+		if err != nil {
+			params.SetAlert(err)
+			u.ForgetPasswordView.Render(w, r, params)
+			return
+		}
+
+		// the email is sent in the background so the response
+		// takes the same time for the unknown emails
+		go u.EmailClient.SendResetPasswordEmail(*user, token)
+	case model.ErrNotFound, model.ErrEmailNotValidFormat:
+	default:
 		params.SetAlert(err)
 		u.ForgetPasswordView.Render(w, r, params)
 		return
 	}
 
-	// send email to user
-	u.EmailClient.SendResetPasswordEmail(*user, token)
-
 	// redirect with alert
-	alert := *views.NewAlert(views.AlertLevelSuccess, "Reset Password instructions sent to your email address. Please check your inbox")
+	alert := *views.NewAlert(views.AlertLevelSuccess, "Reset Password instructions sent to your email address if it is registered. Please check your inbox")
 	views.RedirectWithAlert(w, r, "/password/reset", http.StatusFound, alert)
 }
 
@@ -277,13 +459,23 @@ func (u *User) ResetPassword(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// the tokens are guessed from the same ip
+	if wait, _ := u.guard.reserve(r, guardActionResetPassword, ""); wait > 0 {
+		renderThrottled(w, r, u.ResetPasswordView, viewParams, wait)
+		return
+	}
+
 	// complete the reset password
 	user, err := u.UserService.CompleteResetPassword(form.Token, form.NewPassword)
 	if err != nil {
+		if err != model.ErrInvalidToken {
+			u.guard.forgive(r, guardActionResetPassword, "")
+		}
 		viewParams.SetAlert(err)
 		u.ResetPasswordView.Render(w, r, viewParams)
 		return
 	}
+	u.guard.succeed(r, guardActionResetPassword, "")
 
 	// set remember token to user
 	if err := u.UserService.SaveNewRemeberToken(user); err != nil {
@@ -305,6 +497,25 @@ func (u *User) ResetPassword(w http.ResponseWriter, r *http.Request) {
 	views.RedirectWithAlert(w, r, url.String(), http.StatusFound, *views.NewAlert(views.AlertLevelSuccess, "password is changed. Successfully!"))
 }
 
+// sendAccountLockedEmail tells the user of the email that the
+// login is locked after many failed attempts
+func (u *User) sendAccountLockedEmail(email string) {
+	user, err := u.UserService.FindByEmail(email)
+	if err != nil {
+		return
+	}
+	u.EmailClient.SendAccountLockedEmail(*user, u.guard.accounts.LockDuration)
+}
+
+// ClientIP returns the ip address of the client
+func ClientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
 // setRemeberTokenToCookie is used to set cookie for user in the response writer
 func setRemeberTokenToCookie(w http.ResponseWriter, user *model.User, validDuration time.Duration) {
 	// create cookie to store user token
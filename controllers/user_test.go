@@ -0,0 +1,329 @@
+package controllers_test
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/abanoub-fathy/bebo-gallery/controllers"
+	"github.com/abanoub-fathy/bebo-gallery/model"
+	"github.com/gorilla/mux"
+	"github.com/sendgrid/sendgrid-go/helpers/mail"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newUserController(service *model.Service) (*mux.Router, *mailRecorder) {
+	mailer, recorder := newMailer()
+	r := mux.NewRouter()
+	userController := controllers.NewUser(service.UserService, r, mailer)
+
+	r.HandleFunc("/new", userController.CreateNewUser).Methods("POST")
+	r.HandleFunc("/login", userController.Login).Methods("POST")
+	r.HandleFunc("/login/link", userController.SendLoginLink).Methods("POST")
+	r.HandleFunc("/login/link", userController.LoginLinkPage).Methods("GET")
+	r.HandleFunc("/login/link/confirm", userController.LoginWithLink).Methods("POST")
+	r.HandleFunc("/password/forget", userController.ForgetPassword).Methods("POST")
+	r.HandleFunc("/password/reset", userController.ResetPassword).Methods("POST")
+	r.HandleFunc("/galleries/new", func(w http.ResponseWriter, r *http.Request) {}).Name(controllers.ViewCreateGalleryEndpoint)
+	r.HandleFunc("/galleries", func(w http.ResponseWriter, r *http.Request) {}).Name(controllers.ViewGalleriesEndpoint)
+	return r, recorder
+}
+
+func tokenCookie(w *httptest.ResponseRecorder) *http.Cookie {
+	for _, cookie := range w.Result().Cookies() {
+		if cookie.Name == "token" {
+			return cookie
+		}
+	}
+	return nil
+}
+
+func TestCreateNewUser(t *testing.T) {
+	service := newMemoryService()
+	r, recorder := newUserController(service)
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, postForm("/new", url.Values{
+		"firstName": {"Abanoub"},
+		"lastName":  {"Fathy"},
+		"email":     {"aop4ever@gmail.com"},
+		"password":  {"12212154554554asdsa"},
+	}, nil))
+
+	require.Equal(t, http.StatusFound, w.Code)
+	assert.Equal(t, "/galleries/new", w.Header().Get("Location"))
+
+	cookie := tokenCookie(w)
+	require.NotNil(t, cookie, "the remember token cookie should be set")
+	user, err := service.UserService.FindUserByRememberToken(cookie.Value)
+	require.NoError(t, err)
+	assert.Equal(t, "aop4ever@gmail.com", user.Email)
+	assert.Equal(t, "aop4ever", user.Handle)
+
+	// the welcome email is sent in the background
+	assert.Eventually(t, func() bool {
+		return len(recorder.sentTo("aop4ever@gmail.com")) == 1
+	}, time.Second, 10*time.Millisecond)
+}
+
+func TestCreateNewUserHandle(t *testing.T) {
+	service := newMemoryService()
+	r, _ := newUserController(service)
+
+	signup := func(email, handle string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, postForm("/new", url.Values{
+			"firstName": {"Abanoub"},
+			"lastName":  {"Fathy"},
+			"email":     {email},
+			"password":  {"12212154554554asdsa"},
+			"handle":    {handle},
+		}, nil))
+		return w
+	}
+
+	w := signup("aop4ever@gmail.com", "@Bebo_Fan")
+	require.Equal(t, http.StatusFound, w.Code)
+	user, err := service.UserService.FindByHandle("bebo_fan")
+	require.NoError(t, err)
+	assert.Equal(t, "aop4ever@gmail.com", user.Email)
+
+	w = signup("other@gmail.com", "bebo_fan")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), model.ErrHandleTaken.PublicErrMsg())
+
+	w = signup("other@gmail.com", "settings")
+	assert.Contains(t, w.Body.String(), model.ErrHandleReserved.PublicErrMsg())
+}
+
+func TestCreateNewUserShortPassword(t *testing.T) {
+	r, _ := newUserController(newMemoryService())
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, postForm("/new", url.Values{
+		"firstName": {"Abanoub"},
+		"lastName":  {"Fathy"},
+		"email":     {"aop4ever@gmail.com"},
+		"password":  {"short"},
+	}, nil))
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), model.ErrPasswordTooShort.PublicErrMsg())
+	assert.Nil(t, tokenCookie(w))
+}
+
+func TestLogin(t *testing.T) {
+	service := newMemoryService()
+	createUser(t, service, "aop4ever@gmail.com")
+	r, _ := newUserController(service)
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, postForm("/login", url.Values{
+		"email":    {"aop4ever@gmail.com"},
+		"password": {"wrong-password"},
+	}, nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Nil(t, tokenCookie(w))
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, postForm("/login", url.Values{
+		"email":    {"aop4ever@gmail.com"},
+		"password": {"12212154554554asdsa"},
+	}, nil))
+	assert.Equal(t, http.StatusFound, w.Code)
+	assert.Equal(t, "/galleries", w.Header().Get("Location"))
+	assert.NotNil(t, tokenCookie(w))
+}
+
+func TestLoginThrottle(t *testing.T) {
+	service := newMemoryService()
+	createUser(t, service, "aop4ever@gmail.com")
+	r, _ := newUserController(service)
+
+	// the unknown emails get the same error
+	for _, address := range []string{"aop4ever@gmail.com", "unknown@gmail.com"} {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, postForm("/login", url.Values{
+			"email":    {address},
+			"password": {"wrong-password"},
+		}, nil))
+		require.Equal(t, http.StatusOK, w.Code)
+		assert.Contains(t, w.Body.String(), model.ErrInvalidCredentials.PublicErrMsg())
+	}
+
+	// the failures after the free ones are delayed
+	for i := 0; i < 3; i++ {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, postForm("/login", url.Values{
+			"email":    {"aop4ever@gmail.com"},
+			"password": {"wrong-password"},
+		}, nil))
+		require.Equal(t, http.StatusOK, w.Code)
+	}
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, postForm("/login", url.Values{
+		"email":    {"aop4ever@gmail.com"},
+		"password": {"12212154554554asdsa"},
+	}, nil))
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Equal(t, "1", w.Header().Get("Retry-After"))
+	assert.Nil(t, tokenCookie(w))
+
+	// the other accounts are not delayed
+	createUser(t, service, "other@gmail.com")
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, postForm("/login", url.Values{
+		"email":    {"other@gmail.com"},
+		"password": {"12212154554554asdsa"},
+	}, nil))
+	assert.Equal(t, http.StatusFound, w.Code)
+}
+
+func TestLoginThrottleParallel(t *testing.T) {
+	service := newMemoryService()
+	createUser(t, service, "aop4ever@gmail.com")
+	r, _ := newUserController(service)
+
+	// the attempts sent at the same time are counted before
+	// they are checked so only the free ones are not delayed
+	codes := make(chan int, 10)
+	var wg sync.WaitGroup
+	for i := 0; i < cap(codes); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, postForm("/login", url.Values{
+				"email":    {"aop4ever@gmail.com"},
+				"password": {"wrong-password"},
+			}, nil))
+			codes <- w.Code
+		}()
+	}
+	wg.Wait()
+	close(codes)
+
+	checked := 0
+	for code := range codes {
+		if code != http.StatusTooManyRequests {
+			checked++
+		}
+	}
+	assert.Equal(t, 4, checked)
+}
+
+func TestForgetAndResetPassword(t *testing.T) {
+	service := newMemoryService()
+	createUser(t, service, "aop4ever@gmail.com")
+	r, recorder := newUserController(service)
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, postForm("/password/forget", url.Values{"email": {"aop4ever@gmail.com"}}, nil))
+	require.Equal(t, http.StatusFound, w.Code)
+
+	// the email is sent in the background
+	var sent []*mail.SGMailV3
+	require.Eventually(t, func() bool {
+		sent = recorder.sentTo("aop4ever@gmail.com")
+		return len(sent) == 1
+	}, time.Second, 10*time.Millisecond, "the reset link should be sent")
+	matches := regexp.MustCompile(`token=([^"&\s]+)`).FindStringSubmatch(sent[0].Content[len(sent[0].Content)-1].Value)
+	require.NotNil(t, matches, "the email should contain the reset link")
+	token, err := url.QueryUnescape(matches[1])
+	require.NoError(t, err)
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, postForm("/password/reset", url.Values{
+		"token":    {token},
+		"password": {"the-new-password"},
+	}, nil))
+	assert.Equal(t, http.StatusFound, w.Code)
+	assert.NotNil(t, tokenCookie(w))
+
+	_, err = service.UserService.AuthenticateUser("aop4ever@gmail.com", "the-new-password")
+	assert.NoError(t, err)
+}
+
+func TestLoginLink(t *testing.T) {
+	service := newMemoryService()
+	createUser(t, service, "aop4ever@gmail.com")
+	r, recorder := newUserController(service)
+
+	// the unknown emails get the same response
+	var responses []*httptest.ResponseRecorder
+	for _, address := range []string{"aop4ever@gmail.com", "unknown@gmail.com"} {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, postForm("/login/link", url.Values{"email": {address}}, nil))
+		require.Equal(t, http.StatusFound, w.Code)
+		responses = append(responses, w)
+	}
+	assert.Equal(t, responses[0].Header().Get("Location"), responses[1].Header().Get("Location"))
+	assert.Equal(t, responses[0].Result().Cookies(), responses[1].Result().Cookies())
+
+	var sent []*mail.SGMailV3
+	require.Eventually(t, func() bool {
+		sent = recorder.sentTo("aop4ever@gmail.com")
+		return len(sent) == 1
+	}, time.Second, 10*time.Millisecond, "the login link should be sent")
+	assert.Empty(t, recorder.sentTo("unknown@gmail.com"))
+
+	matches := regexp.MustCompile(`token=([^"&\s]+)`).FindStringSubmatch(sent[0].Content[len(sent[0].Content)-1].Value)
+	require.NotNil(t, matches, "the email should contain the login link")
+	token, err := url.QueryUnescape(matches[1])
+	require.NoError(t, err)
+
+	// opening the link only shows the confirmation so the
+	// email scanners that open it do not use the token
+	for i := 0; i < 2; i++ {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/login/link?token="+matches[1], nil))
+		require.Equal(t, http.StatusOK, w.Code)
+		assert.Nil(t, tokenCookie(w))
+		assert.Contains(t, w.Body.String(), `action="/login/link/confirm"`)
+		assert.Contains(t, w.Body.String(), `name="token" value="`)
+	}
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, postForm("/login/link/confirm", url.Values{"token": {token}}, nil))
+	require.Equal(t, http.StatusFound, w.Code)
+	assert.Equal(t, "/galleries", w.Header().Get("Location"))
+	assert.NotNil(t, tokenCookie(w))
+
+	// the link is used once
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, postForm("/login/link/confirm", url.Values{"token": {token}}, nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Nil(t, tokenCookie(w))
+	assert.Contains(t, w.Body.String(), "the login link is invalid or expired")
+}
+
+func TestLoginLinkRateLimit(t *testing.T) {
+	service := newMemoryService()
+	createUser(t, service, "aop4ever@gmail.com")
+	r, _ := newUserController(service)
+
+	for i := 0; i < 3; i++ {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, postForm("/login/link", url.Values{"email": {"aop4ever@gmail.com"}}, nil))
+		require.Equal(t, http.StatusFound, w.Code)
+	}
+
+	// the email is limited whatever its case is
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, postForm("/login/link", url.Values{"email": {"AOP4ever@gmail.com"}}, nil))
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+
+	// the ip is limited for every email
+	for i := 0; i < 7; i++ {
+		w = httptest.NewRecorder()
+		r.ServeHTTP(w, postForm("/login/link", url.Values{"email": {fmt.Sprintf("user%v@gmail.com", i)}}, nil))
+	}
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+}
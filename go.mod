@@ -5,15 +5,20 @@ go 1.19
 require github.com/gorilla/mux v1.8.0
 
 require (
+	github.com/BurntSushi/toml v1.2.1
 	github.com/gorilla/csrf v1.7.1
 	github.com/gorilla/schema v1.2.0
 	github.com/joho/godotenv v1.4.0
+	github.com/mattn/go-sqlite3 v1.14.12
 	github.com/satori/go.uuid v1.2.0
+	github.com/sendgrid/rest v2.6.9+incompatible
 	github.com/sendgrid/sendgrid-go v3.12.0+incompatible
 	github.com/stretchr/testify v1.8.0
 	golang.org/x/crypto v0.0.0-20221012134737-56aed061732a
 	golang.org/x/text v0.3.7
+	gopkg.in/yaml.v3 v3.0.1
 	gorm.io/driver/postgres v1.3.10
+	gorm.io/driver/sqlite v1.3.6
 	gorm.io/gorm v1.23.9
 )
 
@@ -33,6 +38,5 @@ require (
 	github.com/lib/pq v1.10.7 // indirect
 	github.com/pkg/errors v0.9.1 // indirect
 	github.com/pmezard/go-difflib v1.0.0 // indirect
-	github.com/sendgrid/rest v2.6.9+incompatible // indirect
-	gopkg.in/yaml.v3 v3.0.1 // indirect
+	golang.org/x/sys v0.0.0-20210615035016-665e8c7367d1 // indirect
 )
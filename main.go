@@ -1,93 +1,68 @@
 package main
 
 import (
+	"flag"
 	"fmt"
-	"net/http"
+	"os"
 
 	"github.com/abanoub-fathy/bebo-gallery/config"
-	"github.com/abanoub-fathy/bebo-gallery/controllers"
-	"github.com/abanoub-fathy/bebo-gallery/middlewares"
-	"github.com/abanoub-fathy/bebo-gallery/model"
-	"github.com/abanoub-fathy/bebo-gallery/pkg/email"
-	"github.com/abanoub-fathy/bebo-gallery/utils"
-	"github.com/gorilla/csrf"
-	"github.com/gorilla/mux"
 )
 
-func main() {
-	// create new email client
-	emailClient := email.NewClient(config.AppConfig.EmailAPIKey)
-
-	// create new service
-	service, err := model.NewService(config.AppConfig.DatabaseURI)
-	utils.Must(err)
+// command is a management command of the app
+type command struct {
+	name  string
+	usage string
+	run   func(cfg *config.Config, args []string) error
+}
 
-	// defer closing the services
-	defer service.Close()
+var commands = []command{
+	{"serve", "start the web server (default)", serveCommand},
+	{"migrate", "run the sql migrations: migrate up|down|status", migrateCommand},
+	{"reset-db", "drop and re-create all the tables, refused in production", resetDBCommand},
+	{"user", "manage users: user create|disable|set-password", userCommand},
+	{"seed", "create demo users and galleries with sample images", seedCommand},
+	{"gc", "remove orphan images and expired tokens", gcCommand},
+	{"rotate-keys", "print new secret keys and log out all the users", rotateKeysCommand},
+}
 
-	// migrate all the models to the DB
-	utils.Must(service.AutoMigrate())
+func main() {
+	flag.Usage = usage
 
-	// creat middleware
-	requireUserMiddleWare := middlewares.RequireUser{
-		Service: service,
+	// load the app configurations
+	cfg, err := config.Load(flag.CommandLine, os.Args[1:])
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
 	}
 
-	userMiddleWare := middlewares.UserMiddleware{
-		Service: service,
+	// serve is the default command
+	args := flag.Args()
+	if len(args) == 0 {
+		args = []string{"serve"}
 	}
 
-	// set router
-	r := mux.NewRouter()
-
-	// serve static assets
-	assetsServerHandler := http.FileServer(http.Dir("./views/assets/"))
-	r.PathPrefix("/assets/").Handler(http.StripPrefix("/assets/", assetsServerHandler))
-
-	// file server
-	fileServerHandler := http.FileServer(http.Dir("./images"))
-	r.PathPrefix("/images/").Handler(http.StripPrefix("/images/", fileServerHandler))
-
-	// create StaticController
-	staticController := controllers.NewStatic()
-
-	// static routes
-	r.Handle("/", staticController.Home).Methods("GET")
-	r.Handle("/contact", staticController.Contact).Methods("GET")
-	r.NotFoundHandler = staticController.NotFound
-
-	// create new user controller
-	userController := controllers.NewUser(service.UserService, r, emailClient)
-
-	// user routes
-	r.HandleFunc("/signup", userController.NewUser).Methods("GET")
-	r.HandleFunc("/new", userController.CreateNewUser).Methods("POST")
-	r.Handle("/login", userController.LogInView).Methods("GET")
-	r.HandleFunc("/login", userController.Login).Methods("POST")
-	r.HandleFunc("/password/forget", userController.ForgetPasswordPage).Methods("GET")
-	r.HandleFunc("/password/forget", userController.ForgetPassword).Methods("POST")
-	r.HandleFunc("/password/reset", userController.ResetPasswordPage).Methods("GET")
-	r.HandleFunc("/password/reset", userController.ResetPassword).Methods("POST")
-	r.HandleFunc("/logout", requireUserMiddleWare.ApplyFunc(userController.Logout)).Methods("POST")
-
-	// create gallery controllers
-	galleryController := controllers.NewGallery(service.GalleryService, service.ImageService, r)
-
-	// gallery routes
-	r.Handle("/galleries/new", requireUserMiddleWare.Apply(galleryController.CreateGalleryView)).Methods("GET").Name(controllers.ViewCreateGalleryEndpoint)
-	r.HandleFunc("/galleries/{galleryID}", galleryController.ViewGallery).Methods("GET").Name(controllers.ViewGalleryEndpoint)
-	r.HandleFunc("/galleries", requireUserMiddleWare.ApplyFunc(galleryController.CreateNewGallery)).Methods("POST")
-	r.HandleFunc("/galleries", requireUserMiddleWare.ApplyFunc(galleryController.ShowUserGalleriesPage)).Methods("GET").Name(controllers.ViewGalleriesEndpoint)
-	r.HandleFunc("/galleries/{galleryID}/edit", requireUserMiddleWare.ApplyFunc(galleryController.EditGalleryPage)).Methods("GET").Name(controllers.EditGalleryPageEndpoint)
-	r.HandleFunc("/galleries/{galleryID}/edit", requireUserMiddleWare.ApplyFunc(galleryController.EditGallery)).Methods("POST")
-	r.HandleFunc("/galleries/{galleryID}/images", requireUserMiddleWare.ApplyFunc(galleryController.UploadImage)).Methods("POST")
-	r.HandleFunc("/galleries/{galleryID}/images/{fileName}/delete", requireUserMiddleWare.ApplyFunc(galleryController.DeleteImage)).Methods("POST")
-	r.HandleFunc("/galleries/{galleryID}/delete", requireUserMiddleWare.ApplyFunc(galleryController.DeleteGallery)).Methods("POST")
+	for _, cmd := range commands {
+		if cmd.name != args[0] {
+			continue
+		}
+		if err := cmd.run(cfg, args[1:]); err != nil {
+			fmt.Fprintf(os.Stderr, "%v: %v\n", cmd.name, err)
+			os.Exit(1)
+		}
+		return
+	}
 
-	// CSRF Protection
-	CSRF := csrf.Protect([]byte(config.AppConfig.CSRFKey), csrf.Secure(config.AppConfig.IsProductionEnv))
+	fmt.Fprintf(os.Stderr, "unknown command %q\n", args[0])
+	usage()
+	os.Exit(2)
+}
 
-	// start the app
-	fmt.Printf("🚀🚀 Server is working on http://localhost:%v\n", config.AppConfig.Port)
-	utils.Must(http.ListenAndServe(fmt.Sprintf(":%v", config.AppConfig.Port), CSRF(userMiddleWare.UserInCtxApply(r))))
+func usage() {
+	out := flag.CommandLine.Output()
+	fmt.Fprintf(out, "Usage: %v [flags] <command> [command flags]\n\nCommands:\n", os.Args[0])
+	for _, cmd := range commands {
+		fmt.Fprintf(out, "  %-12v %v\n", cmd.name, cmd.usage)
+	}
+	fmt.Fprintln(out, "\nFlags:")
+	flag.PrintDefaults()
 }
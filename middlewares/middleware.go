@@ -5,7 +5,9 @@ import (
 	"net/http"
 	"strings"
 
+	"github.com/abanoub-fathy/bebo-gallery/controllers"
 	"github.com/abanoub-fathy/bebo-gallery/pkg/context"
+	"github.com/gorilla/csrf"
 
 	"github.com/abanoub-fathy/bebo-gallery/model"
 )
@@ -50,6 +52,46 @@ func (mw *RequireUser) Apply(next http.Handler) http.Handler {
 	return mw.ApplyFunc(next.ServeHTTP)
 }
 
+// RequireAPIUser is the RequireUser middleware of the json api
+// it responds with a json error instead of redirecting to the
+// login page. it expects the user to be set in the ctx by
+// the UserMiddleware
+//
+// the requests authenticated by an access token also need
+// the Scope. if it is empty the safe methods need the read
+// scope and the other methods need the write scope
+type RequireAPIUser struct {
+	Scope string
+}
+
+func (mw *RequireAPIUser) Apply(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if context.UserValue(r.Context()) == nil {
+			controllers.WriteJSONError(w, http.StatusUnauthorized, "unauthorized", "authentication is required")
+			return
+		}
+
+		token := context.AccessTokenValue(r.Context())
+		if scope := mw.scope(r); token != nil && !token.Allows(scope) {
+			controllers.WriteJSONError(w, http.StatusForbidden, "insufficient_scope", "the token needs the "+scope+" scope")
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (mw *RequireAPIUser) scope(r *http.Request) string {
+	switch {
+	case mw.Scope != "":
+		return mw.Scope
+	case r.Method == http.MethodGet || r.Method == http.MethodHead || r.Method == http.MethodOptions:
+		return model.ScopeRead
+	default:
+		return model.ScopeWrite
+	}
+}
+
 type UserMiddleware struct {
 	Service *model.Service
 }
@@ -58,13 +100,54 @@ func (userMW *UserMiddleware) UserInCtxApply(next http.Handler) http.Handler {
 	return userMW.UserInCtxApplyFn(next.ServeHTTP)
 }
 
+// AccessTokenApply sets the user of the access token sent
+// in the Authorization header of the api requests in the ctx
+//
+// the requests using the access tokens do not use the cookies
+// so they are not exposed to csrf and the csrf check is skipped.
+// it must be applied before the csrf middleware
+func (userMW *UserMiddleware) AccessTokenApply(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		authorization := r.Header.Get("Authorization")
+		if !strings.HasPrefix(r.URL.Path, "/api/") || authorization == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if !strings.HasPrefix(authorization, "Bearer ") {
+			controllers.WriteJSONError(w, http.StatusUnauthorized, "unauthorized", "the authorization header should be: Bearer <token>")
+			return
+		}
+
+		user, accessToken, err := userMW.Service.AuthenticateAccessToken(strings.TrimSpace(strings.TrimPrefix(authorization, "Bearer ")))
+		if err != nil {
+			fmt.Println("error while getting user from access token", err)
+			controllers.WriteJSONError(w, http.StatusUnauthorized, "invalid_token", "the access token is not valid")
+			return
+		}
+
+		ctx := context.WithUser(r.Context(), user)
+		ctx = context.WithAccessToken(ctx, accessToken)
+		r = csrf.UnsafeSkipCheck(r.WithContext(ctx))
+
+		next.ServeHTTP(w, r)
+	})
+}
+
 func (userMW *UserMiddleware) UserInCtxApplyFn(next http.HandlerFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
+		// the user is already set by the access token
+		if context.UserValue(r.Context()) != nil {
+			next(w, r)
+			return
+		}
+
 		// if the path for getting public assets
 		// we don't need to set user in ctx so we will
-		// call next and return
+		// call next and return. the images need the
+		// user since the unlisted ones are not public
 		path := r.URL.Path
-		if strings.HasPrefix(path, "/images/") || strings.HasPrefix(path, "/assets/") {
+		if strings.HasPrefix(path, "/assets/") {
 			next(w, r)
 			return
 		}
@@ -0,0 +1,105 @@
+package middlewares
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/abanoub-fathy/bebo-gallery/controllers"
+	"github.com/abanoub-fathy/bebo-gallery/pkg/context"
+	"github.com/abanoub-fathy/bebo-gallery/pkg/ratelimit"
+)
+
+// RateLimit limits the requests every client can make to the
+// route with the Policy. the limits are counted in the Store so
+// a database store shares them between the replicas of the app
+//
+// the responses carry the RateLimit-Limit, RateLimit-Remaining,
+// RateLimit-Reset and RateLimit-Policy headers and the limited
+// requests get 429 with the Retry-After header. the requests are
+// not limited if the store fails so the app keeps working
+type RateLimit struct {
+	Store  ratelimit.Store
+	Policy ratelimit.Policy
+
+	// Name separates the limits of the routes sharing the store
+	Name string
+
+	// Key returns the key of the client. it is KeyByUser if nil
+	Key func(r *http.Request) string
+}
+
+func (mw *RateLimit) ApplyFunc(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if mw.Policy.Limit <= 0 {
+			next(w, r)
+			return
+		}
+
+		key := mw.Key
+		if key == nil {
+			key = KeyByUser
+		}
+
+		result, err := mw.Store.Take(r.Context(), mw.Name+":"+key(r), mw.Policy)
+		if err != nil {
+			fmt.Println("error while taking the rate limit", err)
+			next(w, r)
+			return
+		}
+
+		header := w.Header()
+		header.Set("RateLimit-Limit", strconv.Itoa(result.Limit))
+		header.Set("RateLimit-Remaining", strconv.Itoa(result.Remaining))
+		header.Set("RateLimit-Reset", seconds(result.Reset))
+		header.Set("RateLimit-Policy", mw.Policy.String())
+
+		if !result.Allowed {
+			header.Set("Retry-After", seconds(result.RetryAfter))
+			if strings.HasPrefix(r.URL.Path, "/api/") {
+				controllers.WriteJSONError(w, http.StatusTooManyRequests, "rate_limited", "too many requests, try again later")
+				return
+			}
+			http.Error(w, "Too many requests, try again later", http.StatusTooManyRequests)
+			return
+		}
+
+		next(w, r)
+	}
+}
+
+func (mw *RateLimit) Apply(next http.Handler) http.Handler {
+	return mw.ApplyFunc(next.ServeHTTP)
+}
+
+// KeyByIP keys the requests by the ip address of the client
+func KeyByIP(r *http.Request) string {
+	return "ip:" + controllers.ClientIP(r)
+}
+
+// KeyByUser keys the requests by the user in the ctx
+// and the anonymous requests by the ip address
+func KeyByUser(r *http.Request) string {
+	if user := context.UserValue(r.Context()); user != nil {
+		return "user:" + user.ID.String()
+	}
+	return KeyByIP(r)
+}
+
+// KeyByAccessToken keys the requests by the access token
+// they use so every token of a user has its own limit.
+// the other requests are keyed by KeyByUser
+func KeyByAccessToken(r *http.Request) string {
+	if token := context.AccessTokenValue(r.Context()); token != nil {
+		return "token:" + token.ID.String()
+	}
+	return KeyByUser(r)
+}
+
+// seconds rounds d up to whole seconds for the headers
+func seconds(d time.Duration) string {
+	return strconv.FormatInt(int64(math.Ceil(d.Seconds())), 10)
+}
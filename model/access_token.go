@@ -0,0 +1,368 @@
+package model
+
+import (
+	"strings"
+	"time"
+
+	"github.com/abanoub-fathy/bebo-gallery/pkg/hash"
+	"github.com/abanoub-fathy/bebo-gallery/pkg/rand"
+	uuid "github.com/satori/go.uuid"
+	"gorm.io/gorm"
+)
+
+const (
+	ErrAccessTokenNameRequired publicError = "model: token name is required"
+	ErrAccessTokenScopeInvalid publicError = "model: token scope should be read, write or admin"
+	ErrAccessTokenExpired      publicError = "model: token is expired"
+
+	// RefreshTokenDuration is how long the refresh token of
+	// the tokens issued to the OAuth clients is valid
+	RefreshTokenDuration = 30 * 24 * time.Hour
+
+	// AccessTokenPrefix is the prefix of all the access tokens
+	// so they can be told apart from the other tokens
+	AccessTokenPrefix = "bebo_"
+)
+
+// the scopes of the access tokens
+// every scope allows the scopes before it
+const (
+	ScopeRead  = "read"
+	ScopeWrite = "write"
+	ScopeAdmin = "admin"
+)
+
+// scopeLevels orders the scopes from the least to the most allowed
+var scopeLevels = map[string]int{
+	ScopeRead:  1,
+	ScopeWrite: 2,
+	ScopeAdmin: 3,
+}
+
+// AccessToken is a token of a user used to authenticate
+// the api requests. it is a personal access token or a
+// token issued to an OAuth client if ClientID is set
+type AccessToken struct {
+	Base
+	UserID     uuid.UUID `gorm:"not null;index"`
+	Name       string    `gorm:"not null"`
+	Scope      string    `gorm:"not null"`
+	ExpiresAt  *time.Time
+	LastUsedAt *time.Time
+	Token      string `gorm:"-"`
+	TokenHash  string `gorm:"not null;unique"`
+
+	// ClientID is the id of the OAuth client the token is
+	// issued to. these tokens have a refresh token too
+	ClientID         *uuid.UUID `gorm:"type:uuid"`
+	RefreshToken     string     `gorm:"-"`
+	RefreshTokenHash *string    `gorm:"unique"`
+}
+
+// Allows tells if the token scope allows the given scope
+func (t *AccessToken) Allows(scope string) bool {
+	return scopeLevels[t.Scope] >= scopeLevels[scope]
+}
+
+// IsExpired tells if the token is expired at the given time
+func (t *AccessToken) IsExpired(now time.Time) bool {
+	return t.ExpiresAt != nil && !now.Before(*t.ExpiresAt)
+}
+
+// IsRefreshExpired tells if the refresh token
+// is expired at the given time
+func (t *AccessToken) IsRefreshExpired(now time.Time) bool {
+	return !now.Before(t.CreatedAt.Add(RefreshTokenDuration))
+}
+
+// IsOAuth tells if the token is issued to an OAuth client
+func (t *AccessToken) IsOAuth() bool {
+	return t.ClientID != nil
+}
+
+// AccessTokenService is used to manage the access tokens
+type AccessTokenService interface {
+	AccessTokenDB
+}
+
+// AccessTokenDB has all methods needed to implement and
+// use the access tokens database methods
+type AccessTokenDB interface {
+	// Create stores a new token. the validation layer generates
+	// the token and sets it to the Token field which is not
+	// stored so it can be shown only once
+	Create(token *AccessToken) error
+
+	// FindByToken returns the token. the validation layer
+	// hashes the token and refuses the expired ones
+	FindByToken(token string) (*AccessToken, error)
+
+	// FindByRefreshToken returns the token of the refresh token.
+	// the validation layer hashes the token and refuses the
+	// expired refresh tokens
+	FindByRefreshToken(refreshToken string) (*AccessToken, error)
+
+	// FindByUserID returns the tokens of the user
+	FindByUserID(userID uuid.UUID) ([]*AccessToken, error)
+
+	// Touch sets the last used time of the token
+	Touch(id uuid.UUID, usedAt time.Time) error
+
+	// Revoke deletes the token of the user
+	Revoke(userID uuid.UUID, id uuid.UUID) error
+}
+
+type accessTokenService struct {
+	AccessTokenDB
+}
+
+// NewAccessTokenService creates a new AccessTokenService
+//
+// hashSecretKey is the secret key used to hash the tokens
+func NewAccessTokenService(db *gorm.DB, hashSecretKey string) AccessTokenService {
+	return NewAccessTokenServiceWithDB(newAccessTokenGorm(db), hashSecretKey)
+}
+
+// NewAccessTokenServiceWithDB creates a new AccessTokenService
+// on top of the given db layer like the in memory one
+func NewAccessTokenServiceWithDB(tokenDB AccessTokenDB, hashSecretKey string) AccessTokenService {
+	return &accessTokenService{
+		AccessTokenDB: newAccessTokenValidator(tokenDB, hash.NewHasher(hashSecretKey)),
+	}
+}
+
+type accessTokenValidator struct {
+	AccessTokenDB
+	hasher *hash.Hasher
+}
+
+type accessTokenValidationFn func(t *AccessToken) error
+
+func runAccessTokenValidationFns(t *AccessToken, fns ...accessTokenValidationFn) error {
+	for _, fn := range fns {
+		if err := fn(t); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func newAccessTokenValidator(db AccessTokenDB, hasher *hash.Hasher) *accessTokenValidator {
+	return &accessTokenValidator{
+		AccessTokenDB: db,
+		hasher:        hasher,
+	}
+}
+
+func (tv *accessTokenValidator) Create(t *AccessToken) error {
+	err := runAccessTokenValidationFns(t,
+		tv.requireUserID,
+		tv.normalizeName,
+		tv.requireName,
+		tv.validateScope,
+		tv.validateExpiry,
+		tv.setToken,
+		tv.setTokenHash,
+		tv.setRefreshToken,
+	)
+	if err != nil {
+		return err
+	}
+
+	return tv.AccessTokenDB.Create(t)
+}
+
+func (tv *accessTokenValidator) FindByRefreshToken(refreshToken string) (*AccessToken, error) {
+	if refreshToken == "" {
+		return nil, ErrInvalidToken
+	}
+
+	t, err := tv.AccessTokenDB.FindByRefreshToken(tv.hasher.HashByHMAC(refreshToken))
+	if err != nil {
+		return nil, err
+	}
+
+	if t.IsRefreshExpired(time.Now()) {
+		return nil, ErrAccessTokenExpired
+	}
+	return t, nil
+}
+
+func (tv *accessTokenValidator) FindByToken(token string) (*AccessToken, error) {
+	if !strings.HasPrefix(token, AccessTokenPrefix) {
+		return nil, ErrInvalidToken
+	}
+
+	t := &AccessToken{Token: token}
+	if err := runAccessTokenValidationFns(t, tv.setTokenHash); err != nil {
+		return nil, err
+	}
+
+	t, err := tv.AccessTokenDB.FindByToken(t.TokenHash)
+	if err != nil {
+		return nil, err
+	}
+
+	if t.IsExpired(time.Now()) {
+		return nil, ErrAccessTokenExpired
+	}
+	return t, nil
+}
+
+func (tv *accessTokenValidator) Revoke(userID uuid.UUID, id uuid.UUID) error {
+	if userID.String() == ZeroID {
+		return ErrUserIDRequired
+	}
+	if id.String() == ZeroID {
+		return ErrInvalidID
+	}
+	return tv.AccessTokenDB.Revoke(userID, id)
+}
+
+func (tv *accessTokenValidator) requireUserID(t *AccessToken) error {
+	if t.UserID.String() == ZeroID {
+		return ErrUserIDRequired
+	}
+	return nil
+}
+
+func (tv *accessTokenValidator) normalizeName(t *AccessToken) error {
+	t.Name = strings.TrimSpace(t.Name)
+	return nil
+}
+
+func (tv *accessTokenValidator) requireName(t *AccessToken) error {
+	if t.Name == "" {
+		return ErrAccessTokenNameRequired
+	}
+	return nil
+}
+
+func (tv *accessTokenValidator) validateScope(t *AccessToken) error {
+	if _, found := scopeLevels[t.Scope]; !found {
+		return ErrAccessTokenScopeInvalid
+	}
+	return nil
+}
+
+func (tv *accessTokenValidator) validateExpiry(t *AccessToken) error {
+	if t.IsExpired(time.Now()) {
+		return ErrAccessTokenExpired
+	}
+	return nil
+}
+
+func (tv *accessTokenValidator) setToken(t *AccessToken) error {
+	token, err := rand.GenerateRememberToken()
+	if err != nil {
+		return err
+	}
+	t.Token = AccessTokenPrefix + token
+	return nil
+}
+
+func (tv *accessTokenValidator) setTokenHash(t *AccessToken) error {
+	t.TokenHash = tv.hasher.HashByHMAC(t.Token)
+	return nil
+}
+
+// setRefreshToken generates the refresh token
+// of the tokens issued to the OAuth clients
+func (tv *accessTokenValidator) setRefreshToken(t *AccessToken) error {
+	if !t.IsOAuth() {
+		t.RefreshToken = ""
+		t.RefreshTokenHash = nil
+		return nil
+	}
+
+	token, err := rand.GenerateRememberToken()
+	if err != nil {
+		return err
+	}
+	t.RefreshToken = token
+	hash := tv.hasher.HashByHMAC(token)
+	t.RefreshTokenHash = &hash
+	return nil
+}
+
+type accessTokenGorm struct {
+	db *gorm.DB
+}
+
+func newAccessTokenGorm(db *gorm.DB) *accessTokenGorm {
+	return &accessTokenGorm{db: db}
+}
+
+// make sure that accessTokenGorm implements AccessTokenDB
+var _ AccessTokenDB = (*accessTokenGorm)(nil)
+
+func (tg *accessTokenGorm) Create(t *AccessToken) error {
+	return tg.db.Create(t).Error
+}
+
+func (tg *accessTokenGorm) FindByToken(tokenHash string) (*AccessToken, error) {
+	t := new(AccessToken)
+	query := tg.db.Where(AccessToken{
+		TokenHash: tokenHash,
+	})
+	if err := getRecord(query, t); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+func (tg *accessTokenGorm) FindByRefreshToken(refreshTokenHash string) (*AccessToken, error) {
+	t := new(AccessToken)
+	query := tg.db.Where("refresh_token_hash = ?", refreshTokenHash)
+	if err := getRecord(query, t); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+func (tg *accessTokenGorm) FindByUserID(userID uuid.UUID) ([]*AccessToken, error) {
+	tokens := []*AccessToken{}
+	err := tg.db.Where("user_id = ?", userID).Order("created_at desc").Find(&tokens).Error
+	return tokens, err
+}
+
+func (tg *accessTokenGorm) Touch(id uuid.UUID, usedAt time.Time) error {
+	return tg.db.Model(&AccessToken{}).Where("id = ?", id).UpdateColumn("last_used_at", usedAt).Error
+}
+
+func (tg *accessTokenGorm) Revoke(userID uuid.UUID, id uuid.UUID) error {
+	result := tg.db.Unscoped().Where("user_id = ? AND id = ?", userID, id).Delete(&AccessToken{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// AuthenticateAccessToken returns the user of the access token
+// and the token itself. it refuses the tokens of the disabled
+// users and records the time the token is used
+func (s *Service) AuthenticateAccessToken(token string) (*User, *AccessToken, error) {
+	accessToken, err := s.AccessTokenService.FindByToken(token)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	user, err := s.UserService.FindByID(accessToken.UserID.String())
+	if err != nil {
+		return nil, nil, err
+	}
+	if user.Disabled {
+		return nil, nil, ErrUserDisabled
+	}
+
+	now := time.Now()
+	if err := s.AccessTokenService.Touch(accessToken.ID, now); err != nil {
+		return nil, nil, err
+	}
+	accessToken.LastUsedAt = &now
+
+	return user, accessToken, nil
+}
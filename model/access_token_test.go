@@ -0,0 +1,99 @@
+package model_test
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/abanoub-fathy/bebo-gallery/model"
+	uuid "github.com/satori/go.uuid"
+	"github.com/stretchr/testify/suite"
+)
+
+type AccessTokenServiceSuite struct {
+	suite.Suite
+	*model.Service
+	user *model.User
+}
+
+func (s *AccessTokenServiceSuite) SetupSuite() {
+	s.Service = newTestService(s.T())
+}
+
+func (s *AccessTokenServiceSuite) SetupTest() {
+	s.Require().NoError(s.Service.ResetDB())
+
+	s.user = &model.User{
+		FirstName: "Abanoub",
+		LastName:  "Fathy",
+		Email:     "aop4ever@gmail.com",
+		Password:  "12212154554554asdsa",
+	}
+	s.Require().NoError(s.UserService.CreateUser(s.user))
+}
+
+func (s *AccessTokenServiceSuite) TearDownSuite() {
+	s.Service.Close()
+}
+
+func (s *AccessTokenServiceSuite) TestCreateValidation() {
+	err := s.AccessTokenService.Create(&model.AccessToken{UserID: s.user.ID, Name: " ", Scope: model.ScopeRead})
+	s.Assert().Equal(model.ErrAccessTokenNameRequired, err)
+
+	err = s.AccessTokenService.Create(&model.AccessToken{UserID: s.user.ID, Name: "cli", Scope: "owner"})
+	s.Assert().Equal(model.ErrAccessTokenScopeInvalid, err)
+
+	expiresAt := time.Now().Add(-time.Minute)
+	err = s.AccessTokenService.Create(&model.AccessToken{UserID: s.user.ID, Name: "cli", Scope: model.ScopeRead, ExpiresAt: &expiresAt})
+	s.Assert().Equal(model.ErrAccessTokenExpired, err)
+}
+
+func (s *AccessTokenServiceSuite) TestAuthenticateAccessToken() {
+	token := &model.AccessToken{UserID: s.user.ID, Name: "cli", Scope: model.ScopeWrite}
+	s.Require().NoError(s.AccessTokenService.Create(token))
+	s.Require().True(strings.HasPrefix(token.Token, model.AccessTokenPrefix))
+
+	// only the hash of the token is stored
+	tokens, err := s.AccessTokenService.FindByUserID(s.user.ID)
+	s.Require().NoError(err)
+	s.Require().Len(tokens, 1)
+	s.Assert().Empty(tokens[0].Token)
+	s.Assert().NotEqual(token.Token, tokens[0].TokenHash)
+	s.Assert().Nil(tokens[0].LastUsedAt)
+
+	user, found, err := s.AuthenticateAccessToken(token.Token)
+	s.Require().NoError(err)
+	s.Assert().Equal(s.user.ID, user.ID)
+	s.Assert().True(found.Allows(model.ScopeRead))
+	s.Assert().False(found.Allows(model.ScopeAdmin))
+
+	tokens, err = s.AccessTokenService.FindByUserID(s.user.ID)
+	s.Require().NoError(err)
+	s.Assert().NotNil(tokens[0].LastUsedAt)
+
+	_, _, err = s.AuthenticateAccessToken(model.AccessTokenPrefix + "unknown")
+	s.Assert().Equal(model.ErrNotFound, err)
+
+	// disabled users can not use their tokens
+	_, err = s.UserService.FindAndUpdateByID(s.user.ID.String(), map[string]interface{}{"disabled": true})
+	s.Require().NoError(err)
+	_, _, err = s.AuthenticateAccessToken(token.Token)
+	s.Assert().Equal(model.ErrUserDisabled, err)
+}
+
+func (s *AccessTokenServiceSuite) TestRevoke() {
+	token := &model.AccessToken{UserID: s.user.ID, Name: "cli", Scope: model.ScopeRead}
+	s.Require().NoError(s.AccessTokenService.Create(token))
+
+	// only the owner can revoke the token
+	err := s.AccessTokenService.Revoke(uuid.NewV4(), token.ID)
+	s.Assert().Equal(model.ErrNotFound, err)
+
+	s.Require().NoError(s.AccessTokenService.Revoke(s.user.ID, token.ID))
+	_, err = s.AccessTokenService.FindByToken(token.Token)
+	s.Assert().Equal(model.ErrNotFound, err)
+}
+
+func TestAccessTokenServiceSuite(t *testing.T) {
+	suite.Run(t, new(AccessTokenServiceSuite))
+}
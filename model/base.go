@@ -15,10 +15,15 @@ type Base struct {
 	DeletedAt gorm.DeletedAt `gorm:"index"`
 }
 
-// BeforeSave is used to assign new UUID to the id column
-// of the Base type
+// BeforeCreate is used to assign new UUID to the id column
+// of the Base type if it is not set already
+//
+// the id is generated in go instead of the database
+// so it works on both postgres and sqlite
 func (b *Base) BeforeCreate(db *gorm.DB) (err error) {
-	uuid := uuid.NewV4()
-	db.Statement.SetColumn("ID", uuid)
+	if !uuid.Equal(b.ID, uuid.Nil) {
+		return
+	}
+	db.Statement.SetColumn("ID", uuid.NewV4())
 	return
 }
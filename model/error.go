@@ -1,7 +1,9 @@
 package model
 
 import (
+	"errors"
 	"strings"
+	"unicode"
 
 	"golang.org/x/text/cases"
 	"golang.org/x/text/language"
@@ -24,8 +26,21 @@ const (
 	// ErrEmailIsTaken
 	ErrEmailIsTaken publicError = "email address is already taken"
 
-	// ErrPasswordTooShort is returned on password is less than 8 chars
-	ErrPasswordTooShort publicError = "password should be at least 8 chars"
+	// ErrPasswordTooShort is returned when the password is shorter
+	// than the min length of the password policy
+	ErrPasswordTooShort publicError = "password is too short"
+
+	// ErrPasswordTooWeak is returned when the password is not
+	// as strong as the min entropy of the password policy
+	ErrPasswordTooWeak publicError = "password is too weak, make it longer or mix letters, digits and symbols"
+
+	// ErrPasswordHasPersonalInfo is returned when the
+	// password contains the name or the email of the user
+	ErrPasswordHasPersonalInfo publicError = "password should not contain your name or email"
+
+	// ErrPasswordBreached is returned when the password is
+	// found in the list of the breached passwords
+	ErrPasswordBreached publicError = "password was found in a data breach, choose another one"
 
 	//ErrPasswordRequired
 	ErrPasswordRequired publicError = "password can not be empty"
@@ -40,12 +55,35 @@ const (
 
 	// ErrInvalidToken is returned when the token is not existed while reseting password
 	ErrInvalidToken publicError = "model: token provided is not valid"
+
+	// ErrUserDisabled is returned when a disabled user tries to log in
+	ErrUserDisabled publicError = "model: user account is disabled"
+
+	// ErrInvalidCredentials is shown instead of ErrNotFound and
+	// ErrPasswordNotCorrect so the login does not tell which
+	// emails are registered
+	ErrInvalidCredentials publicError = "model: email or password is incorrect"
 )
 
+// ErrNoDatabase is returned by the database operations
+// of the in memory services
+var ErrNoDatabase = errors.New("model: the service has no database")
+
 func (e publicError) Error() string {
 	return string(e)
 }
 
+// Code returns a stable snake case code of the error
+// that can be used by the api clients
+//
+// Eg: ErrNotFound code is resource_not_found
+func (e publicError) Code() string {
+	errMsg := strings.Replace(string(e), "model: ", "", 1)
+	return strings.Join(strings.FieldsFunc(strings.ToLower(errMsg), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	}), "_")
+}
+
 func (e publicError) PublicErrMsg() string {
 	errMsg := strings.Replace(string(e), "model: ", "", 1)
 	parts := strings.Split(errMsg, " ")
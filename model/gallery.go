@@ -2,6 +2,8 @@ package model
 
 import (
 	"strings"
+	"time"
+	"unicode/utf8"
 
 	uuid "github.com/satori/go.uuid"
 	"gorm.io/gorm"
@@ -12,6 +14,14 @@ const (
 	ErrGalleryTitleRequired publicError = "model: gallery title is required"
 	ErrInvalidID            publicError = "model: not valid id"
 
+	// ErrGalleryDescriptionTooLong is returned when the description
+	// of the gallery is longer than MaxGalleryDescriptionLength
+	ErrGalleryDescriptionTooLong publicError = "gallery description is too long"
+
+	// MaxGalleryDescriptionLength is the max length
+	// of the description of the gallery in chars
+	MaxGalleryDescriptionLength = 5000
+
 	ZeroID = "00000000-0000-0000-0000-000000000000"
 )
 
@@ -21,6 +31,77 @@ type Gallery struct {
 	Title  string    `gorm:"not_null"`
 	UserID uuid.UUID `gorm:"not_null;index"`
 	Images []Image   `gorm:"-"`
+	Tags   []string  `gorm:"-"`
+
+	// Description is written in the markdown subset of pkg/markdown
+	Description string `gorm:"not null"`
+
+	// CoverImageID is the image shown as the thumbnail
+	// of the gallery. it is nil if it is not chosen
+	CoverImageID *uuid.UUID `gorm:"type:uuid"`
+
+	// ImageCount is the number of the images of the gallery
+	// it is set only by ListGalleries
+	ImageCount int `gorm:"-"`
+
+	// PublishedAt is the time the gallery was made public. the
+	// public galleries are listed in the explore feed and on the
+	// profile of the owner. it is nil if the gallery is unlisted
+	// and then it is seen only by its owner and the people with
+	// one of its share links
+	PublishedAt *time.Time
+}
+
+// Public tells if the gallery is published
+func (gallery *Gallery) Public() bool {
+	return gallery.PublishedAt != nil
+}
+
+// ListedFor tells if the gallery is listed in the search and
+// the tag pages of the user. the unlisted galleries are listed
+// only for their owner. the user id is nil for the visitors
+func (gallery *Gallery) ListedFor(userID uuid.UUID) bool {
+	return gallery.Public() || uuid.Equal(gallery.UserID, userID)
+}
+
+// listedFor keeps the galleries that are listed for the user
+// the galleries table should be in the query
+func listedFor(db *gorm.DB, userID uuid.UUID) *gorm.DB {
+	return db.Where("(galleries.published_at IS NOT NULL OR galleries.user_id = ?)", userID)
+}
+
+// SetPublic publishes or unlists the gallery. the
+// publish time is kept if it is already public
+func (gallery *Gallery) SetPublic(public bool) {
+	switch {
+	case !public:
+		gallery.PublishedAt = nil
+	case gallery.PublishedAt == nil:
+		now := time.Now()
+		gallery.PublishedAt = &now
+	}
+}
+
+// Cover returns the cover image of the gallery or its first
+// image if the cover is not chosen. it is nil if the gallery
+// has no images. the Images should be set
+func (gallery *Gallery) Cover() *Image {
+	if len(gallery.Images) == 0 {
+		return nil
+	}
+	if gallery.CoverImageID != nil {
+		for i := range gallery.Images {
+			if uuid.Equal(gallery.Images[i].ID, *gallery.CoverImageID) {
+				return &gallery.Images[i]
+			}
+		}
+	}
+	return &gallery.Images[0]
+}
+
+// IsCover tells if the image is the chosen cover of the gallery
+func (gallery *Gallery) IsCover(image Image) bool {
+	return gallery.CoverImageID != nil && uuid.Equal(*gallery.CoverImageID, image.ID)
 }
 
 // ImageSplit is gallery method used to return gallery images
@@ -82,6 +163,10 @@ type GalleryDB interface {
 
 	// FindByUserID will be used to find user galler's
 	FindByUserID(userID uuid.UUID) ([]*Gallery, error)
+
+	// ListGalleries returns a page of the galleries
+	// found by the listing query
+	ListGalleries(query *GalleryListQuery) (*GalleryPage, error)
 }
 
 type galleryService struct {
@@ -106,9 +191,18 @@ func (gv *galleryValidator) validateGalleryTitle(g *Gallery) error {
 	return nil
 }
 
+func (gv *galleryValidator) validateGalleryDescription(g *Gallery) error {
+	g.Description = strings.TrimSpace(g.Description)
+	if utf8.RuneCountInString(g.Description) > MaxGalleryDescriptionLength {
+		return ErrGalleryDescriptionTooLong
+	}
+	return nil
+}
+
 func (gv *galleryValidator) CreateGallery(gallery *Gallery) error {
 	err := runGalleryValidationFns(gallery,
 		gv.validateGalleryTitle,
+		gv.validateGalleryDescription,
 		gv.validateGalleryUserID,
 	)
 	if err != nil {
@@ -131,6 +225,7 @@ func (gv *galleryValidator) Update(gallery *Gallery) error {
 	err := runGalleryValidationFns(gallery,
 		gv.validateGalleryUserID,
 		gv.validateGalleryTitle,
+		gv.validateGalleryDescription,
 	)
 	if err != nil {
 		return err
@@ -157,11 +252,17 @@ func (gv *galleryValidator) FindByUserID(userID uuid.UUID) ([]*Gallery, error) {
 // with its layers first layer is the validator the second
 // is the gorm layer
 func NewGalleryService(db *gorm.DB) GalleryService {
+	return NewGalleryServiceWithDB(&galleryGorm{
+		db: db,
+	})
+}
+
+// NewGalleryServiceWithDB is used to return GalleryService
+// with the validator layer on top of the given db layer
+func NewGalleryServiceWithDB(galleryDB GalleryDB) GalleryService {
 	return &galleryService{
 		GalleryDB: &galleryValidator{
-			GalleryDB: &galleryGorm{
-				db: db,
-			},
+			GalleryDB: galleryDB,
 		},
 	}
 }
@@ -0,0 +1,324 @@
+package model
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	uuid "github.com/satori/go.uuid"
+)
+
+const (
+	// ErrGallerySortInvalid is returned when the sort
+	// of a listing is not one of the gallery sorts
+	ErrGallerySortInvalid publicError = "gallery sort is not valid"
+
+	// ErrCursorInvalid is returned when the cursor of a listing
+	// is not valid or it was made for another sort
+	ErrCursorInvalid publicError = "page cursor is not valid"
+)
+
+// the sorts of the gallery listings
+const (
+	GallerySortCreated    = "created"
+	GallerySortUpdated    = "updated"
+	GallerySortTitle      = "title"
+	GallerySortImageCount = "images"
+
+	// GallerySortPublished lists only the public galleries
+	GallerySortPublished = "published"
+)
+
+const (
+	// DefaultGalleryListLimit is the number of the galleries
+	// of a listing page when its limit is not set
+	DefaultGalleryListLimit = 20
+
+	// MaxGalleryListLimit is the max limit of a listing page
+	MaxGalleryListLimit = 100
+)
+
+// imageCountSQL counts the images of the gallery in the query
+const imageCountSQL = "(SELECT COUNT(*) FROM images WHERE images.gallery_id = galleries.id AND images.deleted_at IS NULL)"
+
+// GalleryListQuery is a listing of the galleries. the pages
+// are found by the cursor of the previous page so the galleries
+// added while listing do not move the next pages
+type GalleryListQuery struct {
+	// UserID lists only the galleries of the user
+	// the galleries of all the users are listed if it is nil
+	UserID uuid.UUID
+
+	// Sort is one of the gallery sorts. it is created if it is empty
+	Sort string
+
+	// Ascending sorts the galleries from the oldest, the first
+	// title or the fewest images. the titles are sorted ascending
+	// and the other sorts descending by default
+	Ascending *bool
+
+	// Title lists only the galleries with the text in their title
+	Title string
+
+	// Tag lists only the galleries with the tag
+	Tag string
+
+	// Public lists only the public galleries
+	Public bool
+
+	Limit int
+
+	// Cursor is the NextCursor of the previous page
+	// it is empty for the first page
+	Cursor string
+
+	// cursor is the decoded Cursor
+	cursor *galleryCursor
+}
+
+// ascending tells if the galleries are sorted ascending
+func (query *GalleryListQuery) ascending() bool {
+	if query.Ascending != nil {
+		return *query.Ascending
+	}
+	return query.Sort == GallerySortTitle
+}
+
+// GalleryPage is a page of a gallery listing
+type GalleryPage struct {
+	Galleries []*Gallery
+
+	// NextCursor is the cursor of the next page
+	// it is empty if this is the last page
+	NextCursor string
+}
+
+// galleryCursor is the position after the last gallery of a page
+// it has the sort to reject the cursors of the other sorts
+type galleryCursor struct {
+	Sort      string    `json:"s"`
+	Ascending bool      `json:"a"`
+	ID        uuid.UUID `json:"id"`
+	Time      time.Time `json:"t,omitempty"`
+	Title     string    `json:"ti,omitempty"`
+	Count     int       `json:"c,omitempty"`
+}
+
+// newGalleryCursor returns the cursor after the gallery
+func newGalleryCursor(query *GalleryListQuery, gallery *Gallery) *galleryCursor {
+	cursor := &galleryCursor{Sort: query.Sort, Ascending: query.ascending(), ID: gallery.ID}
+	switch query.Sort {
+	case GallerySortCreated:
+		cursor.Time = gallery.CreatedAt
+	case GallerySortUpdated:
+		cursor.Time = gallery.UpdatedAt
+	case GallerySortTitle:
+		cursor.Title = strings.ToLower(gallery.Title)
+	case GallerySortImageCount:
+		cursor.Count = gallery.ImageCount
+	case GallerySortPublished:
+		if gallery.PublishedAt != nil {
+			cursor.Time = *gallery.PublishedAt
+		}
+	}
+	return cursor
+}
+
+// encode returns the cursor as an url safe string
+func (cursor *galleryCursor) encode() string {
+	data, _ := json.Marshal(cursor)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// value returns the value of the sort column of the cursor
+func (cursor *galleryCursor) value() interface{} {
+	switch cursor.Sort {
+	case GallerySortTitle:
+		return cursor.Title
+	case GallerySortImageCount:
+		return cursor.Count
+	}
+	return cursor.Time
+}
+
+// compare compares the gallery to the cursor in the sort order
+// it is negative if the gallery comes before the cursor
+func (cursor *galleryCursor) compare(gallery *Gallery) int {
+	other := newGalleryCursor(&GalleryListQuery{Sort: cursor.Sort}, gallery)
+
+	result := 0
+	switch {
+	case cursor.Sort == GallerySortTitle:
+		result = strings.Compare(other.Title, cursor.Title)
+	case cursor.Sort == GallerySortImageCount:
+		result = other.Count - cursor.Count
+	case other.Time.Before(cursor.Time):
+		result = -1
+	case other.Time.After(cursor.Time):
+		result = 1
+	}
+	if result == 0 {
+		result = strings.Compare(other.ID.String(), cursor.ID.String())
+	}
+	if !cursor.Ascending {
+		result = -result
+	}
+	return result
+}
+
+// decodeGalleryCursor decodes the cursor of the query
+func decodeGalleryCursor(query *GalleryListQuery) (*galleryCursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(query.Cursor)
+	if err != nil {
+		return nil, ErrCursorInvalid
+	}
+	cursor := new(galleryCursor)
+	if err := json.Unmarshal(data, cursor); err != nil {
+		return nil, ErrCursorInvalid
+	}
+	if cursor.Sort != query.Sort || cursor.Ascending != query.ascending() {
+		return nil, ErrCursorInvalid
+	}
+	return cursor, nil
+}
+
+// validateListQuery sets the defaults of the query
+// and decodes its cursor
+func validateListQuery(query *GalleryListQuery) error {
+	switch query.Sort {
+	case "":
+		query.Sort = GallerySortCreated
+	case GallerySortCreated, GallerySortUpdated, GallerySortTitle, GallerySortImageCount:
+	case GallerySortPublished:
+		query.Public = true
+	default:
+		return ErrGallerySortInvalid
+	}
+
+	if query.Limit <= 0 || query.Limit > MaxGalleryListLimit {
+		query.Limit = DefaultGalleryListLimit
+	}
+	query.Title = strings.TrimSpace(query.Title)
+
+	if query.Tag != "" {
+		tag, err := NormalizeTag(query.Tag)
+		if err != nil {
+			return err
+		}
+		query.Tag = tag
+	}
+
+	query.cursor = nil
+	if query.Cursor != "" {
+		cursor, err := decodeGalleryCursor(query)
+		if err != nil {
+			return err
+		}
+		query.cursor = cursor
+	}
+	return nil
+}
+
+// newGalleryPage returns the page of the galleries. the galleries
+// have one more gallery than the limit if there is a next page
+func newGalleryPage(query *GalleryListQuery, galleries []*Gallery) *GalleryPage {
+	page := &GalleryPage{Galleries: galleries}
+	if len(galleries) > query.Limit {
+		page.Galleries = galleries[:query.Limit]
+		page.NextCursor = newGalleryCursor(query, page.Galleries[query.Limit-1]).encode()
+	}
+	return page
+}
+
+func (gv *galleryValidator) ListGalleries(query *GalleryListQuery) (*GalleryPage, error) {
+	if err := validateListQuery(query); err != nil {
+		return nil, err
+	}
+	return gv.GalleryDB.ListGalleries(query)
+}
+
+// gallerySortSQL are the sql expressions of the sorts
+var gallerySortSQL = map[string]string{
+	GallerySortCreated:    "galleries.created_at",
+	GallerySortUpdated:    "galleries.updated_at",
+	GallerySortTitle:      "lower(galleries.title)",
+	GallerySortImageCount: imageCountSQL,
+	GallerySortPublished:  "galleries.published_at",
+}
+
+func (gg *galleryGorm) ListGalleries(query *GalleryListQuery) (*GalleryPage, error) {
+	db := gg.db.Model(&Gallery{})
+	if !uuid.Equal(query.UserID, uuid.Nil) {
+		db = db.Where("galleries.user_id = ?", query.UserID)
+	}
+	if query.Public {
+		db = db.Where("galleries.published_at IS NOT NULL")
+	}
+	if query.Title != "" {
+		db = db.Where(`lower(galleries.title) LIKE ? ESCAPE '\'`, "%"+escapeLike(strings.ToLower(query.Title))+"%")
+	}
+	if query.Tag != "" {
+		tagged := gg.db.Table("gallery_tags").
+			Select("gallery_tags.gallery_id").
+			Joins("JOIN tags ON tags.id = gallery_tags.tag_id").
+			Where("tags.name = ?", query.Tag)
+		db = db.Where("galleries.id IN (?)", tagged)
+	}
+
+	sortSQL := gallerySortSQL[query.Sort]
+	direction, operator := "DESC", "<"
+	if query.ascending() {
+		direction, operator = "ASC", ">"
+	}
+	if query.cursor != nil {
+		value := query.cursor.value()
+		db = db.Where(fmt.Sprintf("(%[1]s %[2]s ? OR (%[1]s = ? AND galleries.id %[2]s ?))", sortSQL, operator), value, value, query.cursor.ID)
+	}
+
+	galleries := []*Gallery{}
+	err := db.Order(fmt.Sprintf("%s %s, galleries.id %s", sortSQL, direction, direction)).
+		Limit(query.Limit + 1).
+		Find(&galleries).Error
+	if err != nil {
+		return nil, err
+	}
+	if err := gg.loadImageCounts(galleries); err != nil {
+		return nil, err
+	}
+	return newGalleryPage(query, galleries), nil
+}
+
+// loadImageCounts sets the image counts of the galleries
+func (gg *galleryGorm) loadImageCounts(galleries []*Gallery) error {
+	if len(galleries) == 0 {
+		return nil
+	}
+	ids := make([]uuid.UUID, len(galleries))
+	for i, gallery := range galleries {
+		ids[i] = gallery.ID
+	}
+
+	counts := []struct {
+		GalleryID uuid.UUID
+		Count     int
+	}{}
+	err := gg.db.Model(&Image{}).
+		Select("gallery_id, COUNT(*) AS count").
+		Where("gallery_id IN ?", ids).
+		Group("gallery_id").
+		Scan(&counts).Error
+	if err != nil {
+		return err
+	}
+
+	byID := make(map[uuid.UUID]int, len(counts))
+	for _, count := range counts {
+		byID[count.GalleryID] = count.Count
+	}
+	for _, gallery := range galleries {
+		gallery.ImageCount = byID[gallery.ID]
+	}
+	return nil
+}
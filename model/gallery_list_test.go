@@ -0,0 +1,234 @@
+package model_test
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/abanoub-fathy/bebo-gallery/model"
+	"github.com/stretchr/testify/suite"
+)
+
+// GalleryListSuite runs on the database and on the
+// memory services so both of them behave the same
+type GalleryListSuite struct {
+	suite.Suite
+	*model.Service
+	newService func(t *testing.T) *model.Service
+	user       *model.User
+}
+
+func (s *GalleryListSuite) SetupTest() {
+	s.Service = s.newService(s.T())
+
+	s.user = &model.User{FirstName: "Abanoub", LastName: "Fathy", Email: "aop4ever@gmail.com", Password: "12212154554554asdsa"}
+	s.Require().NoError(s.UserService.CreateUser(s.user))
+}
+
+func (s *GalleryListSuite) TearDownTest() {
+	s.Service.Close()
+}
+
+// createGalleries creates the galleries with the titles and the
+// numbers of images. they are created one after the other
+func (s *GalleryListSuite) createGalleries(titles []string, imageCounts []int) {
+	for i, title := range titles {
+		gallery := &model.Gallery{Title: title, UserID: s.user.ID}
+		s.Require().NoError(s.GalleryService.CreateGallery(gallery))
+		for j := 0; j < imageCounts[i]; j++ {
+			name := fmt.Sprintf("%v.jpg", j)
+			_, err := s.ImageService.CreateImage(io.NopCloser(strings.NewReader(name)), gallery.ID, name)
+			s.Require().NoError(err)
+		}
+		time.Sleep(2 * time.Millisecond)
+	}
+}
+
+// listAll lists all the pages of the query and returns the titles
+func (s *GalleryListSuite) listAll(query model.GalleryListQuery) []string {
+	titles := []string{}
+	for pages := 0; pages < 10; pages++ {
+		pageQuery := query
+		page, err := s.ListGalleries(&pageQuery)
+		s.Require().NoError(err)
+		s.Require().LessOrEqual(len(page.Galleries), pageQuery.Limit)
+		for _, gallery := range page.Galleries {
+			titles = append(titles, gallery.Title)
+		}
+		if page.NextCursor == "" {
+			return titles
+		}
+		query.Cursor = page.NextCursor
+	}
+	s.FailNow("too many pages")
+	return nil
+}
+
+func (s *GalleryListSuite) TestSorts() {
+	s.createGalleries([]string{"banana", "Apple", "cherry", "date", "elder"}, []int{2, 0, 3, 1, 2})
+
+	ascending := true
+	descending := false
+	tests := []struct {
+		query model.GalleryListQuery
+		want  []string
+	}{
+		{model.GalleryListQuery{}, []string{"elder", "date", "cherry", "Apple", "banana"}},
+		{model.GalleryListQuery{Ascending: &ascending}, []string{"banana", "Apple", "cherry", "date", "elder"}},
+		{model.GalleryListQuery{Sort: model.GallerySortTitle}, []string{"Apple", "banana", "cherry", "date", "elder"}},
+		{model.GalleryListQuery{Sort: model.GallerySortTitle, Ascending: &descending}, []string{"elder", "date", "cherry", "banana", "Apple"}},
+		{model.GalleryListQuery{Sort: model.GallerySortImageCount, Ascending: &ascending}, []string{"Apple", "date"}},
+	}
+
+	for _, test := range tests {
+		for _, limit := range []int{1, 2, 5} {
+			query := test.query
+			query.Limit = limit
+			titles := s.listAll(query)
+			if test.query.Sort == model.GallerySortImageCount {
+				// the galleries with the same count are
+				// ordered by their random ids
+				s.Assert().Equal(test.want, titles[:2], "limit %v", limit)
+				s.Assert().ElementsMatch([]string{"banana", "elder"}, titles[2:4], "limit %v", limit)
+				s.Assert().Equal("cherry", titles[4], "limit %v", limit)
+				continue
+			}
+			s.Assert().Equal(test.want, titles, "%+v limit %v", test.query, limit)
+		}
+	}
+
+	// the image counts are set
+	page, err := s.ListGalleries(&model.GalleryListQuery{Sort: model.GallerySortImageCount, Limit: 1})
+	s.Require().NoError(err)
+	s.Assert().Equal(3, page.Galleries[0].ImageCount)
+}
+
+func (s *GalleryListSuite) TestFilters() {
+	s.createGalleries([]string{"Summer Trip", "Winter Trip", "Party"}, []int{0, 0, 0})
+	page, err := s.ListGalleries(&model.GalleryListQuery{Title: "summer"})
+	s.Require().NoError(err)
+	s.Require().Len(page.Galleries, 1)
+	s.Require().NoError(s.SetGalleryTags(page.Galleries[0].ID, []string{"beach"}))
+
+	s.Assert().Equal([]string{"Winter Trip", "Summer Trip"}, s.listAll(model.GalleryListQuery{Title: " TRIP "}))
+	s.Assert().Equal([]string{"Summer Trip"}, s.listAll(model.GalleryListQuery{Tag: "#Beach"}))
+	s.Assert().Empty(s.listAll(model.GalleryListQuery{Title: "%"}))
+
+	other := &model.User{FirstName: "Other", LastName: "User", Email: "other@gmail.com", Password: "12212154554554asdsa"}
+	s.Require().NoError(s.UserService.CreateUser(other))
+	s.Assert().Empty(s.listAll(model.GalleryListQuery{UserID: other.ID}))
+	s.Assert().Len(s.listAll(model.GalleryListQuery{UserID: s.user.ID}), 3)
+}
+
+func (s *GalleryListSuite) TestPublic() {
+	s.createGalleries([]string{"first", "private", "second"}, []int{0, 0, 0})
+	for _, title := range []string{"second", "first"} {
+		page, err := s.ListGalleries(&model.GalleryListQuery{Title: title})
+		s.Require().NoError(err)
+		page.Galleries[0].SetPublic(true)
+		s.Require().NoError(s.GalleryService.Update(page.Galleries[0]))
+		time.Sleep(2 * time.Millisecond)
+	}
+
+	// the galleries are listed by their publish time
+	s.Assert().Equal([]string{"first", "second"}, s.listAll(model.GalleryListQuery{Sort: model.GallerySortPublished, Limit: 1}))
+	s.Assert().Equal([]string{"second", "first"}, s.listAll(model.GalleryListQuery{Public: true, Limit: 1}))
+
+	// unlisting the gallery removes it from the public listings
+	page, err := s.ListGalleries(&model.GalleryListQuery{Title: "first"})
+	s.Require().NoError(err)
+	page.Galleries[0].SetPublic(false)
+	s.Require().NoError(s.GalleryService.Update(page.Galleries[0]))
+	s.Assert().Equal([]string{"second"}, s.listAll(model.GalleryListQuery{Sort: model.GallerySortPublished}))
+}
+
+func (s *GalleryListSuite) TestValidation() {
+	_, err := s.ListGalleries(&model.GalleryListQuery{Sort: "views"})
+	s.Assert().Equal(model.ErrGallerySortInvalid, err)
+
+	_, err = s.ListGalleries(&model.GalleryListQuery{Cursor: "not a cursor"})
+	s.Assert().Equal(model.ErrCursorInvalid, err)
+
+	// the cursors of the other sorts are rejected
+	s.createGalleries([]string{"a", "b"}, []int{0, 0})
+	page, err := s.ListGalleries(&model.GalleryListQuery{Limit: 1})
+	s.Require().NoError(err)
+	s.Require().NotEmpty(page.NextCursor)
+	_, err = s.ListGalleries(&model.GalleryListQuery{Sort: model.GallerySortTitle, Cursor: page.NextCursor})
+	s.Assert().Equal(model.ErrCursorInvalid, err)
+}
+
+func (s *GalleryListSuite) TestImagePages() {
+	s.createGalleries([]string{"Trip"}, []int{5})
+	page, err := s.ListGalleries(&model.GalleryListQuery{})
+	s.Require().NoError(err)
+	gallery := page.Galleries[0]
+
+	names := []string{}
+	cursor := ""
+	for i := 0; i < 3; i++ {
+		imagePage, err := s.ImageService.ListImages(gallery.ID, cursor, 2)
+		s.Require().NoError(err)
+		names = append(names, fileNames(imagePage.Images)...)
+		cursor = imagePage.NextCursor
+		if cursor == "" {
+			break
+		}
+	}
+	s.Assert().Equal([]string{"0.jpg", "1.jpg", "2.jpg", "3.jpg", "4.jpg"}, names)
+	s.Assert().Empty(cursor)
+
+	_, err = s.ImageService.ListImages(gallery.ID, "!", 2)
+	s.Assert().Equal(model.ErrCursorInvalid, err)
+}
+
+func (s *GalleryListSuite) TestImageNeighbours() {
+	s.createGalleries([]string{"Trip"}, []int{3})
+	page, err := s.ListGalleries(&model.GalleryListQuery{})
+	s.Require().NoError(err)
+	images, err := s.ImageService.GetImagesByGalleryID(page.Galleries[0].ID)
+	s.Require().NoError(err)
+	s.Require().Len(images, 3)
+
+	tests := []struct {
+		image      model.Image
+		prev, next string
+	}{
+		{images[0], "", "1.jpg"},
+		{images[1], "0.jpg", "2.jpg"},
+		{images[2], "1.jpg", ""},
+	}
+	for _, test := range tests {
+		prev, next, err := s.ImageService.FindNeighbours(&test.image)
+		s.Require().NoError(err)
+		for _, neighbour := range []struct {
+			image *model.Image
+			want  string
+		}{{prev, test.prev}, {next, test.next}} {
+			if neighbour.want == "" {
+				s.Assert().Nil(neighbour.image, test.image.FileName)
+				continue
+			}
+			s.Require().NotNil(neighbour.image, test.image.FileName)
+			s.Assert().Equal(neighbour.want, neighbour.image.FileName, test.image.FileName)
+		}
+	}
+}
+
+func TestGalleryListSuite(t *testing.T) {
+	suite.Run(t, &GalleryListSuite{newService: func(t *testing.T) *model.Service {
+		service := newTestService(t)
+		if err := service.ResetDB(); err != nil {
+			t.Fatal("Unable to reset the db", err)
+		}
+		return service
+	}})
+}
+
+func TestMemoryGalleryListSuite(t *testing.T) {
+	suite.Run(t, &GalleryListSuite{newService: func(t *testing.T) *model.Service {
+		return model.NewMemoryService("test-hash-secret-key")
+	}})
+}
@@ -0,0 +1,266 @@
+package model_test
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/iotest"
+
+	"github.com/abanoub-fathy/bebo-gallery/model"
+	uuid "github.com/satori/go.uuid"
+	"github.com/stretchr/testify/suite"
+)
+
+type GalleryServiceSuite struct {
+	suite.Suite
+	*model.Service
+	user      *model.User
+	imagesDir string
+}
+
+func (s *GalleryServiceSuite) SetupSuite() {
+	cfg := newTestConfig(s.T())
+	s.imagesDir = cfg.Storage.ImagesDir
+	s.Service = newTestServiceWithConfig(s.T(), cfg)
+}
+
+func (s *GalleryServiceSuite) SetupTest() {
+	s.Require().NoError(s.Service.ResetDB())
+
+	s.user = &model.User{
+		FirstName: "Abanoub",
+		LastName:  "Fathy",
+		Email:     "aop4ever@gmail.com",
+		Password:  "12212154554554asdsa",
+	}
+	s.Require().NoError(s.UserService.CreateUser(s.user))
+}
+
+func (s *GalleryServiceSuite) TearDownSuite() {
+	s.Service.Close()
+}
+
+func (s *GalleryServiceSuite) TestCreateGalleryValidation() {
+	err := s.GalleryService.CreateGallery(&model.Gallery{UserID: s.user.ID})
+	s.Assert().Equal(model.ErrGalleryTitleRequired, err)
+
+	err = s.GalleryService.CreateGallery(&model.Gallery{Title: "No Owner"})
+	s.Assert().Equal(model.ErrUserIDRequired, err)
+}
+
+func (s *GalleryServiceSuite) TestGalleryLifecycle() {
+	gallery := &model.Gallery{Title: "Wedding", UserID: s.user.ID}
+	s.Require().NoError(s.GalleryService.CreateGallery(gallery))
+
+	found, err := s.GalleryService.FindByID(gallery.ID.String())
+	s.Require().NoError(err)
+	s.Assert().Equal("Wedding", found.Title)
+
+	found.Title = "Our Wedding"
+	s.Require().NoError(s.GalleryService.Update(found))
+
+	galleries, err := s.GalleryService.FindByUserID(s.user.ID)
+	s.Require().NoError(err)
+	s.Require().Len(galleries, 1)
+	s.Assert().Equal("Our Wedding", galleries[0].Title)
+
+	s.Require().NoError(s.GalleryService.Delete(found))
+	_, err = s.GalleryService.FindByID(gallery.ID.String())
+	s.Assert().Equal(model.ErrNotFound, err)
+}
+
+func (s *GalleryServiceSuite) TestCollectGarbage() {
+	gallery := &model.Gallery{Title: "Trip", UserID: s.user.ID}
+	s.Require().NoError(s.GalleryService.CreateGallery(gallery))
+	_, err := s.ImageService.CreateImage(io.NopCloser(strings.NewReader("image")), gallery.ID, "a.jpg")
+	s.Require().NoError(err)
+
+	report, err := s.CollectGarbage(false)
+	s.Require().NoError(err)
+	s.Assert().Empty(report.OrphanImageDirs)
+
+	s.Require().NoError(s.GalleryService.Delete(gallery))
+	report, err = s.CollectGarbage(false)
+	s.Require().NoError(err)
+	s.Assert().Equal([]string{gallery.ID.String()}, report.OrphanImageDirs)
+
+	images, err := s.ImageService.GetImagesByGalleryID(gallery.ID)
+	s.Require().NoError(err)
+	s.Assert().Empty(images)
+}
+
+func (s *GalleryServiceSuite) TestImageOrderAndCover() {
+	gallery := &model.Gallery{Title: "Trip", UserID: s.user.ID}
+	s.Require().NoError(s.GalleryService.CreateGallery(gallery))
+
+	ids := []uuid.UUID{}
+	for _, name := range []string{"c.jpg", "a.jpg", "b.jpg"} {
+		image, err := s.ImageService.CreateImage(io.NopCloser(strings.NewReader(name)), gallery.ID, name)
+		s.Require().NoError(err)
+		ids = append(ids, image.ID)
+	}
+
+	// the images are in the order of the uploads
+	images, err := s.ImageService.GetImagesByGalleryID(gallery.ID)
+	s.Require().NoError(err)
+	s.Assert().Equal([]string{"c.jpg", "a.jpg", "b.jpg"}, fileNames(images))
+
+	// replacing a file keeps its position
+	image, err := s.ImageService.CreateImage(io.NopCloser(strings.NewReader("new")), gallery.ID, "c.jpg")
+	s.Require().NoError(err)
+	s.Assert().Equal(ids[0], image.ID)
+
+	s.Require().NoError(s.ImageService.ReorderImages(gallery.ID, []uuid.UUID{ids[2], ids[0], ids[1]}))
+	images, err = s.ImageService.GetImagesByGalleryID(gallery.ID)
+	s.Require().NoError(err)
+	s.Assert().Equal([]string{"b.jpg", "c.jpg", "a.jpg"}, fileNames(images))
+
+	// the order should list every image once
+	for _, order := range [][]uuid.UUID{{ids[0], ids[1]}, {ids[0], ids[0], ids[1]}, {ids[0], ids[1], uuid.NewV4()}} {
+		s.Assert().Equal(model.ErrImageOrderInvalid, s.ImageService.ReorderImages(gallery.ID, order))
+	}
+
+	// the cover is the first image until one is chosen
+	gallery.Images = images
+	s.Assert().Equal("b.jpg", gallery.Cover().FileName)
+	gallery.CoverImageID = &ids[1]
+	s.Require().NoError(s.GalleryService.Update(gallery))
+	found, err := s.GalleryService.FindByID(gallery.ID.String())
+	s.Require().NoError(err)
+	found.Images = images
+	s.Assert().Equal("a.jpg", found.Cover().FileName)
+
+	// deleting the cover image unsets it
+	s.Require().NoError(s.ImageService.DeleteImage(&model.Image{GalleryID: gallery.ID, FileName: "a.jpg"}))
+	found, err = s.GalleryService.FindByID(gallery.ID.String())
+	s.Require().NoError(err)
+	s.Assert().Nil(found.CoverImageID)
+
+	_, err = s.ImageService.FindImageByID(gallery.ID, ids[1])
+	s.Assert().Equal(model.ErrNotFound, err)
+}
+
+func (s *GalleryServiceSuite) TestImagesWithoutRecords() {
+	gallery := &model.Gallery{Title: "Trip", UserID: s.user.ID}
+	s.Require().NoError(s.GalleryService.CreateGallery(gallery))
+	_, err := s.ImageService.CreateImage(io.NopCloser(strings.NewReader("image")), gallery.ID, "b.jpg")
+	s.Require().NoError(err)
+
+	// the files uploaded before the images had records
+	// are added after the other images by name
+	dir := filepath.Join(s.imagesDir, "galleries", gallery.ID.String())
+	for _, name := range []string{"d.jpg", "a.jpg"} {
+		s.Require().NoError(os.WriteFile(filepath.Join(dir, name), []byte(name), 0644))
+	}
+
+	// reading the images adds nothing
+	images, err := s.ImageService.GetImagesByGalleryID(gallery.ID)
+	s.Require().NoError(err)
+	s.Assert().Equal([]string{"b.jpg"}, fileNames(images))
+
+	report, err := s.CollectGarbage(true)
+	s.Require().NoError(err)
+	s.Assert().Equal(2, report.RecordedImages)
+	images, err = s.ImageService.GetImagesByGalleryID(gallery.ID)
+	s.Require().NoError(err)
+	s.Assert().Len(images, 1)
+
+	count, err := s.RecordMissingImages(true)
+	s.Require().NoError(err)
+	s.Assert().Equal(2, count)
+
+	// migrating adds the records so an upgrade does not hide them
+	s.Require().NoError(s.Migrate())
+	images, err = s.ImageService.GetImagesByGalleryID(gallery.ID)
+	s.Require().NoError(err)
+	s.Assert().Equal([]string{"b.jpg", "a.jpg", "d.jpg"}, fileNames(images))
+
+	report, err = s.CollectGarbage(false)
+	s.Require().NoError(err)
+	s.Assert().Equal(0, report.RecordedImages)
+
+	recorded, err := s.ImageService.RecordImages(gallery.ID, false)
+	s.Require().NoError(err)
+	s.Assert().Empty(recorded)
+}
+
+func (s *GalleryServiceSuite) TestReplaceImageFails() {
+	gallery := &model.Gallery{Title: "Trip", UserID: s.user.ID}
+	s.Require().NoError(s.GalleryService.CreateGallery(gallery))
+	image, err := s.ImageService.CreateImage(io.NopCloser(strings.NewReader("original")), gallery.ID, "a.jpg")
+	s.Require().NoError(err)
+
+	// the failed copy does not cut the image it replaces
+	reader := io.MultiReader(strings.NewReader("cut"), iotest.ErrReader(errors.New("connection reset")))
+	_, err = s.ImageService.CreateImage(io.NopCloser(reader), gallery.ID, "a.jpg")
+	s.Require().Error(err)
+
+	file, err := s.ImageService.Open(image)
+	s.Require().NoError(err)
+	defer file.Close()
+	content, err := io.ReadAll(file)
+	s.Require().NoError(err)
+	s.Assert().Equal("original", string(content))
+
+	// the temp files are not left behind
+	entries, err := os.ReadDir(filepath.Join(s.imagesDir, "galleries", gallery.ID.String()))
+	s.Require().NoError(err)
+	s.Assert().Len(entries, 1)
+	entries, err = os.ReadDir(filepath.Join(s.imagesDir, "tmp"))
+	s.Require().NoError(err)
+	s.Assert().Empty(entries)
+}
+
+func (s *GalleryServiceSuite) TestUpdateImages() {
+	gallery := &model.Gallery{Title: "Trip", UserID: s.user.ID}
+	s.Require().NoError(s.GalleryService.CreateGallery(gallery))
+
+	images := []model.Image{}
+	for _, name := range []string{"beach.jpg", "boat.jpg"} {
+		image, err := s.ImageService.CreateImage(io.NopCloser(strings.NewReader(name)), gallery.ID, name)
+		s.Require().NoError(err)
+		s.Assert().Equal(strings.TrimSuffix(name, ".jpg"), image.Alt())
+		images = append(images, *image)
+	}
+
+	images[0].Title = "  Sunset  "
+	images[0].Caption = "The **last** day"
+	images[1].AltText = "A red boat on the sea"
+	s.Require().NoError(s.ImageService.UpdateImages(gallery.ID, images))
+
+	found, err := s.ImageService.GetImagesByGalleryID(gallery.ID)
+	s.Require().NoError(err)
+	s.Assert().Equal("Sunset", found[0].Title)
+	s.Assert().Equal("The **last** day", found[0].Caption)
+	s.Assert().Equal("Sunset", found[0].Alt())
+	s.Assert().Equal("A red boat on the sea", found[1].Alt())
+
+	// nothing is updated if one of the images is not valid
+	found[0].Title = "Dawn"
+	found[1].AltText = strings.Repeat("a", model.MaxImageAltTextLength+1)
+	s.Assert().Equal(model.ErrImageAltTextTooLong, s.ImageService.UpdateImages(gallery.ID, found))
+
+	found[1].AltText = ""
+	found = append(found, model.Image{Base: model.Base{ID: uuid.NewV4()}})
+	s.Assert().Equal(model.ErrNotFound, s.ImageService.UpdateImages(gallery.ID, found))
+
+	found, err = s.ImageService.GetImagesByGalleryID(gallery.ID)
+	s.Require().NoError(err)
+	s.Assert().Equal("Sunset", found[0].Title)
+	s.Assert().Equal("A red boat on the sea", found[1].AltText)
+}
+
+func fileNames(images []model.Image) []string {
+	names := []string{}
+	for _, image := range images {
+		names = append(names, image.FileName)
+	}
+	return names
+}
+
+func TestGalleryServiceSuite(t *testing.T) {
+	suite.Run(t, new(GalleryServiceSuite))
+}
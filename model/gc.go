@@ -0,0 +1,77 @@
+package model
+
+// GCReport describes what is removed by
+// the garbage collection of the service
+type GCReport struct {
+	// OrphanImageDirs are the ids of the deleted or missing
+	// galleries that still have images on the disk
+	OrphanImageDirs []string
+
+	// RecordedImages is the number of the image files of the
+	// galleries that get their records. they are the files
+	// uploaded before the images had records
+	RecordedImages int
+
+	// ExpiredResetTokens is the number of the
+	// expired reset password tokens
+	ExpiredResetTokens int64
+
+	// ExpiredLoginTokens is the number of the
+	// expired login link tokens
+	ExpiredLoginTokens int64
+}
+
+// CollectGarbage removes the data that is not used any more
+// like the images of the deleted galleries and the expired
+// reset password and login link tokens. it adds the records
+// of the image files that have none too
+//
+// if dryRun is true nothing is removed and the report
+// tells what would be removed
+func (s *Service) CollectGarbage(dryRun bool) (*GCReport, error) {
+	report := &GCReport{OrphanImageDirs: []string{}}
+
+	// find the images of the galleries that are not found
+	// and the images of the other galleries without records
+	galleryIDs, err := s.ImageService.GetGalleryIDs()
+	if err != nil {
+		return nil, err
+	}
+	for _, galleryID := range galleryIDs {
+		_, err := s.GalleryService.FindByID(galleryID.String())
+		switch err {
+		case nil:
+			recorded, err := s.ImageService.RecordImages(galleryID, dryRun)
+			if err != nil {
+				return nil, err
+			}
+			report.RecordedImages += len(recorded)
+			continue
+		case ErrNotFound:
+		default:
+			return nil, err
+		}
+
+		report.OrphanImageDirs = append(report.OrphanImageDirs, galleryID.String())
+		if dryRun {
+			continue
+		}
+		if err := s.ImageService.DeleteImagesByGalleryID(galleryID); err != nil {
+			return nil, err
+		}
+	}
+
+	// remove the expired reset password tokens
+	report.ExpiredResetTokens, err = s.UserService.CleanExpiredResetTokens(dryRun)
+	if err != nil {
+		return nil, err
+	}
+
+	// remove the expired login link tokens
+	report.ExpiredLoginTokens, err = s.UserService.CleanExpiredLoginTokens(dryRun)
+	if err != nil {
+		return nil, err
+	}
+
+	return report, nil
+}
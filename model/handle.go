@@ -0,0 +1,169 @@
+package model
+
+import (
+	"fmt"
+	"strings"
+)
+
+const (
+	// ErrHandleInvalid is returned when a handle is too short,
+	// too long or has chars other than the ascii letters,
+	// digits, dashes and underscores
+	ErrHandleInvalid publicError = "handle should be 3 to 39 letters, digits, dashes or underscores"
+
+	// ErrHandleReserved is returned when the handle
+	// is one of the reserved handles
+	ErrHandleReserved publicError = "handle is reserved, choose another one"
+
+	// ErrHandleTaken is returned when another
+	// user already has the handle
+	ErrHandleTaken publicError = "handle is already taken"
+)
+
+const (
+	// MinHandleLength is the min length of a handle
+	MinHandleLength = 3
+
+	// MaxHandleLength is the max length of a handle
+	MaxHandleLength = 39
+)
+
+// reservedHandles can not be chosen by the users because
+// they are the names of the pages or they can be mistaken
+// for the staff of the website
+var reservedHandles = map[string]bool{
+	"about": true, "account": true, "admin": true, "administrator": true,
+	"api": true, "assets": true, "auth": true, "bebo": true,
+	"contact": true, "explore": true, "galleries": true, "gallery": true,
+	"help": true, "home": true, "images": true, "login": true,
+	"logout": true, "me": true, "moderator": true, "new": true,
+	"null": true, "oauth": true, "password": true, "root": true,
+	"search": true, "security": true, "settings": true, "signup": true,
+	"staff": true, "static": true, "support": true, "system": true,
+	"tags": true, "undefined": true, "user": true, "users": true,
+	"www": true,
+}
+
+// IsReservedHandle tells if the handle can not be chosen
+func IsReservedHandle(handle string) bool {
+	return reservedHandles[strings.ToLower(handle)]
+}
+
+// NormalizeHandle returns the handle in lower case
+// without the spaces around it and the leading @
+func NormalizeHandle(handle string) string {
+	return strings.ToLower(strings.TrimPrefix(strings.TrimSpace(handle), "@"))
+}
+
+// validHandle tells if the normalized handle has a valid
+// length and only the allowed chars. it can not start or
+// end with a dash or an underscore
+func validHandle(handle string) bool {
+	if len(handle) < MinHandleLength || len(handle) > MaxHandleLength {
+		return false
+	}
+	for i, r := range handle {
+		switch {
+		case r >= 'a' && r <= 'z', r >= '0' && r <= '9':
+		case (r == '-' || r == '_') && i > 0 && i < len(handle)-1:
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// handleFromEmail returns a valid handle made from the
+// local part of the email. it may be reserved or taken
+func handleFromEmail(email string) string {
+	local := email
+	if at := strings.Index(local, "@"); at >= 0 {
+		local = local[:at]
+	}
+
+	var b strings.Builder
+	for _, r := range strings.ToLower(local) {
+		switch {
+		case r >= 'a' && r <= 'z', r >= '0' && r <= '9', r == '_':
+			b.WriteRune(r)
+		default:
+			b.WriteRune('-')
+		}
+	}
+
+	handle := strings.Trim(b.String(), "-_")
+	if len(handle) > MaxHandleLength-4 {
+		handle = strings.TrimRight(handle[:MaxHandleLength-4], "-_")
+	}
+	if len(handle) < MinHandleLength {
+		handle = "user"
+	}
+	return handle
+}
+
+// NormalizeHandle normalizes the handle of the user
+func (uv *userValidator) NormalizeHandle(user *User) error {
+	user.Handle = NormalizeHandle(user.Handle)
+	return nil
+}
+
+// ValidateHandle checks that the handle is valid and not reserved
+func (uv *userValidator) ValidateHandle(user *User) error {
+	if !validHandle(user.Handle) {
+		return ErrHandleInvalid
+	}
+	if IsReservedHandle(user.Handle) {
+		return ErrHandleReserved
+	}
+	return nil
+}
+
+// HandleIsNotTaken checks that no other user has the handle
+func (uv *userValidator) HandleIsNotTaken(user *User) error {
+	existing, err := uv.UserDB.FindByHandle(user.Handle)
+	if err == ErrNotFound {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if existing.ID.String() != user.ID.String() {
+		return ErrHandleTaken
+	}
+	return nil
+}
+
+// SetHandle validates the chosen handle or it sets a free handle
+// made from the email of the user if the handle is empty. the
+// numbers are added to the handle until it is free
+func (uv *userValidator) SetHandle(user *User) error {
+	if user.Handle != "" {
+		return runUserValidationFuncs(user, uv.ValidateHandle, uv.HandleIsNotTaken)
+	}
+
+	base := handleFromEmail(user.Email)
+	for i := 1; i <= 1000; i++ {
+		user.Handle = base
+		if i > 1 {
+			user.Handle = fmt.Sprintf("%s%d", base, i)
+		}
+		err := runUserValidationFuncs(user, uv.ValidateHandle, uv.HandleIsNotTaken)
+		if err == nil {
+			return nil
+		}
+		if err != ErrHandleReserved && err != ErrHandleTaken {
+			return err
+		}
+	}
+	user.Handle = ""
+	return ErrHandleTaken
+}
+
+// FindByHandle normalizes the handle before finding the user
+func (uv *userValidator) FindByHandle(handle string) (*User, error) {
+	handle = NormalizeHandle(handle)
+	if !validHandle(handle) {
+		return nil, ErrNotFound
+	}
+	return uv.UserDB.FindByHandle(handle)
+}
@@ -0,0 +1,295 @@
+package model
+
+import (
+	"strings"
+
+	"github.com/abanoub-fathy/bebo-gallery/pkg/rand"
+	uuid "github.com/satori/go.uuid"
+	"gorm.io/gorm"
+)
+
+const (
+	ErrIdentityProviderRequired publicError = "model: identity provider is required"
+	ErrIdentitySubjectRequired  publicError = "model: identity subject is required"
+	ErrIdentityIsLinked         publicError = "model: this account is already connected to another user"
+
+	// ErrIdentityEmailNotVerified is returned when a new external
+	// account can not be linked because its email is not verified
+	ErrIdentityEmailNotVerified publicError = "model: the provider did not share a verified email address"
+)
+
+// Identity links the account of a user at an
+// external OpenID Connect provider to the User
+type Identity struct {
+	Base
+	UserID   uuid.UUID `gorm:"not null;index"`
+	Provider string    `gorm:"not null"`
+	Subject  string    `gorm:"not null"`
+	Email    string
+}
+
+// IdentityService is used to manage the identities of the users
+type IdentityService interface {
+	IdentityDB
+}
+
+// IdentityDB has all methods needed to implement and
+// use the identities database methods
+type IdentityDB interface {
+	// Create links a new identity to the user
+	// it returns ErrIdentityIsLinked if the provider
+	// account is linked already
+	Create(identity *Identity) error
+
+	// FindByProviderSubject returns the identity of the
+	// provider account
+	FindByProviderSubject(provider, subject string) (*Identity, error)
+
+	// FindByUserID returns the identities of the user
+	FindByUserID(userID uuid.UUID) ([]*Identity, error)
+
+	// Delete disconnects the identity of the user
+	Delete(userID uuid.UUID, id uuid.UUID) error
+}
+
+type identityService struct {
+	IdentityDB
+}
+
+// NewIdentityService creates a new IdentityService
+func NewIdentityService(db *gorm.DB) IdentityService {
+	return NewIdentityServiceWithDB(newIdentityGorm(db))
+}
+
+// NewIdentityServiceWithDB creates a new IdentityService
+// on top of the given db layer like the in memory one
+func NewIdentityServiceWithDB(identityDB IdentityDB) IdentityService {
+	return &identityService{
+		IdentityDB: &identityValidator{identityDB},
+	}
+}
+
+type identityValidator struct {
+	IdentityDB
+}
+
+type identityValidationFn func(identity *Identity) error
+
+func runIdentityValidationFns(identity *Identity, fns ...identityValidationFn) error {
+	for _, fn := range fns {
+		if err := fn(identity); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (iv *identityValidator) Create(identity *Identity) error {
+	err := runIdentityValidationFns(identity,
+		iv.requireUserID,
+		iv.requireProvider,
+		iv.requireSubject,
+		iv.normalizeEmail,
+		iv.subjectIsNotLinked,
+	)
+	if err != nil {
+		return err
+	}
+
+	return iv.IdentityDB.Create(identity)
+}
+
+func (iv *identityValidator) Delete(userID uuid.UUID, id uuid.UUID) error {
+	if userID.String() == ZeroID {
+		return ErrUserIDRequired
+	}
+	if id.String() == ZeroID {
+		return ErrInvalidID
+	}
+	return iv.IdentityDB.Delete(userID, id)
+}
+
+func (iv *identityValidator) requireUserID(identity *Identity) error {
+	if identity.UserID.String() == ZeroID {
+		return ErrUserIDRequired
+	}
+	return nil
+}
+
+func (iv *identityValidator) requireProvider(identity *Identity) error {
+	if identity.Provider == "" {
+		return ErrIdentityProviderRequired
+	}
+	return nil
+}
+
+func (iv *identityValidator) requireSubject(identity *Identity) error {
+	if identity.Subject == "" {
+		return ErrIdentitySubjectRequired
+	}
+	return nil
+}
+
+func (iv *identityValidator) normalizeEmail(identity *Identity) error {
+	identity.Email = strings.ToLower(strings.TrimSpace(identity.Email))
+	return nil
+}
+
+func (iv *identityValidator) subjectIsNotLinked(identity *Identity) error {
+	_, err := iv.IdentityDB.FindByProviderSubject(identity.Provider, identity.Subject)
+	switch err {
+	case nil:
+		return ErrIdentityIsLinked
+	case ErrNotFound:
+		return nil
+	default:
+		return err
+	}
+}
+
+type identityGorm struct {
+	db *gorm.DB
+}
+
+func newIdentityGorm(db *gorm.DB) *identityGorm {
+	return &identityGorm{db: db}
+}
+
+// make sure that identityGorm implements IdentityDB
+var _ IdentityDB = (*identityGorm)(nil)
+
+func (ig *identityGorm) Create(identity *Identity) error {
+	return ig.db.Create(identity).Error
+}
+
+func (ig *identityGorm) FindByProviderSubject(provider, subject string) (*Identity, error) {
+	identity := new(Identity)
+	query := ig.db.Where(Identity{
+		Provider: provider,
+		Subject:  subject,
+	})
+	if err := getRecord(query, identity); err != nil {
+		return nil, err
+	}
+	return identity, nil
+}
+
+func (ig *identityGorm) FindByUserID(userID uuid.UUID) ([]*Identity, error) {
+	identities := []*Identity{}
+	err := ig.db.Where("user_id = ?", userID).Order("created_at").Find(&identities).Error
+	return identities, err
+}
+
+func (ig *identityGorm) Delete(userID uuid.UUID, id uuid.UUID) error {
+	result := ig.db.Unscoped().Where("user_id = ? AND id = ?", userID, id).Delete(&Identity{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// ExternalAccount is the account of the user at a provider
+// as reported by the provider
+type ExternalAccount struct {
+	Provider      string
+	Subject       string
+	Email         string
+	EmailVerified bool
+	FirstName     string
+	LastName      string
+}
+
+// AuthenticateExternalAccount returns the user of the account.
+//
+// if the account is not linked yet it is linked to the user
+// with the same email only if the provider verified the email.
+// if there is no such user a new user is created with a random
+// password that can be changed by resetting the password
+func (s *Service) AuthenticateExternalAccount(account ExternalAccount) (*User, error) {
+	identity, err := s.IdentityService.FindByProviderSubject(account.Provider, account.Subject)
+	switch err {
+	case nil:
+		user, err := s.UserService.FindByID(identity.UserID.String())
+		if err != nil {
+			return nil, err
+		}
+		if user.Disabled {
+			return nil, ErrUserDisabled
+		}
+		return user, nil
+	case ErrNotFound:
+	default:
+		return nil, err
+	}
+
+	if account.Email == "" || !account.EmailVerified {
+		return nil, ErrIdentityEmailNotVerified
+	}
+
+	user, err := s.UserService.FindByEmail(account.Email)
+	switch err {
+	case nil:
+		if user.Disabled {
+			return nil, ErrUserDisabled
+		}
+	case ErrNotFound:
+		user = &User{
+			FirstName: account.FirstName,
+			LastName:  account.LastName,
+			Email:     account.Email,
+		}
+		if err := s.createExternalUser(user); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, err
+	}
+
+	if err := s.ConnectExternalAccount(user, account); err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// ConnectExternalAccount links the account to the user whatever
+// its email is. it returns ErrIdentityIsLinked if the account
+// is linked to another user
+func (s *Service) ConnectExternalAccount(user *User, account ExternalAccount) error {
+	identity, err := s.IdentityService.FindByProviderSubject(account.Provider, account.Subject)
+	switch {
+	case err == nil && uuid.Equal(identity.UserID, user.ID):
+		return nil
+	case err == nil:
+		return ErrIdentityIsLinked
+	case err != ErrNotFound:
+		return err
+	}
+
+	return s.IdentityService.Create(&Identity{
+		UserID:   user.ID,
+		Provider: account.Provider,
+		Subject:  account.Subject,
+		Email:    account.Email,
+	})
+}
+
+// createExternalUser creates the user with a random password the user
+// never knows. a new one is generated if the random password contains
+// the name of the user by chance
+func (s *Service) createExternalUser(user *User) error {
+	for attempt := 0; ; attempt++ {
+		password, err := rand.RandString(32)
+		if err != nil {
+			return err
+		}
+		user.Password = password
+
+		err = s.UserService.CreateUser(user)
+		if err != ErrPasswordHasPersonalInfo || attempt == 2 {
+			return err
+		}
+	}
+}
@@ -1,19 +1,90 @@
 package model
 
 import (
+	"encoding/base64"
+	"encoding/json"
 	"fmt"
 	"io"
 	"net/url"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
+	"unicode/utf8"
 
+	"github.com/abanoub-fathy/bebo-gallery/pkg/exif"
 	uuid "github.com/satori/go.uuid"
+	"gorm.io/gorm"
 )
 
+const (
+	// ErrImageOrderInvalid is returned when the ids of a reorder
+	// are not the ids of all the images of the gallery
+	ErrImageOrderInvalid publicError = "model: the image ids should list every image of the gallery once"
+
+	// ErrImageTitleTooLong is returned when the title of
+	// the image is longer than MaxImageTitleLength
+	ErrImageTitleTooLong publicError = "image title is too long"
+
+	// ErrImageCaptionTooLong is returned when the caption of
+	// the image is longer than MaxImageCaptionLength
+	ErrImageCaptionTooLong publicError = "image caption is too long"
+
+	// ErrImageAltTextTooLong is returned when the alt text of
+	// the image is longer than MaxImageAltTextLength
+	ErrImageAltTextTooLong publicError = "image alt text is too long"
+)
+
+const (
+	// DefaultImagePageLimit is the number of the images of
+	// a page of a gallery when its limit is not set
+	DefaultImagePageLimit = 30
+
+	// MaxImagePageLimit is the max limit of an image page
+	MaxImagePageLimit = 100
+)
+
+// the max lengths of the details of the images in chars
+const (
+	MaxImageTitleLength   = 200
+	MaxImageCaptionLength = 2000
+	MaxImageAltTextLength = 500
+)
+
+// Image is an image file of a gallery. the file is stored on
+// the disk and its record keeps its position in the gallery
 type Image struct {
-	GalleryID string
-	FileName  string
+	Base
+	GalleryID uuid.UUID `gorm:"not null;uniqueIndex:idx_images_gallery_file"`
+	FileName  string    `gorm:"not null;uniqueIndex:idx_images_gallery_file"`
+	Position  int       `gorm:"not null"`
+
+	Title string `gorm:"not null"`
+
+	// Caption is written in the markdown subset of pkg/markdown
+	Caption string `gorm:"not null"`
+
+	// AltText describes the image for the screen readers
+	AltText string `gorm:"not null"`
+
+	// Camera is the make and the model of the camera read
+	// from the exif data of the file. it is empty if the
+	// file has no exif data
+	Camera string `gorm:"not null"`
+
+	Tags []string `gorm:"-"`
+}
+
+// Alt returns the alt text of the image. it falls back to the
+// title and then to the file name without its extension
+func (i *Image) Alt() string {
+	if i.AltText != "" {
+		return i.AltText
+	}
+	if i.Title != "" {
+		return i.Title
+	}
+	return strings.TrimSuffix(i.FileName, filepath.Ext(i.FileName))
 }
 
 // Path method is used to return the full path to the image
@@ -28,69 +99,403 @@ func (i *Image) RelativePath() string {
 	return fmt.Sprintf("images/galleries/%v/%v", i.GalleryID, i.FileName)
 }
 
+// ImagePage is a page of the images of a gallery
+type ImagePage struct {
+	Images []Image
+
+	// NextCursor is the cursor of the next page
+	// it is empty if this is the last page
+	NextCursor string
+}
+
+// imageCursor is the position after the last image of a page
+type imageCursor struct {
+	Position int    `json:"p"`
+	FileName string `json:"f"`
+}
+
+func (cursor *imageCursor) encode() string {
+	data, _ := json.Marshal(cursor)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// after tells if the image comes after the cursor
+func (cursor *imageCursor) after(image Image) bool {
+	if image.Position != cursor.Position {
+		return image.Position > cursor.Position
+	}
+	return image.FileName > cursor.FileName
+}
+
+// decodeImageCursor returns nil for the cursor of the first page
+func decodeImageCursor(s string) (*imageCursor, error) {
+	if s == "" {
+		return nil, nil
+	}
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, ErrCursorInvalid
+	}
+	cursor := new(imageCursor)
+	if err := json.Unmarshal(data, cursor); err != nil {
+		return nil, ErrCursorInvalid
+	}
+	return cursor, nil
+}
+
+// imagePageLimit returns the limit or the default one
+func imagePageLimit(limit int) int {
+	if limit <= 0 || limit > MaxImagePageLimit {
+		return DefaultImagePageLimit
+	}
+	return limit
+}
+
+// newImagePage returns the page of the images. the images
+// have one more image than the limit if there is a next page
+func newImagePage(images []Image, limit int) *ImagePage {
+	page := &ImagePage{Images: images}
+	if len(images) > limit {
+		page.Images = images[:limit]
+		last := page.Images[limit-1]
+		page.NextCursor = (&imageCursor{Position: last.Position, FileName: last.FileName}).encode()
+	}
+	return page
+}
+
+// sortImages sorts the images by their position
+// and the images with the same position by name
+func sortImages(images []Image) {
+	sort.SliceStable(images, func(i, j int) bool {
+		if images[i].Position != images[j].Position {
+			return images[i].Position < images[j].Position
+		}
+		return images[i].FileName < images[j].FileName
+	})
+}
+
 type ImageService interface {
-	CreateImage(reader io.ReadCloser, galleryID uuid.UUID, fileName string) error
+	// CreateImage saves the image file and adds it to the end of
+	// the gallery. a file with the same name is replaced and
+	// keeps its position
+	CreateImage(reader io.ReadCloser, galleryID uuid.UUID, fileName string) (*Image, error)
+
+	// GetImagesByGalleryID returns the images of the gallery by position
 	GetImagesByGalleryID(galleryID uuid.UUID) ([]Image, error)
+
+	// ListImages returns a page of the images of the gallery by
+	// position. the cursor is the NextCursor of the previous page
+	// and it is empty for the first page. the files without records
+	// are not listed until RecordImages adds their records
+	ListImages(galleryID uuid.UUID, cursor string, limit int) (*ImagePage, error)
+
+	// RecordImages adds the records of the files of the gallery that
+	// have none like the files uploaded before the images had
+	// records. they are added after the other images by name and
+	// their names are returned. if dryRun is true nothing is added
+	RecordImages(galleryID uuid.UUID, dryRun bool) ([]string, error)
+
+	// FindImageByID returns the image of the gallery
+	// it returns ErrNotFound if it is not in the gallery
+	FindImageByID(galleryID, imageID uuid.UUID) (*Image, error)
+
+	// FindImageByFileName returns the image of the gallery with
+	// the file name. it returns ErrNotFound if it is not found
+	FindImageByFileName(galleryID uuid.UUID, fileName string) (*Image, error)
+
+	// Open returns the content of the image. it returns
+	// ErrNotFound if the file of the image is not stored
+	Open(image *Image) (io.ReadCloser, error)
+
+	// FindNeighbours returns the images before and after the image
+	// in the gallery by position. they are nil at the ends
+	FindNeighbours(image *Image) (prev, next *Image, err error)
+
+	// UpdateImages updates the title, caption and alt text of the
+	// images of the gallery found by their ID. all of them are
+	// updated or none. it returns ErrNotFound if one of the
+	// images is not in the gallery
+	UpdateImages(galleryID uuid.UUID, images []Image) error
+
+	// DeleteImage deletes the image of the GalleryID and FileName
 	DeleteImage(image *Image) error
+
+	// ReorderImages sets the positions of the images of the gallery
+	// to the order of imageIDs. it should list every image of the
+	// gallery once and nothing is changed if it does not
+	ReorderImages(galleryID uuid.UUID, imageIDs []uuid.UUID) error
+
+	// GetGalleryIDs returns the ids of all the
+	// galleries that have images stored
+	GetGalleryIDs() ([]uuid.UUID, error)
+
+	// DeleteImagesByGalleryID deletes all the images of the gallery
+	DeleteImagesByGalleryID(galleryID uuid.UUID) error
+}
+
+// imageDB is used to interact with the records of the images
+type imageDB interface {
+	FindByGalleryID(galleryID uuid.UUID) ([]Image, error)
+	FindByID(galleryID, imageID uuid.UUID) (*Image, error)
+	FindByFileName(galleryID uuid.UUID, fileName string) (*Image, error)
+
+	// FindPage returns limit images after the cursor by position
+	FindPage(galleryID uuid.UUID, after *imageCursor, limit int) ([]Image, error)
+
+	// FindPageBefore returns limit images before the
+	// cursor from the nearest one to the first one
+	FindPageBefore(galleryID uuid.UUID, before *imageCursor, limit int) ([]Image, error)
+
+	// Create adds the image after the last image of the gallery
+	Create(image *Image) error
+	UpdateDetails(galleryID uuid.UUID, images []Image) error
+	Delete(id uuid.UUID) error
+	DeleteByGalleryID(galleryID uuid.UUID) error
+	Reorder(galleryID uuid.UUID, imageIDs []uuid.UUID) error
 }
 
-type imageService struct{}
+// imageService stores the images as files under the images
+// dir on the disk and their records in the database
+type imageService struct {
+	imageDB
+	imagesDir string
+}
 
 // make sure that imageService type implements ImageService interface
 var _ ImageService = (*imageService)(nil)
 
-func NewImageService() ImageService {
-	return &imageService{}
+// NewImageService returns an ImageService that
+// stores the images inside imagesDir
+func NewImageService(db *gorm.DB, imagesDir string) ImageService {
+	return &imageService{
+		imageDB:   &imageValidator{imageDB: &imageGorm{db: db}},
+		imagesDir: imagesDir,
+	}
 }
 
-func (is *imageService) CreateImage(reader io.ReadCloser, galleryID uuid.UUID, fileName string) error {
+func (is *imageService) CreateImage(reader io.ReadCloser, galleryID uuid.UUID, fileName string) (*Image, error) {
 	defer reader.Close()
+	fileName = filepath.Base(fileName)
 
 	// create image dir path
 	imagePath, err := is.createImageDirPath(galleryID.String())
 	if err != nil {
-		return err
+		return nil, err
+	}
+
+	// the file is copied to a temp file and moved to its
+	// place when it is complete so a failed copy does not
+	// cut the image it replaces
+	destinationPath := filepath.Join(imagePath, fileName)
+	if err := is.writeFile(destinationPath, reader); err != nil {
+		return nil, err
 	}
 
-	// create destination file
-	destinationFile, err := os.Create(imagePath + fileName)
+	// the replaced files keep their records
+	image, err := is.imageDB.FindByFileName(galleryID, fileName)
+	switch err {
+	case nil:
+		return image, nil
+	case ErrNotFound:
+	default:
+		return nil, err
+	}
+
+	image = &Image{GalleryID: galleryID, FileName: fileName, Camera: is.readCamera(destinationPath)}
+	if err := is.imageDB.Create(image); err != nil {
+		return nil, err
+	}
+	return image, nil
+}
+
+func (is *imageService) GetImagesByGalleryID(galleryID uuid.UUID) ([]Image, error) {
+	return is.imageDB.FindByGalleryID(galleryID)
+}
+
+func (is *imageService) RecordImages(galleryID uuid.UUID, dryRun bool) ([]string, error) {
+	images, err := is.imageDB.FindByGalleryID(galleryID)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	defer destinationFile.Close()
 
-	// copy the uploaded file to destination file
-	_, err = io.Copy(destinationFile, reader)
+	filePaths, err := filepath.Glob(filepath.Join(is.imagesPath(galleryID.String()), "*"))
 	if err != nil {
+		return nil, err
+	}
+	recorded := map[string]bool{}
+	for _, image := range images {
+		recorded[image.FileName] = true
+	}
+
+	added := []string{}
+	for _, filePath := range filePaths {
+		fileName := filepath.Base(filePath)
+		if recorded[fileName] {
+			continue
+		}
+		added = append(added, fileName)
+		if dryRun {
+			continue
+		}
+		image := Image{GalleryID: galleryID, FileName: fileName, Camera: is.readCamera(filePath)}
+		if err := is.imageDB.Create(&image); err != nil {
+			return nil, err
+		}
+	}
+	return added, nil
+}
+
+func (is *imageService) ListImages(galleryID uuid.UUID, cursor string, limit int) (*ImagePage, error) {
+	after, err := decodeImageCursor(cursor)
+	if err != nil {
+		return nil, err
+	}
+	limit = imagePageLimit(limit)
+
+	images, err := is.imageDB.FindPage(galleryID, after, limit+1)
+	if err != nil {
+		return nil, err
+	}
+	return newImagePage(images, limit), nil
+}
+
+func (is *imageService) FindImageByID(galleryID, imageID uuid.UUID) (*Image, error) {
+	return is.imageDB.FindByID(galleryID, imageID)
+}
+
+func (is *imageService) FindImageByFileName(galleryID uuid.UUID, fileName string) (*Image, error) {
+	return is.imageDB.FindByFileName(galleryID, fileName)
+}
+
+func (is *imageService) FindNeighbours(image *Image) (*Image, *Image, error) {
+	cursor := &imageCursor{Position: image.Position, FileName: image.FileName}
+	before, err := is.imageDB.FindPageBefore(image.GalleryID, cursor, 1)
+	if err != nil {
+		return nil, nil, err
+	}
+	after, err := is.imageDB.FindPage(image.GalleryID, cursor, 1)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var prev, next *Image
+	if len(before) > 0 {
+		prev = &before[0]
+	}
+	if len(after) > 0 {
+		next = &after[0]
+	}
+	return prev, next, nil
+}
+
+func (is *imageService) UpdateImages(galleryID uuid.UUID, images []Image) error {
+	return is.imageDB.UpdateDetails(galleryID, images)
+}
+
+func (is *imageService) DeleteImage(image *Image) error {
+	found, err := is.imageDB.FindByFileName(image.GalleryID, filepath.Base(image.FileName))
+	if err != nil && err != ErrNotFound {
 		return err
 	}
 
-	return nil
+	err = os.Remove(filepath.Join(is.imagesPath(image.GalleryID.String()), filepath.Base(image.FileName)))
+	if os.IsNotExist(err) && found == nil {
+		return ErrNotFound
+	}
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	if found == nil {
+		return nil
+	}
+	return is.imageDB.Delete(found.ID)
 }
 
-func (is *imageService) GetImagesByGalleryID(galleryID uuid.UUID) ([]Image, error) {
-	imagesDirPath := is.imagesPath(galleryID.String())
-	fileNames, err := filepath.Glob(imagesDirPath + "*")
+func (is *imageService) ReorderImages(galleryID uuid.UUID, imageIDs []uuid.UUID) error {
+	return is.imageDB.Reorder(galleryID, imageIDs)
+}
+
+func (is *imageService) GetGalleryIDs() ([]uuid.UUID, error) {
+	entries, err := os.ReadDir(filepath.Join(is.imagesDir, "galleries"))
+	if os.IsNotExist(err) {
+		return []uuid.UUID{}, nil
+	}
 	if err != nil {
 		return nil, err
 	}
-	images := make([]Image, len(fileNames))
-	for i := range fileNames {
-		fileNames[i] = strings.ReplaceAll(fileNames[i], "\\", "/")
-		images[i] = Image{
-			GalleryID: galleryID.String(),
-			FileName:  strings.ReplaceAll(fileNames[i], is.imagesPath(galleryID.String()), ""),
+
+	galleryIDs := []uuid.UUID{}
+	for _, entry := range entries {
+		galleryID, err := uuid.FromString(entry.Name())
+		if err != nil || !entry.IsDir() {
+			continue
 		}
+		galleryIDs = append(galleryIDs, galleryID)
 	}
-	return images, nil
+	return galleryIDs, nil
 }
 
-func (is *imageService) DeleteImage(image *Image) error {
-	return os.Remove(image.RelativePath())
+func (is *imageService) DeleteImagesByGalleryID(galleryID uuid.UUID) error {
+	if err := is.imageDB.DeleteByGalleryID(galleryID); err != nil {
+		return err
+	}
+	return os.RemoveAll(is.imagesPath(galleryID.String()))
+}
+
+func (is *imageService) Open(image *Image) (io.ReadCloser, error) {
+	file, err := os.Open(filepath.Join(is.imagesPath(image.GalleryID.String()), filepath.Base(image.FileName)))
+	if os.IsNotExist(err) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return file, nil
+}
+
+// readCamera returns the camera of the exif data of the file
+// it is empty if the file can not be read or has no exif data
+func (is *imageService) readCamera(filePath string) string {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return ""
+	}
+	defer file.Close()
+
+	info, _ := exif.Decode(file)
+	return info.Camera()
 }
 
 func (is *imageService) imagesPath(galleryID string) string {
-	return fmt.Sprintf("images/galleries/%v/", galleryID)
+	return filepath.Join(is.imagesDir, "galleries", galleryID)
+}
+
+// writeFile copies the reader to a temp file and renames it to
+// the path when it is complete. the temp files are kept out of
+// the gallery dirs so they are never taken for images
+func (is *imageService) writeFile(path string, reader io.Reader) error {
+	tmpDir := filepath.Join(is.imagesDir, "tmp")
+	if err := os.MkdirAll(tmpDir, 0755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(tmpDir, "image-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	_, err = io.Copy(tmp, reader)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
 }
 
 func (is *imageService) createImageDirPath(galleryID string) (string, error) {
@@ -101,3 +506,177 @@ func (is *imageService) createImageDirPath(galleryID string) (string, error) {
 	}
 	return imageDirPath, nil
 }
+
+// imageValidationFn is a type for image validation functions
+type imageValidationFn func(*Image) error
+
+func runImageValidationFns(image *Image, fns ...imageValidationFn) error {
+	for _, fn := range fns {
+		if err := fn(image); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// normalizeImageDetails trims the spaces around the details
+func normalizeImageDetails(image *Image) error {
+	image.Title = strings.TrimSpace(image.Title)
+	image.Caption = strings.TrimSpace(image.Caption)
+	image.AltText = strings.TrimSpace(image.AltText)
+	return nil
+}
+
+func validateImageDetails(image *Image) error {
+	switch {
+	case utf8.RuneCountInString(image.Title) > MaxImageTitleLength:
+		return ErrImageTitleTooLong
+	case utf8.RuneCountInString(image.Caption) > MaxImageCaptionLength:
+		return ErrImageCaptionTooLong
+	case utf8.RuneCountInString(image.AltText) > MaxImageAltTextLength:
+		return ErrImageAltTextTooLong
+	}
+	return nil
+}
+
+type imageValidator struct {
+	imageDB
+}
+
+func (iv *imageValidator) UpdateDetails(galleryID uuid.UUID, images []Image) error {
+	for i := range images {
+		if err := runImageValidationFns(&images[i], normalizeImageDetails, validateImageDetails); err != nil {
+			return err
+		}
+	}
+	return iv.imageDB.UpdateDetails(galleryID, images)
+}
+
+func (iv *imageValidator) Reorder(galleryID uuid.UUID, imageIDs []uuid.UUID) error {
+	seen := map[uuid.UUID]bool{}
+	for _, id := range imageIDs {
+		if seen[id] {
+			return ErrImageOrderInvalid
+		}
+		seen[id] = true
+	}
+	return iv.imageDB.Reorder(galleryID, imageIDs)
+}
+
+type imageGorm struct {
+	db *gorm.DB
+}
+
+// make sure that imageGorm implements imageDB
+var _ imageDB = (*imageGorm)(nil)
+
+func (ig *imageGorm) FindByGalleryID(galleryID uuid.UUID) ([]Image, error) {
+	images := []Image{}
+	err := ig.db.Where("gallery_id = ?", galleryID).Order("position, file_name").Find(&images).Error
+	return images, err
+}
+
+func (ig *imageGorm) FindPage(galleryID uuid.UUID, after *imageCursor, limit int) ([]Image, error) {
+	db := ig.db.Where("gallery_id = ?", galleryID)
+	if after != nil {
+		db = db.Where("(position > ? OR (position = ? AND file_name > ?))", after.Position, after.Position, after.FileName)
+	}
+
+	images := []Image{}
+	err := db.Order("position, file_name").Limit(limit).Find(&images).Error
+	return images, err
+}
+
+func (ig *imageGorm) FindPageBefore(galleryID uuid.UUID, before *imageCursor, limit int) ([]Image, error) {
+	images := []Image{}
+	err := ig.db.Where("gallery_id = ?", galleryID).
+		Where("(position < ? OR (position = ? AND file_name < ?))", before.Position, before.Position, before.FileName).
+		Order("position DESC, file_name DESC").
+		Limit(limit).
+		Find(&images).Error
+	return images, err
+}
+
+func (ig *imageGorm) FindByID(galleryID, imageID uuid.UUID) (*Image, error) {
+	image := new(Image)
+	query := ig.db.Where("gallery_id = ? AND id = ?", galleryID, imageID)
+	if err := getRecord(query, image); err != nil {
+		return nil, err
+	}
+	return image, nil
+}
+
+func (ig *imageGorm) FindByFileName(galleryID uuid.UUID, fileName string) (*Image, error) {
+	image := new(Image)
+	query := ig.db.Where("gallery_id = ? AND file_name = ?", galleryID, fileName)
+	if err := getRecord(query, image); err != nil {
+		return nil, err
+	}
+	return image, nil
+}
+
+func (ig *imageGorm) Create(image *Image) error {
+	return ig.db.Transaction(func(tx *gorm.DB) error {
+		var last struct{ Position *int }
+		err := tx.Model(&Image{}).Select("MAX(position) AS position").Where("gallery_id = ?", image.GalleryID).Scan(&last).Error
+		if err != nil {
+			return err
+		}
+		if last.Position != nil {
+			image.Position = *last.Position + 1
+		}
+		return tx.Create(image).Error
+	})
+}
+
+func (ig *imageGorm) UpdateDetails(galleryID uuid.UUID, images []Image) error {
+	return ig.db.Transaction(func(tx *gorm.DB) error {
+		for _, image := range images {
+			result := tx.Model(&Image{}).Where("gallery_id = ? AND id = ?", galleryID, image.ID).Updates(map[string]interface{}{
+				"title":    image.Title,
+				"caption":  image.Caption,
+				"alt_text": image.AltText,
+			})
+			if result.Error != nil {
+				return result.Error
+			}
+			if result.RowsAffected == 0 {
+				return ErrNotFound
+			}
+		}
+		return nil
+	})
+}
+
+func (ig *imageGorm) Delete(id uuid.UUID) error {
+	return ig.db.Unscoped().Delete(&Image{}, "id = ?", id).Error
+}
+
+func (ig *imageGorm) DeleteByGalleryID(galleryID uuid.UUID) error {
+	return ig.db.Unscoped().Where("gallery_id = ?", galleryID).Delete(&Image{}).Error
+}
+
+func (ig *imageGorm) Reorder(galleryID uuid.UUID, imageIDs []uuid.UUID) error {
+	return ig.db.Transaction(func(tx *gorm.DB) error {
+		var count int64
+		err := tx.Model(&Image{}).Where("gallery_id = ? AND id IN ?", galleryID, imageIDs).Count(&count).Error
+		if err != nil {
+			return err
+		}
+		var total int64
+		if err := tx.Model(&Image{}).Where("gallery_id = ?", galleryID).Count(&total).Error; err != nil {
+			return err
+		}
+		if count != int64(len(imageIDs)) || total != count {
+			return ErrImageOrderInvalid
+		}
+
+		for position, id := range imageIDs {
+			err := tx.Model(&Image{}).Where("id = ?", id).Update("position", position).Error
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
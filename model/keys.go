@@ -0,0 +1,36 @@
+package model
+
+import (
+	"github.com/abanoub-fathy/bebo-gallery/pkg/rand"
+)
+
+// RotateRememberTokens gives every user a new remember token
+// so all the current sessions are logged out. it is used when
+// the secret keys are rotated and returns the count of users
+//
+// if dryRun is true the users are only counted
+func (s *Service) RotateRememberTokens(dryRun bool) (int, error) {
+	if s.db == nil {
+		return 0, ErrNoDatabase
+	}
+
+	var userIDs []string
+	if err := s.db.Model(&User{}).Pluck("id", &userIDs).Error; err != nil {
+		return 0, err
+	}
+	if dryRun {
+		return len(userIDs), nil
+	}
+
+	for _, userID := range userIDs {
+		token, err := rand.GenerateRememberToken()
+		if err != nil {
+			return 0, err
+		}
+		_, err = s.UserService.FindAndUpdateByID(userID, map[string]interface{}{"remember_token": token})
+		if err != nil {
+			return 0, err
+		}
+	}
+	return len(userIDs), nil
+}
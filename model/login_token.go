@@ -0,0 +1,165 @@
+package model
+
+import (
+	"time"
+
+	"github.com/abanoub-fathy/bebo-gallery/pkg/hash"
+	"github.com/abanoub-fathy/bebo-gallery/pkg/rand"
+	uuid "github.com/satori/go.uuid"
+	"gorm.io/gorm"
+)
+
+// loginTokenDuration is how long the login
+// link is valid after it is created
+const loginTokenDuration = 15 * time.Minute
+
+// loginToken is the token of the login link sent by
+// email. it is used once to log in without a password
+type loginToken struct {
+	Base
+	UserID    uuid.UUID `gorm:"not null"`
+	Token     string    `gorm:"-"`
+	TokenHash string    `gorm:"not null;unique"`
+}
+
+type loginTokenDB interface {
+	GetByToken(token string) (*loginToken, error)
+	Create(t *loginToken) error
+
+	// Delete returns ErrNotFound if the token is deleted
+	// already so the token can be used only once
+	Delete(id uuid.UUID) error
+
+	// CountCreatedBefore and DeleteCreatedBefore work on
+	// the tokens created before the given time
+	CountCreatedBefore(before time.Time) (int64, error)
+	DeleteCreatedBefore(before time.Time) (int64, error)
+}
+
+type loginTokenValidator struct {
+	loginTokenDB
+	hasher *hash.Hasher
+}
+
+type loginTokenValidationFn func(t *loginToken) error
+
+func runLoginTokenValidationFns(t *loginToken, fns ...loginTokenValidationFn) error {
+	for _, fn := range fns {
+		if err := fn(t); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func newLoginTokenValidator(db loginTokenDB, hasher *hash.Hasher) *loginTokenValidator {
+	return &loginTokenValidator{
+		loginTokenDB: db,
+		hasher:       hasher,
+	}
+}
+
+func (lv *loginTokenValidator) GetByToken(token string) (*loginToken, error) {
+	if token == "" {
+		return nil, ErrInvalidToken
+	}
+
+	t := &loginToken{
+		Token: token,
+	}
+	if err := runLoginTokenValidationFns(t, lv.setTokenHash); err != nil {
+		return nil, err
+	}
+	return lv.loginTokenDB.GetByToken(t.TokenHash)
+}
+
+func (lv *loginTokenValidator) Create(t *loginToken) error {
+	err := runLoginTokenValidationFns(t,
+		lv.requireUserID,
+		lv.setToken,
+		lv.setTokenHash,
+	)
+	if err != nil {
+		return err
+	}
+
+	return lv.loginTokenDB.Create(t)
+}
+
+func (lv *loginTokenValidator) Delete(id uuid.UUID) error {
+	if id.String() == ZeroID {
+		return ErrInvalidID
+	}
+	return lv.loginTokenDB.Delete(id)
+}
+
+func (lv *loginTokenValidator) requireUserID(t *loginToken) error {
+	if t.UserID.String() == ZeroID {
+		return ErrUserIDRequired
+	}
+	return nil
+}
+
+func (lv *loginTokenValidator) setToken(t *loginToken) error {
+	token, err := rand.GenerateRememberToken()
+	if err != nil {
+		return err
+	}
+	t.Token = token
+	return nil
+}
+
+func (lv *loginTokenValidator) setTokenHash(t *loginToken) error {
+	t.TokenHash = lv.hasher.HashByHMAC(t.Token)
+	return nil
+}
+
+type loginTokenGorm struct {
+	db *gorm.DB
+}
+
+func newLoginTokenGorm(db *gorm.DB) *loginTokenGorm {
+	return &loginTokenGorm{db: db}
+}
+
+// make sure that loginTokenGorm implements loginTokenDB
+var _ loginTokenDB = (*loginTokenGorm)(nil)
+
+func (lg *loginTokenGorm) GetByToken(tokenHash string) (*loginToken, error) {
+	t := new(loginToken)
+	query := lg.db.Where(loginToken{
+		TokenHash: tokenHash,
+	})
+	if err := getRecord(query, t); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+func (lg *loginTokenGorm) Create(t *loginToken) error {
+	return lg.db.Create(t).Error
+}
+
+func (lg *loginTokenGorm) Delete(id uuid.UUID) error {
+	result := lg.db.Unscoped().Delete(&loginToken{}, "id = ?", id)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// CountCreatedBefore is unscoped like DeleteCreatedBefore
+// so the dry run of the gc reports what it removes
+func (lg *loginTokenGorm) CountCreatedBefore(before time.Time) (int64, error) {
+	var count int64
+	err := lg.db.Unscoped().Model(&loginToken{}).Where("created_at < ?", before).Count(&count).Error
+	return count, err
+}
+
+func (lg *loginTokenGorm) DeleteCreatedBefore(before time.Time) (int64, error) {
+	result := lg.db.Unscoped().Where("created_at < ?", before).Delete(&loginToken{})
+	return result.RowsAffected, result.Error
+}
@@ -0,0 +1,1322 @@
+package model
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/abanoub-fathy/bebo-gallery/pkg/exif"
+	uuid "github.com/satori/go.uuid"
+)
+
+// NewMemoryService creates a Service that keeps all the data
+// in memory. it has no database so it can be used in the
+// tests of the controllers without any setup
+func NewMemoryService(hashSecretKey string) *Service {
+	galleryDB := NewMemoryGalleryDB()
+	imageService := NewMemoryImageService()
+	tagDB := NewMemoryTagDB(galleryDB, imageService)
+	galleryDB.images = imageService
+	galleryDB.tags = tagDB
+
+	return &Service{
+		GalleryService: NewGalleryServiceWithDB(galleryDB),
+		UserService:    NewUserServiceWithDB(NewMemoryUserDB(), NewMemoryPwResetDB(), NewMemoryLoginTokenDB(), hashSecretKey, DefaultPasswordPolicy()),
+		ImageService:   imageService,
+		TagService:     NewTagServiceWithDB(tagDB),
+		SearchService:  NewSearchServiceWithDB(NewMemorySearchDB(tagDB)),
+
+		AccessTokenService: NewAccessTokenServiceWithDB(NewMemoryAccessTokenDB(), hashSecretKey),
+		ShareLinkService:   NewShareLinkServiceWithDB(NewMemoryShareLinkDB(), hashSecretKey),
+		IdentityService:    NewIdentityServiceWithDB(NewMemoryIdentityDB()),
+		OAuthService:       NewOAuthServiceWithDB(NewMemoryOAuthDB(), hashSecretKey),
+	}
+}
+
+// newBase returns a Base with a new id and the current time
+func newBase() Base {
+	now := time.Now()
+	return Base{
+		ID:        uuid.NewV4(),
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+}
+
+// applyUpdates sets the fields of dst from the updates map
+// the keys can be the field names or the column names
+// like the updates passed to gorm
+func applyUpdates(dst interface{}, updates map[string]interface{}) error {
+	value := reflect.ValueOf(dst).Elem()
+	for key, update := range updates {
+		name := strings.ReplaceAll(strings.ToLower(key), "_", "")
+		field := value.FieldByNameFunc(func(fieldName string) bool {
+			return strings.ToLower(fieldName) == name
+		})
+		if !field.IsValid() || !field.CanSet() {
+			return fmt.Errorf("model: unknown field %v", key)
+		}
+
+		updateValue := reflect.ValueOf(update)
+		if !updateValue.Type().ConvertibleTo(field.Type()) {
+			return fmt.Errorf("model: invalid type %T for field %v", update, key)
+		}
+		field.Set(updateValue.Convert(field.Type()))
+	}
+	return nil
+}
+
+// MemoryUserDB is an in memory implementation of UserDB
+// it is safe for concurrent use
+type MemoryUserDB struct {
+	mu    sync.RWMutex
+	users map[uuid.UUID]User
+}
+
+// make sure that MemoryUserDB implements UserDB
+var _ UserDB = (*MemoryUserDB)(nil)
+
+// NewMemoryUserDB creates an empty MemoryUserDB
+func NewMemoryUserDB() *MemoryUserDB {
+	return &MemoryUserDB{users: map[uuid.UUID]User{}}
+}
+
+func (m *MemoryUserDB) findBy(match func(u *User) bool) (*User, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	for _, user := range m.users {
+		if match(&user) {
+			return &user, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+func (m *MemoryUserDB) FindByID(ID string) (*User, error) {
+	return m.findBy(func(u *User) bool { return u.ID.String() == ID })
+}
+
+func (m *MemoryUserDB) FindByEmail(email string) (*User, error) {
+	return m.findBy(func(u *User) bool { return u.Email == email })
+}
+
+func (m *MemoryUserDB) FindByHandle(handle string) (*User, error) {
+	return m.findBy(func(u *User) bool { return u.Handle == handle })
+}
+
+func (m *MemoryUserDB) FindUserByRememberToken(hashedToken string) (*User, error) {
+	return m.findBy(func(u *User) bool { return u.RemeberTokenHash == hashedToken })
+}
+
+func (m *MemoryUserDB) CreateUser(user *User) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, existing := range m.users {
+		if existing.Email == user.Email {
+			return fmt.Errorf("model: duplicate email %v", user.Email)
+		}
+		if existing.Handle == user.Handle {
+			return fmt.Errorf("model: duplicate handle %v", user.Handle)
+		}
+	}
+
+	user.Base = newBase()
+	m.users[user.ID] = *user
+	return nil
+}
+
+func (m *MemoryUserDB) FindAndUpdateByID(userID string, updates map[string]interface{}) (*User, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	user, found := m.users[uuid.FromStringOrNil(userID)]
+	if !found {
+		return nil, ErrNotFound
+	}
+	if err := applyUpdates(&user, updates); err != nil {
+		return nil, err
+	}
+	user.UpdatedAt = time.Now()
+	m.users[user.ID] = user
+	return &user, nil
+}
+
+func (m *MemoryUserDB) FindAndDeleteByID(userID string) (*User, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	user, found := m.users[uuid.FromStringOrNil(userID)]
+	if !found {
+		return nil, ErrNotFound
+	}
+	delete(m.users, user.ID)
+	return &user, nil
+}
+
+func (m *MemoryUserDB) Save(user *User) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, found := m.users[user.ID]; !found {
+		return ErrNotFound
+	}
+	user.UpdatedAt = time.Now()
+	m.users[user.ID] = *user
+	return nil
+}
+
+func (m *MemoryUserDB) SaveNewRemeberToken(user *User) error {
+	return m.Save(user)
+}
+
+// MemoryGalleryDB is an in memory implementation of GalleryDB
+// it is safe for concurrent use
+type MemoryGalleryDB struct {
+	mu        sync.RWMutex
+	galleries map[uuid.UUID]Gallery
+
+	// the images and the tags are used by the listings
+	// to count the images and to filter by the tags
+	images *MemoryImageService
+	tags   *MemoryTagDB
+}
+
+// make sure that MemoryGalleryDB implements GalleryDB
+var _ GalleryDB = (*MemoryGalleryDB)(nil)
+
+// NewMemoryGalleryDB creates an empty MemoryGalleryDB
+func NewMemoryGalleryDB() *MemoryGalleryDB {
+	return &MemoryGalleryDB{galleries: map[uuid.UUID]Gallery{}}
+}
+
+func (m *MemoryGalleryDB) CreateGallery(gallery *Gallery) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	gallery.Base = newBase()
+	m.galleries[gallery.ID] = *gallery
+	return nil
+}
+
+func (m *MemoryGalleryDB) FindByID(ID string) (*Gallery, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	gallery, found := m.galleries[uuid.FromStringOrNil(ID)]
+	if !found {
+		return nil, ErrNotFound
+	}
+	return &gallery, nil
+}
+
+func (m *MemoryGalleryDB) Update(gallery *Gallery) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, found := m.galleries[gallery.ID]; !found {
+		return ErrNotFound
+	}
+	gallery.UpdatedAt = time.Now()
+	m.galleries[gallery.ID] = *gallery
+	return nil
+}
+
+func (m *MemoryGalleryDB) Delete(gallery *Gallery) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.galleries, gallery.ID)
+	return nil
+}
+
+func (m *MemoryGalleryDB) FindByUserID(userID uuid.UUID) ([]*Gallery, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	galleries := []*Gallery{}
+	for _, gallery := range m.galleries {
+		if uuid.Equal(gallery.UserID, userID) {
+			gallery := gallery
+			galleries = append(galleries, &gallery)
+		}
+	}
+	sort.Slice(galleries, func(i, j int) bool {
+		return galleries[i].CreatedAt.After(galleries[j].CreatedAt)
+	})
+	return galleries, nil
+}
+
+func (m *MemoryGalleryDB) ListGalleries(query *GalleryListQuery) (*GalleryPage, error) {
+	m.mu.RLock()
+	galleries := []*Gallery{}
+	for _, gallery := range m.galleries {
+		gallery := gallery
+		galleries = append(galleries, &gallery)
+	}
+	m.mu.RUnlock()
+
+	// the galleries lock is released before the
+	// images and the tags are locked
+	found := []*Gallery{}
+	for _, gallery := range galleries {
+		switch {
+		case !uuid.Equal(query.UserID, uuid.Nil) && !uuid.Equal(gallery.UserID, query.UserID):
+			continue
+		case query.Public && gallery.PublishedAt == nil:
+			continue
+		case !strings.Contains(strings.ToLower(gallery.Title), strings.ToLower(query.Title)):
+			continue
+		case query.Tag != "" && (m.tags == nil || !m.tags.galleryHasTag(gallery.ID, query.Tag)):
+			continue
+		}
+		if m.images != nil {
+			images, _ := m.images.GetImagesByGalleryID(gallery.ID)
+			gallery.ImageCount = len(images)
+		}
+		if query.cursor != nil && query.cursor.compare(gallery) <= 0 {
+			continue
+		}
+		found = append(found, gallery)
+	}
+
+	sort.Slice(found, func(i, j int) bool {
+		return newGalleryCursor(query, found[j]).compare(found[i]) < 0
+	})
+	if len(found) > query.Limit+1 {
+		found = found[:query.Limit+1]
+	}
+	return newGalleryPage(query, found), nil
+}
+
+// MemoryPwResetDB is an in memory implementation of the
+// reset password tokens db. it is safe for concurrent use
+type MemoryPwResetDB struct {
+	mu     sync.RWMutex
+	resets map[uuid.UUID]pwReset
+}
+
+// make sure that MemoryPwResetDB implements pwResetDB
+var _ pwResetDB = (*MemoryPwResetDB)(nil)
+
+// NewMemoryPwResetDB creates an empty MemoryPwResetDB
+func NewMemoryPwResetDB() *MemoryPwResetDB {
+	return &MemoryPwResetDB{resets: map[uuid.UUID]pwReset{}}
+}
+
+func (m *MemoryPwResetDB) GetByToken(tokenHash string) (*pwReset, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	for _, p := range m.resets {
+		if p.TokenHash == tokenHash {
+			return &p, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+func (m *MemoryPwResetDB) Create(p *pwReset) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	p.Base = newBase()
+	m.resets[p.ID] = *p
+	return nil
+}
+
+func (m *MemoryPwResetDB) Delete(id uuid.UUID) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.resets, id)
+	return nil
+}
+
+func (m *MemoryPwResetDB) CountCreatedBefore(before time.Time) (int64, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var count int64
+	for _, p := range m.resets {
+		if p.CreatedAt.Before(before) {
+			count++
+		}
+	}
+	return count, nil
+}
+
+func (m *MemoryPwResetDB) DeleteCreatedBefore(before time.Time) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var count int64
+	for id, p := range m.resets {
+		if p.CreatedAt.Before(before) {
+			delete(m.resets, id)
+			count++
+		}
+	}
+	return count, nil
+}
+
+// MemoryLoginTokenDB is an in memory implementation of the
+// login link tokens db. it is safe for concurrent use
+type MemoryLoginTokenDB struct {
+	mu     sync.RWMutex
+	tokens map[uuid.UUID]loginToken
+}
+
+// make sure that MemoryLoginTokenDB implements loginTokenDB
+var _ loginTokenDB = (*MemoryLoginTokenDB)(nil)
+
+// NewMemoryLoginTokenDB creates an empty MemoryLoginTokenDB
+func NewMemoryLoginTokenDB() *MemoryLoginTokenDB {
+	return &MemoryLoginTokenDB{tokens: map[uuid.UUID]loginToken{}}
+}
+
+func (m *MemoryLoginTokenDB) GetByToken(tokenHash string) (*loginToken, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	for _, t := range m.tokens {
+		if t.TokenHash == tokenHash {
+			return &t, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+func (m *MemoryLoginTokenDB) Create(t *loginToken) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	t.Base = newBase()
+	m.tokens[t.ID] = *t
+	return nil
+}
+
+func (m *MemoryLoginTokenDB) Delete(id uuid.UUID) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, found := m.tokens[id]; !found {
+		return ErrNotFound
+	}
+	delete(m.tokens, id)
+	return nil
+}
+
+func (m *MemoryLoginTokenDB) CountCreatedBefore(before time.Time) (int64, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var count int64
+	for _, t := range m.tokens {
+		if t.CreatedAt.Before(before) {
+			count++
+		}
+	}
+	return count, nil
+}
+
+func (m *MemoryLoginTokenDB) DeleteCreatedBefore(before time.Time) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var count int64
+	for id, t := range m.tokens {
+		if t.CreatedAt.Before(before) {
+			delete(m.tokens, id)
+			count++
+		}
+	}
+	return count, nil
+}
+
+// MemoryAccessTokenDB is an in memory implementation
+// of AccessTokenDB. it is safe for concurrent use
+type MemoryAccessTokenDB struct {
+	mu     sync.RWMutex
+	tokens map[uuid.UUID]AccessToken
+}
+
+// make sure that MemoryAccessTokenDB implements AccessTokenDB
+var _ AccessTokenDB = (*MemoryAccessTokenDB)(nil)
+
+// NewMemoryAccessTokenDB creates an empty MemoryAccessTokenDB
+func NewMemoryAccessTokenDB() *MemoryAccessTokenDB {
+	return &MemoryAccessTokenDB{tokens: map[uuid.UUID]AccessToken{}}
+}
+
+func (m *MemoryAccessTokenDB) Create(t *AccessToken) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	t.Base = newBase()
+	m.tokens[t.ID] = *t
+	return nil
+}
+
+func (m *MemoryAccessTokenDB) FindByToken(tokenHash string) (*AccessToken, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	for _, t := range m.tokens {
+		if t.TokenHash == tokenHash {
+			return &t, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+func (m *MemoryAccessTokenDB) FindByRefreshToken(refreshTokenHash string) (*AccessToken, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	for _, t := range m.tokens {
+		if t.RefreshTokenHash != nil && *t.RefreshTokenHash == refreshTokenHash {
+			return &t, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+func (m *MemoryAccessTokenDB) FindByUserID(userID uuid.UUID) ([]*AccessToken, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	tokens := []*AccessToken{}
+	for _, t := range m.tokens {
+		if uuid.Equal(t.UserID, userID) {
+			t := t
+			tokens = append(tokens, &t)
+		}
+	}
+	sort.Slice(tokens, func(i, j int) bool {
+		return tokens[i].CreatedAt.After(tokens[j].CreatedAt)
+	})
+	return tokens, nil
+}
+
+func (m *MemoryAccessTokenDB) Touch(id uuid.UUID, usedAt time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	t, found := m.tokens[id]
+	if !found {
+		return ErrNotFound
+	}
+	t.LastUsedAt = &usedAt
+	m.tokens[id] = t
+	return nil
+}
+
+func (m *MemoryAccessTokenDB) Revoke(userID uuid.UUID, id uuid.UUID) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	t, found := m.tokens[id]
+	if !found || !uuid.Equal(t.UserID, userID) {
+		return ErrNotFound
+	}
+	delete(m.tokens, id)
+	return nil
+}
+
+// MemoryShareLinkDB is an in memory implementation
+// of ShareLinkDB. it is safe for concurrent use
+type MemoryShareLinkDB struct {
+	mu    sync.RWMutex
+	links map[uuid.UUID]ShareLink
+}
+
+// make sure that MemoryShareLinkDB implements ShareLinkDB
+var _ ShareLinkDB = (*MemoryShareLinkDB)(nil)
+
+// NewMemoryShareLinkDB creates an empty MemoryShareLinkDB
+func NewMemoryShareLinkDB() *MemoryShareLinkDB {
+	return &MemoryShareLinkDB{links: map[uuid.UUID]ShareLink{}}
+}
+
+func (m *MemoryShareLinkDB) Create(link *ShareLink) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	link.Base = newBase()
+	stored := *link
+	stored.Token = ""
+	m.links[link.ID] = stored
+	return nil
+}
+
+func (m *MemoryShareLinkDB) FindByToken(galleryID uuid.UUID, tokenHash string) (*ShareLink, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	for _, link := range m.links {
+		if uuid.Equal(link.GalleryID, galleryID) && link.TokenHash == tokenHash {
+			return &link, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+func (m *MemoryShareLinkDB) FindByGalleryID(galleryID uuid.UUID) ([]*ShareLink, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	links := []*ShareLink{}
+	for _, link := range m.links {
+		if uuid.Equal(link.GalleryID, galleryID) {
+			link := link
+			links = append(links, &link)
+		}
+	}
+	sort.Slice(links, func(i, j int) bool {
+		return links[i].CreatedAt.After(links[j].CreatedAt)
+	})
+	return links, nil
+}
+
+func (m *MemoryShareLinkDB) Delete(galleryID uuid.UUID, id uuid.UUID) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	link, found := m.links[id]
+	if !found || !uuid.Equal(link.GalleryID, galleryID) {
+		return ErrNotFound
+	}
+	delete(m.links, id)
+	return nil
+}
+
+// MemoryIdentityDB is an in memory implementation
+// of IdentityDB. it is safe for concurrent use
+type MemoryIdentityDB struct {
+	mu         sync.RWMutex
+	identities map[uuid.UUID]Identity
+}
+
+// make sure that MemoryIdentityDB implements IdentityDB
+var _ IdentityDB = (*MemoryIdentityDB)(nil)
+
+// NewMemoryIdentityDB creates an empty MemoryIdentityDB
+func NewMemoryIdentityDB() *MemoryIdentityDB {
+	return &MemoryIdentityDB{identities: map[uuid.UUID]Identity{}}
+}
+
+func (m *MemoryIdentityDB) Create(identity *Identity) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, existing := range m.identities {
+		if existing.Provider == identity.Provider && existing.Subject == identity.Subject {
+			return fmt.Errorf("model: duplicate identity %v/%v", identity.Provider, identity.Subject)
+		}
+	}
+
+	identity.Base = newBase()
+	m.identities[identity.ID] = *identity
+	return nil
+}
+
+func (m *MemoryIdentityDB) FindByProviderSubject(provider, subject string) (*Identity, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	for _, identity := range m.identities {
+		if identity.Provider == provider && identity.Subject == subject {
+			return &identity, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+func (m *MemoryIdentityDB) FindByUserID(userID uuid.UUID) ([]*Identity, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	identities := []*Identity{}
+	for _, identity := range m.identities {
+		if uuid.Equal(identity.UserID, userID) {
+			identity := identity
+			identities = append(identities, &identity)
+		}
+	}
+	sort.Slice(identities, func(i, j int) bool {
+		return identities[i].CreatedAt.Before(identities[j].CreatedAt)
+	})
+	return identities, nil
+}
+
+func (m *MemoryIdentityDB) Delete(userID uuid.UUID, id uuid.UUID) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	identity, found := m.identities[id]
+	if !found || !uuid.Equal(identity.UserID, userID) {
+		return ErrNotFound
+	}
+	delete(m.identities, id)
+	return nil
+}
+
+// MemoryOAuthDB is an in memory implementation
+// of OAuthDB. it is safe for concurrent use
+type MemoryOAuthDB struct {
+	mu      sync.RWMutex
+	clients map[uuid.UUID]OAuthClient
+	codes   map[uuid.UUID]OAuthCode
+}
+
+// make sure that MemoryOAuthDB implements OAuthDB
+var _ OAuthDB = (*MemoryOAuthDB)(nil)
+
+// NewMemoryOAuthDB creates an empty MemoryOAuthDB
+func NewMemoryOAuthDB() *MemoryOAuthDB {
+	return &MemoryOAuthDB{
+		clients: map[uuid.UUID]OAuthClient{},
+		codes:   map[uuid.UUID]OAuthCode{},
+	}
+}
+
+func (m *MemoryOAuthDB) CreateClient(client *OAuthClient) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, existing := range m.clients {
+		if existing.ClientID == client.ClientID {
+			return fmt.Errorf("model: duplicate client id %v", client.ClientID)
+		}
+	}
+
+	client.Base = newBase()
+	m.clients[client.ID] = *client
+	return nil
+}
+
+func (m *MemoryOAuthDB) FindClientByClientID(clientID string) (*OAuthClient, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	for _, client := range m.clients {
+		if client.ClientID == clientID {
+			return &client, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+func (m *MemoryOAuthDB) FindClientsByUserID(userID uuid.UUID) ([]*OAuthClient, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	clients := []*OAuthClient{}
+	for _, client := range m.clients {
+		if uuid.Equal(client.UserID, userID) {
+			client := client
+			clients = append(clients, &client)
+		}
+	}
+	sort.Slice(clients, func(i, j int) bool {
+		return clients[i].CreatedAt.After(clients[j].CreatedAt)
+	})
+	return clients, nil
+}
+
+func (m *MemoryOAuthDB) DeleteClient(userID uuid.UUID, id uuid.UUID) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	client, found := m.clients[id]
+	if !found || !uuid.Equal(client.UserID, userID) {
+		return ErrNotFound
+	}
+	delete(m.clients, id)
+	for codeID, code := range m.codes {
+		if uuid.Equal(code.ClientID, id) {
+			delete(m.codes, codeID)
+		}
+	}
+	return nil
+}
+
+func (m *MemoryOAuthDB) CreateCode(code *OAuthCode) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	code.Base = newBase()
+	m.codes[code.ID] = *code
+	return nil
+}
+
+func (m *MemoryOAuthDB) ConsumeCode(codeHash string) (*OAuthCode, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for id, code := range m.codes {
+		if code.CodeHash == codeHash {
+			delete(m.codes, id)
+			return &code, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+// MemoryImageService is an in memory implementation
+// of ImageService. it is safe for concurrent use
+type MemoryImageService struct {
+	mu       sync.RWMutex
+	images   map[uuid.UUID][]Image
+	contents map[uuid.UUID][]byte
+}
+
+// make sure that MemoryImageService implements ImageService
+var _ ImageService = (*MemoryImageService)(nil)
+
+// NewMemoryImageService creates an empty MemoryImageService
+func NewMemoryImageService() *MemoryImageService {
+	return &MemoryImageService{
+		images:   map[uuid.UUID][]Image{},
+		contents: map[uuid.UUID][]byte{},
+	}
+}
+
+func (m *MemoryImageService) CreateImage(reader io.ReadCloser, galleryID uuid.UUID, fileName string) (*Image, error) {
+	defer reader.Close()
+
+	content, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	// the replaced files keep their records
+	if image := m.find(galleryID, fileName); image != nil {
+		m.contents[image.ID] = content
+		found := *image
+		return &found, nil
+	}
+
+	images := m.images[galleryID]
+	image := Image{Base: newBase(), GalleryID: galleryID, FileName: fileName}
+	if info, err := exif.Decode(bytes.NewReader(content)); err == nil {
+		image.Camera = info.Camera()
+	}
+	if len(images) > 0 {
+		image.Position = images[len(images)-1].Position + 1
+	}
+	m.images[galleryID] = append(images, image)
+	m.contents[image.ID] = content
+	return &image, nil
+}
+
+func (m *MemoryImageService) GetImagesByGalleryID(galleryID uuid.UUID) ([]Image, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	images := append([]Image{}, m.images[galleryID]...)
+	sortImages(images)
+	return images, nil
+}
+
+// RecordImages adds nothing since the memory
+// service keeps no files without records
+func (m *MemoryImageService) RecordImages(galleryID uuid.UUID, dryRun bool) ([]string, error) {
+	return []string{}, nil
+}
+
+func (m *MemoryImageService) ListImages(galleryID uuid.UUID, cursor string, limit int) (*ImagePage, error) {
+	after, err := decodeImageCursor(cursor)
+	if err != nil {
+		return nil, err
+	}
+	limit = imagePageLimit(limit)
+
+	images, _ := m.GetImagesByGalleryID(galleryID)
+	found := []Image{}
+	for _, image := range images {
+		if (after == nil || after.after(image)) && len(found) <= limit {
+			found = append(found, image)
+		}
+	}
+	return newImagePage(found, limit), nil
+}
+
+func (m *MemoryImageService) FindImageByID(galleryID, imageID uuid.UUID) (*Image, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	for _, image := range m.images[galleryID] {
+		if uuid.Equal(image.ID, imageID) {
+			return &image, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+func (m *MemoryImageService) FindImageByFileName(galleryID uuid.UUID, fileName string) (*Image, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	found := m.find(galleryID, fileName)
+	if found == nil {
+		return nil, ErrNotFound
+	}
+	image := *found
+	return &image, nil
+}
+
+func (m *MemoryImageService) FindNeighbours(image *Image) (*Image, *Image, error) {
+	cursor := &imageCursor{Position: image.Position, FileName: image.FileName}
+	images, _ := m.GetImagesByGalleryID(image.GalleryID)
+
+	var prev, next *Image
+	for i := range images {
+		switch {
+		case cursor.after(images[i]):
+			if next == nil {
+				next = &images[i]
+			}
+		case images[i].FileName != image.FileName:
+			prev = &images[i]
+		}
+	}
+	return prev, next, nil
+}
+
+func (m *MemoryImageService) UpdateImages(galleryID uuid.UUID, images []Image) error {
+	for i := range images {
+		if err := runImageValidationFns(&images[i], normalizeImageDetails, validateImageDetails); err != nil {
+			return err
+		}
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	// find all the images before updating any of them
+	found := make([]*Image, len(images))
+	for i, image := range images {
+		for j := range m.images[galleryID] {
+			if uuid.Equal(m.images[galleryID][j].ID, image.ID) {
+				found[i] = &m.images[galleryID][j]
+			}
+		}
+		if found[i] == nil {
+			return ErrNotFound
+		}
+	}
+
+	for i, image := range images {
+		found[i].Title = image.Title
+		found[i].Caption = image.Caption
+		found[i].AltText = image.AltText
+	}
+	return nil
+}
+
+func (m *MemoryImageService) DeleteImage(image *Image) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	images := m.images[image.GalleryID]
+	for i := range images {
+		if images[i].FileName == image.FileName {
+			delete(m.contents, images[i].ID)
+			m.images[image.GalleryID] = append(images[:i:i], images[i+1:]...)
+			return nil
+		}
+	}
+	return ErrNotFound
+}
+
+func (m *MemoryImageService) ReorderImages(galleryID uuid.UUID, imageIDs []uuid.UUID) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	images := m.images[galleryID]
+	positions := map[uuid.UUID]int{}
+	for position, id := range imageIDs {
+		if _, found := positions[id]; found {
+			return ErrImageOrderInvalid
+		}
+		positions[id] = position
+	}
+	if len(positions) != len(images) {
+		return ErrImageOrderInvalid
+	}
+	for _, image := range images {
+		if _, found := positions[image.ID]; !found {
+			return ErrImageOrderInvalid
+		}
+	}
+
+	for i := range images {
+		images[i].Position = positions[images[i].ID]
+	}
+	sortImages(images)
+	return nil
+}
+
+func (m *MemoryImageService) GetGalleryIDs() ([]uuid.UUID, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	galleryIDs := []uuid.UUID{}
+	for galleryID := range m.images {
+		galleryIDs = append(galleryIDs, galleryID)
+	}
+	return galleryIDs, nil
+}
+
+func (m *MemoryImageService) DeleteImagesByGalleryID(galleryID uuid.UUID) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, image := range m.images[galleryID] {
+		delete(m.contents, image.ID)
+	}
+	delete(m.images, galleryID)
+	return nil
+}
+
+// find returns the image of the file name in the gallery
+func (m *MemoryImageService) find(galleryID uuid.UUID, fileName string) *Image {
+	for i, image := range m.images[galleryID] {
+		if image.FileName == fileName {
+			return &m.images[galleryID][i]
+		}
+	}
+	return nil
+}
+
+// Open returns the content of the image
+// it returns ErrNotFound if the image is not stored
+func (m *MemoryImageService) Open(image *Image) (io.ReadCloser, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	found := m.find(image.GalleryID, image.FileName)
+	if found == nil {
+		return nil, ErrNotFound
+	}
+	content := m.contents[found.ID]
+	return io.NopCloser(bytes.NewReader(content)), nil
+}
+
+// MemoryTagDB is an in memory implementation of TagDB
+// it is safe for concurrent use
+type MemoryTagDB struct {
+	mu          sync.RWMutex
+	galleryTags map[uuid.UUID][]string
+	imageTags   map[uuid.UUID][]string
+
+	// the galleries and the images are
+	// needed to find them by their tags
+	galleries *MemoryGalleryDB
+	images    *MemoryImageService
+}
+
+// make sure that MemoryTagDB implements TagDB
+var _ TagDB = (*MemoryTagDB)(nil)
+
+// NewMemoryTagDB creates an empty MemoryTagDB
+// of the galleries and the images
+func NewMemoryTagDB(galleries *MemoryGalleryDB, images *MemoryImageService) *MemoryTagDB {
+	return &MemoryTagDB{
+		galleryTags: map[uuid.UUID][]string{},
+		imageTags:   map[uuid.UUID][]string{},
+		galleries:   galleries,
+		images:      images,
+	}
+}
+
+func (m *MemoryTagDB) SetGalleryTags(galleryID uuid.UUID, names []string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.galleryTags[galleryID] = addTags(nil, names)
+	return nil
+}
+
+func (m *MemoryTagDB) FindGalleryTags(galleryIDs []uuid.UUID) (map[uuid.UUID][]string, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return findTags(m.galleryTags, galleryIDs), nil
+}
+
+func (m *MemoryTagDB) AddImageTags(galleryID uuid.UUID, imageIDs []uuid.UUID, names []string) error {
+	if err := m.checkImages(galleryID, imageIDs); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, imageID := range imageIDs {
+		m.imageTags[imageID] = addTags(m.imageTags[imageID], names)
+	}
+	return nil
+}
+
+func (m *MemoryTagDB) RemoveImageTags(galleryID uuid.UUID, imageIDs []uuid.UUID, names []string) error {
+	if err := m.checkImages(galleryID, imageIDs); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	removed := map[string]bool{}
+	for _, name := range names {
+		removed[name] = true
+	}
+	for _, imageID := range imageIDs {
+		kept := []string{}
+		for _, name := range m.imageTags[imageID] {
+			if !removed[name] {
+				kept = append(kept, name)
+			}
+		}
+		m.imageTags[imageID] = kept
+	}
+	return nil
+}
+
+func (m *MemoryTagDB) FindImageTags(imageIDs []uuid.UUID) (map[uuid.UUID][]string, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return findTags(m.imageTags, imageIDs), nil
+}
+
+func (m *MemoryTagDB) SuggestTags(userID uuid.UUID, prefix string, limit int) ([]string, error) {
+	galleries, err := m.galleries.FindByUserID(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var names []string
+	for _, gallery := range galleries {
+		names = addTags(names, m.galleryTags[gallery.ID])
+		images, _ := m.images.GetImagesByGalleryID(gallery.ID)
+		for _, image := range images {
+			names = addTags(names, m.imageTags[image.ID])
+		}
+	}
+
+	suggestions := []string{}
+	for _, name := range names {
+		if strings.HasPrefix(name, prefix) && len(suggestions) < limit {
+			suggestions = append(suggestions, name)
+		}
+	}
+	return suggestions, nil
+}
+
+func (m *MemoryTagDB) FindGalleriesByTag(name string, userID uuid.UUID) ([]*Gallery, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	m.galleries.mu.RLock()
+	defer m.galleries.mu.RUnlock()
+
+	galleries := []*Gallery{}
+	for _, gallery := range m.galleries.galleries {
+		if hasTag(m.galleryTags[gallery.ID], name) && gallery.ListedFor(userID) {
+			gallery := gallery
+			galleries = append(galleries, &gallery)
+		}
+	}
+	sort.Slice(galleries, func(i, j int) bool {
+		return galleries[i].CreatedAt.After(galleries[j].CreatedAt)
+	})
+	return galleries, nil
+}
+
+func (m *MemoryTagDB) FindImagesByTag(name string, userID uuid.UUID) ([]Image, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	m.galleries.mu.RLock()
+	defer m.galleries.mu.RUnlock()
+
+	m.images.mu.RLock()
+	defer m.images.mu.RUnlock()
+
+	images := []Image{}
+	for galleryID, galleryImages := range m.images.images {
+		gallery, found := m.galleries.galleries[galleryID]
+		if !found || !gallery.ListedFor(userID) {
+			continue
+		}
+		for _, image := range galleryImages {
+			if hasTag(m.imageTags[image.ID], name) {
+				images = append(images, image)
+			}
+		}
+	}
+	sort.SliceStable(images, func(i, j int) bool {
+		return images[i].CreatedAt.After(images[j].CreatedAt)
+	})
+	return images, nil
+}
+
+// galleryHasTag tells if the gallery has the tag
+func (m *MemoryTagDB) galleryHasTag(galleryID uuid.UUID, name string) bool {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return hasTag(m.galleryTags[galleryID], name)
+}
+
+// checkImages returns ErrNotFound if one of
+// the images is not in the gallery
+func (m *MemoryTagDB) checkImages(galleryID uuid.UUID, imageIDs []uuid.UUID) error {
+	for _, imageID := range imageIDs {
+		if _, err := m.images.FindImageByID(galleryID, imageID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// addTags adds the names that are not in tags and sorts them
+func addTags(tags []string, names []string) []string {
+	result := append([]string{}, tags...)
+	for _, name := range names {
+		if !hasTag(result, name) {
+			result = append(result, name)
+		}
+	}
+	sort.Strings(result)
+	return result
+}
+
+func hasTag(tags []string, name string) bool {
+	for _, tag := range tags {
+		if tag == name {
+			return true
+		}
+	}
+	return false
+}
+
+// findTags returns the tags of the ids that have tags
+func findTags(tags map[uuid.UUID][]string, ids []uuid.UUID) map[uuid.UUID][]string {
+	found := map[uuid.UUID][]string{}
+	for _, id := range ids {
+		if len(tags[id]) > 0 {
+			found[id] = append([]string{}, tags[id]...)
+		}
+	}
+	return found
+}
+
+// MemorySearchDB is an in memory implementation of SearchDB
+// it searches the galleries, the images and the tags of
+// the tag db. it is safe for concurrent use
+type MemorySearchDB struct {
+	tags *MemoryTagDB
+}
+
+// make sure that MemorySearchDB implements SearchDB
+var _ SearchDB = (*MemorySearchDB)(nil)
+
+// NewMemorySearchDB creates a MemorySearchDB searching the
+// tags and the galleries and the images of the tag db
+func NewMemorySearchDB(tags *MemoryTagDB) *MemorySearchDB {
+	return &MemorySearchDB{tags: tags}
+}
+
+func (m *MemorySearchDB) SearchGalleries(query *SearchQuery) ([]*Gallery, error) {
+	m.tags.mu.RLock()
+	defer m.tags.mu.RUnlock()
+
+	m.tags.galleries.mu.RLock()
+	defer m.tags.galleries.mu.RUnlock()
+
+	galleries := []*Gallery{}
+	for _, gallery := range m.tags.galleries.galleries {
+		fields := []string{gallery.Title, gallery.Description}
+		if !gallery.ListedFor(query.ViewerID) || !matchSearch(query, gallery.UserID, gallery.CreatedAt, fields, m.tags.galleryTags[gallery.ID]) {
+			continue
+		}
+		gallery := gallery
+		galleries = append(galleries, &gallery)
+	}
+	sort.Slice(galleries, func(i, j int) bool {
+		return galleries[i].CreatedAt.After(galleries[j].CreatedAt)
+	})
+	if len(galleries) > query.Limit {
+		galleries = galleries[:query.Limit]
+	}
+	return galleries, nil
+}
+
+func (m *MemorySearchDB) SearchImages(query *SearchQuery) ([]Image, error) {
+	m.tags.mu.RLock()
+	defer m.tags.mu.RUnlock()
+
+	m.tags.galleries.mu.RLock()
+	defer m.tags.galleries.mu.RUnlock()
+
+	m.tags.images.mu.RLock()
+	defer m.tags.images.mu.RUnlock()
+
+	images := []Image{}
+	for galleryID, galleryImages := range m.tags.images.images {
+		gallery, found := m.tags.galleries.galleries[galleryID]
+		if !found || !gallery.ListedFor(query.ViewerID) {
+			continue
+		}
+		for _, image := range galleryImages {
+			fields := []string{image.Title, image.Caption, image.AltText, image.FileName, image.Camera}
+			if matchSearch(query, gallery.UserID, image.CreatedAt, fields, m.tags.imageTags[image.ID]) {
+				images = append(images, image)
+			}
+		}
+	}
+	sort.SliceStable(images, func(i, j int) bool {
+		return images[i].CreatedAt.After(images[j].CreatedAt)
+	})
+	if len(images) > query.Limit {
+		images = images[:query.Limit]
+	}
+	return images, nil
+}
+
+// matchSearch tells if every term of the query is in one of the
+// fields or the tags and the filters of the query match
+func matchSearch(query *SearchQuery, ownerID uuid.UUID, createdAt time.Time, fields []string, tags []string) bool {
+	switch {
+	case !uuid.Equal(query.OwnerID, uuid.Nil) && !uuid.Equal(query.OwnerID, ownerID):
+		return false
+	case !query.From.IsZero() && createdAt.Before(query.From):
+		return false
+	case !query.To.IsZero() && !createdAt.Before(query.To):
+		return false
+	}
+
+	text := strings.ToLower(strings.Join(append(fields, tags...), " "))
+	for _, term := range query.terms {
+		if !strings.Contains(text, term) {
+			return false
+		}
+	}
+	return true
+}
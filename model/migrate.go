@@ -0,0 +1,73 @@
+package model
+
+import (
+	"embed"
+	"io/fs"
+	"path"
+
+	"github.com/abanoub-fathy/bebo-gallery/pkg/migrate"
+)
+
+// migrationsFS contains the sql migrations
+// of every database dialect in its own dir
+//
+//go:embed migrations
+var migrationsFS embed.FS
+
+// Migrator returns the migrator of the versioned
+// sql migrations of the service database
+func (s *Service) Migrator() (*migrate.Migrator, error) {
+	if s.db == nil {
+		return nil, ErrNoDatabase
+	}
+
+	sqlDB, err := s.db.DB()
+	if err != nil {
+		return nil, err
+	}
+
+	name := s.db.Dialector.Name()
+	dialect := migrate.Postgres
+	if name == "sqlite" {
+		dialect = migrate.SQLite
+	}
+
+	migrations, err := fs.Sub(migrationsFS, path.Join("migrations", name))
+	if err != nil {
+		return nil, err
+	}
+
+	return migrate.New(sqlDB, dialect, migrations)
+}
+
+// RecordMissingImages adds the records of the image files of
+// every gallery that have none. the images uploaded before the
+// images table of the migration 0008 have no records and they
+// are not shown until they get them so it runs after migrating.
+// it returns the number of the records that are added or would
+// be added if dryRun is true
+func (s *Service) RecordMissingImages(dryRun bool) (int, error) {
+	galleryIDs, err := s.ImageService.GetGalleryIDs()
+	if err != nil {
+		return 0, err
+	}
+
+	count := 0
+	for _, galleryID := range galleryIDs {
+		// the images of the deleted galleries are removed by the gc
+		_, err := s.GalleryService.FindByID(galleryID.String())
+		if err == ErrNotFound {
+			continue
+		}
+		if err != nil {
+			return 0, err
+		}
+
+		recorded, err := s.ImageService.RecordImages(galleryID, dryRun)
+		if err != nil {
+			return 0, err
+		}
+		count += len(recorded)
+	}
+	return count, nil
+}
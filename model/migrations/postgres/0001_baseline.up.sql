@@ -0,0 +1,40 @@
+-- baseline of the tables created by the gorm auto migration
+-- the statements are idempotent so they can be applied on
+-- top of a database created before the versioned migrations
+CREATE TABLE IF NOT EXISTS users (
+	id uuid PRIMARY KEY,
+	created_at timestamptz,
+	updated_at timestamptz,
+	deleted_at timestamptz,
+	first_name text NOT NULL,
+	last_name text NOT NULL,
+	email text NOT NULL UNIQUE,
+	password_hash text NOT NULL,
+	remeber_token_hash text UNIQUE
+);
+CREATE INDEX IF NOT EXISTS idx_users_deleted_at ON users (deleted_at);
+CREATE INDEX IF NOT EXISTS idx_users_email ON users (email);
+CREATE INDEX IF NOT EXISTS idx_users_remeber_token_hash ON users (remeber_token_hash);
+
+CREATE TABLE IF NOT EXISTS galleries (
+	id uuid PRIMARY KEY,
+	created_at timestamptz,
+	updated_at timestamptz,
+	deleted_at timestamptz,
+	title text,
+	user_id uuid,
+	CONSTRAINT fk_users_galleries FOREIGN KEY (user_id) REFERENCES users (id)
+);
+CREATE INDEX IF NOT EXISTS idx_galleries_deleted_at ON galleries (deleted_at);
+CREATE INDEX IF NOT EXISTS idx_galleries_user_id ON galleries (user_id);
+
+CREATE TABLE IF NOT EXISTS pw_resets (
+	id uuid PRIMARY KEY,
+	created_at timestamptz,
+	updated_at timestamptz,
+	deleted_at timestamptz,
+	user_id uuid NOT NULL,
+	token_hash text NOT NULL UNIQUE
+);
+CREATE INDEX IF NOT EXISTS idx_pw_resets_deleted_at ON pw_resets (deleted_at);
+CREATE INDEX IF NOT EXISTS idx_pw_resets_token_hash ON pw_resets (token_hash);
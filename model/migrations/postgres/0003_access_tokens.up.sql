@@ -0,0 +1,15 @@
+CREATE TABLE access_tokens (
+	id uuid PRIMARY KEY,
+	created_at timestamptz,
+	updated_at timestamptz,
+	deleted_at timestamptz,
+	user_id uuid NOT NULL,
+	name text NOT NULL,
+	scope text NOT NULL,
+	expires_at timestamptz,
+	last_used_at timestamptz,
+	token_hash text NOT NULL UNIQUE,
+	CONSTRAINT fk_users_access_tokens FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+);
+CREATE INDEX idx_access_tokens_deleted_at ON access_tokens (deleted_at);
+CREATE INDEX idx_access_tokens_user_id ON access_tokens (user_id);
@@ -0,0 +1,6 @@
+DELETE FROM access_tokens WHERE client_id IS NOT NULL;
+DROP INDEX IF EXISTS idx_access_tokens_refresh_token_hash;
+ALTER TABLE access_tokens DROP COLUMN refresh_token_hash;
+ALTER TABLE access_tokens DROP COLUMN client_id;
+DROP TABLE IF EXISTS oauth_codes;
+DROP TABLE IF EXISTS oauth_clients;
@@ -0,0 +1,36 @@
+CREATE TABLE oauth_clients (
+	id uuid PRIMARY KEY,
+	created_at timestamptz,
+	updated_at timestamptz,
+	deleted_at timestamptz,
+	user_id uuid NOT NULL,
+	name text NOT NULL,
+	redirect_uris text NOT NULL,
+	client_id text NOT NULL UNIQUE,
+	confidential boolean NOT NULL DEFAULT false,
+	secret_hash text,
+	CONSTRAINT fk_users_oauth_clients FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+);
+CREATE INDEX idx_oauth_clients_deleted_at ON oauth_clients (deleted_at);
+CREATE INDEX idx_oauth_clients_user_id ON oauth_clients (user_id);
+
+CREATE TABLE oauth_codes (
+	id uuid PRIMARY KEY,
+	created_at timestamptz,
+	updated_at timestamptz,
+	deleted_at timestamptz,
+	client_id uuid NOT NULL,
+	user_id uuid NOT NULL,
+	scope text NOT NULL,
+	redirect_uri text NOT NULL,
+	code_challenge text NOT NULL,
+	expires_at timestamptz NOT NULL,
+	code_hash text NOT NULL UNIQUE,
+	CONSTRAINT fk_oauth_clients_oauth_codes FOREIGN KEY (client_id) REFERENCES oauth_clients (id) ON DELETE CASCADE,
+	CONSTRAINT fk_users_oauth_codes FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+);
+CREATE INDEX idx_oauth_codes_deleted_at ON oauth_codes (deleted_at);
+
+ALTER TABLE access_tokens ADD COLUMN client_id uuid REFERENCES oauth_clients (id) ON DELETE CASCADE;
+ALTER TABLE access_tokens ADD COLUMN refresh_token_hash text;
+CREATE UNIQUE INDEX idx_access_tokens_refresh_token_hash ON access_tokens (refresh_token_hash);
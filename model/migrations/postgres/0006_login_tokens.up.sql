@@ -0,0 +1,10 @@
+CREATE TABLE login_tokens (
+	id uuid PRIMARY KEY,
+	created_at timestamptz,
+	updated_at timestamptz,
+	deleted_at timestamptz,
+	user_id uuid NOT NULL,
+	token_hash text NOT NULL UNIQUE,
+	CONSTRAINT fk_users_login_tokens FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+);
+CREATE INDEX idx_login_tokens_deleted_at ON login_tokens (deleted_at);
@@ -0,0 +1,8 @@
+CREATE TABLE rate_limits (
+	key text PRIMARY KEY,
+	a double precision NOT NULL DEFAULT 0,
+	b double precision NOT NULL DEFAULT 0,
+	at timestamptz,
+	expires_at timestamptz NOT NULL
+);
+CREATE INDEX idx_rate_limits_expires_at ON rate_limits (expires_at);
@@ -0,0 +1,2 @@
+ALTER TABLE galleries DROP COLUMN IF EXISTS cover_image_id;
+DROP TABLE IF EXISTS images;
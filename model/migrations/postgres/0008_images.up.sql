@@ -0,0 +1,15 @@
+CREATE TABLE images (
+	id uuid PRIMARY KEY,
+	created_at timestamptz,
+	updated_at timestamptz,
+	deleted_at timestamptz,
+	gallery_id uuid NOT NULL,
+	file_name text NOT NULL,
+	position integer NOT NULL DEFAULT 0,
+	CONSTRAINT fk_galleries_images FOREIGN KEY (gallery_id) REFERENCES galleries (id) ON DELETE CASCADE
+);
+CREATE UNIQUE INDEX idx_images_gallery_file ON images (gallery_id, file_name);
+CREATE INDEX idx_images_deleted_at ON images (deleted_at);
+
+ALTER TABLE galleries ADD COLUMN cover_image_id uuid
+	CONSTRAINT fk_galleries_cover_image REFERENCES images (id) ON DELETE SET NULL;
@@ -0,0 +1,3 @@
+ALTER TABLE images DROP COLUMN IF EXISTS alt_text;
+ALTER TABLE images DROP COLUMN IF EXISTS caption;
+ALTER TABLE images DROP COLUMN IF EXISTS title;
@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS idx_tags_search_vector;
+ALTER TABLE images DROP COLUMN IF EXISTS search_vector;
+ALTER TABLE galleries DROP COLUMN IF EXISTS search_vector;
+ALTER TABLE images DROP COLUMN IF EXISTS camera;
+ALTER TABLE galleries DROP COLUMN IF EXISTS description;
@@ -0,0 +1,18 @@
+ALTER TABLE galleries ADD COLUMN description text NOT NULL DEFAULT '';
+ALTER TABLE images ADD COLUMN camera text NOT NULL DEFAULT '';
+
+-- the 'simple' config is used because the galleries are written
+-- in many languages and it does not drop any of the words
+ALTER TABLE galleries ADD COLUMN search_vector tsvector GENERATED ALWAYS AS (
+	to_tsvector('simple', coalesce(title, '') || ' ' || description)
+) STORED;
+CREATE INDEX idx_galleries_search_vector ON galleries USING GIN (search_vector);
+
+-- the dots, the dashes and the underscores split the
+-- file names like IMG_1234.jpg to separate words
+ALTER TABLE images ADD COLUMN search_vector tsvector GENERATED ALWAYS AS (
+	to_tsvector('simple', title || ' ' || caption || ' ' || alt_text || ' ' || translate(file_name, '._-', '   ') || ' ' || camera)
+) STORED;
+CREATE INDEX idx_images_search_vector ON images USING GIN (search_vector);
+
+CREATE INDEX idx_tags_search_vector ON tags USING GIN (to_tsvector('simple', translate(name, '_-', '  ')));
@@ -0,0 +1,2 @@
+ALTER TABLE galleries DROP COLUMN published_at;
+ALTER TABLE users DROP COLUMN handle;
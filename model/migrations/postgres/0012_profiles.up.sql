@@ -0,0 +1,9 @@
+-- the existing users get a handle made from their id
+-- they can not choose it so it is never reserved or taken
+ALTER TABLE users ADD COLUMN handle text;
+UPDATE users SET handle = 'u' || replace(id::text, '-', '');
+ALTER TABLE users ALTER COLUMN handle SET NOT NULL;
+CREATE UNIQUE INDEX idx_users_handle ON users (handle);
+
+ALTER TABLE galleries ADD COLUMN published_at timestamptz;
+CREATE INDEX idx_galleries_published_at ON galleries (published_at) WHERE published_at IS NOT NULL;
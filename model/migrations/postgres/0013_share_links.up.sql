@@ -0,0 +1,12 @@
+CREATE TABLE share_links (
+	id uuid PRIMARY KEY,
+	created_at timestamptz,
+	updated_at timestamptz,
+	deleted_at timestamptz,
+	gallery_id uuid NOT NULL,
+	allow_download boolean NOT NULL DEFAULT false,
+	token_hash text NOT NULL UNIQUE,
+	CONSTRAINT fk_galleries_share_links FOREIGN KEY (gallery_id) REFERENCES galleries (id) ON DELETE CASCADE
+);
+CREATE INDEX idx_share_links_deleted_at ON share_links (deleted_at);
+CREATE INDEX idx_share_links_gallery_id ON share_links (gallery_id);
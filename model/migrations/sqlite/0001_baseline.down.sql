@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS pw_resets;
+DROP TABLE IF EXISTS galleries;
+DROP TABLE IF EXISTS users;
@@ -0,0 +1,37 @@
+CREATE TABLE users (
+	id text PRIMARY KEY,
+	created_at datetime,
+	updated_at datetime,
+	deleted_at datetime,
+	first_name text NOT NULL,
+	last_name text NOT NULL,
+	email text NOT NULL UNIQUE,
+	password_hash text NOT NULL,
+	remeber_token_hash text UNIQUE
+);
+CREATE INDEX idx_users_deleted_at ON users (deleted_at);
+CREATE INDEX idx_users_email ON users (email);
+CREATE INDEX idx_users_remeber_token_hash ON users (remeber_token_hash);
+
+CREATE TABLE galleries (
+	id text PRIMARY KEY,
+	created_at datetime,
+	updated_at datetime,
+	deleted_at datetime,
+	title text,
+	user_id text,
+	CONSTRAINT fk_users_galleries FOREIGN KEY (user_id) REFERENCES users (id)
+);
+CREATE INDEX idx_galleries_deleted_at ON galleries (deleted_at);
+CREATE INDEX idx_galleries_user_id ON galleries (user_id);
+
+CREATE TABLE pw_resets (
+	id text PRIMARY KEY,
+	created_at datetime,
+	updated_at datetime,
+	deleted_at datetime,
+	user_id text NOT NULL,
+	token_hash text NOT NULL UNIQUE
+);
+CREATE INDEX idx_pw_resets_deleted_at ON pw_resets (deleted_at);
+CREATE INDEX idx_pw_resets_token_hash ON pw_resets (token_hash);
@@ -0,0 +1,14 @@
+CREATE TABLE identities (
+	id text PRIMARY KEY,
+	created_at datetime,
+	updated_at datetime,
+	deleted_at datetime,
+	user_id text NOT NULL,
+	provider text NOT NULL,
+	subject text NOT NULL,
+	email text,
+	CONSTRAINT fk_users_identities FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+);
+CREATE INDEX idx_identities_deleted_at ON identities (deleted_at);
+CREATE INDEX idx_identities_user_id ON identities (user_id);
+CREATE UNIQUE INDEX idx_identities_provider_subject ON identities (provider, subject);
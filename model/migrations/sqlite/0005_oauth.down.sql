@@ -0,0 +1,24 @@
+-- sqlite can not drop a column with a foreign key
+-- so the tokens table is created again without it
+DELETE FROM access_tokens WHERE client_id IS NOT NULL;
+CREATE TABLE access_tokens_old (
+	id text PRIMARY KEY,
+	created_at datetime,
+	updated_at datetime,
+	deleted_at datetime,
+	user_id text NOT NULL,
+	name text NOT NULL,
+	scope text NOT NULL,
+	expires_at datetime,
+	last_used_at datetime,
+	token_hash text NOT NULL UNIQUE,
+	CONSTRAINT fk_users_access_tokens FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+);
+INSERT INTO access_tokens_old (id, created_at, updated_at, deleted_at, user_id, name, scope, expires_at, last_used_at, token_hash)
+	SELECT id, created_at, updated_at, deleted_at, user_id, name, scope, expires_at, last_used_at, token_hash FROM access_tokens;
+DROP TABLE access_tokens;
+ALTER TABLE access_tokens_old RENAME TO access_tokens;
+CREATE INDEX idx_access_tokens_deleted_at ON access_tokens (deleted_at);
+CREATE INDEX idx_access_tokens_user_id ON access_tokens (user_id);
+DROP TABLE IF EXISTS oauth_codes;
+DROP TABLE IF EXISTS oauth_clients;
@@ -0,0 +1,10 @@
+CREATE TABLE login_tokens (
+	id text PRIMARY KEY,
+	created_at datetime,
+	updated_at datetime,
+	deleted_at datetime,
+	user_id text NOT NULL,
+	token_hash text NOT NULL UNIQUE,
+	CONSTRAINT fk_users_login_tokens FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+);
+CREATE INDEX idx_login_tokens_deleted_at ON login_tokens (deleted_at);
@@ -0,0 +1,8 @@
+CREATE TABLE rate_limits (
+	key text PRIMARY KEY,
+	a real NOT NULL DEFAULT 0,
+	b real NOT NULL DEFAULT 0,
+	at datetime,
+	expires_at datetime NOT NULL
+);
+CREATE INDEX idx_rate_limits_expires_at ON rate_limits (expires_at);
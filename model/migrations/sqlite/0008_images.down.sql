@@ -0,0 +1,18 @@
+-- sqlite can not drop a column with a foreign key
+-- so the galleries table is created again without it
+CREATE TABLE galleries_old (
+	id text PRIMARY KEY,
+	created_at datetime,
+	updated_at datetime,
+	deleted_at datetime,
+	title text,
+	user_id text,
+	CONSTRAINT fk_users_galleries FOREIGN KEY (user_id) REFERENCES users (id)
+);
+INSERT INTO galleries_old (id, created_at, updated_at, deleted_at, title, user_id)
+	SELECT id, created_at, updated_at, deleted_at, title, user_id FROM galleries;
+DROP TABLE images;
+DROP TABLE galleries;
+ALTER TABLE galleries_old RENAME TO galleries;
+CREATE INDEX idx_galleries_deleted_at ON galleries (deleted_at);
+CREATE INDEX idx_galleries_user_id ON galleries (user_id);
@@ -0,0 +1,3 @@
+ALTER TABLE images DROP COLUMN alt_text;
+ALTER TABLE images DROP COLUMN caption;
+ALTER TABLE images DROP COLUMN title;
@@ -0,0 +1,3 @@
+ALTER TABLE images ADD COLUMN title text NOT NULL DEFAULT '';
+ALTER TABLE images ADD COLUMN caption text NOT NULL DEFAULT '';
+ALTER TABLE images ADD COLUMN alt_text text NOT NULL DEFAULT '';
@@ -0,0 +1,23 @@
+CREATE TABLE tags (
+	id text PRIMARY KEY,
+	created_at datetime,
+	name text NOT NULL UNIQUE
+);
+
+CREATE TABLE gallery_tags (
+	gallery_id text NOT NULL,
+	tag_id text NOT NULL,
+	PRIMARY KEY (gallery_id, tag_id),
+	CONSTRAINT fk_galleries_gallery_tags FOREIGN KEY (gallery_id) REFERENCES galleries (id) ON DELETE CASCADE,
+	CONSTRAINT fk_tags_gallery_tags FOREIGN KEY (tag_id) REFERENCES tags (id) ON DELETE CASCADE
+);
+CREATE INDEX idx_gallery_tags_tag_id ON gallery_tags (tag_id);
+
+CREATE TABLE image_tags (
+	image_id text NOT NULL,
+	tag_id text NOT NULL,
+	PRIMARY KEY (image_id, tag_id),
+	CONSTRAINT fk_images_image_tags FOREIGN KEY (image_id) REFERENCES images (id) ON DELETE CASCADE,
+	CONSTRAINT fk_tags_image_tags FOREIGN KEY (tag_id) REFERENCES tags (id) ON DELETE CASCADE
+);
+CREATE INDEX idx_image_tags_tag_id ON image_tags (tag_id);
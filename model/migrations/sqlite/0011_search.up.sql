@@ -0,0 +1,3 @@
+-- sqlite has no tsvector so the search uses LIKE on the columns
+ALTER TABLE galleries ADD COLUMN description text NOT NULL DEFAULT '';
+ALTER TABLE images ADD COLUMN camera text NOT NULL DEFAULT '';
@@ -0,0 +1,4 @@
+DROP INDEX idx_galleries_published_at;
+ALTER TABLE galleries DROP COLUMN published_at;
+DROP INDEX idx_users_handle;
+ALTER TABLE users DROP COLUMN handle;
@@ -0,0 +1,6 @@
+ALTER TABLE users ADD COLUMN handle text NOT NULL DEFAULT '';
+UPDATE users SET handle = 'u' || replace(id, '-', '');
+CREATE UNIQUE INDEX idx_users_handle ON users (handle);
+
+ALTER TABLE galleries ADD COLUMN published_at datetime;
+CREATE INDEX idx_galleries_published_at ON galleries (published_at);
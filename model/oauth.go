@@ -0,0 +1,447 @@
+package model
+
+import (
+	"crypto/subtle"
+	"encoding/hex"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/abanoub-fathy/bebo-gallery/pkg/hash"
+	"github.com/abanoub-fathy/bebo-gallery/pkg/rand"
+	uuid "github.com/satori/go.uuid"
+	"gorm.io/gorm"
+)
+
+const (
+	ErrOAuthClientNameRequired   publicError = "model: app name is required"
+	ErrOAuthRedirectURIsRequired publicError = "model: at least one redirect uri is required"
+	ErrOAuthRedirectURIInvalid   publicError = "model: redirect uris should be absolute https urls or http urls of localhost"
+	ErrOAuthClientInvalid        publicError = "model: client authentication failed"
+	ErrOAuthScopeInvalid         publicError = "model: scope should be read or write"
+
+	// OAuthCodeDuration is how long the authorization
+	// code is valid after the user approves the client
+	OAuthCodeDuration = 10 * time.Minute
+
+	// OAuthAccessTokenDuration is how long the access
+	// tokens issued to the clients are valid
+	OAuthAccessTokenDuration = time.Hour
+
+	// oauthClientIDPrefix is the prefix of the public client ids
+	oauthClientIDPrefix = "bebo-app-"
+)
+
+// OAuthClient is a third party app registered by a user
+// that can ask the users for access to their galleries
+type OAuthClient struct {
+	Base
+	// UserID is the user who registered the app
+	UserID uuid.UUID `gorm:"not null;index"`
+	Name   string    `gorm:"not null"`
+
+	// RedirectURIs are the allowed redirect uris
+	// separated by new lines
+	RedirectURIs string `gorm:"not null"`
+
+	// ClientID is the public id of the client
+	ClientID string `gorm:"not null;unique"`
+
+	// Confidential clients have a secret and they authenticate
+	// with it. the public clients like the mobile apps have no
+	// secret and they rely only on PKCE
+	Confidential bool
+	Secret       string `gorm:"-"`
+	SecretHash   string
+}
+
+// TableName is the table of the clients. gorm would
+// name it o_auth_clients
+func (OAuthClient) TableName() string {
+	return "oauth_clients"
+}
+
+// RedirectURIList returns the redirect uris of the client
+func (c *OAuthClient) RedirectURIList() []string {
+	return strings.Fields(c.RedirectURIs)
+}
+
+// AllowsRedirectURI tells if the redirect uri is registered
+// it must be an exact match of one of them
+func (c *OAuthClient) AllowsRedirectURI(redirectURI string) bool {
+	for _, uri := range c.RedirectURIList() {
+		if uri == redirectURI {
+			return true
+		}
+	}
+	return false
+}
+
+// OAuthCode is the authorization code given to the
+// client after the user approves it
+type OAuthCode struct {
+	Base
+	// ClientID is the id of the OAuthClient record
+	ClientID      uuid.UUID `gorm:"type:uuid;not null"`
+	UserID        uuid.UUID `gorm:"not null"`
+	Scope         string    `gorm:"not null"`
+	RedirectURI   string    `gorm:"not null"`
+	CodeChallenge string    `gorm:"not null"`
+	ExpiresAt     time.Time `gorm:"not null"`
+	Code          string    `gorm:"-"`
+	CodeHash      string    `gorm:"not null;unique"`
+}
+
+// TableName is the table of the codes
+func (OAuthCode) TableName() string {
+	return "oauth_codes"
+}
+
+// ParseOAuthScope returns the scope of the access token for
+// the space separated scopes requested by the client.
+// the clients can ask for read and write only. if nothing
+// is requested the read scope is used
+func ParseOAuthScope(scope string) (string, error) {
+	result := ScopeRead
+	for _, s := range strings.Fields(scope) {
+		switch s {
+		case ScopeRead:
+		case ScopeWrite:
+			result = ScopeWrite
+		default:
+			return "", ErrOAuthScopeInvalid
+		}
+	}
+	return result, nil
+}
+
+// OAuthService is used to manage the OAuth clients
+// and their authorization codes
+type OAuthService interface {
+	OAuthDB
+
+	// AuthenticateClient returns the client with the client id
+	// the secret is required only for the confidential clients
+	AuthenticateClient(clientID, secret string) (*OAuthClient, error)
+}
+
+// OAuthDB has all methods needed to implement and
+// use the OAuth database methods
+type OAuthDB interface {
+	// CreateClient registers a new client. the validation layer
+	// generates the client id and the secret which is shown once
+	CreateClient(client *OAuthClient) error
+	FindClientByClientID(clientID string) (*OAuthClient, error)
+	FindClientsByUserID(userID uuid.UUID) ([]*OAuthClient, error)
+	DeleteClient(userID uuid.UUID, id uuid.UUID) error
+
+	// CreateCode stores a new authorization code. the validation
+	// layer generates the code and sets its expiry
+	CreateCode(code *OAuthCode) error
+
+	// ConsumeCode returns the code and deletes it so every
+	// code is used once. the validation layer hashes the
+	// code and refuses the expired ones
+	ConsumeCode(code string) (*OAuthCode, error)
+}
+
+type oauthService struct {
+	OAuthDB
+	hasher *hash.Hasher
+}
+
+// NewOAuthService creates a new OAuthService
+//
+// hashSecretKey is the secret key used to hash the
+// client secrets and the codes
+func NewOAuthService(db *gorm.DB, hashSecretKey string) OAuthService {
+	return NewOAuthServiceWithDB(newOAuthGorm(db), hashSecretKey)
+}
+
+// NewOAuthServiceWithDB creates a new OAuthService
+// on top of the given db layer like the in memory one
+func NewOAuthServiceWithDB(oauthDB OAuthDB, hashSecretKey string) OAuthService {
+	hasher := hash.NewHasher(hashSecretKey)
+	return &oauthService{
+		OAuthDB: newOAuthValidator(oauthDB, hasher),
+		hasher:  hasher,
+	}
+}
+
+func (oas *oauthService) AuthenticateClient(clientID, secret string) (*OAuthClient, error) {
+	client, err := oas.OAuthDB.FindClientByClientID(clientID)
+	switch err {
+	case nil:
+	case ErrNotFound:
+		return nil, ErrOAuthClientInvalid
+	default:
+		return nil, err
+	}
+
+	if client.Confidential {
+		secretHash := oas.hasher.HashByHMAC(secret)
+		if secret == "" || subtle.ConstantTimeCompare([]byte(secretHash), []byte(client.SecretHash)) != 1 {
+			return nil, ErrOAuthClientInvalid
+		}
+	}
+	return client, nil
+}
+
+type oauthValidator struct {
+	OAuthDB
+	hasher *hash.Hasher
+}
+
+type oauthClientValidationFn func(client *OAuthClient) error
+
+func runOAuthClientValidationFns(client *OAuthClient, fns ...oauthClientValidationFn) error {
+	for _, fn := range fns {
+		if err := fn(client); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func newOAuthValidator(db OAuthDB, hasher *hash.Hasher) *oauthValidator {
+	return &oauthValidator{
+		OAuthDB: db,
+		hasher:  hasher,
+	}
+}
+
+func (ov *oauthValidator) CreateClient(client *OAuthClient) error {
+	err := runOAuthClientValidationFns(client,
+		ov.requireClientUserID,
+		ov.requireClientName,
+		ov.normalizeRedirectURIs,
+		ov.validateRedirectURIs,
+		ov.setClientID,
+		ov.setSecret,
+	)
+	if err != nil {
+		return err
+	}
+
+	return ov.OAuthDB.CreateClient(client)
+}
+
+func (ov *oauthValidator) DeleteClient(userID uuid.UUID, id uuid.UUID) error {
+	if userID.String() == ZeroID {
+		return ErrUserIDRequired
+	}
+	if id.String() == ZeroID {
+		return ErrInvalidID
+	}
+	return ov.OAuthDB.DeleteClient(userID, id)
+}
+
+func (ov *oauthValidator) CreateCode(code *OAuthCode) error {
+	if code.UserID.String() == ZeroID {
+		return ErrUserIDRequired
+	}
+	if code.ClientID.String() == ZeroID || code.RedirectURI == "" || code.CodeChallenge == "" {
+		return ErrInvalidToken
+	}
+
+	token, err := rand.GenerateRememberToken()
+	if err != nil {
+		return err
+	}
+	code.Code = token
+	code.CodeHash = ov.hasher.HashByHMAC(token)
+	code.ExpiresAt = time.Now().Add(OAuthCodeDuration)
+
+	return ov.OAuthDB.CreateCode(code)
+}
+
+func (ov *oauthValidator) ConsumeCode(code string) (*OAuthCode, error) {
+	if code == "" {
+		return nil, ErrInvalidToken
+	}
+
+	c, err := ov.OAuthDB.ConsumeCode(ov.hasher.HashByHMAC(code))
+	if err != nil {
+		return nil, err
+	}
+	if !time.Now().Before(c.ExpiresAt) {
+		return nil, ErrAccessTokenExpired
+	}
+	return c, nil
+}
+
+func (ov *oauthValidator) requireClientUserID(client *OAuthClient) error {
+	if client.UserID.String() == ZeroID {
+		return ErrUserIDRequired
+	}
+	return nil
+}
+
+func (ov *oauthValidator) requireClientName(client *OAuthClient) error {
+	client.Name = strings.TrimSpace(client.Name)
+	if client.Name == "" {
+		return ErrOAuthClientNameRequired
+	}
+	return nil
+}
+
+func (ov *oauthValidator) normalizeRedirectURIs(client *OAuthClient) error {
+	client.RedirectURIs = strings.Join(strings.Fields(client.RedirectURIs), "\n")
+	if client.RedirectURIs == "" {
+		return ErrOAuthRedirectURIsRequired
+	}
+	return nil
+}
+
+func (ov *oauthValidator) validateRedirectURIs(client *OAuthClient) error {
+	for _, uri := range client.RedirectURIList() {
+		u, err := url.Parse(uri)
+		if err != nil || !u.IsAbs() || u.Host == "" || u.Fragment != "" {
+			return ErrOAuthRedirectURIInvalid
+		}
+
+		localhost := u.Hostname() == "localhost" || u.Hostname() == "127.0.0.1" || u.Hostname() == "::1"
+		if u.Scheme != "https" && !(u.Scheme == "http" && localhost) {
+			return ErrOAuthRedirectURIInvalid
+		}
+	}
+	return nil
+}
+
+func (ov *oauthValidator) setClientID(client *OAuthClient) error {
+	b, err := rand.RandBytes(12)
+	if err != nil {
+		return err
+	}
+	client.ClientID = oauthClientIDPrefix + hex.EncodeToString(b)
+	return nil
+}
+
+func (ov *oauthValidator) setSecret(client *OAuthClient) error {
+	client.Secret = ""
+	client.SecretHash = ""
+	if !client.Confidential {
+		return nil
+	}
+
+	secret, err := rand.GenerateRememberToken()
+	if err != nil {
+		return err
+	}
+	client.Secret = secret
+	client.SecretHash = ov.hasher.HashByHMAC(secret)
+	return nil
+}
+
+type oauthGorm struct {
+	db *gorm.DB
+}
+
+func newOAuthGorm(db *gorm.DB) *oauthGorm {
+	return &oauthGorm{db: db}
+}
+
+// make sure that oauthGorm implements OAuthDB
+var _ OAuthDB = (*oauthGorm)(nil)
+
+func (og *oauthGorm) CreateClient(client *OAuthClient) error {
+	return og.db.Create(client).Error
+}
+
+func (og *oauthGorm) FindClientByClientID(clientID string) (*OAuthClient, error) {
+	client := new(OAuthClient)
+	query := og.db.Where(OAuthClient{
+		ClientID: clientID,
+	})
+	if err := getRecord(query, client); err != nil {
+		return nil, err
+	}
+	return client, nil
+}
+
+func (og *oauthGorm) FindClientsByUserID(userID uuid.UUID) ([]*OAuthClient, error) {
+	clients := []*OAuthClient{}
+	err := og.db.Where("user_id = ?", userID).Order("created_at desc").Find(&clients).Error
+	return clients, err
+}
+
+func (og *oauthGorm) DeleteClient(userID uuid.UUID, id uuid.UUID) error {
+	result := og.db.Unscoped().Where("user_id = ? AND id = ?", userID, id).Delete(&OAuthClient{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (og *oauthGorm) CreateCode(code *OAuthCode) error {
+	return og.db.Create(code).Error
+}
+
+func (og *oauthGorm) ConsumeCode(codeHash string) (*OAuthCode, error) {
+	code := new(OAuthCode)
+	err := og.db.Transaction(func(tx *gorm.DB) error {
+		if err := getRecord(tx.Where("code_hash = ?", codeHash), code); err != nil {
+			return err
+		}
+
+		// the code is used only if this request deleted it
+		result := tx.Unscoped().Delete(&OAuthCode{}, "id = ?", code.ID)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrNotFound
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return code, nil
+}
+
+// IssueOAuthToken creates an access token and a refresh
+// token of the user for the client with the scope
+func (s *Service) IssueOAuthToken(client *OAuthClient, userID uuid.UUID, scope string) (*AccessToken, error) {
+	expiresAt := time.Now().Add(OAuthAccessTokenDuration)
+	token := &AccessToken{
+		UserID:    userID,
+		Name:      client.Name,
+		Scope:     scope,
+		ExpiresAt: &expiresAt,
+		ClientID:  &client.ID,
+	}
+	if err := s.AccessTokenService.Create(token); err != nil {
+		return nil, err
+	}
+	return token, nil
+}
+
+// RefreshOAuthToken exchanges the refresh token of the client
+// with a new access token and a new refresh token. the old
+// tokens are revoked so every refresh token is used once
+func (s *Service) RefreshOAuthToken(client *OAuthClient, refreshToken string) (*AccessToken, error) {
+	token, err := s.AccessTokenService.FindByRefreshToken(refreshToken)
+	if err != nil {
+		return nil, err
+	}
+	if token.ClientID == nil || !uuid.Equal(*token.ClientID, client.ID) {
+		return nil, ErrInvalidToken
+	}
+
+	user, err := s.UserService.FindByID(token.UserID.String())
+	if err != nil {
+		return nil, err
+	}
+	if user.Disabled {
+		return nil, ErrUserDisabled
+	}
+
+	if err := s.AccessTokenService.Revoke(token.UserID, token.ID); err != nil {
+		return nil, err
+	}
+	return s.IssueOAuthToken(client, token.UserID, token.Scope)
+}
@@ -0,0 +1,129 @@
+package model_test
+
+import (
+	"testing"
+
+	"github.com/abanoub-fathy/bebo-gallery/model"
+	"github.com/stretchr/testify/suite"
+)
+
+type OAuthServiceSuite struct {
+	suite.Suite
+	*model.Service
+	user *model.User
+}
+
+func (s *OAuthServiceSuite) SetupSuite() {
+	s.Service = newTestService(s.T())
+}
+
+func (s *OAuthServiceSuite) SetupTest() {
+	s.Require().NoError(s.Service.ResetDB())
+
+	s.user = &model.User{
+		FirstName: "Abanoub",
+		LastName:  "Fathy",
+		Email:     "aop4ever@gmail.com",
+		Password:  "12212154554554asdsa",
+	}
+	s.Require().NoError(s.UserService.CreateUser(s.user))
+}
+
+func (s *OAuthServiceSuite) TearDownSuite() {
+	s.Service.Close()
+}
+
+func (s *OAuthServiceSuite) TestCreateClientValidation() {
+	err := s.OAuthService.CreateClient(&model.OAuthClient{UserID: s.user.ID, RedirectURIs: "https://app.test/cb"})
+	s.Assert().Equal(model.ErrOAuthClientNameRequired, err)
+
+	err = s.OAuthService.CreateClient(&model.OAuthClient{UserID: s.user.ID, Name: "app", RedirectURIs: " \n "})
+	s.Assert().Equal(model.ErrOAuthRedirectURIsRequired, err)
+
+	for _, uri := range []string{"http://app.test/cb", "/cb", "https://app.test/cb#x", "app://cb"} {
+		err = s.OAuthService.CreateClient(&model.OAuthClient{UserID: s.user.ID, Name: "app", RedirectURIs: uri})
+		s.Assert().Equal(model.ErrOAuthRedirectURIInvalid, err, uri)
+	}
+}
+
+func (s *OAuthServiceSuite) TestAuthenticateClient() {
+	confidential := &model.OAuthClient{
+		UserID:       s.user.ID,
+		Name:         "web app",
+		RedirectURIs: "https://app.test/cb\r\nhttp://localhost:8080/cb",
+		Confidential: true,
+	}
+	s.Require().NoError(s.OAuthService.CreateClient(confidential))
+	s.Require().NotEmpty(confidential.Secret)
+	s.Assert().True(confidential.AllowsRedirectURI("http://localhost:8080/cb"))
+	s.Assert().False(confidential.AllowsRedirectURI("https://app.test/cb/other"))
+
+	client, err := s.OAuthService.AuthenticateClient(confidential.ClientID, confidential.Secret)
+	s.Require().NoError(err)
+	s.Assert().Equal(confidential.ID, client.ID)
+	s.Assert().Empty(client.Secret)
+
+	_, err = s.OAuthService.AuthenticateClient(confidential.ClientID, "")
+	s.Assert().Equal(model.ErrOAuthClientInvalid, err)
+	_, err = s.OAuthService.AuthenticateClient("unknown", "")
+	s.Assert().Equal(model.ErrOAuthClientInvalid, err)
+
+	// the public clients have no secret
+	public := &model.OAuthClient{UserID: s.user.ID, Name: "mobile app", RedirectURIs: "https://app.test/cb"}
+	s.Require().NoError(s.OAuthService.CreateClient(public))
+	s.Assert().Empty(public.Secret)
+	_, err = s.OAuthService.AuthenticateClient(public.ClientID, "")
+	s.Assert().NoError(err)
+}
+
+func (s *OAuthServiceSuite) TestConsumeCode() {
+	client := &model.OAuthClient{UserID: s.user.ID, Name: "app", RedirectURIs: "https://app.test/cb"}
+	s.Require().NoError(s.OAuthService.CreateClient(client))
+
+	code := &model.OAuthCode{
+		ClientID:      client.ID,
+		UserID:        s.user.ID,
+		Scope:         model.ScopeRead,
+		RedirectURI:   "https://app.test/cb",
+		CodeChallenge: "challenge",
+	}
+	s.Require().NoError(s.OAuthService.CreateCode(code))
+
+	found, err := s.OAuthService.ConsumeCode(code.Code)
+	s.Require().NoError(err)
+	s.Assert().Equal(client.ID, found.ClientID)
+
+	// every code is used once
+	_, err = s.OAuthService.ConsumeCode(code.Code)
+	s.Assert().Equal(model.ErrNotFound, err)
+}
+
+func (s *OAuthServiceSuite) TestRefreshOAuthToken() {
+	client := &model.OAuthClient{UserID: s.user.ID, Name: "app", RedirectURIs: "https://app.test/cb"}
+	s.Require().NoError(s.OAuthService.CreateClient(client))
+
+	token, err := s.IssueOAuthToken(client, s.user.ID, model.ScopeWrite)
+	s.Require().NoError(err)
+	s.Require().NotEmpty(token.RefreshToken)
+	s.Require().NotNil(token.ExpiresAt)
+
+	refreshed, err := s.RefreshOAuthToken(client, token.RefreshToken)
+	s.Require().NoError(err)
+	s.Assert().Equal(model.ScopeWrite, refreshed.Scope)
+	s.Assert().NotEqual(token.RefreshToken, refreshed.RefreshToken)
+
+	// the old tokens are revoked
+	_, err = s.RefreshOAuthToken(client, token.RefreshToken)
+	s.Assert().Equal(model.ErrNotFound, err)
+	_, _, err = s.AuthenticateAccessToken(token.Token)
+	s.Assert().Equal(model.ErrNotFound, err)
+
+	// deleting the client revokes its tokens
+	s.Require().NoError(s.OAuthService.DeleteClient(s.user.ID, client.ID))
+	_, _, err = s.AuthenticateAccessToken(refreshed.Token)
+	s.Assert().Equal(model.ErrNotFound, err)
+}
+
+func TestOAuthServiceSuite(t *testing.T) {
+	suite.Run(t, new(OAuthServiceSuite))
+}
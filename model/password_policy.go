@@ -0,0 +1,145 @@
+package model
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/abanoub-fathy/bebo-gallery/config"
+	"github.com/abanoub-fathy/bebo-gallery/pkg/password"
+)
+
+// minPersonalInfoLength is the min length of the parts of the
+// name and the email the passwords should not contain. the
+// shorter parts are found inside too many good passwords
+const minPersonalInfoLength = 3
+
+// PasswordPolicy is the policy the passwords of the users should
+// follow. it is checked on signup, reset and password changes
+//
+// Hasher hashes the passwords that follow the policy
+type PasswordPolicy struct {
+	MinLength int
+
+	// MinEntropy is the min estimated strength in bits
+	MinEntropy float64
+
+	// Breached is the list of the breached passwords
+	// the passwords are not checked against it if it is nil
+	Breached *password.BreachedList
+
+	Hasher *password.Hasher
+
+	// dummyHash is verified when the user is not found
+	// it is made by the Hasher on the first use
+	dummyOnce sync.Once
+	dummyHash string
+}
+
+// DefaultPasswordPolicy returns the policy of the default configurations
+func DefaultPasswordPolicy() *PasswordPolicy {
+	return &PasswordPolicy{
+		MinLength:  8,
+		MinEntropy: 40,
+		Hasher:     password.DefaultHasher(),
+	}
+}
+
+// NewPasswordPolicy creates the password policy of the configurations
+func NewPasswordPolicy(cfg config.Passwords) (*PasswordPolicy, error) {
+	policy := &PasswordPolicy{
+		MinLength:  cfg.MinLength,
+		MinEntropy: float64(cfg.MinEntropy),
+		Hasher: &password.Hasher{
+			Algorithm:  cfg.Hash,
+			BcryptCost: cfg.BcryptCost,
+			Argon2: password.Argon2Params{
+				Memory:  uint32(cfg.Argon2Memory),
+				Time:    uint32(cfg.Argon2Time),
+				Threads: uint8(cfg.Argon2Threads),
+			},
+			Pepper: []byte(cfg.Pepper),
+		},
+	}
+
+	if cfg.BreachedFile != "" {
+		breached, err := password.OpenBreachedList(cfg.BreachedFile)
+		if err != nil {
+			return nil, fmt.Errorf("model: could not open the breached passwords: %w", err)
+		}
+		policy.Breached = breached
+	}
+
+	return policy, nil
+}
+
+// Check checks the password of the user. the name and the
+// email of the user should be set to check that the
+// password does not contain them
+//
+// it returns ErrPasswordTooShort, ErrPasswordHasPersonalInfo,
+// ErrPasswordTooWeak or ErrPasswordBreached
+func (p *PasswordPolicy) Check(user *User) error {
+	if len([]rune(user.Password)) < p.MinLength {
+		return ErrPasswordTooShort
+	}
+
+	lowerPassword := strings.ToLower(user.Password)
+	for _, info := range personalInfo(user) {
+		if len(info) >= minPersonalInfoLength && strings.Contains(lowerPassword, info) {
+			return ErrPasswordHasPersonalInfo
+		}
+	}
+
+	if password.Entropy(user.Password) < p.MinEntropy {
+		return ErrPasswordTooWeak
+	}
+
+	if p.Breached != nil {
+		breached, err := p.Breached.Contains(user.Password)
+		if err != nil {
+			return err
+		}
+		if breached {
+			return ErrPasswordBreached
+		}
+	}
+
+	return nil
+}
+
+// Verify checks the password against the password hash of the user
+// it returns ErrPasswordNotCorrect if the password is not correct
+//
+// rehash is true when the hash is not made with the current
+// algorithm, params and pepper of the Hasher
+func (p *PasswordPolicy) Verify(user *User, pw string) (rehash bool, err error) {
+	rehash, err = p.Hasher.Verify(user.PasswordHash, pw)
+	if err == password.ErrMismatchedHashAndPassword {
+		return false, ErrPasswordNotCorrect
+	}
+	return rehash, err
+}
+
+// VerifyDummy checks the password against a hash of a password no
+// user has. it is called when the user is not found so finding out
+// that an email is not used takes as long as a wrong password
+func (p *PasswordPolicy) VerifyDummy(pw string) {
+	p.dummyOnce.Do(func() {
+		p.dummyHash, _ = p.Hasher.Hash("bebo-gallery-dummy-password")
+	})
+	if p.dummyHash != "" {
+		p.Hasher.Verify(p.dummyHash, pw)
+	}
+}
+
+// personalInfo returns the lower case names of the
+// user and the local part of the email
+func personalInfo(user *User) []string {
+	local, _, _ := strings.Cut(user.Email, "@")
+	return []string{
+		strings.ToLower(strings.TrimSpace(user.FirstName)),
+		strings.ToLower(strings.TrimSpace(user.LastName)),
+		strings.ToLower(strings.TrimSpace(local)),
+	}
+}
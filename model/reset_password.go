@@ -1,12 +1,18 @@
 package model
 
 import (
+	"time"
+
 	"github.com/abanoub-fathy/bebo-gallery/pkg/hash"
 	"github.com/abanoub-fathy/bebo-gallery/pkg/rand"
 	uuid "github.com/satori/go.uuid"
 	"gorm.io/gorm"
 )
 
+// pwResetTokenDuration is how long the reset
+// password token is valid after it is created
+const pwResetTokenDuration = time.Hour
+
 type pwReset struct {
 	Base
 	UserID    uuid.UUID `gorm:"not null"`
@@ -18,6 +24,11 @@ type pwResetDB interface {
 	GetByToken(token string) (*pwReset, error)
 	Create(p *pwReset) error
 	Delete(id uuid.UUID) error
+
+	// CountCreatedBefore and DeleteCreatedBefore work on
+	// the tokens created before the given time
+	CountCreatedBefore(before time.Time) (int64, error)
+	DeleteCreatedBefore(before time.Time) (int64, error)
 }
 
 type pwResetValidator struct {
@@ -142,3 +153,16 @@ func (pg *pwResetGorm) Delete(id uuid.UUID) error {
 		},
 	}).Error
 }
+
+// CountCreatedBefore counts the used tokens that are soft
+// deleted too so it matches the count DeleteCreatedBefore removes
+func (pg *pwResetGorm) CountCreatedBefore(before time.Time) (int64, error) {
+	var count int64
+	err := pg.db.Unscoped().Model(&pwReset{}).Where("created_at < ?", before).Count(&count).Error
+	return count, err
+}
+
+func (pg *pwResetGorm) DeleteCreatedBefore(before time.Time) (int64, error) {
+	result := pg.db.Unscoped().Where("created_at < ?", before).Delete(&pwReset{})
+	return result.RowsAffected, result.Error
+}
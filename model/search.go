@@ -0,0 +1,250 @@
+package model
+
+import (
+	"strings"
+	"time"
+	"unicode"
+
+	uuid "github.com/satori/go.uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	// ErrSearchTextRequired is returned when the search
+	// text has no words to search for
+	ErrSearchTextRequired publicError = "search text is required"
+
+	// ErrSearchDateRange is returned when the from
+	// date of the search is after its to date
+	ErrSearchDateRange publicError = "search from date should be before the to date"
+)
+
+const (
+	// DefaultSearchLimit is the number of the galleries and the
+	// images found by a search when its limit is not set
+	DefaultSearchLimit = 50
+
+	// MaxSearchLimit is the max limit of a search
+	MaxSearchLimit = 100
+
+	// maxSearchTerms is the max number of the words searched for
+	// the words after it are ignored
+	maxSearchTerms = 10
+)
+
+// SearchQuery is what the galleries and the images are searched by
+// the zero filters do not filter the results
+type SearchQuery struct {
+	// Text is split to words and every one of them should be in
+	// the title, the description, the caption, the file name, the
+	// camera or the tags. the words match the words starting
+	// with them so the search can be done while typing
+	Text string
+
+	// OwnerID is the id of the user who owns the galleries
+	OwnerID uuid.UUID
+
+	// ViewerID is the id of the user who searches. the unlisted
+	// galleries and their images are found only by their owner
+	ViewerID uuid.UUID
+
+	// From and To limit the creation time of the results
+	// the results created at To are not included
+	From time.Time
+	To   time.Time
+
+	Limit int
+
+	// terms are the normalized words of the text
+	terms []string
+}
+
+// searchTerms splits the text to lower case words
+// the chars other than the letters and the digits split them
+func searchTerms(text string) []string {
+	terms := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	if len(terms) > maxSearchTerms {
+		terms = terms[:maxSearchTerms]
+	}
+	return terms
+}
+
+// SearchService is used to search the galleries and the images
+// of all the users. a search finds the public galleries of the
+// other users and all the galleries of the user who searches
+type SearchService interface {
+	SearchDB
+}
+
+// SearchDB has the methods used to search the galleries and
+// the images. the results are sorted by their relevance
+// or by their creation time with the newest first
+type SearchDB interface {
+	// SearchGalleries finds the galleries by their title,
+	// description and tags
+	SearchGalleries(query *SearchQuery) ([]*Gallery, error)
+
+	// SearchImages finds the images by their title, caption, alt
+	// text, file name, camera and tags. the images of the deleted
+	// galleries are not found
+	SearchImages(query *SearchQuery) ([]Image, error)
+}
+
+type searchService struct {
+	SearchDB
+}
+
+// NewSearchService returns the SearchService that searches the db
+// postgres uses its full text search and sqlite uses LIKE
+func NewSearchService(db *gorm.DB) SearchService {
+	return NewSearchServiceWithDB(&searchGorm{
+		db:       db,
+		postgres: db.Dialector.Name() == "postgres",
+	})
+}
+
+// NewSearchServiceWithDB returns the SearchService with
+// the validator layer on top of the given db layer
+func NewSearchServiceWithDB(searchDB SearchDB) SearchService {
+	return &searchService{
+		SearchDB: &searchValidator{SearchDB: searchDB},
+	}
+}
+
+type searchValidator struct {
+	SearchDB
+}
+
+// validate sets the terms of the query and its default limit
+func (sv *searchValidator) validate(query *SearchQuery) error {
+	query.terms = searchTerms(query.Text)
+	if len(query.terms) == 0 {
+		return ErrSearchTextRequired
+	}
+	if !query.From.IsZero() && !query.To.IsZero() && query.To.Before(query.From) {
+		return ErrSearchDateRange
+	}
+	if query.Limit <= 0 || query.Limit > MaxSearchLimit {
+		query.Limit = DefaultSearchLimit
+	}
+	return nil
+}
+
+func (sv *searchValidator) SearchGalleries(query *SearchQuery) ([]*Gallery, error) {
+	if err := sv.validate(query); err != nil {
+		return nil, err
+	}
+	return sv.SearchDB.SearchGalleries(query)
+}
+
+func (sv *searchValidator) SearchImages(query *SearchQuery) ([]Image, error) {
+	if err := sv.validate(query); err != nil {
+		return nil, err
+	}
+	return sv.SearchDB.SearchImages(query)
+}
+
+// searchGorm searches the tsvector columns on postgres and
+// falls back to LIKE on sqlite which has no full text search
+type searchGorm struct {
+	db       *gorm.DB
+	postgres bool
+}
+
+// make sure that searchGorm implements SearchDB
+var _ SearchDB = (*searchGorm)(nil)
+
+func (sg *searchGorm) SearchGalleries(query *SearchQuery) ([]*Gallery, error) {
+	db := sg.filter(sg.db.Model(&Gallery{}), "galleries", query)
+	for _, term := range query.terms {
+		tagged := sg.db.Table("gallery_tags").
+			Select("gallery_tags.gallery_id").
+			Joins("JOIN tags ON tags.id = gallery_tags.tag_id").
+			Where(sg.tagMatch(term))
+		if sg.postgres {
+			db = db.Where("(galleries.search_vector @@ to_tsquery('simple', ?) OR galleries.id IN (?))", prefixQuery(term), tagged)
+		} else {
+			pattern := "%" + escapeLike(term) + "%"
+			db = db.Where(`(galleries.title LIKE ? ESCAPE '\' OR galleries.description LIKE ? ESCAPE '\' OR galleries.id IN (?))`, pattern, pattern, tagged)
+		}
+	}
+
+	galleries := []*Gallery{}
+	err := sg.order(db, "galleries", query).Limit(query.Limit).Find(&galleries).Error
+	return galleries, err
+}
+
+func (sg *searchGorm) SearchImages(query *SearchQuery) ([]Image, error) {
+	db := sg.db.Joins("JOIN galleries ON galleries.id = images.gallery_id AND galleries.deleted_at IS NULL")
+	db = sg.filter(db, "images", query)
+	for _, term := range query.terms {
+		tagged := sg.db.Table("image_tags").
+			Select("image_tags.image_id").
+			Joins("JOIN tags ON tags.id = image_tags.tag_id").
+			Where(sg.tagMatch(term))
+		if sg.postgres {
+			db = db.Where("(images.search_vector @@ to_tsquery('simple', ?) OR images.id IN (?))", prefixQuery(term), tagged)
+		} else {
+			pattern := "%" + escapeLike(term) + "%"
+			db = db.Where(`(images.title LIKE ? ESCAPE '\' OR images.caption LIKE ? ESCAPE '\' OR images.alt_text LIKE ? ESCAPE '\' OR images.file_name LIKE ? ESCAPE '\' OR images.camera LIKE ? ESCAPE '\' OR images.id IN (?))`,
+				pattern, pattern, pattern, pattern, pattern, tagged)
+		}
+	}
+
+	images := []Image{}
+	err := sg.order(db, "images", query).Limit(query.Limit).Find(&images).Error
+	return images, err
+}
+
+// filter adds the visibility, the owner and the date filters
+// of the query. the galleries table should be in the query
+func (sg *searchGorm) filter(db *gorm.DB, table string, query *SearchQuery) *gorm.DB {
+	db = listedFor(db, query.ViewerID)
+	if !uuid.Equal(query.OwnerID, uuid.Nil) {
+		db = db.Where("galleries.user_id = ?", query.OwnerID)
+	}
+	if !query.From.IsZero() {
+		db = db.Where(table+".created_at >= ?", query.From)
+	}
+	if !query.To.IsZero() {
+		db = db.Where(table+".created_at < ?", query.To)
+	}
+	return db
+}
+
+// tagMatch returns the condition of the tags that match the term
+// the dashes and the underscores split the tags to words
+func (sg *searchGorm) tagMatch(term string) clause.Expr {
+	if sg.postgres {
+		return gorm.Expr("to_tsvector('simple', translate(tags.name, '_-', '  ')) @@ to_tsquery('simple', ?)", prefixQuery(term))
+	}
+	return gorm.Expr(`tags.name LIKE ? ESCAPE '\'`, "%"+escapeLike(term)+"%")
+}
+
+// order sorts the results by their rank on postgres
+// and then by their creation time
+func (sg *searchGorm) order(db *gorm.DB, table string, query *SearchQuery) *gorm.DB {
+	if !sg.postgres {
+		return db.Order(table + ".created_at DESC")
+	}
+
+	terms := make([]string, len(query.terms))
+	for i, term := range query.terms {
+		terms[i] = prefixQuery(term)
+	}
+	return db.Clauses(clause.OrderBy{Expression: clause.Expr{
+		SQL:                "ts_rank(" + table + ".search_vector, to_tsquery('simple', ?)) DESC, " + table + ".created_at DESC",
+		Vars:               []interface{}{strings.Join(terms, " | ")},
+		WithoutParentheses: true,
+	}})
+}
+
+// prefixQuery returns the tsquery matching the words starting
+// with the term. the terms have only letters and digits so
+// they have none of the tsquery operators
+func prefixQuery(term string) string {
+	return term + ":*"
+}
@@ -0,0 +1,186 @@
+package model_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/abanoub-fathy/bebo-gallery/model"
+	uuid "github.com/satori/go.uuid"
+	"github.com/stretchr/testify/suite"
+)
+
+// jpegWithCamera returns a jpeg with the exif
+// make and model of the camera
+func jpegWithCamera(maker, model string) []byte {
+	values := maker + "\x00" + model + "\x00"
+
+	var tiff bytes.Buffer
+	tiff.WriteString("MM\x00\x2a\x00\x00\x00\x08\x00\x02")
+	offset := uint32(8 + 2 + 2*12 + 4)
+	for i, value := range []string{maker, model} {
+		binary.Write(&tiff, binary.BigEndian, []uint16{0x010f + uint16(i), 2})
+		binary.Write(&tiff, binary.BigEndian, []uint32{uint32(len(value) + 1), offset})
+		offset += uint32(len(value) + 1)
+	}
+	tiff.Write([]byte{0, 0, 0, 0})
+	tiff.WriteString(values)
+
+	var b bytes.Buffer
+	b.Write([]byte{0xff, 0xd8, 0xff, 0xe1})
+	binary.Write(&b, binary.BigEndian, uint16(tiff.Len()+8))
+	b.WriteString("Exif\x00\x00")
+	b.Write(tiff.Bytes())
+	b.Write([]byte{0xff, 0xd9})
+	return b.Bytes()
+}
+
+// SearchServiceSuite runs on the database and on the
+// memory services so both of them behave the same
+type SearchServiceSuite struct {
+	suite.Suite
+	*model.Service
+	newService func(t *testing.T) *model.Service
+	user       *model.User
+	other      *model.User
+}
+
+func (s *SearchServiceSuite) SetupTest() {
+	s.Service = s.newService(s.T())
+
+	s.user = &model.User{FirstName: "Abanoub", LastName: "Fathy", Email: "aop4ever@gmail.com", Password: "12212154554554asdsa"}
+	s.Require().NoError(s.UserService.CreateUser(s.user))
+	s.other = &model.User{FirstName: "Other", LastName: "User", Email: "other@gmail.com", Password: "12212154554554asdsa"}
+	s.Require().NoError(s.UserService.CreateUser(s.other))
+}
+
+func (s *SearchServiceSuite) TearDownTest() {
+	s.Service.Close()
+}
+
+// createGallery creates a public gallery so everyone can find it
+func (s *SearchServiceSuite) createGallery(user *model.User, title, description string) *model.Gallery {
+	gallery := &model.Gallery{Title: title, Description: description, UserID: user.ID}
+	gallery.SetPublic(true)
+	s.Require().NoError(s.GalleryService.CreateGallery(gallery))
+	return gallery
+}
+
+func (s *SearchServiceSuite) createImage(gallery *model.Gallery, name string, content []byte) *model.Image {
+	image, err := s.ImageService.CreateImage(io.NopCloser(bytes.NewReader(content)), gallery.ID, name)
+	s.Require().NoError(err)
+	return image
+}
+
+func (s *SearchServiceSuite) searchGalleries(query model.SearchQuery) []string {
+	galleries, err := s.SearchGalleries(&query)
+	s.Require().NoError(err)
+	titles := []string{}
+	for _, gallery := range galleries {
+		titles = append(titles, gallery.Title)
+	}
+	return titles
+}
+
+func (s *SearchServiceSuite) searchImages(query model.SearchQuery) []string {
+	images, err := s.SearchImages(&query)
+	s.Require().NoError(err)
+	names := []string{}
+	for _, image := range images {
+		names = append(names, image.FileName)
+	}
+	return names
+}
+
+func (s *SearchServiceSuite) TestSearchGalleries() {
+	s.createGallery(s.user, "Summer in Alexandria", "a week at the beach")
+	party := s.createGallery(s.user, "Party", "")
+	s.Require().NoError(s.SetGalleryTags(party.ID, []string{"birthday-beach"}))
+	s.createGallery(s.other, "Winter", "no beach at all")
+
+	s.Assert().ElementsMatch([]string{"Summer in Alexandria", "Party", "Winter"}, s.searchGalleries(model.SearchQuery{Text: "Beach"}))
+	s.Assert().Equal([]string{"Summer in Alexandria"}, s.searchGalleries(model.SearchQuery{Text: "beach alexandria"}))
+	s.Assert().Equal([]string{"Party"}, s.searchGalleries(model.SearchQuery{Text: "birthday"}))
+	s.Assert().Equal([]string{"Summer in Alexandria"}, s.searchGalleries(model.SearchQuery{Text: "alex"}))
+	s.Assert().Empty(s.searchGalleries(model.SearchQuery{Text: "mountains"}))
+
+	// the filters
+	s.Assert().Equal([]string{"Winter"}, s.searchGalleries(model.SearchQuery{Text: "beach", OwnerID: s.other.ID}))
+	s.Assert().Empty(s.searchGalleries(model.SearchQuery{Text: "beach", From: time.Now().Add(time.Hour)}))
+	s.Assert().Empty(s.searchGalleries(model.SearchQuery{Text: "beach", To: time.Now().Add(-time.Hour)}))
+	s.Assert().Len(s.searchGalleries(model.SearchQuery{Text: "beach", From: time.Now().Add(-time.Hour), To: time.Now().Add(time.Hour)}), 3)
+	s.Assert().Len(s.searchGalleries(model.SearchQuery{Text: "beach", Limit: 2}), 2)
+
+	// the deleted galleries are not found
+	s.Require().NoError(s.GalleryService.Delete(party))
+	s.Assert().Empty(s.searchGalleries(model.SearchQuery{Text: "birthday"}))
+}
+
+func (s *SearchServiceSuite) TestSearchImages() {
+	gallery := s.createGallery(s.user, "Trip", "")
+	sunset := s.createImage(gallery, "IMG_1234.jpg", jpegWithCamera("Canon", "Canon EOS 5D"))
+	s.Assert().Equal("Canon EOS 5D", sunset.Camera)
+	s.Require().NoError(s.UpdateImages(gallery.ID, []model.Image{{Base: sunset.Base, Caption: "the **sunset** at the beach"}}))
+	sea := s.createImage(gallery, "sea.png", []byte("not a jpeg"))
+	s.Require().NoError(s.AddImageTags(gallery.ID, []uuid.UUID{sea.ID}, []string{"blue_sea"}))
+
+	s.Assert().Equal([]string{"IMG_1234.jpg"}, s.searchImages(model.SearchQuery{Text: "sunset"}))
+	s.Assert().Equal([]string{"IMG_1234.jpg"}, s.searchImages(model.SearchQuery{Text: "eos"}))
+	s.Assert().Equal([]string{"IMG_1234.jpg"}, s.searchImages(model.SearchQuery{Text: "img 1234"}))
+	s.Assert().Equal([]string{"sea.png"}, s.searchImages(model.SearchQuery{Text: "sea"}))
+	s.Assert().Empty(s.searchImages(model.SearchQuery{Text: "sunset", OwnerID: s.other.ID}))
+
+	// the images of the deleted galleries are not found
+	s.Require().NoError(s.GalleryService.Delete(gallery))
+	s.Assert().Empty(s.searchImages(model.SearchQuery{Text: "sunset"}))
+}
+
+func (s *SearchServiceSuite) TestSearchUnlisted() {
+	gallery := &model.Gallery{Title: "Secret beach", UserID: s.user.ID}
+	s.Require().NoError(s.GalleryService.CreateGallery(gallery))
+	s.createImage(gallery, "beach.jpg", []byte("not a jpeg"))
+
+	// the unlisted galleries are found only by their owner
+	s.Assert().Empty(s.searchGalleries(model.SearchQuery{Text: "beach"}))
+	s.Assert().Empty(s.searchGalleries(model.SearchQuery{Text: "beach", ViewerID: s.other.ID}))
+	s.Assert().Empty(s.searchGalleries(model.SearchQuery{Text: "beach", OwnerID: s.user.ID}))
+	s.Assert().Empty(s.searchImages(model.SearchQuery{Text: "beach"}))
+	s.Assert().Empty(s.searchImages(model.SearchQuery{Text: "beach", ViewerID: s.other.ID}))
+	s.Assert().Equal([]string{"Secret beach"}, s.searchGalleries(model.SearchQuery{Text: "beach", ViewerID: s.user.ID}))
+	s.Assert().Equal([]string{"beach.jpg"}, s.searchImages(model.SearchQuery{Text: "beach", ViewerID: s.user.ID}))
+
+	gallery.SetPublic(true)
+	s.Require().NoError(s.GalleryService.Update(gallery))
+	s.Assert().Equal([]string{"Secret beach"}, s.searchGalleries(model.SearchQuery{Text: "beach"}))
+	s.Assert().Equal([]string{"beach.jpg"}, s.searchImages(model.SearchQuery{Text: "beach"}))
+}
+
+func (s *SearchServiceSuite) TestSearchValidation() {
+	_, err := s.SearchGalleries(&model.SearchQuery{Text: " ?! "})
+	s.Assert().Equal(model.ErrSearchTextRequired, err)
+
+	_, err = s.SearchImages(&model.SearchQuery{Text: "sea", From: time.Now(), To: time.Now().Add(-time.Hour)})
+	s.Assert().Equal(model.ErrSearchDateRange, err)
+
+	// the wildcards split the words like the other symbols
+	s.createGallery(s.user, "100% fun", "")
+	s.Assert().Equal([]string{"100% fun"}, s.searchGalleries(model.SearchQuery{Text: "100%_fun"}))
+}
+
+func TestSearchServiceSuite(t *testing.T) {
+	suite.Run(t, &SearchServiceSuite{newService: func(t *testing.T) *model.Service {
+		service := newTestService(t)
+		if err := service.ResetDB(); err != nil {
+			t.Fatal("Unable to reset the db", err)
+		}
+		return service
+	}})
+}
+
+func TestMemorySearchServiceSuite(t *testing.T) {
+	suite.Run(t, &SearchServiceSuite{newService: func(t *testing.T) *model.Service {
+		return model.NewMemoryService("test-hash-secret-key")
+	}})
+}
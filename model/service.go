@@ -1,7 +1,13 @@
 package model
 
 import (
+	"context"
+	"strings"
+
+	"github.com/abanoub-fathy/bebo-gallery/config"
+	"github.com/abanoub-fathy/bebo-gallery/pkg/ratelimit"
 	"gorm.io/driver/postgres"
+	"gorm.io/driver/sqlite"
 	"gorm.io/gorm"
 )
 
@@ -12,14 +18,45 @@ type Service struct {
 	GalleryService
 	UserService
 	ImageService
+	TagService
+	SearchService
+	AccessTokenService
+	ShareLinkService
+	IdentityService
+	OAuthService
 }
 
 // NewService is used to create service struct
 // that will used to wrap all the services
 // we used in our application inside it
-func NewService(DB_URI string) (*Service, error) {
+//
+// the services are configured from cfg instead
+// of reading any package level configurations
+//
+// the database uri can be a postgres uri or a sqlite
+// one starting with sqlite:// or file:
+func NewService(cfg *config.Config) (*Service, error) {
 	// open db connection to be used in all services
-	db, err := gorm.Open(postgres.Open(DB_URI), &gorm.Config{})
+	db, err := gorm.Open(dialector(cfg.Database.URI), &gorm.Config{})
+	if err != nil {
+		return nil, err
+	}
+
+	// set the connection pool limits
+	sqlDB, err := db.DB()
+	if err != nil {
+		return nil, err
+	}
+	sqlDB.SetMaxOpenConns(cfg.Database.MaxOpenConns)
+	sqlDB.SetMaxIdleConns(cfg.Database.MaxIdleConns)
+
+	// sqlite allows only one writer at a time and every
+	// connection to an in memory db opens a new db
+	if db.Dialector.Name() == "sqlite" {
+		sqlDB.SetMaxOpenConns(1)
+	}
+
+	passwordPolicy, err := NewPasswordPolicy(cfg.Passwords)
 	if err != nil {
 		return nil, err
 	}
@@ -27,15 +64,60 @@ func NewService(DB_URI string) (*Service, error) {
 	service := &Service{
 		db:             db,
 		GalleryService: NewGalleryService(db),
-		UserService:    NewUserService(db),
-		ImageService:   NewImageService(),
+		UserService:    NewUserService(db, cfg.Security.HashSecretKey, passwordPolicy),
+		ImageService:   NewImageService(db, cfg.Storage.ImagesDir),
+		TagService:     NewTagService(db),
+		SearchService:  NewSearchService(db),
+
+		AccessTokenService: NewAccessTokenService(db, cfg.Security.HashSecretKey),
+		ShareLinkService:   NewShareLinkService(db, cfg.Security.HashSecretKey),
+		IdentityService:    NewIdentityService(db),
+		OAuthService:       NewOAuthService(db, cfg.Security.HashSecretKey),
 	}
 
 	return service, nil
 }
 
+// RateLimitStore returns a rate limit store that keeps the
+// limits in the database so they are shared by the replicas
+func (s *Service) RateLimitStore() (ratelimit.Store, error) {
+	if s.db == nil {
+		return nil, ErrNoDatabase
+	}
+
+	sqlDB, err := s.db.DB()
+	if err != nil {
+		return nil, err
+	}
+	if s.db.Dialector.Name() == "sqlite" {
+		return ratelimit.NewSQLiteStore(sqlDB), nil
+	}
+	return ratelimit.NewPostgresStore(sqlDB), nil
+}
+
+// dialector returns the gorm dialector of the database uri
+func dialector(uri string) gorm.Dialector {
+	switch {
+	case strings.HasPrefix(uri, "sqlite://"):
+		dsn := strings.TrimPrefix(uri, "sqlite://")
+		if !strings.Contains(dsn, "?") {
+			dsn += "?_foreign_keys=1"
+		}
+		return sqlite.Open(dsn)
+	case strings.HasPrefix(uri, "file:"):
+		return sqlite.Open(uri)
+	default:
+		return postgres.Open(uri)
+	}
+}
+
 // Close should be used to close the db connection
 func (s *Service) Close() error {
+	// the in memory services have no db
+	if s.db == nil {
+		return nil
+	}
+
 	sqlDB, err := s.db.DB()
 	if err != nil {
 		return err
@@ -51,14 +133,35 @@ func (s *Service) Close() error {
 // new fresh tables with no data inside them
 // then call this method
 func (s *Service) ResetDB() error {
-	if err := s.db.Migrator().DropTable(&User{}, &Gallery{}, &pwReset{}); err != nil {
+	if s.db == nil {
+		return ErrNoDatabase
+	}
+
+	migrator, err := s.Migrator()
+	if err != nil {
+		return err
+	}
+	if _, err := migrator.Down(context.Background(), 0); err != nil {
 		return err
 	}
-	return s.AutoMigrate()
+	_, err = migrator.Up(context.Background())
+	return err
 }
 
-// AutoMigrate should be used to auto migrate
-// all models to the database
-func (s *Service) AutoMigrate() error {
-	return s.db.AutoMigrate(&User{}, &Gallery{}, &pwReset{})
+// Migrate applies all the migrations that are not applied
+// yet to the database and adds the missing image records
+func (s *Service) Migrate() error {
+	if s.db == nil {
+		return nil
+	}
+
+	migrator, err := s.Migrator()
+	if err != nil {
+		return err
+	}
+	if _, err := migrator.Up(context.Background()); err != nil {
+		return err
+	}
+	_, err = s.RecordMissingImages(false)
+	return err
 }
@@ -0,0 +1,107 @@
+package model_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/abanoub-fathy/bebo-gallery/config"
+	"github.com/abanoub-fathy/bebo-gallery/model"
+	"github.com/abanoub-fathy/bebo-gallery/pkg/ratelimit"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestService creates a service for the tests
+//
+// the tests run on a sqlite db unless
+// TEST_DATABASE_URI is set to another db
+func newTestService(t *testing.T) *model.Service {
+	return newTestServiceWithConfig(t, newTestConfig(t))
+}
+
+// newTestConfig creates the configurations of the test services
+func newTestConfig(t *testing.T) *config.Config {
+	DB_URI, found := os.LookupEnv("TEST_DATABASE_URI")
+	if !found {
+		DB_URI = "sqlite://" + filepath.Join(t.TempDir(), "test.db")
+	}
+
+	cfg := config.Default()
+	cfg.Database.URI = DB_URI
+	cfg.Security.HashSecretKey = "test-hash-secret-key"
+	cfg.Storage.ImagesDir = t.TempDir()
+	return cfg
+}
+
+func newTestServiceWithConfig(t *testing.T, cfg *config.Config) *model.Service {
+	// create new service
+	service, err := model.NewService(cfg)
+	if err != nil {
+		t.Fatal("Unable to create service", err)
+	}
+	return service
+}
+
+func TestRateLimitStore(t *testing.T) {
+	service := newTestService(t)
+	defer service.Close()
+	require.NoError(t, service.ResetDB())
+
+	store, err := service.RateLimitStore()
+	require.NoError(t, err)
+
+	policy := ratelimit.Policy{Algorithm: ratelimit.SlidingWindow, Limit: 2, Window: time.Hour}
+	for i := 0; i < 2; i++ {
+		result, err := store.Take(context.Background(), "uploads:user:1", policy)
+		require.NoError(t, err)
+		assert.True(t, result.Allowed, "hit %v should be allowed", i+1)
+		assert.Equal(t, 1-i, result.Remaining)
+	}
+
+	result, err := store.Take(context.Background(), "uploads:user:1", policy)
+	require.NoError(t, err)
+	assert.False(t, result.Allowed)
+	assert.Positive(t, result.RetryAfter)
+
+	// the other keys have their own state
+	result, err = store.Take(context.Background(), "uploads:user:2", policy)
+	require.NoError(t, err)
+	assert.True(t, result.Allowed)
+
+	// the in memory services have no database
+	_, err = model.NewMemoryService("test-hash-secret-key").RateLimitStore()
+	assert.Equal(t, model.ErrNoDatabase, err)
+}
+
+func TestRotateRememberTokens(t *testing.T) {
+	service := newTestService(t)
+	defer service.Close()
+	require.NoError(t, service.ResetDB())
+
+	users := []*model.User{}
+	for _, email := range []string{"aop4ever@gmail.com", "bebo@gmail.com"} {
+		user := &model.User{FirstName: "Abanoub", LastName: "Fathy", Email: email, Password: "correct-horse-battery"}
+		require.NoError(t, service.UserService.CreateUser(user))
+		users = append(users, user)
+	}
+
+	count, err := service.RotateRememberTokens(true)
+	require.NoError(t, err)
+	assert.Equal(t, 2, count)
+	_, err = service.UserService.FindUserByRememberToken(users[0].RememberToken)
+	assert.NoError(t, err)
+
+	count, err = service.RotateRememberTokens(false)
+	require.NoError(t, err)
+	assert.Equal(t, 2, count)
+	for _, user := range users {
+		_, err = service.UserService.FindUserByRememberToken(user.RememberToken)
+		assert.Equal(t, model.ErrNotFound, err)
+	}
+
+	_, err = model.NewMemoryService("test-hash-secret-key").RotateRememberTokens(false)
+	assert.Equal(t, model.ErrNoDatabase, err)
+}
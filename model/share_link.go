@@ -0,0 +1,148 @@
+package model
+
+import (
+	"github.com/abanoub-fathy/bebo-gallery/pkg/hash"
+	"github.com/abanoub-fathy/bebo-gallery/pkg/rand"
+	uuid "github.com/satori/go.uuid"
+	"gorm.io/gorm"
+)
+
+const (
+	ErrGalleryIDRequired publicError = "model: gallery id is required"
+)
+
+// ShareLink is a secret link to a gallery that the owner
+// gives to the people who should get the images. it allows
+// downloading the images of the gallery if AllowDownload
+// is set even if the gallery is not public
+type ShareLink struct {
+	Base
+	GalleryID     uuid.UUID `gorm:"type:uuid;not null;index"`
+	AllowDownload bool      `gorm:"not null;default:false"`
+	Token         string    `gorm:"-"`
+	TokenHash     string    `gorm:"not null;unique"`
+}
+
+// ShareLinkService is used to manage the share links of the galleries
+type ShareLinkService interface {
+	ShareLinkDB
+}
+
+// ShareLinkDB has all methods needed to implement and
+// use the share links database methods
+type ShareLinkDB interface {
+	// Create stores a new link. the validation layer generates
+	// the token and sets it to the Token field which is not
+	// stored so it can be shown only once
+	Create(link *ShareLink) error
+
+	// FindByToken returns the link of the gallery with the
+	// token. the validation layer hashes the token
+	FindByToken(galleryID uuid.UUID, token string) (*ShareLink, error)
+
+	// FindByGalleryID returns the links of the gallery the newest first
+	FindByGalleryID(galleryID uuid.UUID) ([]*ShareLink, error)
+
+	// Delete deletes the link of the gallery
+	Delete(galleryID uuid.UUID, id uuid.UUID) error
+}
+
+type shareLinkService struct {
+	ShareLinkDB
+}
+
+// NewShareLinkService creates a new ShareLinkService
+//
+// hashSecretKey is the secret key used to hash the tokens
+func NewShareLinkService(db *gorm.DB, hashSecretKey string) ShareLinkService {
+	return NewShareLinkServiceWithDB(newShareLinkGorm(db), hashSecretKey)
+}
+
+// NewShareLinkServiceWithDB creates a new ShareLinkService
+// on top of the given db layer like the in memory one
+func NewShareLinkServiceWithDB(linkDB ShareLinkDB, hashSecretKey string) ShareLinkService {
+	return &shareLinkService{
+		ShareLinkDB: &shareLinkValidator{
+			ShareLinkDB: linkDB,
+			hasher:      hash.NewHasher(hashSecretKey),
+		},
+	}
+}
+
+type shareLinkValidator struct {
+	ShareLinkDB
+	hasher *hash.Hasher
+}
+
+func (sv *shareLinkValidator) Create(link *ShareLink) error {
+	if link.GalleryID.String() == ZeroID {
+		return ErrGalleryIDRequired
+	}
+
+	token, err := rand.GenerateRememberToken()
+	if err != nil {
+		return err
+	}
+	link.Token = token
+	link.TokenHash = sv.hasher.HashByHMAC(token)
+
+	return sv.ShareLinkDB.Create(link)
+}
+
+func (sv *shareLinkValidator) FindByToken(galleryID uuid.UUID, token string) (*ShareLink, error) {
+	if token == "" {
+		return nil, ErrInvalidToken
+	}
+	return sv.ShareLinkDB.FindByToken(galleryID, sv.hasher.HashByHMAC(token))
+}
+
+func (sv *shareLinkValidator) Delete(galleryID uuid.UUID, id uuid.UUID) error {
+	if galleryID.String() == ZeroID {
+		return ErrGalleryIDRequired
+	}
+	if id.String() == ZeroID {
+		return ErrInvalidID
+	}
+	return sv.ShareLinkDB.Delete(galleryID, id)
+}
+
+type shareLinkGorm struct {
+	db *gorm.DB
+}
+
+func newShareLinkGorm(db *gorm.DB) *shareLinkGorm {
+	return &shareLinkGorm{db: db}
+}
+
+// make sure that shareLinkGorm implements ShareLinkDB
+var _ ShareLinkDB = (*shareLinkGorm)(nil)
+
+func (sg *shareLinkGorm) Create(link *ShareLink) error {
+	return sg.db.Create(link).Error
+}
+
+func (sg *shareLinkGorm) FindByToken(galleryID uuid.UUID, tokenHash string) (*ShareLink, error) {
+	link := new(ShareLink)
+	query := sg.db.Where("gallery_id = ? AND token_hash = ?", galleryID, tokenHash)
+	if err := getRecord(query, link); err != nil {
+		return nil, err
+	}
+	return link, nil
+}
+
+func (sg *shareLinkGorm) FindByGalleryID(galleryID uuid.UUID) ([]*ShareLink, error) {
+	links := []*ShareLink{}
+	err := sg.db.Where("gallery_id = ?", galleryID).Order("created_at desc").Find(&links).Error
+	return links, err
+}
+
+func (sg *shareLinkGorm) Delete(galleryID uuid.UUID, id uuid.UUID) error {
+	result := sg.db.Unscoped().Where("gallery_id = ? AND id = ?", galleryID, id).Delete(&ShareLink{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
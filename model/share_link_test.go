@@ -0,0 +1,77 @@
+package model_test
+
+import (
+	"testing"
+
+	"github.com/abanoub-fathy/bebo-gallery/model"
+	uuid "github.com/satori/go.uuid"
+	"github.com/stretchr/testify/suite"
+)
+
+// ShareLinkServiceSuite runs on the database and on the
+// memory services so both of them behave the same
+type ShareLinkServiceSuite struct {
+	suite.Suite
+	*model.Service
+	newService func(t *testing.T) *model.Service
+	gallery    *model.Gallery
+}
+
+func (s *ShareLinkServiceSuite) SetupTest() {
+	s.Service = s.newService(s.T())
+
+	user := &model.User{FirstName: "Abanoub", LastName: "Fathy", Email: "aop4ever@gmail.com", Password: "12212154554554asdsa"}
+	s.Require().NoError(s.UserService.CreateUser(user))
+	s.gallery = &model.Gallery{Title: "Wedding", UserID: user.ID}
+	s.Require().NoError(s.GalleryService.CreateGallery(s.gallery))
+}
+
+func (s *ShareLinkServiceSuite) TearDownTest() {
+	s.Service.Close()
+}
+
+func (s *ShareLinkServiceSuite) TestShareLinks() {
+	s.Assert().Equal(model.ErrGalleryIDRequired, s.ShareLinkService.Create(&model.ShareLink{}))
+
+	link := &model.ShareLink{GalleryID: s.gallery.ID, AllowDownload: true}
+	s.Require().NoError(s.ShareLinkService.Create(link))
+	s.Require().NotEmpty(link.Token)
+
+	found, err := s.ShareLinkService.FindByToken(s.gallery.ID, link.Token)
+	s.Require().NoError(err)
+	s.Assert().Equal(link.ID, found.ID)
+	s.Assert().True(found.AllowDownload)
+
+	// the token works only for its gallery
+	_, err = s.ShareLinkService.FindByToken(uuid.NewV4(), link.Token)
+	s.Assert().Equal(model.ErrNotFound, err)
+	_, err = s.ShareLinkService.FindByToken(s.gallery.ID, "")
+	s.Assert().Equal(model.ErrInvalidToken, err)
+
+	// only the hash of the token is stored
+	links, err := s.ShareLinkService.FindByGalleryID(s.gallery.ID)
+	s.Require().NoError(err)
+	s.Require().Len(links, 1)
+	s.Assert().Empty(links[0].Token)
+
+	s.Assert().Equal(model.ErrNotFound, s.ShareLinkService.Delete(uuid.NewV4(), link.ID))
+	s.Require().NoError(s.ShareLinkService.Delete(s.gallery.ID, link.ID))
+	_, err = s.ShareLinkService.FindByToken(s.gallery.ID, link.Token)
+	s.Assert().Equal(model.ErrNotFound, err)
+}
+
+func TestShareLinkServiceSuite(t *testing.T) {
+	suite.Run(t, &ShareLinkServiceSuite{newService: func(t *testing.T) *model.Service {
+		service := newTestService(t)
+		if err := service.ResetDB(); err != nil {
+			t.Fatal("Unable to reset the db", err)
+		}
+		return service
+	}})
+}
+
+func TestMemoryShareLinkServiceSuite(t *testing.T) {
+	suite.Run(t, &ShareLinkServiceSuite{newService: func(t *testing.T) *model.Service {
+		return model.NewMemoryService("test-hash-secret-key")
+	}})
+}
@@ -0,0 +1,465 @@
+package model
+
+import (
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	uuid "github.com/satori/go.uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	// ErrTagInvalid is returned when a tag has chars other
+	// than the letters, digits, dashes and underscores
+	ErrTagInvalid publicError = "tags can have only letters, digits, dashes and underscores"
+
+	// ErrTagTooLong is returned when a tag is
+	// longer than MaxTagLength
+	ErrTagTooLong publicError = "tag is too long"
+
+	// ErrTooManyTags is returned when more than
+	// MaxTags tags are set on a gallery
+	ErrTooManyTags publicError = "too many tags"
+)
+
+const (
+	// MaxTagLength is the max length of a tag in chars
+	MaxTagLength = 50
+
+	// MaxTags is the max number of tags of a gallery
+	MaxTags = 30
+)
+
+// Tag is a label of the galleries and the images. the tags
+// are shared by all the users and their names are normalized
+// by NormalizeTag so they are case insensitive
+type Tag struct {
+	ID        uuid.UUID `gorm:"type:uuid;primary_key;"`
+	CreatedAt time.Time
+	Name      string `gorm:"not null;unique"`
+}
+
+// galleryTag is a row of the gallery_tags join table
+type galleryTag struct {
+	GalleryID uuid.UUID `gorm:"type:uuid;primary_key;"`
+	TagID     uuid.UUID `gorm:"type:uuid;primary_key;"`
+}
+
+func (galleryTag) TableName() string {
+	return "gallery_tags"
+}
+
+// imageTag is a row of the image_tags join table
+type imageTag struct {
+	ImageID uuid.UUID `gorm:"type:uuid;primary_key;"`
+	TagID   uuid.UUID `gorm:"type:uuid;primary_key;"`
+}
+
+func (imageTag) TableName() string {
+	return "image_tags"
+}
+
+// NormalizeTag returns the normalized name of the tag. it is
+// lower case without the leading # and the spaces inside it
+// are replaced by dashes. it returns ErrTagInvalid if the
+// tag is empty or has other chars than the letters, digits,
+// dashes and underscores
+func NormalizeTag(name string) (string, error) {
+	name = strings.TrimPrefix(strings.TrimSpace(name), "#")
+	name = strings.ToLower(strings.Join(strings.Fields(name), "-"))
+	if name == "" {
+		return "", ErrTagInvalid
+	}
+	for _, r := range name {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '-' && r != '_' {
+			return "", ErrTagInvalid
+		}
+	}
+	if utf8.RuneCountInString(name) > MaxTagLength {
+		return "", ErrTagTooLong
+	}
+	return name, nil
+}
+
+// ParseTags splits the comma separated tags of the
+// forms. the empty tags are skipped
+func ParseTags(input string) []string {
+	names := []string{}
+	for _, name := range strings.Split(input, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// NormalizeTags normalizes the names and removes the duplicates
+func NormalizeTags(names []string) ([]string, error) {
+	normalized := []string{}
+	seen := map[string]bool{}
+	for _, name := range names {
+		name, err := NormalizeTag(name)
+		if err != nil {
+			return nil, err
+		}
+		if !seen[name] {
+			seen[name] = true
+			normalized = append(normalized, name)
+		}
+	}
+	return normalized, nil
+}
+
+type TagService interface {
+	TagDB
+
+	// LoadGalleryTags sets the Tags of the galleries
+	LoadGalleryTags(galleries ...*Gallery) error
+
+	// LoadImageTags sets the Tags of the images
+	LoadImageTags(images []Image) error
+}
+
+// TagDB has all methods needed to implement and
+// use the tags database methods
+//
+// the names of the tags are normalized by the validation layer
+type TagDB interface {
+	// SetGalleryTags replaces the tags of the gallery
+	SetGalleryTags(galleryID uuid.UUID, names []string) error
+
+	// FindGalleryTags returns the sorted tags of the galleries by id
+	FindGalleryTags(galleryIDs []uuid.UUID) (map[uuid.UUID][]string, error)
+
+	// AddImageTags adds the tags to all the images. it returns
+	// ErrNotFound if one of the images is not in the gallery
+	AddImageTags(galleryID uuid.UUID, imageIDs []uuid.UUID, names []string) error
+
+	// RemoveImageTags removes the tags from all the images. it returns
+	// ErrNotFound if one of the images is not in the gallery
+	RemoveImageTags(galleryID uuid.UUID, imageIDs []uuid.UUID, names []string) error
+
+	// FindImageTags returns the sorted tags of the images by id
+	FindImageTags(imageIDs []uuid.UUID) (map[uuid.UUID][]string, error)
+
+	// SuggestTags returns the tags starting with the prefix that
+	// the user has put on its galleries or images. they are
+	// used to autocomplete the tags
+	SuggestTags(userID uuid.UUID, prefix string, limit int) ([]string, error)
+
+	// FindGalleriesByTag returns the galleries with the tag that
+	// are listed for the user the newest first. the user id is
+	// nil for the visitors
+	FindGalleriesByTag(name string, userID uuid.UUID) ([]*Gallery, error)
+
+	// FindImagesByTag returns the images with the tag in the
+	// galleries listed for the user the newest first
+	FindImagesByTag(name string, userID uuid.UUID) ([]Image, error)
+}
+
+type tagService struct {
+	TagDB
+}
+
+// NewTagService is used to return TagService with
+// the validator layer on top of the gorm layer
+func NewTagService(db *gorm.DB) TagService {
+	return NewTagServiceWithDB(&tagGorm{db: db})
+}
+
+// NewTagServiceWithDB is used to return TagService
+// with the validator layer on top of the given db layer
+func NewTagServiceWithDB(tagDB TagDB) TagService {
+	return &tagService{
+		TagDB: &tagValidator{TagDB: tagDB},
+	}
+}
+
+func (ts *tagService) LoadGalleryTags(galleries ...*Gallery) error {
+	ids := []uuid.UUID{}
+	for _, gallery := range galleries {
+		ids = append(ids, gallery.ID)
+	}
+	tags, err := ts.FindGalleryTags(ids)
+	if err != nil {
+		return err
+	}
+	for _, gallery := range galleries {
+		gallery.Tags = tags[gallery.ID]
+	}
+	return nil
+}
+
+func (ts *tagService) LoadImageTags(images []Image) error {
+	ids := []uuid.UUID{}
+	for _, image := range images {
+		ids = append(ids, image.ID)
+	}
+	tags, err := ts.FindImageTags(ids)
+	if err != nil {
+		return err
+	}
+	for i := range images {
+		images[i].Tags = tags[images[i].ID]
+	}
+	return nil
+}
+
+type tagValidator struct {
+	TagDB
+}
+
+func (tv *tagValidator) SetGalleryTags(galleryID uuid.UUID, names []string) error {
+	names, err := NormalizeTags(names)
+	if err != nil {
+		return err
+	}
+	if len(names) > MaxTags {
+		return ErrTooManyTags
+	}
+	return tv.TagDB.SetGalleryTags(galleryID, names)
+}
+
+func (tv *tagValidator) AddImageTags(galleryID uuid.UUID, imageIDs []uuid.UUID, names []string) error {
+	names, err := NormalizeTags(names)
+	if err != nil {
+		return err
+	}
+	if len(names) == 0 || len(imageIDs) == 0 {
+		return nil
+	}
+	return tv.TagDB.AddImageTags(galleryID, imageIDs, names)
+}
+
+func (tv *tagValidator) RemoveImageTags(galleryID uuid.UUID, imageIDs []uuid.UUID, names []string) error {
+	names, err := NormalizeTags(names)
+	if err != nil {
+		return err
+	}
+	if len(names) == 0 || len(imageIDs) == 0 {
+		return nil
+	}
+	return tv.TagDB.RemoveImageTags(galleryID, imageIDs, names)
+}
+
+func (tv *tagValidator) SuggestTags(userID uuid.UUID, prefix string, limit int) ([]string, error) {
+	prefix = strings.ToLower(strings.Join(strings.Fields(strings.TrimPrefix(strings.TrimSpace(prefix), "#")), "-"))
+	if limit <= 0 {
+		limit = 10
+	}
+	return tv.TagDB.SuggestTags(userID, prefix, limit)
+}
+
+func (tv *tagValidator) FindGalleriesByTag(name string, userID uuid.UUID) ([]*Gallery, error) {
+	name, err := NormalizeTag(name)
+	if err != nil {
+		return nil, ErrNotFound
+	}
+	return tv.TagDB.FindGalleriesByTag(name, userID)
+}
+
+func (tv *tagValidator) FindImagesByTag(name string, userID uuid.UUID) ([]Image, error) {
+	name, err := NormalizeTag(name)
+	if err != nil {
+		return nil, ErrNotFound
+	}
+	return tv.TagDB.FindImagesByTag(name, userID)
+}
+
+type tagGorm struct {
+	db *gorm.DB
+}
+
+// make sure that tagGorm implements TagDB
+var _ TagDB = (*tagGorm)(nil)
+
+// findOrCreateTags returns the tags of the names
+// the tags that do not exist are created
+func (tg *tagGorm) findOrCreateTags(tx *gorm.DB, names []string) ([]Tag, error) {
+	for _, name := range names {
+		tag := Tag{ID: uuid.NewV4(), Name: name}
+		if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&tag).Error; err != nil {
+			return nil, err
+		}
+	}
+
+	tags := []Tag{}
+	err := tx.Where("name IN ?", names).Find(&tags).Error
+	return tags, err
+}
+
+func (tg *tagGorm) SetGalleryTags(galleryID uuid.UUID, names []string) error {
+	return tg.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("gallery_id = ?", galleryID).Delete(&galleryTag{}).Error; err != nil {
+			return err
+		}
+		if len(names) == 0 {
+			return nil
+		}
+
+		tags, err := tg.findOrCreateTags(tx, names)
+		if err != nil {
+			return err
+		}
+		rows := []galleryTag{}
+		for _, tag := range tags {
+			rows = append(rows, galleryTag{GalleryID: galleryID, TagID: tag.ID})
+		}
+		return tx.Create(&rows).Error
+	})
+}
+
+// tagRow is a row of the queries of the tags of many records
+type tagRow struct {
+	ID   uuid.UUID
+	Name string
+}
+
+func (tg *tagGorm) FindGalleryTags(galleryIDs []uuid.UUID) (map[uuid.UUID][]string, error) {
+	rows := []tagRow{}
+	err := tg.db.Table("gallery_tags").
+		Select("gallery_tags.gallery_id AS id, tags.name AS name").
+		Joins("JOIN tags ON tags.id = gallery_tags.tag_id").
+		Where("gallery_tags.gallery_id IN ?", galleryIDs).
+		Order("tags.name").
+		Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+	return groupTags(rows), nil
+}
+
+// checkImages returns ErrNotFound if one of
+// the images is not in the gallery
+func (tg *tagGorm) checkImages(tx *gorm.DB, galleryID uuid.UUID, imageIDs []uuid.UUID) error {
+	var count int64
+	err := tx.Model(&Image{}).Where("gallery_id = ? AND id IN ?", galleryID, imageIDs).Count(&count).Error
+	if err != nil {
+		return err
+	}
+	if count != int64(len(uniqueIDs(imageIDs))) {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (tg *tagGorm) AddImageTags(galleryID uuid.UUID, imageIDs []uuid.UUID, names []string) error {
+	return tg.db.Transaction(func(tx *gorm.DB) error {
+		if err := tg.checkImages(tx, galleryID, imageIDs); err != nil {
+			return err
+		}
+
+		tags, err := tg.findOrCreateTags(tx, names)
+		if err != nil {
+			return err
+		}
+		rows := []imageTag{}
+		for _, imageID := range uniqueIDs(imageIDs) {
+			for _, tag := range tags {
+				rows = append(rows, imageTag{ImageID: imageID, TagID: tag.ID})
+			}
+		}
+		return tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&rows).Error
+	})
+}
+
+func (tg *tagGorm) RemoveImageTags(galleryID uuid.UUID, imageIDs []uuid.UUID, names []string) error {
+	return tg.db.Transaction(func(tx *gorm.DB) error {
+		if err := tg.checkImages(tx, galleryID, imageIDs); err != nil {
+			return err
+		}
+
+		tagIDs := tx.Model(&Tag{}).Select("id").Where("name IN ?", names)
+		return tx.Where("image_id IN ? AND tag_id IN (?)", imageIDs, tagIDs).Delete(&imageTag{}).Error
+	})
+}
+
+func (tg *tagGorm) FindImageTags(imageIDs []uuid.UUID) (map[uuid.UUID][]string, error) {
+	rows := []tagRow{}
+	err := tg.db.Table("image_tags").
+		Select("image_tags.image_id AS id, tags.name AS name").
+		Joins("JOIN tags ON tags.id = image_tags.tag_id").
+		Where("image_tags.image_id IN ?", imageIDs).
+		Order("tags.name").
+		Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+	return groupTags(rows), nil
+}
+
+func (tg *tagGorm) SuggestTags(userID uuid.UUID, prefix string, limit int) ([]string, error) {
+	galleryTags := tg.db.Table("gallery_tags").
+		Select("gallery_tags.tag_id").
+		Joins("JOIN galleries ON galleries.id = gallery_tags.gallery_id").
+		Where("galleries.user_id = ? AND galleries.deleted_at IS NULL", userID)
+	imageTags := tg.db.Table("image_tags").
+		Select("image_tags.tag_id").
+		Joins("JOIN images ON images.id = image_tags.image_id").
+		Joins("JOIN galleries ON galleries.id = images.gallery_id").
+		Where("galleries.user_id = ? AND galleries.deleted_at IS NULL", userID)
+
+	names := []string{}
+	err := tg.db.Model(&Tag{}).
+		Where("name LIKE ? ESCAPE '\\'", escapeLike(prefix)+"%").
+		Where("id IN (?) OR id IN (?)", galleryTags, imageTags).
+		Order("name").
+		Limit(limit).
+		Pluck("name", &names).Error
+	return names, err
+}
+
+// the tag pages list the public galleries of all the
+// users and the unlisted galleries of the user
+func (tg *tagGorm) FindGalleriesByTag(name string, userID uuid.UUID) ([]*Gallery, error) {
+	galleries := []*Gallery{}
+	err := listedFor(tg.db, userID).
+		Joins("JOIN gallery_tags ON gallery_tags.gallery_id = galleries.id").
+		Joins("JOIN tags ON tags.id = gallery_tags.tag_id").
+		Where("tags.name = ?", name).
+		Order("galleries.created_at DESC").
+		Find(&galleries).Error
+	return galleries, err
+}
+
+func (tg *tagGorm) FindImagesByTag(name string, userID uuid.UUID) ([]Image, error) {
+	images := []Image{}
+	err := listedFor(tg.db, userID).
+		Joins("JOIN image_tags ON image_tags.image_id = images.id").
+		Joins("JOIN tags ON tags.id = image_tags.tag_id").
+		Joins("JOIN galleries ON galleries.id = images.gallery_id AND galleries.deleted_at IS NULL").
+		Where("tags.name = ?", name).
+		Order("images.created_at DESC").
+		Find(&images).Error
+	return images, err
+}
+
+// groupTags groups the names of the rows by id
+func groupTags(rows []tagRow) map[uuid.UUID][]string {
+	tags := map[uuid.UUID][]string{}
+	for _, row := range rows {
+		tags[row.ID] = append(tags[row.ID], row.Name)
+	}
+	return tags
+}
+
+// uniqueIDs returns the ids without the duplicates
+func uniqueIDs(ids []uuid.UUID) []uuid.UUID {
+	unique := []uuid.UUID{}
+	seen := map[uuid.UUID]bool{}
+	for _, id := range ids {
+		if !seen[id] {
+			seen[id] = true
+			unique = append(unique, id)
+		}
+	}
+	return unique
+}
+
+// escapeLike escapes the wildcards of the LIKE patterns
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
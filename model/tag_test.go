@@ -0,0 +1,205 @@
+package model_test
+
+import (
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/abanoub-fathy/bebo-gallery/model"
+	uuid "github.com/satori/go.uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+func TestNormalizeTag(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+		err  error
+	}{
+		{"Beach", "beach", nil},
+		{"  #Summer  Trip ", "summer-trip", nil},
+		{"new_york-2022", "new_york-2022", nil},
+		{"Café", "café", nil},
+		{"", "", model.ErrTagInvalid},
+		{"#", "", model.ErrTagInvalid},
+		{"a,b", "", model.ErrTagInvalid},
+		{"<script>", "", model.ErrTagInvalid},
+		{strings.Repeat("a", model.MaxTagLength+1), "", model.ErrTagTooLong},
+	}
+
+	for _, test := range tests {
+		name, err := model.NormalizeTag(test.name)
+		assert.Equal(t, test.err, err, test.name)
+		assert.Equal(t, test.want, name, test.name)
+	}
+
+	assert.Equal(t, []string{"beach", "summer trip"}, model.ParseTags(" beach,, summer trip ,"))
+}
+
+// TagServiceSuite runs on the database and on the
+// memory services so both of them behave the same
+type TagServiceSuite struct {
+	suite.Suite
+	*model.Service
+	newService func(t *testing.T) *model.Service
+	user       *model.User
+}
+
+func (s *TagServiceSuite) SetupTest() {
+	s.Service = s.newService(s.T())
+
+	s.user = &model.User{
+		FirstName: "Abanoub",
+		LastName:  "Fathy",
+		Email:     "aop4ever@gmail.com",
+		Password:  "12212154554554asdsa",
+	}
+	s.Require().NoError(s.UserService.CreateUser(s.user))
+}
+
+func (s *TagServiceSuite) TearDownTest() {
+	s.Service.Close()
+}
+
+// createGallery creates a public gallery so it is listed for everyone
+func (s *TagServiceSuite) createGallery(title string) *model.Gallery {
+	gallery := &model.Gallery{Title: title, UserID: s.user.ID}
+	gallery.SetPublic(true)
+	s.Require().NoError(s.GalleryService.CreateGallery(gallery))
+	return gallery
+}
+
+func (s *TagServiceSuite) createImage(gallery *model.Gallery, name string) uuid.UUID {
+	image, err := s.ImageService.CreateImage(io.NopCloser(strings.NewReader(name)), gallery.ID, name)
+	s.Require().NoError(err)
+	return image.ID
+}
+
+func (s *TagServiceSuite) TestGalleryTags() {
+	trip := s.createGallery("Trip")
+	party := s.createGallery("Party")
+
+	s.Require().NoError(s.SetGalleryTags(trip.ID, []string{"Summer", "#beach", "summer"}))
+	s.Require().NoError(s.SetGalleryTags(party.ID, []string{"summer"}))
+
+	tags, err := s.FindGalleryTags([]uuid.UUID{trip.ID, party.ID})
+	s.Require().NoError(err)
+	s.Assert().Equal([]string{"beach", "summer"}, tags[trip.ID])
+	s.Assert().Equal([]string{"summer"}, tags[party.ID])
+
+	galleries, err := s.FindGalleriesByTag("SUMMER", uuid.Nil)
+	s.Require().NoError(err)
+	s.Assert().Len(galleries, 2)
+
+	// the tags are replaced
+	s.Require().NoError(s.SetGalleryTags(trip.ID, []string{"sea"}))
+	galleries, err = s.FindGalleriesByTag("beach", uuid.Nil)
+	s.Require().NoError(err)
+	s.Assert().Empty(galleries)
+
+	s.Assert().Equal(model.ErrTagInvalid, s.SetGalleryTags(trip.ID, []string{"sea", "a/b"}))
+	tags, err = s.FindGalleryTags([]uuid.UUID{trip.ID})
+	s.Require().NoError(err)
+	s.Assert().Equal([]string{"sea"}, tags[trip.ID])
+
+	// the deleted galleries are not listed
+	s.Require().NoError(s.GalleryService.Delete(party))
+	galleries, err = s.FindGalleriesByTag("summer", uuid.Nil)
+	s.Require().NoError(err)
+	s.Assert().Empty(galleries)
+}
+
+func (s *TagServiceSuite) TestImageTags() {
+	gallery := s.createGallery("Trip")
+	first := s.createImage(gallery, "first.jpg")
+	second := s.createImage(gallery, "second.jpg")
+	other := s.createImage(s.createGallery("Other"), "other.jpg")
+
+	s.Require().NoError(s.AddImageTags(gallery.ID, []uuid.UUID{first, second}, []string{"Sunset", "sea"}))
+	s.Require().NoError(s.AddImageTags(gallery.ID, []uuid.UUID{first}, []string{"sunset"}))
+	s.Require().NoError(s.RemoveImageTags(gallery.ID, []uuid.UUID{second}, []string{"sunset"}))
+
+	tags, err := s.FindImageTags([]uuid.UUID{first, second})
+	s.Require().NoError(err)
+	s.Assert().Equal([]string{"sea", "sunset"}, tags[first])
+	s.Assert().Equal([]string{"sea"}, tags[second])
+
+	images, err := s.FindImagesByTag("sea", uuid.Nil)
+	s.Require().NoError(err)
+	s.Assert().Len(images, 2)
+
+	// the images should be in the gallery
+	err = s.AddImageTags(gallery.ID, []uuid.UUID{first, other}, []string{"sea"})
+	s.Assert().Equal(model.ErrNotFound, err)
+	tags, err = s.FindImageTags([]uuid.UUID{other})
+	s.Require().NoError(err)
+	s.Assert().Empty(tags[other])
+}
+
+func (s *TagServiceSuite) TestUnlistedTags() {
+	gallery := &model.Gallery{Title: "Secret", UserID: s.user.ID}
+	s.Require().NoError(s.GalleryService.CreateGallery(gallery))
+	image := s.createImage(gallery, "first.jpg")
+	s.Require().NoError(s.SetGalleryTags(gallery.ID, []string{"secret"}))
+	s.Require().NoError(s.AddImageTags(gallery.ID, []uuid.UUID{image}, []string{"secret"}))
+
+	// the unlisted galleries and their images are listed only for their owner
+	for _, userID := range []uuid.UUID{uuid.Nil, uuid.NewV4()} {
+		galleries, err := s.FindGalleriesByTag("secret", userID)
+		s.Require().NoError(err)
+		s.Assert().Empty(galleries)
+		images, err := s.FindImagesByTag("secret", userID)
+		s.Require().NoError(err)
+		s.Assert().Empty(images)
+	}
+
+	galleries, err := s.FindGalleriesByTag("secret", s.user.ID)
+	s.Require().NoError(err)
+	s.Assert().Len(galleries, 1)
+	images, err := s.FindImagesByTag("secret", s.user.ID)
+	s.Require().NoError(err)
+	s.Assert().Len(images, 1)
+}
+
+func (s *TagServiceSuite) TestSuggestTags() {
+	gallery := s.createGallery("Trip")
+	image := s.createImage(gallery, "first.jpg")
+	s.Require().NoError(s.SetGalleryTags(gallery.ID, []string{"beach", "berlin", "sea"}))
+	s.Require().NoError(s.AddImageTags(gallery.ID, []uuid.UUID{image}, []string{"bee", "be_happy"}))
+
+	// the tags of the other users are not suggested
+	other := &model.User{FirstName: "Other", LastName: "User", Email: "other@gmail.com", Password: "12212154554554asdsa"}
+	s.Require().NoError(s.UserService.CreateUser(other))
+	otherGallery := &model.Gallery{Title: "Other", UserID: other.ID}
+	s.Require().NoError(s.GalleryService.CreateGallery(otherGallery))
+	s.Require().NoError(s.SetGalleryTags(otherGallery.ID, []string{"bear"}))
+
+	tags, err := s.SuggestTags(s.user.ID, "BE", 10)
+	s.Require().NoError(err)
+	s.Assert().Equal([]string{"be_happy", "beach", "bee", "berlin"}, tags)
+
+	tags, err = s.SuggestTags(s.user.ID, "be_", 10)
+	s.Require().NoError(err)
+	s.Assert().Equal([]string{"be_happy"}, tags)
+
+	tags, err = s.SuggestTags(s.user.ID, "b", 2)
+	s.Require().NoError(err)
+	s.Assert().Len(tags, 2)
+}
+
+func TestTagServiceSuite(t *testing.T) {
+	suite.Run(t, &TagServiceSuite{newService: func(t *testing.T) *model.Service {
+		service := newTestService(t)
+		if err := service.ResetDB(); err != nil {
+			t.Fatal("Unable to reset the db", err)
+		}
+		return service
+	}})
+}
+
+func TestMemoryTagServiceSuite(t *testing.T) {
+	suite.Run(t, &TagServiceSuite{newService: func(t *testing.T) *model.Service {
+		return model.NewMemoryService("test-hash-secret-key")
+	}})
+}
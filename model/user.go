@@ -6,11 +6,9 @@ import (
 	"strings"
 	"time"
 
-	"github.com/abanoub-fathy/bebo-gallery/config"
 	"github.com/abanoub-fathy/bebo-gallery/pkg/hash"
 	"github.com/abanoub-fathy/bebo-gallery/pkg/rand"
 	uuid "github.com/satori/go.uuid"
-	"golang.org/x/crypto/bcrypt"
 	"gorm.io/gorm"
 )
 
@@ -21,10 +19,12 @@ type User struct {
 	FirstName        string `gorm:"not null"`
 	LastName         string `gorm:"not null"`
 	Email            string `gorm:"not null;unique;index"`
+	Handle           string `gorm:"not null;unique"`
 	Password         string `gorm:"-"`
 	PasswordHash     string `gorm:"not null"`
 	RememberToken    string `gorm:"-"`
 	RemeberTokenHash string `gorm:"unique;index"`
+	Disabled         bool   `gorm:"not null;default:false"`
 	Galleries        []Gallery
 }
 
@@ -44,6 +44,7 @@ type UserDB interface {
 	// Methods for querying for single users
 	FindByID(ID string) (*User, error)
 	FindByEmail(email string) (*User, error)
+	FindByHandle(handle string) (*User, error)
 	FindUserByRememberToken(token string) (*User, error)
 
 	// Methods for altering users
@@ -57,8 +58,7 @@ type UserDB interface {
 // userGorm represents our database interaction layer
 // and implements the UserDB interface fully.
 type userGorm struct {
-	db     *gorm.DB
-	hasher *hash.Hasher
+	db *gorm.DB
 }
 
 // newUserGorm creates a new userGorm
@@ -66,8 +66,7 @@ type userGorm struct {
 func newUserGorm(db *gorm.DB) *userGorm {
 	// return userGorm object
 	return &userGorm{
-		db:     db,
-		hasher: hash.NewHasher(config.AppConfig.HashSecretKey),
+		db: db,
 	}
 }
 
@@ -82,13 +81,33 @@ type UserService interface {
 	// if it is correct you will get the user and nil error
 	// otherwise you will get an error
 	//
-	// error can be ErrEmailNotValidFormat, ErrNotFound, ErrPasswordNotCorrect
-	// or other generic error during authenticate user
+	// error can be ErrEmailNotValidFormat, ErrNotFound, ErrPasswordNotCorrect,
+	// ErrUserDisabled or other generic error during authenticate user
 	AuthenticateUser(email, password string) (*User, error)
 
+	// DisableUser disables the user and changes the remember
+	// token in the same update so the current sessions of
+	// the user are logged out
+	DisableUser(userID string) (*User, error)
+
 	// Methods to Reset password
 	IntiateResetPassword(email string) (string, error)
 	CompleteResetPassword(token string, newPassword string) (*User, error)
+
+	// CleanExpiredResetTokens deletes the expired reset password
+	// tokens and returns their count. if dryRun is true they
+	// are only counted
+	CleanExpiredResetTokens(dryRun bool) (int64, error)
+
+	// Methods to log in by the login link sent by email.
+	// IntiateLoginLink returns the user of the email and
+	// the token of the link
+	IntiateLoginLink(email string) (*User, string, error)
+	CompleteLoginLink(token string) (*User, error)
+
+	// CleanExpiredLoginTokens works like CleanExpiredResetTokens
+	// on the tokens of the login links
+	CleanExpiredLoginTokens(dryRun bool) (int64, error)
 }
 
 // userService struct is an implementation for UserService
@@ -96,32 +115,40 @@ type UserService interface {
 type userService struct {
 	UserDB
 	PassworResetDB pwResetDB
+	LoginTokenDB   loginTokenDB
+	policy         *PasswordPolicy
 }
 
 var _ UserService = &userService{}
 
 // NewUserService creates a new userService to
 // interact with users
-func NewUserService(db *gorm.DB) UserService {
-	// create new userGorm
-	userGorm := newUserGorm(db)
-
-	// create new pwResetGorm
-	pwResetGorm := newPwResetGorm(db)
+//
+// hashSecretKey is the secret key used to hash the tokens
+// and policy is checked on every new password
+func NewUserService(db *gorm.DB, hashSecretKey string, policy *PasswordPolicy) UserService {
+	return NewUserServiceWithDB(newUserGorm(db), newPwResetGorm(db), newLoginTokenGorm(db), hashSecretKey, policy)
+}
 
+// NewUserServiceWithDB creates a new userService on top of
+// the given db layers like the in memory ones
+// the validation layers are added on top of them
+func NewUserServiceWithDB(userDB UserDB, resetDB pwResetDB, loginDB loginTokenDB, hashSecretKey string, policy *PasswordPolicy) UserService {
 	// create new hasher
-	hasher := hash.NewHasher(config.AppConfig.HashSecretKey)
+	hasher := hash.NewHasher(hashSecretKey)
 
 	// create userValidator
-	userValidator := newUserValidator(userGorm, hasher)
+	userValidator := newUserValidator(userDB, hasher, policy)
 
 	// create resetPasswordValidator
-	resetPasswordValidator := newPwResetValidator(pwResetGorm, hasher)
+	resetPasswordValidator := newPwResetValidator(resetDB, hasher)
 
 	// set the userGorm to UserDB in the UserService
 	userService := &userService{
 		UserDB:         userValidator,
 		PassworResetDB: resetPasswordValidator,
+		LoginTokenDB:   newLoginTokenValidator(loginDB, hasher),
+		policy:         policy,
 	}
 
 	// return
@@ -131,13 +158,15 @@ func NewUserService(db *gorm.DB) UserService {
 type userValidator struct {
 	UserDB
 	hasher     *hash.Hasher
+	policy     *PasswordPolicy
 	emailRegex *regexp.Regexp
 }
 
-func newUserValidator(userDB UserDB, hasher *hash.Hasher) *userValidator {
+func newUserValidator(userDB UserDB, hasher *hash.Hasher, policy *PasswordPolicy) *userValidator {
 	return &userValidator{
 		UserDB:     userDB,
 		hasher:     hasher,
+		policy:     policy,
 		emailRegex: regexp.MustCompile(`^[a-z0-9._%+\-]+@[a-z0-9.\-]+\.[a-z]{2,16}$`),
 	}
 }
@@ -168,8 +197,10 @@ func (uv *userValidator) CreateUser(user *User) error {
 		uv.NormalizeEmail,
 		uv.ValidateEmail,
 		uv.EmailIsNotTaken,
+		uv.NormalizeHandle,
+		uv.SetHandle,
 		uv.RequirePassword,
-		uv.ValidatePassword(8),
+		uv.ValidatePassword,
 		uv.HashUserPassword,
 		uv.GenerateNewRemeberToken,
 		uv.CheckRemeberTokenLength,
@@ -185,15 +216,11 @@ func (uv *userValidator) CreateUser(user *User) error {
 	return uv.UserDB.CreateUser(user)
 }
 
-// ValidatePassword is used to check for valid user password
-// if the password is less than minLength chars it will trow an error
-func (uv *userValidator) ValidatePassword(minLength uint) userValidationFunc {
-	return func(user *User) error {
-		if len(user.Password) < int(minLength) {
-			return ErrPasswordTooShort
-		}
-		return nil
-	}
+// ValidatePassword checks the user password against the
+// password policy. the name and the email of the user
+// should be set so the policy can check them too
+func (uv *userValidator) ValidatePassword(user *User) error {
+	return uv.policy.Check(user)
 }
 
 func (uv *userValidator) RequirePassword(user *User) error {
@@ -209,11 +236,11 @@ func (uv *userValidator) HashUserPassword(user *User) error {
 	}
 
 	// hash the user password
-	password, err := bcrypt.GenerateFromPassword([]byte(user.Password), bcrypt.DefaultCost)
+	hash, err := uv.policy.Hasher.Hash(user.Password)
 	if err != nil {
 		return err
 	}
-	user.PasswordHash = string(password)
+	user.PasswordHash = hash
 	user.Password = ""
 	return nil
 }
@@ -284,7 +311,17 @@ func (uv *userValidator) FindUserByRememberToken(token string) (*User, error) {
 	}
 
 	// call the next UserDB layer
-	return uv.UserDB.FindUserByRememberToken(user.RemeberTokenHash)
+	user, err = uv.UserDB.FindUserByRememberToken(user.RemeberTokenHash)
+	if err != nil {
+		return nil, err
+	}
+
+	// disabled users can not use their sessions
+	if user.Disabled {
+		return nil, ErrUserDisabled
+	}
+
+	return user, nil
 }
 
 func (uv *userValidator) FindAndUpdateByID(userID string, updates map[string]interface{}) (*User, error) {
@@ -303,6 +340,38 @@ func (uv *userValidator) FindAndUpdateByID(userID string, updates map[string]int
 		}
 	}
 
+	if _, handleUpdate := updates["handle"]; handleUpdate {
+		// assert the type
+		handle, ok := updates["handle"].(string)
+		if !ok {
+			return nil, errors.New("invalid type for handle update")
+		}
+		user.ID = uuid.FromStringOrNil(userID)
+		user.Handle = handle
+
+		err := runUserValidationFuncs(user, uv.NormalizeHandle, uv.ValidateHandle, uv.HandleIsNotTaken)
+		if err != nil {
+			return nil, err
+		}
+		updates["handle"] = user.Handle
+	}
+
+	if _, tokenUpdate := updates["remember_token"]; tokenUpdate {
+		// assert the type
+		token, ok := updates["remember_token"].(string)
+		if !ok {
+			return nil, errors.New("invalid type for remember token update")
+		}
+		user.RememberToken = token
+
+		err := runUserValidationFuncs(user, uv.CheckRemeberTokenLength, uv.HashUserRememberToken)
+		if err != nil {
+			return nil, err
+		}
+		updates["RemeberTokenHash"] = user.RemeberTokenHash
+		delete(updates, "remember_token")
+	}
+
 	if _, passwordUpdate := updates["password"]; passwordUpdate {
 		// assert the type
 		if password, ok := updates["password"].(string); !ok {
@@ -311,7 +380,24 @@ func (uv *userValidator) FindAndUpdateByID(userID string, updates map[string]int
 			user.Password = password
 		}
 
-		err := runUserValidationFuncs(user, uv.ValidatePassword(8), uv.HashUserPassword)
+		// the policy checks the name and the email
+		// the user has after the updates
+		existing, err := uv.UserDB.FindByID(userID)
+		if err != nil {
+			return nil, err
+		}
+		if user.Email == "" {
+			user.Email = existing.Email
+		}
+		user.FirstName, user.LastName = existing.FirstName, existing.LastName
+		if firstName, ok := updates["first_name"].(string); ok {
+			user.FirstName = firstName
+		}
+		if lastName, ok := updates["last_name"].(string); ok {
+			user.LastName = lastName
+		}
+
+		err = runUserValidationFuncs(user, uv.ValidatePassword, uv.HashUserPassword)
 		if err != nil {
 			return nil, err
 		}
@@ -386,21 +472,40 @@ func (uv *userValidator) FindByEmail(email string) (*User, error) {
 // AuthenticateUser is used to return user by email and password
 //
 // if the user is found the method will return the user object and nil error
+//
+// the password hash is upgraded if it is not made with the
+// current algorithm, params and pepper of the hasher
 func (userService *userService) AuthenticateUser(email, password string) (*User, error) {
-	// find user by email
+	// find user by email. the password is checked against a
+	// dummy hash if the user is not found so the unknown
+	// emails can not be told apart by the response time
 	user, err := userService.FindByEmail(email)
+	if err == ErrNotFound {
+		userService.policy.VerifyDummy(password)
+	}
 	if err != nil {
 		return nil, err
 	}
 
 	// compare user password
-	err = bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(password))
+	rehash, err := userService.policy.Verify(user, password)
 	if err != nil {
-		switch err {
-		case bcrypt.ErrMismatchedHashAndPassword:
-			return nil, ErrPasswordNotCorrect
-		default:
-			return nil, err
+		return nil, err
+	}
+
+	// disabled users can not log in
+	if user.Disabled {
+		return nil, ErrUserDisabled
+	}
+
+	// the login does not fail if the upgrade fails
+	// it is tried again on the next login
+	if rehash {
+		if hash, err := userService.policy.Hasher.Hash(password); err == nil {
+			updates := map[string]interface{}{"PasswordHash": hash}
+			if _, err := userService.UserDB.FindAndUpdateByID(user.ID.String(), updates); err == nil {
+				user.PasswordHash = hash
+			}
 		}
 	}
 
@@ -408,6 +513,20 @@ func (userService *userService) AuthenticateUser(email, password string) (*User,
 	return user, nil
 }
 
+// DisableUser saves the disabled flag and the new remember token
+// in one update. a token saved after the flag would write back the
+// stale user and enable it again
+func (us *userService) DisableUser(userID string) (*User, error) {
+	token, err := rand.GenerateRememberToken()
+	if err != nil {
+		return nil, err
+	}
+	return us.UserDB.FindAndUpdateByID(userID, map[string]interface{}{
+		"disabled":       true,
+		"remember_token": token,
+	})
+}
+
 func (us *userService) IntiateResetPassword(email string) (string, error) {
 	user, err := us.UserDB.FindByEmail(email)
 	if err != nil {
@@ -436,7 +555,7 @@ func (us *userService) CompleteResetPassword(token string, newPassword string) (
 	}
 
 	// check if the pwResetToken is not expired
-	expirationTokenTime := pw.CreatedAt.Add(time.Hour)
+	expirationTokenTime := pw.CreatedAt.Add(pwResetTokenDuration)
 	if time.Now().After(expirationTokenTime) {
 		return nil, ErrInvalidToken
 	}
@@ -456,6 +575,73 @@ func (us *userService) CompleteResetPassword(token string, newPassword string) (
 	return user, nil
 }
 
+func (us *userService) CleanExpiredResetTokens(dryRun bool) (int64, error) {
+	before := time.Now().Add(-pwResetTokenDuration)
+	if dryRun {
+		return us.PassworResetDB.CountCreatedBefore(before)
+	}
+	return us.PassworResetDB.DeleteCreatedBefore(before)
+}
+
+func (us *userService) IntiateLoginLink(email string) (*User, string, error) {
+	user, err := us.UserDB.FindByEmail(email)
+	if err != nil {
+		return nil, "", err
+	}
+	if user.Disabled {
+		return nil, "", ErrUserDisabled
+	}
+
+	t := &loginToken{UserID: user.ID}
+	if err := us.LoginTokenDB.Create(t); err != nil {
+		return nil, "", err
+	}
+
+	return user, t.Token, nil
+}
+
+func (us *userService) CompleteLoginLink(token string) (*User, error) {
+	t, err := us.LoginTokenDB.GetByToken(token)
+	switch err {
+	case nil:
+	case ErrNotFound:
+		return nil, ErrInvalidToken
+	default:
+		return nil, err
+	}
+
+	// the token is deleted first so it is used once
+	// even if the link is opened twice at the same time
+	switch err := us.LoginTokenDB.Delete(t.ID); err {
+	case nil:
+	case ErrNotFound:
+		return nil, ErrInvalidToken
+	default:
+		return nil, err
+	}
+
+	if time.Now().After(t.CreatedAt.Add(loginTokenDuration)) {
+		return nil, ErrInvalidToken
+	}
+
+	user, err := us.UserDB.FindByID(t.UserID.String())
+	if err != nil {
+		return nil, err
+	}
+	if user.Disabled {
+		return nil, ErrUserDisabled
+	}
+	return user, nil
+}
+
+func (us *userService) CleanExpiredLoginTokens(dryRun bool) (int64, error) {
+	before := time.Now().Add(-loginTokenDuration)
+	if dryRun {
+		return us.LoginTokenDB.CountCreatedBefore(before)
+	}
+	return us.LoginTokenDB.DeleteCreatedBefore(before)
+}
+
 // CreateUser is used to save user in the DB
 func (ug *userGorm) CreateUser(user *User) error {
 	return ug.db.Create(&user).Error
@@ -500,6 +686,13 @@ func (ug *userGorm) FindByEmail(email string) (*User, error) {
 	return user, err
 }
 
+// FindByHandle is used to find the user by the handle
+func (ug *userGorm) FindByHandle(handle string) (*User, error) {
+	user := new(User)
+	err := getRecord(ug.db.Where("handle = ?", handle), user)
+	return user, err
+}
+
 // FindAndDeleteByID is used to delete user by its id
 //
 // it will first find the user and then delete it
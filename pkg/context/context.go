@@ -8,7 +8,10 @@ import (
 
 type privateKey string
 
-const userKey privateKey = "user"
+const (
+	userKey        privateKey = "user"
+	accessTokenKey privateKey = "accessToken"
+)
 
 // WithUser is used to create a new context with user value
 func WithUser(ctx context.Context, user *model.User) context.Context {
@@ -27,3 +30,20 @@ func UserValue(ctx context.Context) *model.User {
 
 	return nil
 }
+
+// WithAccessToken is used to create a new context with the
+// access token that authenticated the request
+func WithAccessToken(ctx context.Context, token *model.AccessToken) context.Context {
+	return context.WithValue(ctx, accessTokenKey, token)
+}
+
+// AccessTokenValue is used to get the access token from ctx
+// it will return nil if the request is not authenticated
+// by an access token like the requests using the cookie
+func AccessTokenValue(ctx context.Context) *model.AccessToken {
+	if token, ok := ctx.Value(accessTokenKey).(*model.AccessToken); ok {
+		return token
+	}
+
+	return nil
+}
@@ -4,24 +4,36 @@ import (
 	"fmt"
 	"log"
 	"net/url"
+	"time"
 
+	"github.com/abanoub-fathy/bebo-gallery/config"
 	"github.com/abanoub-fathy/bebo-gallery/model"
+	"github.com/sendgrid/rest"
 	"github.com/sendgrid/sendgrid-go"
 	"github.com/sendgrid/sendgrid-go/helpers/mail"
 )
 
+// Client sends the email messages
+// it is implemented by *sendgrid.Client
+type Client interface {
+	Send(email *mail.SGMailV3) (*rest.Response, error)
+}
+
 type Mailer struct {
-	Client *sendgrid.Client
+	Client Client
+	config config.Mail
 }
 
-func NewClient(apiKey string) *Mailer {
+// NewClient creates a new Mailer from the mail configurations
+func NewClient(cfg config.Mail) *Mailer {
 	return &Mailer{
-		Client: sendgrid.NewSendClient(apiKey),
+		Client: sendgrid.NewSendClient(cfg.APIKey),
+		config: cfg,
 	}
 }
 
 func (mailer *Mailer) sendEmail(subject, toName, toEmailAddress, plainTextContent, htmlContent string) error {
-	from := mail.NewEmail("Abanoub CEO", "logybyvy@lyft.live")
+	from := mail.NewEmail(mailer.config.FromName, mailer.config.FromAddress)
 	toInfo := &mail.Email{
 		Name:    toName,
 		Address: toEmailAddress,
@@ -43,7 +55,7 @@ func (mailer *Mailer) SendWelcomEmail(userName, emailAddress string) error {
 func (mailer *Mailer) SendResetPasswordEmail(user model.User, token string) error {
 	values := url.Values{}
 	values.Set("token", token)
-	resetURL := "http://localhost:3000/password/reset" + "?" + values.Encode()
+	resetURL := mailer.config.BaseURL + "/password/reset" + "?" + values.Encode()
 	return mailer.sendEmail(
 		"Reset Your Password",
 		user.FirstName+" "+user.LastName,
@@ -60,3 +72,45 @@ func (mailer *Mailer) SendResetPasswordEmail(user model.User, token string) erro
 		),
 	)
 }
+
+func (mailer *Mailer) SendLoginLinkEmail(user model.User, token string) error {
+	values := url.Values{}
+	values.Set("token", token)
+	loginURL := mailer.config.BaseURL + "/login/link" + "?" + values.Encode()
+	return mailer.sendEmail(
+		"Your Login Link",
+		user.FirstName+" "+user.LastName,
+		user.Email,
+		"",
+		fmt.Sprintf(`
+			<h1>Hello, %s.</h1>
+			<h3> We have received that you want to log in without your password </h3>
+			<p>
+				You can log in from this link
+				<a href="%s">here</a>
+				it is valid for 15 minutes and can be used only once
+			</p>
+				`, user.FirstName, loginURL,
+		),
+	)
+}
+
+func (mailer *Mailer) SendAccountLockedEmail(user model.User, lockDuration time.Duration) error {
+	resetURL := mailer.config.BaseURL + "/password/forget"
+	return mailer.sendEmail(
+		"Your Account Is Locked",
+		user.FirstName+" "+user.LastName,
+		user.Email,
+		"",
+		fmt.Sprintf(`
+			<h1>Hello, %s.</h1>
+			<h3> There were many failed attempts to log in to your account </h3>
+			<p>
+				The login is locked for %v. If it was not you
+				you can change your password from this link
+				<a href="%s">here</a>
+			</p>
+				`, user.FirstName, lockDuration, resetURL,
+		),
+	)
+}
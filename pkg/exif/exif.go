@@ -0,0 +1,174 @@
+// Package exif reads the camera make and model from the
+// exif data of the jpeg images and the tiff based raw files
+//
+// only the first ifd of the exif data is read because
+// it is where the cameras write their make and model
+package exif
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"io"
+	"strings"
+)
+
+// ErrNoExif is returned when the file has no exif data
+var ErrNoExif = errors.New("exif: no exif data")
+
+// maxTIFFSize is the size of the start of the tiff files
+// that is read. the first ifd is near the start of the files
+const maxTIFFSize = 1 << 20
+
+// the tags of the first ifd
+const (
+	tagMake  = 0x010f
+	tagModel = 0x0110
+)
+
+// typeASCII is the type of the string values
+const typeASCII = 2
+
+// Info is the exif data of the image
+type Info struct {
+	Make  string
+	Model string
+}
+
+// Camera returns the make and the model of the camera
+// the make is not repeated if the model starts with it
+// like "Canon" and "Canon EOS 5D"
+func (info Info) Camera() string {
+	if strings.HasPrefix(strings.ToLower(info.Model), strings.ToLower(info.Make)) {
+		return info.Model
+	}
+	return strings.TrimSpace(info.Make + " " + info.Model)
+}
+
+// Decode reads the exif data of the jpeg or the tiff file
+func Decode(r io.Reader) (Info, error) {
+	br := bufio.NewReader(r)
+	header, err := br.Peek(4)
+	if err != nil {
+		return Info{}, ErrNoExif
+	}
+
+	switch {
+	case header[0] == 0xff && header[1] == 0xd8:
+		return decodeJPEG(br)
+	case string(header) == "II*\x00" || string(header) == "MM\x00*":
+		data, err := io.ReadAll(io.LimitReader(br, maxTIFFSize))
+		if err != nil {
+			return Info{}, err
+		}
+		return decodeTIFF(data)
+	}
+	return Info{}, ErrNoExif
+}
+
+// decodeJPEG finds the exif data in the APP1 segment
+// that comes before the image data
+func decodeJPEG(br *bufio.Reader) (Info, error) {
+	if _, err := br.Discard(2); err != nil {
+		return Info{}, err
+	}
+
+	for {
+		var marker [4]byte
+		if _, err := io.ReadFull(br, marker[:]); err != nil {
+			return Info{}, ErrNoExif
+		}
+		// the start of scan or the end of image
+		if marker[0] != 0xff || marker[1] == 0xda || marker[1] == 0xd9 {
+			return Info{}, ErrNoExif
+		}
+
+		size := int(binary.BigEndian.Uint16(marker[2:])) - 2
+		if size < 0 {
+			return Info{}, ErrNoExif
+		}
+		if marker[1] != 0xe1 {
+			if _, err := br.Discard(size); err != nil {
+				return Info{}, ErrNoExif
+			}
+			continue
+		}
+
+		segment := make([]byte, size)
+		if _, err := io.ReadFull(br, segment); err != nil {
+			return Info{}, ErrNoExif
+		}
+		// APP1 is used by xmp too
+		if strings.HasPrefix(string(segment), "Exif\x00\x00") {
+			return decodeTIFF(segment[6:])
+		}
+	}
+}
+
+// decodeTIFF reads the first ifd of the tiff data
+func decodeTIFF(data []byte) (Info, error) {
+	if len(data) < 8 {
+		return Info{}, ErrNoExif
+	}
+
+	var order binary.ByteOrder
+	switch string(data[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return Info{}, ErrNoExif
+	}
+
+	offset := int(order.Uint32(data[4:]))
+	if offset < 8 || offset+2 > len(data) {
+		return Info{}, ErrNoExif
+	}
+	count := int(order.Uint16(data[offset:]))
+
+	info := Info{}
+	for i := 0; i < count; i++ {
+		entry := offset + 2 + i*12
+		if entry+12 > len(data) {
+			break
+		}
+		tag := order.Uint16(data[entry:])
+		if tag != tagMake && tag != tagModel {
+			continue
+		}
+		value := asciiValue(data, data[entry:entry+12], order)
+		if tag == tagMake {
+			info.Make = value
+		} else {
+			info.Model = value
+		}
+	}
+
+	if info.Make == "" && info.Model == "" {
+		return Info{}, ErrNoExif
+	}
+	return info, nil
+}
+
+// asciiValue returns the string value of the ifd entry
+// the values longer than 4 bytes are stored at an offset
+func asciiValue(data, entry []byte, order binary.ByteOrder) string {
+	if order.Uint16(entry[2:]) != typeASCII {
+		return ""
+	}
+
+	size := int(order.Uint32(entry[4:]))
+	value := entry[8:12]
+	if size > 4 {
+		start := int(order.Uint32(entry[8:]))
+		if start < 0 || size > len(data) || start > len(data)-size {
+			return ""
+		}
+		value = data[start : start+size]
+	} else {
+		value = value[:size]
+	}
+
+	return strings.TrimSpace(strings.TrimRight(string(value), "\x00"))
+}
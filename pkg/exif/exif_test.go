@@ -0,0 +1,91 @@
+package exif_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+
+	"github.com/abanoub-fathy/bebo-gallery/pkg/exif"
+	"github.com/stretchr/testify/assert"
+)
+
+// tiff returns the tiff data with the make and the model
+// in the first ifd. the model is stored at an offset
+func tiff(order binary.ByteOrder, maker, model string) []byte {
+	var b bytes.Buffer
+	if order == binary.LittleEndian {
+		b.WriteString("II")
+	} else {
+		b.WriteString("MM")
+	}
+	binary.Write(&b, order, uint16(42))
+	binary.Write(&b, order, uint32(8))
+
+	// the ifd has 2 entries and the next ifd offset
+	valuesOffset := uint32(8 + 2 + 2*12 + 4)
+	binary.Write(&b, order, uint16(2))
+	for _, entry := range []struct {
+		tag   uint16
+		value string
+	}{{0x010f, maker}, {0x0110, model}} {
+		value := entry.value + "\x00"
+		binary.Write(&b, order, entry.tag)
+		binary.Write(&b, order, uint16(2))
+		binary.Write(&b, order, uint32(len(value)))
+		if len(value) <= 4 {
+			b.WriteString((value + "\x00\x00\x00\x00")[:4])
+			continue
+		}
+		binary.Write(&b, order, valuesOffset)
+		valuesOffset += uint32(len(value))
+	}
+	binary.Write(&b, order, uint32(0))
+
+	for _, value := range []string{maker, model} {
+		if len(value)+1 > 4 {
+			b.WriteString(value + "\x00")
+		}
+	}
+	return b.Bytes()
+}
+
+// jpeg returns a jpeg with an app0 segment before the exif one
+func jpeg(exifData []byte) []byte {
+	var b bytes.Buffer
+	b.Write([]byte{0xff, 0xd8})
+	b.Write([]byte{0xff, 0xe0, 0x00, 0x04, 'J', 'F'})
+	if exifData != nil {
+		segment := append([]byte("Exif\x00\x00"), exifData...)
+		b.Write([]byte{0xff, 0xe1})
+		binary.Write(&b, binary.BigEndian, uint16(len(segment)+2))
+		b.Write(segment)
+	}
+	b.Write([]byte{0xff, 0xda, 0x00, 0x02, 0xff, 0xd9})
+	return b.Bytes()
+}
+
+func TestDecode(t *testing.T) {
+	tests := []struct {
+		name   string
+		data   []byte
+		camera string
+		err    error
+	}{
+		{"jpeg", jpeg(tiff(binary.BigEndian, "Canon", "Canon EOS 5D")), "Canon EOS 5D", nil},
+		{"little endian", jpeg(tiff(binary.LittleEndian, "FUJIFILM", "X-T3")), "FUJIFILM X-T3", nil},
+		{"short make", jpeg(tiff(binary.LittleEndian, "LG", "G6")), "LG G6", nil},
+		{"tiff", tiff(binary.LittleEndian, "NIKON", "D750"), "NIKON D750", nil},
+		{"no exif", jpeg(nil), "", exif.ErrNoExif},
+		{"png", []byte("\x89PNG\r\n\x1a\n"), "", exif.ErrNoExif},
+		{"truncated", jpeg(tiff(binary.BigEndian, "Canon", "Canon EOS 5D"))[:20], "", exif.ErrNoExif},
+		{"empty", nil, "", exif.ErrNoExif},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			info, err := exif.Decode(bytes.NewReader(test.data))
+			assert.Equal(t, test.err, err)
+			assert.Equal(t, test.camera, info.Camera())
+		})
+	}
+}
@@ -5,12 +5,16 @@ import (
 	"crypto/sha256"
 	"encoding/base64"
 	"hash"
+	"sync"
 )
 
 // Hasher is an object that can contain hmac inside it
 // it can be used to make our code more easier
 // while working with hashing
+//
+// it is safe for concurrent use
 type Hasher struct {
+	mu   sync.Mutex
 	hmac hash.Hash
 }
 
@@ -25,6 +29,9 @@ func NewHasher(secretKey string) *Hasher {
 // HashByHMAC is a method used to hash string and return the hashed string
 // the hashing algorithm will use the secret key used when creating the hasher
 func (h *Hasher) HashByHMAC(token string) string {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
 	h.hmac.Reset()
 	h.hmac.Write([]byte(token))
 	hashedByteSlice := h.hmac.Sum(nil)
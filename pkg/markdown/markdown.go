@@ -0,0 +1,168 @@
+// Package markdown renders the small subset of markdown
+// allowed in the captions of the images
+//
+// the subset is paragraphs, line breaks, **bold**, *italic* or
+// _italic_, `code` and [links](https://example.com). all the other
+// text is escaped so the result is safe to put inside the pages
+package markdown
+
+import (
+	"html"
+	"html/template"
+	"net/url"
+	"strings"
+)
+
+// escapable are the chars that can be escaped by a backslash
+const escapable = "\\`*_[]()"
+
+// Render renders the markdown source to html
+func Render(source string) template.HTML {
+	source = strings.ReplaceAll(source, "\r\n", "\n")
+
+	var b strings.Builder
+	for _, paragraph := range paragraphs(source) {
+		b.WriteString("<p>")
+		b.WriteString(inline(paragraph))
+		b.WriteString("</p>\n")
+	}
+	return template.HTML(b.String())
+}
+
+// paragraphs splits the source on the blank lines
+func paragraphs(source string) []string {
+	result := []string{}
+	lines := []string{}
+	for _, line := range strings.Split(source, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			if len(lines) > 0 {
+				result = append(result, strings.Join(lines, "\n"))
+				lines = lines[:0]
+			}
+			continue
+		}
+		lines = append(lines, line)
+	}
+	if len(lines) > 0 {
+		result = append(result, strings.Join(lines, "\n"))
+	}
+	return result
+}
+
+// inline renders the inline elements of the text
+func inline(text string) string {
+	var b strings.Builder
+	for i := 0; i < len(text); {
+		c := text[i]
+		switch {
+		case c == '\\' && i+1 < len(text) && strings.IndexByte(escapable, text[i+1]) >= 0:
+			b.WriteString(html.EscapeString(text[i+1 : i+2]))
+			i += 2
+			continue
+
+		case c == '\n':
+			b.WriteString("<br>\n")
+			i++
+			continue
+
+		case c == '`':
+			if end := strings.IndexByte(text[i+1:], '`'); end > 0 {
+				b.WriteString("<code>" + html.EscapeString(text[i+1:i+1+end]) + "</code>")
+				i += end + 2
+				continue
+			}
+
+		case strings.HasPrefix(text[i:], "**"):
+			if end := strings.Index(text[i+2:], "**"); end > 0 {
+				b.WriteString("<strong>" + inline(text[i+2:i+2+end]) + "</strong>")
+				i += end + 4
+				continue
+			}
+
+		case c == '*' || c == '_':
+			if end := emphasisEnd(text, i); end > 0 {
+				b.WriteString("<em>" + inline(text[i+1:end]) + "</em>")
+				i = end + 1
+				continue
+			}
+
+		case c == '[':
+			if label, link, n := parseLink(text[i:]); n > 0 {
+				b.WriteString(`<a href="` + html.EscapeString(link) + `" rel="nofollow noopener noreferrer">` + inline(label) + "</a>")
+				i += n
+				continue
+			}
+		}
+
+		b.WriteString(html.EscapeString(text[i : i+1]))
+		i++
+	}
+	return b.String()
+}
+
+// emphasisEnd returns the index of the char closing the emphasis
+// opened at start or -1. the underscores inside the words like
+// snake_case do not open or close an emphasis
+func emphasisEnd(text string, start int) int {
+	marker := text[start]
+	if marker == '_' && start > 0 && isWordChar(text[start-1]) {
+		return -1
+	}
+	if start+1 >= len(text) || text[start+1] == ' ' {
+		return -1
+	}
+
+	for end := start + 1; end < len(text); end++ {
+		if text[end] != marker || text[end-1] == ' ' || text[end-1] == '\\' {
+			continue
+		}
+		if marker == '_' && end+1 < len(text) && isWordChar(text[end+1]) {
+			continue
+		}
+		if end == start+1 {
+			return -1
+		}
+		return end
+	}
+	return -1
+}
+
+// parseLink parses the [label](link) at the start of the text
+// n is the length of the link or 0 if it is not a safe link
+func parseLink(text string) (label, link string, n int) {
+	closing := strings.Index(text, "](")
+	if closing < 2 {
+		return "", "", 0
+	}
+	end := strings.IndexByte(text[closing+2:], ')')
+	if end < 0 {
+		return "", "", 0
+	}
+
+	label = text[1:closing]
+	link = strings.TrimSpace(text[closing+2 : closing+2+end])
+	if strings.ContainsAny(label, "\n[") || !safeLink(link) {
+		return "", "", 0
+	}
+	return label, link, closing + end + 3
+}
+
+// safeLink tells if the link is an absolute http, https or mailto url
+func safeLink(link string) bool {
+	u, err := url.Parse(link)
+	if err != nil {
+		return false
+	}
+	switch strings.ToLower(u.Scheme) {
+	case "http", "https":
+		return u.Host != ""
+	case "mailto":
+		return u.Opaque != ""
+	}
+	return false
+}
+
+func isWordChar(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c >= 0x80
+}
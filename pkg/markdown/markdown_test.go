@@ -0,0 +1,38 @@
+package markdown_test
+
+import (
+	"testing"
+
+	"github.com/abanoub-fathy/bebo-gallery/pkg/markdown"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRender(t *testing.T) {
+	tests := []struct {
+		name   string
+		source string
+		want   string
+	}{
+		{"empty", "  \n ", ""},
+		{"text", "a day at the beach", "<p>a day at the beach</p>\n"},
+		{"paragraphs", "first\nline\n\nsecond", "<p>first<br>\nline</p>\n<p>second</p>\n"},
+		{"bold", "a **big** wave", "<p>a <strong>big</strong> wave</p>\n"},
+		{"italic", "*so* _blue_", "<p><em>so</em> <em>blue</em></p>\n"},
+		{"nested", "**very _big_**", "<p><strong>very <em>big</em></strong></p>\n"},
+		{"snake case", "file_name_here", "<p>file_name_here</p>\n"},
+		{"lonely star", "5 * 3 = 15", "<p>5 * 3 = 15</p>\n"},
+		{"code", "run `a < b`", "<p>run <code>a &lt; b</code></p>\n"},
+		{"escaped", `\*not italic\*`, "<p>*not italic*</p>\n"},
+		{"link", "by [me](https://example.com/?a=1&b=2)", `<p>by <a href="https://example.com/?a=1&amp;b=2" rel="nofollow noopener noreferrer">me</a></p>` + "\n"},
+		{"mailto", "[mail](mailto:me@example.com)", `<p><a href="mailto:me@example.com" rel="nofollow noopener noreferrer">mail</a></p>` + "\n"},
+		{"unsafe link", "[x](javascript:alert(1))", "<p>[x](javascript:alert(1))</p>\n"},
+		{"relative link", "[x](/account)", "<p>[x](/account)</p>\n"},
+		{"html", `<script>alert("x")</script>`, "<p>&lt;script&gt;alert(&#34;x&#34;)&lt;/script&gt;</p>\n"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			assert.Equal(t, test.want, string(markdown.Render(test.source)))
+		})
+	}
+}
@@ -0,0 +1,329 @@
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"io"
+	"io/fs"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// Migration is a numbered change of the database schema
+// loaded from the files <version>_<name>.up.sql and
+// <version>_<name>.down.sql
+type Migration struct {
+	Version int64
+	Name    string
+	Up      string
+	Down    string
+}
+
+// Status tells if a migration is applied to the database
+type Status struct {
+	Migration
+	Applied   bool
+	AppliedAt time.Time
+}
+
+// Dialect contains the SQL that differs between the databases
+type Dialect struct {
+	// Lock and Unlock take and release a lock shared by all
+	// the connections so only one migrator runs at a time.
+	// they are skipped when empty
+	Lock   string
+	Unlock string
+
+	// Placeholder returns the bind parameter number n
+	Placeholder func(n int) string
+}
+
+// lockID is the key of the advisory lock taken while migrating
+const lockID = 7301402916
+
+// Postgres is the dialect of the PostgreSQL database
+var Postgres = Dialect{
+	Lock:        fmt.Sprintf("SELECT pg_advisory_lock(%d)", lockID),
+	Unlock:      fmt.Sprintf("SELECT pg_advisory_unlock(%d)", lockID),
+	Placeholder: func(n int) string { return "$" + strconv.Itoa(n) },
+}
+
+// SQLite is the dialect of the SQLite database
+// it has no lock because sqlite allows a single writer
+var SQLite = Dialect{
+	Placeholder: func(n int) string { return "?" },
+}
+
+// Migrator applies and rolls back the migrations
+// and records them in the schema_migrations table
+type Migrator struct {
+	db         *sql.DB
+	dialect    Dialect
+	migrations []Migration
+
+	// DryRun prints the SQL of the migrations to Log
+	// instead of running it
+	DryRun bool
+
+	// Log receives a line for every migration
+	// applied or rolled back
+	Log io.Writer
+}
+
+var fileNameRegex = regexp.MustCompile(`^(\d+)_(\w+)\.(up|down)\.sql$`)
+
+// New creates a Migrator for the migrations files in fsys
+func New(db *sql.DB, dialect Dialect, fsys fs.FS) (*Migrator, error) {
+	migrations, err := Load(fsys)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Migrator{
+		db:         db,
+		dialect:    dialect,
+		migrations: migrations,
+		Log:        io.Discard,
+	}, nil
+}
+
+// Load reads the migrations files in the root of fsys
+// and returns them sorted by their version
+func Load(fsys fs.FS) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := map[int64]*Migration{}
+	for _, entry := range entries {
+		matches := fileNameRegex.FindStringSubmatch(entry.Name())
+		if entry.IsDir() || matches == nil {
+			continue
+		}
+
+		version, err := strconv.ParseInt(matches[1], 10, 64)
+		if err != nil {
+			return nil, err
+		}
+		content, err := fs.ReadFile(fsys, path.Clean(entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+
+		m, found := byVersion[version]
+		if !found {
+			m = &Migration{Version: version, Name: matches[2]}
+			byVersion[version] = m
+		}
+		if m.Name != matches[2] {
+			return nil, fmt.Errorf("migrate: version %v is used by %v and %v", version, m.Name, matches[2])
+		}
+		if matches[3] == "up" {
+			m.Up = string(content)
+		} else {
+			m.Down = string(content)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.Up == "" {
+			return nil, fmt.Errorf("migrate: migration %v_%v has no up file", m.Version, m.Name)
+		}
+		migrations = append(migrations, *m)
+	}
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+	return migrations, nil
+}
+
+// Up applies all the migrations that are not applied yet
+// and returns them
+func (m *Migrator) Up(ctx context.Context) ([]Migration, error) {
+	applied := []Migration{}
+	err := m.withLock(ctx, func(conn *sql.Conn) error {
+		statuses, err := m.status(ctx, conn)
+		if err != nil {
+			return err
+		}
+
+		for _, status := range statuses {
+			if status.Applied {
+				continue
+			}
+			if err := m.run(ctx, conn, status.Migration, true); err != nil {
+				return err
+			}
+			applied = append(applied, status.Migration)
+		}
+		return nil
+	})
+	return applied, err
+}
+
+// Down rolls back the last steps applied migrations
+// and returns them. if steps <= 0 all of them are rolled back
+func (m *Migrator) Down(ctx context.Context, steps int) ([]Migration, error) {
+	rolledBack := []Migration{}
+	err := m.withLock(ctx, func(conn *sql.Conn) error {
+		statuses, err := m.status(ctx, conn)
+		if err != nil {
+			return err
+		}
+
+		for i := len(statuses) - 1; i >= 0; i-- {
+			if steps > 0 && len(rolledBack) == steps {
+				break
+			}
+			if !statuses[i].Applied {
+				continue
+			}
+			if err := m.run(ctx, conn, statuses[i].Migration, false); err != nil {
+				return err
+			}
+			rolledBack = append(rolledBack, statuses[i].Migration)
+		}
+		return nil
+	})
+	return rolledBack, err
+}
+
+// Status returns the status of every migration
+func (m *Migrator) Status(ctx context.Context) ([]Status, error) {
+	conn, err := m.db.Conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	if !m.DryRun {
+		if err := m.createTable(ctx, conn); err != nil {
+			return nil, err
+		}
+	}
+
+	return m.status(ctx, conn)
+}
+
+// withLock runs fn on a single connection holding the migrations lock
+func (m *Migrator) withLock(ctx context.Context, fn func(conn *sql.Conn) error) error {
+	conn, err := m.db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if m.dialect.Lock != "" {
+		if _, err := conn.ExecContext(ctx, m.dialect.Lock); err != nil {
+			return fmt.Errorf("migrate: could not take the lock: %w", err)
+		}
+		defer conn.ExecContext(context.Background(), m.dialect.Unlock)
+	}
+
+	if !m.DryRun {
+		if err := m.createTable(ctx, conn); err != nil {
+			return err
+		}
+	}
+
+	return fn(conn)
+}
+
+func (m *Migrator) createTable(ctx context.Context, conn *sql.Conn) error {
+	_, err := conn.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS schema_migrations (
+	version BIGINT PRIMARY KEY,
+	name TEXT NOT NULL,
+	applied_at TIMESTAMP NOT NULL
+)`)
+	return err
+}
+
+// status reads the applied migrations from the schema_migrations table
+func (m *Migrator) status(ctx context.Context, conn *sql.Conn) ([]Status, error) {
+	appliedAt := map[int64]time.Time{}
+
+	rows, err := conn.QueryContext(ctx, "SELECT version, applied_at FROM schema_migrations")
+	switch {
+	case err != nil && m.DryRun:
+		// the table is not created in dry run mode
+		// so none of the migrations is applied
+	case err != nil:
+		return nil, err
+	default:
+		defer rows.Close()
+		for rows.Next() {
+			var version int64
+			var at time.Time
+			if err := rows.Scan(&version, &at); err != nil {
+				return nil, err
+			}
+			appliedAt[version] = at
+		}
+		if err := rows.Err(); err != nil {
+			return nil, err
+		}
+	}
+
+	statuses := make([]Status, len(m.migrations))
+	for i, migration := range m.migrations {
+		at, applied := appliedAt[migration.Version]
+		statuses[i] = Status{
+			Migration: migration,
+			Applied:   applied,
+			AppliedAt: at,
+		}
+	}
+	return statuses, nil
+}
+
+// run applies or rolls back the migration inside a transaction
+// together with its record in the schema_migrations table
+func (m *Migrator) run(ctx context.Context, conn *sql.Conn, migration Migration, up bool) error {
+	direction, query := "up", migration.Up
+	if !up {
+		direction, query = "down", migration.Down
+	}
+	fmt.Fprintf(m.Log, "%v %v_%v\n", direction, migration.Version, migration.Name)
+
+	if m.DryRun {
+		fmt.Fprintln(m.Log, query)
+		return nil
+	}
+	if query == "" {
+		return fmt.Errorf("migrate: migration %v_%v has no %v file", migration.Version, migration.Name, direction)
+	}
+
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, query); err != nil {
+		return fmt.Errorf("migrate: %v_%v %v: %w", migration.Version, migration.Name, direction, err)
+	}
+
+	p := m.dialect.Placeholder
+	if up {
+		_, err = tx.ExecContext(ctx,
+			fmt.Sprintf("INSERT INTO schema_migrations (version, name, applied_at) VALUES (%v, %v, %v)", p(1), p(2), p(3)),
+			migration.Version, migration.Name, time.Now().UTC(),
+		)
+	} else {
+		_, err = tx.ExecContext(ctx,
+			fmt.Sprintf("DELETE FROM schema_migrations WHERE version = %v", p(1)),
+			migration.Version,
+		)
+	}
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
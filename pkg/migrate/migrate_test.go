@@ -0,0 +1,199 @@
+package migrate_test
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+
+	"github.com/abanoub-fathy/bebo-gallery/pkg/migrate"
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// migrationsFS has three migrations that create the tables a, b and c
+var migrationsFS = fstest.MapFS{
+	"0001_a.up.sql":   {Data: []byte("CREATE TABLE a (id INTEGER PRIMARY KEY);")},
+	"0001_a.down.sql": {Data: []byte("DROP TABLE a;")},
+	"0002_b.up.sql":   {Data: []byte("CREATE TABLE b (id INTEGER PRIMARY KEY);")},
+	"0002_b.down.sql": {Data: []byte("DROP TABLE b;")},
+	"0003_c.up.sql":   {Data: []byte("CREATE TABLE c (id INTEGER PRIMARY KEY);")},
+	"0003_c.down.sql": {Data: []byte("DROP TABLE c;")},
+	"README.md":       {Data: []byte("not a migration")},
+}
+
+// openTestDB opens a new sqlite database in a file so
+// every connection of the pool sees the same database
+func openTestDB(t *testing.T) *sql.DB {
+	db, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "test.db"))
+	require.NoError(t, err)
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+// tableExists tells if the table is in the database
+func tableExists(t *testing.T, db *sql.DB, name string) bool {
+	var count int
+	err := db.QueryRow("SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = ?", name).Scan(&count)
+	require.NoError(t, err)
+	return count == 1
+}
+
+// appliedVersions returns the versions of the applied migrations
+func appliedVersions(t *testing.T, m *migrate.Migrator) []int64 {
+	statuses, err := m.Status(context.Background())
+	require.NoError(t, err)
+
+	versions := []int64{}
+	for _, status := range statuses {
+		if status.Applied {
+			assert.False(t, status.AppliedAt.IsZero())
+			versions = append(versions, status.Version)
+		}
+	}
+	return versions
+}
+
+func versions(migrations []migrate.Migration) []int64 {
+	versions := []int64{}
+	for _, migration := range migrations {
+		versions = append(versions, migration.Version)
+	}
+	return versions
+}
+
+func TestLoad(t *testing.T) {
+	migrations, err := migrate.Load(migrationsFS)
+	require.NoError(t, err)
+	assert.Equal(t, []int64{1, 2, 3}, versions(migrations))
+	assert.Equal(t, "b", migrations[1].Name)
+	assert.Equal(t, "DROP TABLE b;", migrations[1].Down)
+
+	_, err = migrate.Load(fstest.MapFS{
+		"0001_a.up.sql": {Data: []byte("SELECT 1;")},
+		"0001_b.up.sql": {Data: []byte("SELECT 1;")},
+	})
+	assert.Error(t, err)
+
+	_, err = migrate.Load(fstest.MapFS{
+		"0001_a.down.sql": {Data: []byte("SELECT 1;")},
+	})
+	assert.Error(t, err)
+}
+
+func TestUpDownStatus(t *testing.T) {
+	ctx := context.Background()
+	db := openTestDB(t)
+	m, err := migrate.New(db, migrate.SQLite, migrationsFS)
+	require.NoError(t, err)
+	log := &bytes.Buffer{}
+	m.Log = log
+
+	assert.Empty(t, appliedVersions(t, m))
+
+	applied, err := m.Up(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, []int64{1, 2, 3}, versions(applied))
+	assert.Equal(t, []int64{1, 2, 3}, appliedVersions(t, m))
+	assert.True(t, tableExists(t, db, "c"))
+	assert.Equal(t, "up 1_a\nup 2_b\nup 3_c\n", log.String())
+
+	// the applied migrations are not run again
+	applied, err = m.Up(ctx)
+	require.NoError(t, err)
+	assert.Empty(t, applied)
+
+	rolledBack, err := m.Down(ctx, 1)
+	require.NoError(t, err)
+	assert.Equal(t, []int64{3}, versions(rolledBack))
+	assert.Equal(t, []int64{1, 2}, appliedVersions(t, m))
+	assert.False(t, tableExists(t, db, "c"))
+	assert.True(t, tableExists(t, db, "b"))
+
+	// zero steps rolls back all of them the newest first
+	rolledBack, err = m.Down(ctx, 0)
+	require.NoError(t, err)
+	assert.Equal(t, []int64{2, 1}, versions(rolledBack))
+	assert.Empty(t, appliedVersions(t, m))
+	assert.False(t, tableExists(t, db, "a"))
+	assert.True(t, tableExists(t, db, "schema_migrations"))
+}
+
+func TestDryRun(t *testing.T) {
+	ctx := context.Background()
+	db := openTestDB(t)
+	m, err := migrate.New(db, migrate.SQLite, migrationsFS)
+	require.NoError(t, err)
+	log := &bytes.Buffer{}
+	m.Log = log
+	m.DryRun = true
+
+	applied, err := m.Up(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, []int64{1, 2, 3}, versions(applied))
+	assert.Contains(t, log.String(), "up 2_b\nCREATE TABLE b (id INTEGER PRIMARY KEY);\n")
+
+	// nothing is written not even the schema_migrations table
+	assert.Empty(t, appliedVersions(t, m))
+	assert.False(t, tableExists(t, db, "a"))
+	assert.False(t, tableExists(t, db, "schema_migrations"))
+
+	// the dry run of down shows the applied migrations only
+	m.DryRun = false
+	_, err = m.Up(ctx)
+	require.NoError(t, err)
+	m.DryRun = true
+	log.Reset()
+
+	rolledBack, err := m.Down(ctx, 1)
+	require.NoError(t, err)
+	assert.Equal(t, []int64{3}, versions(rolledBack))
+	assert.Equal(t, "down 3_c\nDROP TABLE c;\n", log.String())
+	assert.Equal(t, []int64{1, 2, 3}, appliedVersions(t, m))
+	assert.True(t, tableExists(t, db, "c"))
+}
+
+func TestFailedMigration(t *testing.T) {
+	ctx := context.Background()
+	db := openTestDB(t)
+	m, err := migrate.New(db, migrate.SQLite, fstest.MapFS{
+		"0001_a.up.sql":   {Data: []byte("CREATE TABLE a (id INTEGER PRIMARY KEY);")},
+		"0001_a.down.sql": {Data: []byte("DROP TABLE a;")},
+		"0002_b.up.sql":   {Data: []byte("CREATE TABLE b (id INTEGER PRIMARY KEY); INSERT INTO missing VALUES (1);")},
+		"0003_c.up.sql":   {Data: []byte("CREATE TABLE c (id INTEGER PRIMARY KEY);")},
+	})
+	require.NoError(t, err)
+
+	applied, err := m.Up(ctx)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "2_b up")
+	assert.Equal(t, []int64{1}, versions(applied))
+
+	// the failed migration is rolled back with its record
+	// and the migrations after it are not run
+	assert.Equal(t, []int64{1}, appliedVersions(t, m))
+	assert.True(t, tableExists(t, db, "a"))
+	assert.False(t, tableExists(t, db, "b"))
+	assert.False(t, tableExists(t, db, "c"))
+}
+
+func TestDownWithoutDownFile(t *testing.T) {
+	ctx := context.Background()
+	db := openTestDB(t)
+	m, err := migrate.New(db, migrate.SQLite, fstest.MapFS{
+		"0001_a.up.sql": {Data: []byte("CREATE TABLE a (id INTEGER PRIMARY KEY);")},
+	})
+	require.NoError(t, err)
+
+	_, err = m.Up(ctx)
+	require.NoError(t, err)
+
+	rolledBack, err := m.Down(ctx, 0)
+	assert.Error(t, err)
+	assert.Empty(t, rolledBack)
+	assert.Equal(t, []int64{1}, appliedVersions(t, m))
+	assert.True(t, tableExists(t, db, "a"))
+}
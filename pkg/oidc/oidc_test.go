@@ -0,0 +1,119 @@
+package oidc_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/abanoub-fathy/bebo-gallery/pkg/oidc"
+	"github.com/abanoub-fathy/bebo-gallery/pkg/oidc/oidctest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const redirectURL = "http://localhost:3000/auth/test/callback"
+
+func newClient(issuer *oidctest.Server) *oidc.Client {
+	return oidc.NewClient(oidc.Config{
+		Issuer:       issuer.Issuer(),
+		ClientID:     issuer.ClientID,
+		ClientSecret: issuer.ClientSecret,
+		RedirectURL:  redirectURL,
+		Scopes:       []string{"email", "profile"},
+	})
+}
+
+// authorize follows the auth url and returns the code
+// the issuer redirects back with
+func authorize(t *testing.T, authURL, state string) string {
+	client := &http.Client{
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+	res, err := client.Get(authURL)
+	require.NoError(t, err)
+	res.Body.Close()
+	require.Equal(t, http.StatusFound, res.StatusCode)
+
+	location, err := url.Parse(res.Header.Get("Location"))
+	require.NoError(t, err)
+	require.Equal(t, state, location.Query().Get("state"))
+	return location.Query().Get("code")
+}
+
+func TestLoginFlow(t *testing.T) {
+	issuer := oidctest.NewServer("bebo", "secret")
+	defer issuer.Close()
+	issuer.SetIdentity(oidctest.Identity{Subject: "123", Email: "aop4ever@gmail.com", EmailVerified: true})
+
+	client := newClient(issuer)
+	ctx := context.Background()
+
+	verifier, err := oidc.NewVerifier()
+	require.NoError(t, err)
+	authURL, err := client.AuthCodeURL(ctx, "the-state", "the-nonce", oidc.S256Challenge(verifier))
+	require.NoError(t, err)
+
+	code := authorize(t, authURL, "the-state")
+
+	// the code can not be used without the verifier
+	_, err = client.Exchange(ctx, code, "wrong-verifier")
+	assert.Error(t, err)
+
+	code = authorize(t, authURL, "the-state")
+	token, err := client.Exchange(ctx, code, verifier)
+	require.NoError(t, err)
+
+	_, err = client.Verify(ctx, token.IDToken, "another-nonce")
+	assert.True(t, errors.Is(err, oidc.ErrInvalidIDToken), "the nonce should be checked")
+
+	claims, err := client.Verify(ctx, token.IDToken, "the-nonce")
+	require.NoError(t, err)
+	assert.Equal(t, "123", claims.Subject)
+	assert.Equal(t, "aop4ever@gmail.com", claims.Email)
+	assert.True(t, claims.EmailVerified)
+}
+
+func TestVerifyClaims(t *testing.T) {
+	issuer := oidctest.NewServer("bebo", "secret")
+	defer issuer.Close()
+	client := newClient(issuer)
+
+	now := time.Now()
+	valid := func() map[string]interface{} {
+		return map[string]interface{}{
+			"iss":   issuer.Issuer(),
+			"sub":   "123",
+			"aud":   []string{"other", "bebo"},
+			"iat":   now.Unix(),
+			"exp":   now.Add(time.Hour).Unix(),
+			"nonce": "the-nonce",
+		}
+	}
+
+	_, err := client.Verify(context.Background(), issuer.Sign(valid()), "the-nonce")
+	require.NoError(t, err)
+
+	tests := map[string]func(claims map[string]interface{}){
+		"issuer":   func(claims map[string]interface{}) { claims["iss"] = "https://evil.example.com" },
+		"audience": func(claims map[string]interface{}) { claims["aud"] = "other" },
+		"expiry":   func(claims map[string]interface{}) { claims["exp"] = now.Add(-time.Hour).Unix() },
+		"subject":  func(claims map[string]interface{}) { delete(claims, "sub") },
+	}
+	for name, change := range tests {
+		claims := valid()
+		change(claims)
+		_, err := client.Verify(context.Background(), issuer.Sign(claims), "the-nonce")
+		assert.True(t, errors.Is(err, oidc.ErrInvalidIDToken), "the %v should be checked", name)
+	}
+
+	// the tokens signed by another key are refused
+	other := oidctest.NewServer("bebo", "secret")
+	defer other.Close()
+	_, err = client.Verify(context.Background(), other.Sign(valid()), "the-nonce")
+	assert.True(t, errors.Is(err, oidc.ErrInvalidIDToken))
+}
@@ -0,0 +1,140 @@
+package password
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+)
+
+// PrefixLength is the length of the hash prefixes of the ranges
+const PrefixLength = 5
+
+// BreachedList is a local file of the SHA-1 hashes of the breached
+// passwords like the pwned passwords downloads. the file is sorted
+// by hash and every line is HASH:COUNT
+//
+// the passwords are looked up by the range of the prefix of their
+// hash like the k-anonymity range api so the lookups read only the
+// lines of the prefix and never need the password itself
+type BreachedList struct {
+	path string
+}
+
+// OpenBreachedList checks that the file exists and returns its list
+func OpenBreachedList(path string) (*BreachedList, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if info.IsDir() {
+		return nil, fmt.Errorf("password: breached list %v is a directory", path)
+	}
+	return &BreachedList{path: path}, nil
+}
+
+// Contains tells if the password is in the list
+func (l *BreachedList) Contains(password string) (bool, error) {
+	sum := sha1.Sum([]byte(password))
+	hash := strings.ToUpper(hex.EncodeToString(sum[:]))
+
+	suffixes, err := l.Range(hash[:PrefixLength])
+	if err != nil {
+		return false, err
+	}
+	for _, suffix := range suffixes {
+		if suffix == hash[PrefixLength:] {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// Range returns the suffixes of the hashes starting with the prefix
+func (l *BreachedList) Range(prefix string) ([]string, error) {
+	if len(prefix) != PrefixLength {
+		return nil, errors.New("password: the hash prefix should be 5 chars")
+	}
+	prefix = strings.ToUpper(prefix)
+
+	file, err := os.Open(l.path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+	size := info.Size()
+
+	// find the first line of the range by a binary search
+	// on the offsets of the sorted file
+	var searchErr error
+	start := sort.Search(int(size), func(off int) bool {
+		line, _, err := lineAfter(file, size, int64(off))
+		if err != nil {
+			searchErr = err
+			return true
+		}
+		return line == "" || linePrefix(line) >= prefix
+	})
+	if searchErr != nil {
+		return nil, searchErr
+	}
+
+	_, offset, err := lineAfter(file, size, int64(start))
+	if err != nil {
+		return nil, err
+	}
+
+	suffixes := []string{}
+	scanner := bufio.NewScanner(io.NewSectionReader(file, offset, size-offset))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if linePrefix(line) != prefix {
+			break
+		}
+		hash, _, _ := strings.Cut(line, ":")
+		suffixes = append(suffixes, strings.ToUpper(hash[PrefixLength:]))
+	}
+	return suffixes, scanner.Err()
+}
+
+// lineAfter returns the first line starting at or after off
+// and its offset. the line is empty at the end of the file
+func lineAfter(file *os.File, size, off int64) (string, int64, error) {
+	if off > 0 {
+		// skip the rest of the line containing off - 1
+		reader := bufio.NewReaderSize(io.NewSectionReader(file, off-1, size-off+1), 128)
+		skipped, err := reader.ReadString('\n')
+		if err == io.EOF {
+			return "", size, nil
+		}
+		if err != nil {
+			return "", 0, err
+		}
+		off += int64(len(skipped)) - 1
+	}
+
+	reader := bufio.NewReaderSize(io.NewSectionReader(file, off, size-off), 128)
+	line, err := reader.ReadString('\n')
+	if err != nil && err != io.EOF {
+		return "", 0, err
+	}
+	return strings.TrimSpace(line), off, nil
+}
+
+// linePrefix returns the hash prefix of the line
+func linePrefix(line string) string {
+	if len(line) < PrefixLength {
+		return strings.ToUpper(line)
+	}
+	return strings.ToUpper(line[:PrefixLength])
+}
@@ -0,0 +1,59 @@
+// Package password estimates the strength of the passwords
+// and checks them against the lists of breached passwords
+package password
+
+import (
+	"math"
+	"unicode"
+)
+
+// Entropy estimates the strength of the password in bits
+//
+// every character adds the bits of the pool of the kinds of
+// characters used in the password. the repeated characters
+// and the sequences like abc or 321 add one bit only
+func Entropy(password string) float64 {
+	runes := []rune(password)
+
+	var lower, upper, digit, symbol, other bool
+	for _, r := range runes {
+		switch {
+		case r >= 'a' && r <= 'z':
+			lower = true
+		case r >= 'A' && r <= 'Z':
+			upper = true
+		case r >= '0' && r <= '9':
+			digit = true
+		case r <= unicode.MaxASCII:
+			symbol = true
+		default:
+			other = true
+		}
+	}
+
+	pool := 0
+	for _, kind := range []struct {
+		used bool
+		size int
+	}{{lower, 26}, {upper, 26}, {digit, 10}, {symbol, 33}, {other, 100}} {
+		if kind.used {
+			pool += kind.size
+		}
+	}
+	if pool == 0 {
+		return 0
+	}
+
+	bits := math.Log2(float64(pool))
+	entropy := 0.0
+	for i, r := range runes {
+		if i > 0 {
+			if diff := r - runes[i-1]; diff >= -1 && diff <= 1 {
+				entropy++
+				continue
+			}
+		}
+		entropy += bits
+	}
+	return entropy
+}
@@ -0,0 +1,206 @@
+package password
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// the algorithms of the hashes
+const (
+	Argon2id = "argon2id"
+	Bcrypt   = "bcrypt"
+)
+
+// pepperedPrefix marks the hashes of the peppered passwords
+const pepperedPrefix = "$peppered"
+
+const (
+	argon2SaltLength = 16
+	argon2KeyLength  = 32
+)
+
+var (
+	// ErrMismatchedHashAndPassword is returned by Verify
+	// when the password is not the password of the hash
+	ErrMismatchedHashAndPassword = errors.New("password: hash and password mismatch")
+
+	// ErrPepperRequired is returned by Verify when the hash is
+	// of a peppered password and the Hasher has no pepper
+	ErrPepperRequired = errors.New("password: the hash needs the pepper")
+
+	errInvalidHash = errors.New("password: the hash format is not valid")
+)
+
+// Argon2Params are the params of the argon2id hashes
+type Argon2Params struct {
+	// Memory is in KiB
+	Memory  uint32
+	Time    uint32
+	Threads uint8
+}
+
+// Hasher hashes the passwords with the Algorithm and its params
+//
+// every hash carries its algorithm and params so the hashes made
+// with older settings can still be verified and Verify tells when
+// they should be hashed again with the current settings
+type Hasher struct {
+	Algorithm  string
+	BcryptCost int
+	Argon2     Argon2Params
+
+	// Pepper is an optional secret key mixed into the passwords
+	// before they are hashed. it is kept out of the database
+	Pepper []byte
+}
+
+// DefaultHasher returns a Hasher of argon2id with the
+// params recommended by RFC 9106 for low memory systems
+func DefaultHasher() *Hasher {
+	return &Hasher{
+		Algorithm:  Argon2id,
+		BcryptCost: bcrypt.DefaultCost,
+		Argon2: Argon2Params{
+			Memory:  64 * 1024,
+			Time:    3,
+			Threads: 4,
+		},
+	}
+}
+
+// Hash hashes the password with the current settings
+func (h *Hasher) Hash(password string) (string, error) {
+	secret := h.pepper(password)
+
+	var hash string
+	switch h.Algorithm {
+	case Argon2id:
+		salt := make([]byte, argon2SaltLength)
+		if _, err := rand.Read(salt); err != nil {
+			return "", err
+		}
+		key := argon2.IDKey(secret, salt, h.Argon2.Time, h.Argon2.Memory, h.Argon2.Threads, argon2KeyLength)
+		hash = fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s",
+			argon2.Version, h.Argon2.Memory, h.Argon2.Time, h.Argon2.Threads,
+			base64.RawStdEncoding.EncodeToString(salt),
+			base64.RawStdEncoding.EncodeToString(key),
+		)
+	case Bcrypt:
+		bcryptHash, err := bcrypt.GenerateFromPassword(secret, h.BcryptCost)
+		if err != nil {
+			return "", err
+		}
+		hash = string(bcryptHash)
+	default:
+		return "", fmt.Errorf("password: unknown hash algorithm %q", h.Algorithm)
+	}
+
+	if len(h.Pepper) > 0 {
+		hash = pepperedPrefix + hash
+	}
+	return hash, nil
+}
+
+// Verify checks that the password is the password of the hash.
+// it returns ErrMismatchedHashAndPassword if it is not
+//
+// rehash is true when the hash is not made with the current
+// settings so it should be replaced by a new hash
+func (h *Hasher) Verify(hash, password string) (rehash bool, err error) {
+	peppered := strings.HasPrefix(hash, pepperedPrefix)
+	if peppered {
+		if len(h.Pepper) == 0 {
+			return false, ErrPepperRequired
+		}
+		hash = strings.TrimPrefix(hash, pepperedPrefix)
+	}
+
+	secret := []byte(password)
+	if peppered {
+		secret = h.pepper(password)
+	}
+
+	var current bool
+	if strings.HasPrefix(hash, "$argon2id$") {
+		current, err = h.verifyArgon2(hash, secret)
+	} else {
+		current, err = h.verifyBcrypt(hash, secret)
+	}
+	if err != nil {
+		return false, err
+	}
+
+	return !current || peppered != (len(h.Pepper) > 0), nil
+}
+
+// verifyArgon2 verifies the argon2id hash and tells
+// if it is made with the current settings
+func (h *Hasher) verifyArgon2(hash string, secret []byte) (bool, error) {
+	parts := strings.Split(hash, "$")
+	if len(parts) != 6 {
+		return false, errInvalidHash
+	}
+
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil {
+		return false, errInvalidHash
+	}
+	var params Argon2Params
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &params.Memory, &params.Time, &params.Threads); err != nil {
+		return false, errInvalidHash
+	}
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return false, errInvalidHash
+	}
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil {
+		return false, errInvalidHash
+	}
+
+	computed := argon2.IDKey(secret, salt, params.Time, params.Memory, params.Threads, uint32(len(key)))
+	if subtle.ConstantTimeCompare(key, computed) != 1 {
+		return false, ErrMismatchedHashAndPassword
+	}
+
+	current := h.Algorithm == Argon2id && version == argon2.Version && params == h.Argon2
+	return current, nil
+}
+
+// verifyBcrypt verifies the bcrypt hash and tells
+// if it is made with the current settings
+func (h *Hasher) verifyBcrypt(hash string, secret []byte) (bool, error) {
+	err := bcrypt.CompareHashAndPassword([]byte(hash), secret)
+	if err == bcrypt.ErrMismatchedHashAndPassword {
+		return false, ErrMismatchedHashAndPassword
+	}
+	if err != nil {
+		return false, err
+	}
+
+	cost, err := bcrypt.Cost([]byte(hash))
+	if err != nil {
+		return false, err
+	}
+	return h.Algorithm == Bcrypt && cost == h.BcryptCost, nil
+}
+
+// pepper mixes the pepper into the password. the result
+// is short enough for the 72 bytes limit of bcrypt
+func (h *Hasher) pepper(password string) []byte {
+	if len(h.Pepper) == 0 {
+		return []byte(password)
+	}
+	mac := hmac.New(sha256.New, h.Pepper)
+	mac.Write([]byte(password))
+	return []byte(base64.StdEncoding.EncodeToString(mac.Sum(nil)))
+}
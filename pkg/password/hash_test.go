@@ -0,0 +1,99 @@
+package password
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func testHasher() *Hasher {
+	return &Hasher{
+		Algorithm:  Argon2id,
+		BcryptCost: bcrypt.MinCost,
+		Argon2:     Argon2Params{Memory: 64, Time: 1, Threads: 1},
+	}
+}
+
+func TestHasher(t *testing.T) {
+	h := testHasher()
+
+	hash, err := h.Hash("12212154554554asdsa")
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(hash, "$argon2id$v=19$m=64,t=1,p=1$"), hash)
+
+	rehash, err := h.Verify(hash, "12212154554554asdsa")
+	require.NoError(t, err)
+	assert.False(t, rehash)
+
+	_, err = h.Verify(hash, "wrong-password")
+	assert.Equal(t, ErrMismatchedHashAndPassword, err)
+
+	// every hash has its own salt
+	other, err := h.Hash("12212154554554asdsa")
+	require.NoError(t, err)
+	assert.NotEqual(t, hash, other)
+
+	_, err = h.Verify("$argon2id$v=19$m=64$salt", "12212154554554asdsa")
+	assert.Error(t, err)
+}
+
+func TestHasherRehash(t *testing.T) {
+	h := testHasher()
+	h.Algorithm = Bcrypt
+
+	bcryptHash, err := h.Hash("12212154554554asdsa")
+	require.NoError(t, err)
+	rehash, err := h.Verify(bcryptHash, "12212154554554asdsa")
+	require.NoError(t, err)
+	assert.False(t, rehash)
+
+	// a higher cost needs a rehash
+	h.BcryptCost++
+	rehash, err = h.Verify(bcryptHash, "12212154554554asdsa")
+	require.NoError(t, err)
+	assert.True(t, rehash)
+
+	// another algorithm needs a rehash
+	h.Algorithm = Argon2id
+	rehash, err = h.Verify(bcryptHash, "12212154554554asdsa")
+	require.NoError(t, err)
+	assert.True(t, rehash)
+
+	argon2Hash, err := h.Hash("12212154554554asdsa")
+	require.NoError(t, err)
+	h.Argon2.Time++
+	rehash, err = h.Verify(argon2Hash, "12212154554554asdsa")
+	require.NoError(t, err)
+	assert.True(t, rehash)
+}
+
+func TestHasherPepper(t *testing.T) {
+	h := testHasher()
+	plain, err := h.Hash("12212154554554asdsa")
+	require.NoError(t, err)
+
+	// adding the pepper needs a rehash
+	h.Pepper = []byte("pepper")
+	rehash, err := h.Verify(plain, "12212154554554asdsa")
+	require.NoError(t, err)
+	assert.True(t, rehash)
+
+	peppered, err := h.Hash("12212154554554asdsa")
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(peppered, "$peppered$argon2id$"), peppered)
+	rehash, err = h.Verify(peppered, "12212154554554asdsa")
+	require.NoError(t, err)
+	assert.False(t, rehash)
+
+	// the peppered hashes can not be verified with another pepper
+	h.Pepper = []byte("other")
+	_, err = h.Verify(peppered, "12212154554554asdsa")
+	assert.Equal(t, ErrMismatchedHashAndPassword, err)
+
+	h.Pepper = nil
+	_, err = h.Verify(peppered, "12212154554554asdsa")
+	assert.Equal(t, ErrPepperRequired, err)
+}
@@ -0,0 +1,73 @@
+package password
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEntropy(t *testing.T) {
+	assert.Equal(t, 0.0, Entropy(""))
+
+	// the repeats and the sequences add one bit
+	assert.InDelta(t, 3.32+7, Entropy("12345678"), 0.01)
+	assert.InDelta(t, 4.7+7, Entropy("aaaaaaaa"), 0.01)
+	assert.InDelta(t, 7*4.7+1, Entropy("password"), 0.1)
+
+	// more kinds of characters make a bigger pool
+	assert.Greater(t, Entropy("pa55W0rd!"), Entropy("password1"))
+	assert.Greater(t, Entropy("correct-horse-battery"), 100.0)
+}
+
+func TestBreachedList(t *testing.T) {
+	breached := []string{"password", "123456", "qwerty", "letmein", "dragon"}
+	lines := []string{}
+	for i, pw := range breached {
+		lines = append(lines, hashOf(pw)+":"+strings.Repeat("1", i+1))
+	}
+	sort.Strings(lines)
+
+	path := filepath.Join(t.TempDir(), "pwned.txt")
+	require.NoError(t, os.WriteFile(path, []byte(strings.Join(lines, "\r\n")+"\r\n"), 0644))
+
+	list, err := OpenBreachedList(path)
+	require.NoError(t, err)
+
+	for _, pw := range breached {
+		found, err := list.Contains(pw)
+		require.NoError(t, err)
+		assert.True(t, found, pw)
+	}
+
+	found, err := list.Contains("12212154554554asdsa")
+	require.NoError(t, err)
+	assert.False(t, found)
+
+	// the range has only the suffixes of the prefix
+	hash := hashOf("qwerty")
+	suffixes, err := list.Range(strings.ToLower(hash[:PrefixLength]))
+	require.NoError(t, err)
+	assert.Equal(t, []string{hash[PrefixLength:]}, suffixes)
+
+	suffixes, err = list.Range("00000")
+	require.NoError(t, err)
+	assert.Empty(t, suffixes)
+	suffixes, err = list.Range("FFFFF")
+	require.NoError(t, err)
+	assert.Empty(t, suffixes)
+
+	_, err = OpenBreachedList(filepath.Join(t.TempDir(), "missing.txt"))
+	assert.Error(t, err)
+}
+
+func hashOf(pw string) string {
+	sum := sha1.Sum([]byte(pw))
+	return strings.ToUpper(hex.EncodeToString(sum[:]))
+}
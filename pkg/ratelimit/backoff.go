@@ -0,0 +1,194 @@
+package ratelimit
+
+import (
+	"sync"
+	"time"
+)
+
+// Backoff throttles the failed attempts of every key like the
+// failed logins of an account. after Free failures every next
+// attempt has to wait a delay that starts at BaseDelay and is
+// doubled by every failure up to MaxDelay. every LockAfter
+// failures the key is locked for LockDuration.
+//
+// the failures are forgotten after Window from the last one
+// or by Reset. it is safe for concurrent use
+type Backoff struct {
+	Free         int
+	BaseDelay    time.Duration
+	MaxDelay     time.Duration
+	LockAfter    int
+	LockDuration time.Duration
+	Window       time.Duration
+
+	mu       sync.Mutex
+	failures map[string]*failures
+	calls    int
+
+	// now is replaced by the tests
+	now func() time.Time
+}
+
+// failures are the failed attempts of a key
+type failures struct {
+	count       int
+	last        time.Time
+	lockedUntil time.Time
+}
+
+// NewBackoff creates a Backoff with the delays and the lock
+func NewBackoff(free int, baseDelay, maxDelay time.Duration, lockAfter int, lockDuration, window time.Duration) *Backoff {
+	return &Backoff{
+		Free:         free,
+		BaseDelay:    baseDelay,
+		MaxDelay:     maxDelay,
+		LockAfter:    lockAfter,
+		LockDuration: lockDuration,
+		Window:       window,
+		failures:     map[string]*failures{},
+		now:          time.Now,
+	}
+}
+
+// Wait returns how long the key has to wait before
+// its next attempt. it is 0 if the attempt is allowed
+func (b *Backoff) Wait(key string) time.Duration {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.wait(key, b.now())
+}
+
+// Fail records a failed attempt of the key. it returns
+// true only for the failure that locked the key
+func (b *Backoff) Fail(key string) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.fail(key, b.now())
+}
+
+// Reserve checks the attempt of the key and records it as a
+// failure at once so the attempts sent at the same time can not
+// all pass the check before their failures are recorded. it
+// returns how long the key has to wait and nothing is recorded
+// if it is not 0. locked is true if the failure locked the key.
+// Forgive removes the failure if the attempt does not fail
+func (b *Backoff) Reserve(key string) (wait time.Duration, locked bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := b.now()
+	if wait := b.wait(key, now); wait > 0 {
+		return wait, false
+	}
+	return 0, b.fail(key, now)
+}
+
+// Forgive removes a failure recorded by Reserve for an attempt
+// that did not fail and the lock that the failure applied
+func (b *Backoff) Forgive(key string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	f := b.get(key, b.now())
+	if f == nil {
+		return
+	}
+	if f.count%b.LockAfter == 0 {
+		f.lockedUntil = time.Time{}
+	}
+	f.count--
+	if f.count <= 0 {
+		delete(b.failures, key)
+	}
+}
+
+func (b *Backoff) wait(key string, now time.Time) time.Duration {
+	f := b.get(key, now)
+	if f == nil {
+		return 0
+	}
+
+	if now.Before(f.lockedUntil) {
+		return f.lockedUntil.Sub(now)
+	}
+
+	if wait := f.last.Add(b.delay(f.count)).Sub(now); wait > 0 {
+		return wait
+	}
+	return 0
+}
+
+func (b *Backoff) fail(key string, now time.Time) bool {
+	b.calls++
+	if b.calls%sweepEvery == 0 {
+		b.sweep(now)
+	}
+
+	f := b.get(key, now)
+	if f == nil {
+		f = &failures{}
+		b.failures[key] = f
+	}
+	f.count++
+	f.last = now
+
+	// the key is locked again after LockAfter more failures
+	// so the attempts after a lock expires are locked too
+	if f.count%b.LockAfter == 0 {
+		f.lockedUntil = now.Add(b.LockDuration)
+		return true
+	}
+	return false
+}
+
+// Reset forgets the failures of the key
+func (b *Backoff) Reset(key string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	delete(b.failures, key)
+}
+
+// delay returns the delay after count failures
+func (b *Backoff) delay(count int) time.Duration {
+	if count <= b.Free {
+		return 0
+	}
+
+	delay := b.BaseDelay
+	for i := b.Free + 1; i < count && delay < b.MaxDelay; i++ {
+		delay *= 2
+	}
+	if delay > b.MaxDelay {
+		delay = b.MaxDelay
+	}
+	return delay
+}
+
+// get returns the failures of the key if they are not forgotten
+func (b *Backoff) get(key string, now time.Time) *failures {
+	f, found := b.failures[key]
+	if !found {
+		return nil
+	}
+	if b.expired(f, now) {
+		delete(b.failures, key)
+		return nil
+	}
+	return f
+}
+
+func (b *Backoff) expired(f *failures, now time.Time) bool {
+	return now.After(f.last.Add(b.Window)) && now.After(f.lockedUntil)
+}
+
+// sweep deletes the failures that are forgotten
+func (b *Backoff) sweep(now time.Time) {
+	for key, f := range b.failures {
+		if b.expired(f, now) {
+			delete(b.failures, key)
+		}
+	}
+}
@@ -0,0 +1,92 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBackoff(t *testing.T) {
+	now := time.Date(2022, 9, 1, 10, 0, 0, 0, time.UTC)
+	b := NewBackoff(2, time.Second, 4*time.Second, 6, time.Hour, 30*time.Minute)
+	b.now = func() time.Time { return now }
+
+	// the free failures have no delay
+	for i := 0; i < 2; i++ {
+		require.Zero(t, b.Wait("user"))
+		require.False(t, b.Fail("user"))
+	}
+	assert.Zero(t, b.Wait("user"))
+
+	// the delays are doubled up to the max delay
+	for _, delay := range []time.Duration{time.Second, 2 * time.Second, 4 * time.Second} {
+		require.False(t, b.Fail("user"))
+		require.Equal(t, delay, b.Wait("user"))
+		now = now.Add(delay)
+		require.Zero(t, b.Wait("user"))
+	}
+
+	// the key is locked
+	require.True(t, b.Fail("user"))
+	assert.Equal(t, time.Hour, b.Wait("user"))
+	assert.Zero(t, b.Wait("other"))
+
+	// the failures after the lock expires lock the key again
+	now = now.Add(time.Hour)
+	require.Zero(t, b.Wait("user"))
+	for i := 0; i < 5; i++ {
+		require.False(t, b.Fail("user"))
+		require.Equal(t, 4*time.Second, b.Wait("user"))
+		now = now.Add(4 * time.Second)
+	}
+	require.True(t, b.Fail("user"))
+	assert.Equal(t, time.Hour, b.Wait("user"))
+
+	// the failures are forgotten after the lock and the window
+	now = now.Add(time.Hour + time.Second)
+	assert.Zero(t, b.Wait("user"))
+	assert.False(t, b.Fail("user"))
+	assert.Zero(t, b.Wait("user"))
+
+	b.Reset("user")
+	assert.Empty(t, b.failures)
+}
+
+func TestBackoffReserve(t *testing.T) {
+	now := time.Date(2022, 9, 1, 10, 0, 0, 0, time.UTC)
+	b := NewBackoff(1, time.Second, 4*time.Second, 3, time.Hour, 30*time.Minute)
+	b.now = func() time.Time { return now }
+
+	// the reserved attempts are counted before they are checked
+	for i := 0; i < 2; i++ {
+		wait, locked := b.Reserve("user")
+		require.Zero(t, wait)
+		require.False(t, locked)
+	}
+	wait, _ := b.Reserve("user")
+	assert.Equal(t, time.Second, wait)
+	assert.Equal(t, 2, b.failures["user"].count)
+
+	// the forgiven attempt does not count
+	b.Forgive("user")
+	assert.Zero(t, b.Wait("user"))
+
+	// the lock of the forgiven attempt is removed
+	now = now.Add(time.Second)
+	_, locked := b.Reserve("user")
+	require.False(t, locked)
+	now = now.Add(time.Second)
+	_, locked = b.Reserve("user")
+	require.True(t, locked)
+	assert.Equal(t, time.Hour, b.Wait("user"))
+	b.Forgive("user")
+	assert.Equal(t, time.Second, b.Wait("user"))
+
+	b.Forgive("user")
+	b.Forgive("user")
+	assert.Empty(t, b.failures)
+	b.Forgive("user")
+	assert.Empty(t, b.failures)
+}
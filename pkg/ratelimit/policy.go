@@ -0,0 +1,152 @@
+package ratelimit
+
+import (
+	"fmt"
+	"math"
+	"time"
+)
+
+// Algorithm is how a Policy counts the hits of a key
+type Algorithm string
+
+const (
+	// TokenBucket allows bursts of Limit hits and refills
+	// the bucket with Limit tokens every Window
+	TokenBucket Algorithm = "token_bucket"
+
+	// SlidingWindow allows Limit hits in any Window. it weights
+	// the hits of the previous window by how much of it is still
+	// inside the sliding window so it needs two counters only
+	SlidingWindow Algorithm = "sliding_window"
+)
+
+// Policy is the limit applied to every key of a route
+type Policy struct {
+	Algorithm Algorithm
+	Limit     int
+	Window    time.Duration
+}
+
+// String returns the policy in the format of the RateLimit-Policy header
+func (p Policy) String() string {
+	return fmt.Sprintf("%d;w=%d", p.Limit, int64(math.Ceil(p.Window.Seconds())))
+}
+
+// State is the state of a key kept by the stores. the zero
+// State is the state of a key that has no hits yet
+type State struct {
+	// the token bucket keeps the tokens left in A at the time At.
+	// the sliding window keeps the hits of the previous window
+	// in A and the hits of the window starting at At in B
+	A, B float64
+	At   time.Time
+}
+
+// Result is the result of a hit
+type Result struct {
+	Allowed   bool
+	Limit     int
+	Remaining int
+
+	// Reset is how long until the full limit is available again
+	Reset time.Duration
+
+	// RetryAfter is how long to wait before trying
+	// again when the hit is not allowed
+	RetryAfter time.Duration
+}
+
+// Take records a hit at now in the state if it is allowed.
+// a policy with no limit allows every hit
+func (p Policy) Take(s *State, now time.Time) Result {
+	if p.Limit <= 0 || p.Window <= 0 {
+		return Result{Allowed: true}
+	}
+	if p.Algorithm == SlidingWindow {
+		return p.takeSlidingWindow(s, now)
+	}
+	return p.takeTokenBucket(s, now)
+}
+
+// expiresAt returns when the state is the same as a new one
+// so the stores can forget it
+func (p Policy) expiresAt(s State) time.Time {
+	return s.At.Add(2 * p.Window)
+}
+
+func (p Policy) takeTokenBucket(s *State, now time.Time) Result {
+	limit := float64(p.Limit)
+	perToken := p.Window / time.Duration(p.Limit)
+
+	tokens := limit
+	if !s.At.IsZero() {
+		tokens = math.Min(limit, s.A+float64(now.Sub(s.At))/float64(perToken))
+	}
+
+	result := Result{Limit: p.Limit}
+	if tokens >= 1 {
+		tokens--
+		result.Allowed = true
+	} else {
+		result.RetryAfter = time.Duration((1 - tokens) * float64(perToken))
+	}
+
+	s.A, s.At = tokens, now
+	result.Remaining = int(tokens)
+	result.Reset = time.Duration((limit - tokens) * float64(perToken))
+	return result
+}
+
+func (p Policy) takeSlidingWindow(s *State, now time.Time) Result {
+	start := now.Truncate(p.Window)
+	switch {
+	case s.At.Equal(start):
+	case s.At.Equal(start.Add(-p.Window)):
+		s.A, s.B, s.At = s.B, 0, start
+	default:
+		s.A, s.B, s.At = 0, 0, start
+	}
+
+	limit := float64(p.Limit)
+	elapsed := now.Sub(start)
+	weight := 1 - float64(elapsed)/float64(p.Window)
+	count := s.A*weight + s.B
+
+	result := Result{Limit: p.Limit}
+	if count+1 <= limit {
+		s.B++
+		count++
+		result.Allowed = true
+	} else {
+		result.RetryAfter = p.slidingRetryAfter(*s, elapsed)
+	}
+
+	result.Remaining = int(math.Max(0, limit-count))
+	switch {
+	case s.B > 0:
+		result.Reset = 2*p.Window - elapsed
+	case s.A > 0:
+		result.Reset = p.Window - elapsed
+	}
+	return result
+}
+
+// slidingRetryAfter returns how long until the weighted
+// count of the hits leaves room for one more hit
+func (p Policy) slidingRetryAfter(s State, elapsed time.Duration) time.Duration {
+	room := float64(p.Limit) - 1
+	if s.B > room {
+		// the current window becomes the previous
+		// one and its hits have to slide out
+		wait := p.Window - elapsed
+		return wait + time.Duration((1-room/s.B)*float64(p.Window))
+	}
+
+	// the hits of the previous window have to slide out
+	// until A * weight <= room - B
+	needed := time.Duration((1 - (room-s.B)/s.A) * float64(p.Window))
+	if needed <= elapsed {
+		return 0
+	}
+	return needed - elapsed
+}
@@ -0,0 +1,107 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTokenBucket(t *testing.T) {
+	now := time.Date(2022, 9, 1, 10, 0, 0, 0, time.UTC)
+	policy := Policy{Algorithm: TokenBucket, Limit: 3, Window: time.Minute}
+	state := State{}
+
+	// the full bucket allows a burst
+	for i := 0; i < 3; i++ {
+		result := policy.Take(&state, now)
+		require.True(t, result.Allowed, "hit %v should be allowed", i+1)
+		assert.Equal(t, 2-i, result.Remaining)
+	}
+
+	result := policy.Take(&state, now)
+	require.False(t, result.Allowed)
+	assert.Equal(t, 20*time.Second, result.RetryAfter)
+	assert.Equal(t, time.Minute, result.Reset)
+
+	// a token is added every 20 seconds
+	now = now.Add(20 * time.Second)
+	result = policy.Take(&state, now)
+	assert.True(t, result.Allowed)
+	assert.Equal(t, 0, result.Remaining)
+
+	// the bucket never holds more than the limit
+	now = now.Add(time.Hour)
+	result = policy.Take(&state, now)
+	assert.True(t, result.Allowed)
+	assert.Equal(t, 2, result.Remaining)
+	assert.Equal(t, 20*time.Second, result.Reset)
+}
+
+func TestSlidingWindow(t *testing.T) {
+	now := time.Date(2022, 9, 1, 10, 0, 0, 0, time.UTC)
+	policy := Policy{Algorithm: SlidingWindow, Limit: 4, Window: time.Minute}
+	state := State{}
+
+	for i := 0; i < 4; i++ {
+		result := policy.Take(&state, now)
+		require.True(t, result.Allowed, "hit %v should be allowed", i+1)
+		assert.Equal(t, 3-i, result.Remaining)
+	}
+
+	result := policy.Take(&state, now)
+	require.False(t, result.Allowed)
+	assert.Equal(t, 75*time.Second, result.RetryAfter)
+
+	// halfway through the next window half of
+	// the previous hits are still counted
+	now = now.Add(90 * time.Second)
+	result = policy.Take(&state, now)
+	assert.True(t, result.Allowed)
+	assert.Equal(t, 1, result.Remaining)
+
+	result = policy.Take(&state, now)
+	assert.True(t, result.Allowed)
+	result = policy.Take(&state, now)
+	require.False(t, result.Allowed)
+	assert.Equal(t, 15*time.Second, result.RetryAfter)
+
+	// the hits older than two windows are forgotten
+	now = now.Add(2 * time.Minute)
+	result = policy.Take(&state, now)
+	assert.True(t, result.Allowed)
+	assert.Equal(t, 3, result.Remaining)
+}
+
+func TestPolicyWithoutLimit(t *testing.T) {
+	state := State{}
+	result := Policy{Algorithm: TokenBucket}.Take(&state, time.Now())
+	assert.True(t, result.Allowed)
+}
+
+func TestMemoryStore(t *testing.T) {
+	now := time.Date(2022, 9, 1, 10, 0, 0, 0, time.UTC)
+	store := NewMemoryStore()
+	store.now = func() time.Time { return now }
+	policy := Policy{Algorithm: TokenBucket, Limit: 1, Window: time.Minute}
+
+	result, err := store.Take(context.Background(), "ip:1.2.3.4", policy)
+	require.NoError(t, err)
+	assert.True(t, result.Allowed)
+
+	result, err = store.Take(context.Background(), "ip:1.2.3.4", policy)
+	require.NoError(t, err)
+	assert.False(t, result.Allowed)
+
+	// the other keys have their own state
+	result, err = store.Take(context.Background(), "ip:5.6.7.8", policy)
+	require.NoError(t, err)
+	assert.True(t, result.Allowed)
+
+	// the expired states are swept
+	now = now.Add(time.Hour)
+	store.sweep(now)
+	assert.Empty(t, store.states)
+}
@@ -0,0 +1,86 @@
+// Package ratelimit limits how often an action
+// can be done by the same key like an ip address
+package ratelimit
+
+import (
+	"sync"
+	"time"
+)
+
+// sweepEvery is the number of calls between the
+// sweeps of the keys that have no recent hits
+const sweepEvery = 1000
+
+// Limiter allows Limit hits of every key in a sliding Window.
+// it keeps the hits in memory and it is safe for concurrent use
+type Limiter struct {
+	Limit  int
+	Window time.Duration
+
+	mu    sync.Mutex
+	hits  map[string][]time.Time
+	calls int
+
+	// now is replaced by the tests
+	now func() time.Time
+}
+
+// New creates a Limiter of limit hits per window
+func New(limit int, window time.Duration) *Limiter {
+	return &Limiter{
+		Limit:  limit,
+		Window: window,
+		hits:   map[string][]time.Time{},
+		now:    time.Now,
+	}
+}
+
+// Allow records a hit of the key if it is allowed. if it is
+// not allowed it returns how long to wait before trying again
+func (l *Limiter) Allow(key string) (bool, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	l.calls++
+	if l.calls%sweepEvery == 0 {
+		l.sweep(now)
+	}
+
+	hits := l.recent(key, now)
+	if len(hits) >= l.Limit {
+		l.hits[key] = hits
+		return false, hits[0].Add(l.Window).Sub(now)
+	}
+
+	l.hits[key] = append(hits, now)
+	return true, 0
+}
+
+// Reset forgets the hits of the key
+func (l *Limiter) Reset(key string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	delete(l.hits, key)
+}
+
+// recent returns the hits of the key inside the window
+func (l *Limiter) recent(key string, now time.Time) []time.Time {
+	hits := l.hits[key]
+	start := now.Add(-l.Window)
+	i := 0
+	for i < len(hits) && !hits[i].After(start) {
+		i++
+	}
+	return hits[i:]
+}
+
+// sweep deletes the keys that have no hits inside the window
+func (l *Limiter) sweep(now time.Time) {
+	for key := range l.hits {
+		if len(l.recent(key, now)) == 0 {
+			delete(l.hits, key)
+		}
+	}
+}
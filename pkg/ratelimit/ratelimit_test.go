@@ -0,0 +1,37 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLimiter(t *testing.T) {
+	now := time.Date(2022, 9, 1, 10, 0, 0, 0, time.UTC)
+	l := New(2, time.Minute)
+	l.now = func() time.Time { return now }
+
+	for i := 0; i < 2; i++ {
+		allowed, _ := l.Allow("1.2.3.4")
+		require.True(t, allowed, "hit %v should be allowed", i+1)
+	}
+
+	now = now.Add(10 * time.Second)
+	allowed, retryAfter := l.Allow("1.2.3.4")
+	require.False(t, allowed)
+	assert.Equal(t, 50*time.Second, retryAfter)
+
+	// the other keys have their own hits
+	allowed, _ = l.Allow("5.6.7.8")
+	assert.True(t, allowed)
+
+	// the window slides
+	now = now.Add(50 * time.Second)
+	allowed, _ = l.Allow("1.2.3.4")
+	assert.True(t, allowed)
+
+	l.Reset("5.6.7.8")
+	assert.Empty(t, l.hits["5.6.7.8"])
+}
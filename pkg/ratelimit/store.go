@@ -0,0 +1,157 @@
+package ratelimit
+
+import (
+	"context"
+	"database/sql"
+	"sync"
+	"time"
+)
+
+// Store keeps the states of the keys of the policies
+type Store interface {
+	// Take records a hit of the key with the policy if it is
+	// allowed. it should be atomic for the hits of the same key
+	Take(ctx context.Context, key string, policy Policy) (Result, error)
+}
+
+// MemoryStore keeps the states in memory so every
+// replica of the app has its own limits
+type MemoryStore struct {
+	mu     sync.Mutex
+	states map[string]*memoryState
+	calls  int
+
+	// now is replaced by the tests
+	now func() time.Time
+}
+
+type memoryState struct {
+	State
+	expiresAt time.Time
+}
+
+// NewMemoryStore creates an empty MemoryStore
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		states: map[string]*memoryState{},
+		now:    time.Now,
+	}
+}
+
+// make sure that MemoryStore implements Store
+var _ Store = (*MemoryStore)(nil)
+
+func (ms *MemoryStore) Take(ctx context.Context, key string, policy Policy) (Result, error) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	now := ms.now()
+	ms.calls++
+	if ms.calls%sweepEvery == 0 {
+		ms.sweep(now)
+	}
+
+	state, found := ms.states[key]
+	if !found {
+		state = &memoryState{}
+		ms.states[key] = state
+	}
+
+	result := policy.Take(&state.State, now)
+	state.expiresAt = policy.expiresAt(state.State)
+	return result, nil
+}
+
+// sweep deletes the states that expired
+func (ms *MemoryStore) sweep(now time.Time) {
+	for key, state := range ms.states {
+		if state.expiresAt.Before(now) {
+			delete(ms.states, key)
+		}
+	}
+}
+
+// SQLStore keeps the states in the rate_limits table so the
+// limits are shared by all the replicas of the app using it
+type SQLStore struct {
+	db *sql.DB
+
+	// lockRows locks the row of the key until the
+	// transaction ends. sqlite locks the whole db instead
+	lockRows bool
+
+	mu    sync.Mutex
+	calls int
+
+	// now is replaced by the tests
+	now func() time.Time
+}
+
+// NewPostgresStore creates a SQLStore of a postgres db
+func NewPostgresStore(db *sql.DB) *SQLStore {
+	return &SQLStore{db: db, lockRows: true, now: time.Now}
+}
+
+// NewSQLiteStore creates a SQLStore of a sqlite db
+func NewSQLiteStore(db *sql.DB) *SQLStore {
+	return &SQLStore{db: db, now: time.Now}
+}
+
+// make sure that SQLStore implements Store
+var _ Store = (*SQLStore)(nil)
+
+func (ss *SQLStore) Take(ctx context.Context, key string, policy Policy) (Result, error) {
+	now := ss.now().UTC()
+	if ss.shouldSweep() {
+		if _, err := ss.db.ExecContext(ctx, `DELETE FROM rate_limits WHERE expires_at < $1`, now); err != nil {
+			return Result{}, err
+		}
+	}
+
+	tx, err := ss.db.BeginTx(ctx, nil)
+	if err != nil {
+		return Result{}, err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx,
+		`INSERT INTO rate_limits (key, a, b, at, expires_at) VALUES ($1, 0, 0, NULL, $2) ON CONFLICT (key) DO NOTHING`,
+		key, now,
+	)
+	if err != nil {
+		return Result{}, err
+	}
+
+	query := `SELECT a, b, at FROM rate_limits WHERE key = $1`
+	if ss.lockRows {
+		query += ` FOR UPDATE`
+	}
+	var state State
+	var at sql.NullTime
+	if err := tx.QueryRowContext(ctx, query, key).Scan(&state.A, &state.B, &at); err != nil {
+		return Result{}, err
+	}
+	if at.Valid {
+		state.At = at.Time.UTC()
+	}
+
+	result := policy.Take(&state, now)
+	_, err = tx.ExecContext(ctx,
+		`UPDATE rate_limits SET a = $1, b = $2, at = $3, expires_at = $4 WHERE key = $5`,
+		state.A, state.B, state.At.UTC(), policy.expiresAt(state).UTC(), key,
+	)
+	if err != nil {
+		return Result{}, err
+	}
+
+	return result, tx.Commit()
+}
+
+// shouldSweep tells if the expired states should be deleted
+func (ss *SQLStore) shouldSweep() bool {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+
+	ss.calls++
+	return ss.calls%sweepEvery == 0
+}
@@ -0,0 +1,343 @@
+// Package tus keeps the partial uploads of the tus resumable
+// upload protocol (https://tus.io/protocols/resumable-upload)
+// on the disk so they survive the restarts of the app
+package tus
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// Version is the version of the protocol that is supported
+	Version = "1.0.0"
+
+	// Extensions are the supported extensions of the protocol
+	Extensions = "creation,termination"
+)
+
+var (
+	// ErrNotFound is returned when the upload does not exist
+	ErrNotFound = errors.New("tus: the upload is not found")
+
+	// ErrOffsetMismatch is returned when a chunk does not start
+	// at the end of the bytes received so far
+	ErrOffsetMismatch = errors.New("tus: the offset does not match the upload")
+
+	// ErrInvalidMetadata is returned when the metadata
+	// header is not formatted as the protocol says
+	ErrInvalidMetadata = errors.New("tus: the upload metadata is not valid")
+)
+
+// Upload is the info of a partial upload
+type Upload struct {
+	ID string `json:"id"`
+
+	// Owner and Target are set by the caller to check
+	// who can write the upload and where it goes
+	Owner  string `json:"owner"`
+	Target string `json:"target"`
+
+	Length    int64             `json:"length"`
+	Metadata  map[string]string `json:"metadata"`
+	CreatedAt time.Time         `json:"created_at"`
+
+	// Result is set by the caller when the upload is finished.
+	// the bytes are removed and only the info is kept so the
+	// clients that lost the last response can see it is done
+	Result string `json:"result,omitempty"`
+
+	// Offset is the number of the bytes received so far
+	Offset int64 `json:"-"`
+}
+
+// Done tells if all the bytes of the upload are received
+func (u *Upload) Done() bool {
+	return u.Offset == u.Length
+}
+
+// FileStore keeps every upload in two files in the dir. the
+// info is a json file and the offset is the size of the data
+// file so the bytes written before a connection is cut count
+type FileStore struct {
+	dir string
+
+	mu    sync.Mutex
+	locks map[string]*sync.Mutex
+}
+
+// NewFileStore creates a FileStore that keeps the uploads in dir
+func NewFileStore(dir string) *FileStore {
+	return &FileStore{
+		dir:   dir,
+		locks: map[string]*sync.Mutex{},
+	}
+}
+
+// Create sets the id and the creation time of the
+// upload and saves it without any bytes
+func (fs *FileStore) Create(upload *Upload) error {
+	if err := os.MkdirAll(fs.dir, 0755); err != nil {
+		return err
+	}
+
+	id, err := newID()
+	if err != nil {
+		return err
+	}
+	upload.ID = id
+	upload.CreatedAt = time.Now().UTC()
+	upload.Offset = 0
+
+	data, err := os.OpenFile(fs.dataPath(id), os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	data.Close()
+	return fs.writeInfo(upload)
+}
+
+// Find returns the upload with the id and its current offset.
+// the info is replaced at once so it is read without the lock
+func (fs *FileStore) Find(id string) (*Upload, error) {
+	if !validID(id) {
+		return nil, ErrNotFound
+	}
+	return fs.find(id)
+}
+
+func (fs *FileStore) find(id string) (*Upload, error) {
+	content, err := os.ReadFile(fs.infoPath(id))
+	if os.IsNotExist(err) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	var upload Upload
+	if err := json.Unmarshal(content, &upload); err != nil {
+		return nil, err
+	}
+
+	if upload.Result != "" {
+		upload.Offset = upload.Length
+		return &upload, nil
+	}
+	info, err := os.Stat(fs.dataPath(id))
+	if err != nil {
+		return nil, err
+	}
+	upload.Offset = info.Size()
+	return &upload, nil
+}
+
+// Write appends the bytes of r to the upload if the offset is the
+// end of the bytes received so far. the bytes after the length of
+// the upload are not read. the upload with the new offset is
+// returned even if reading r fails
+func (fs *FileStore) Write(id string, offset int64, r io.Reader) (*Upload, error) {
+	if !validID(id) {
+		return nil, ErrNotFound
+	}
+	lock := fs.lock(id)
+	lock.Lock()
+	defer lock.Unlock()
+
+	upload, err := fs.find(id)
+	if err != nil {
+		return nil, err
+	}
+	if offset != upload.Offset || upload.Result != "" {
+		return upload, ErrOffsetMismatch
+	}
+
+	data, err := os.OpenFile(fs.dataPath(id), os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, err
+	}
+	n, err := io.Copy(data, io.LimitReader(r, upload.Length-upload.Offset))
+	upload.Offset += n
+	if closeErr := data.Close(); err == nil {
+		err = closeErr
+	}
+	return upload, err
+}
+
+// Open returns the reader of the received bytes
+func (fs *FileStore) Open(id string) (io.ReadCloser, error) {
+	if !validID(id) {
+		return nil, ErrNotFound
+	}
+	file, err := os.Open(fs.dataPath(id))
+	if os.IsNotExist(err) {
+		return nil, ErrNotFound
+	}
+	return file, err
+}
+
+// Finish removes the bytes of the upload and keeps its info with
+// the result so the upload is reported as done until it expires
+func (fs *FileStore) Finish(upload *Upload, result string) error {
+	lock := fs.lock(upload.ID)
+	lock.Lock()
+	defer lock.Unlock()
+
+	upload.Result = result
+	upload.Offset = upload.Length
+	if err := fs.writeInfo(upload); err != nil {
+		return err
+	}
+	if err := os.Remove(fs.dataPath(upload.ID)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// Delete removes the upload
+func (fs *FileStore) Delete(id string) error {
+	if !validID(id) {
+		return ErrNotFound
+	}
+	lock := fs.lock(id)
+	lock.Lock()
+	defer func() {
+		lock.Unlock()
+		fs.mu.Lock()
+		delete(fs.locks, id)
+		fs.mu.Unlock()
+	}()
+
+	err := os.Remove(fs.infoPath(id))
+	if os.IsNotExist(err) {
+		return ErrNotFound
+	}
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(fs.dataPath(id)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// Expired returns the ids of the uploads created before the time
+func (fs *FileStore) Expired(before time.Time) ([]string, error) {
+	entries, err := os.ReadDir(fs.dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	ids := []string{}
+	for _, entry := range entries {
+		id := strings.TrimSuffix(entry.Name(), ".info")
+		if id == entry.Name() || !validID(id) {
+			continue
+		}
+		upload, err := fs.Find(id)
+		if err != nil {
+			continue
+		}
+		if upload.CreatedAt.Before(before) {
+			ids = append(ids, id)
+		}
+	}
+	return ids, nil
+}
+
+func (fs *FileStore) writeInfo(upload *Upload) error {
+	content, err := json.Marshal(upload)
+	if err != nil {
+		return err
+	}
+
+	// the info is replaced at once so it is never read half written
+	tmp := fs.infoPath(upload.ID) + ".tmp"
+	if err := os.WriteFile(tmp, content, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, fs.infoPath(upload.ID))
+}
+
+// lock returns the lock of the upload so its
+// chunks are not written at the same time
+func (fs *FileStore) lock(id string) *sync.Mutex {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	lock, found := fs.locks[id]
+	if !found {
+		lock = &sync.Mutex{}
+		fs.locks[id] = lock
+	}
+	return lock
+}
+
+func (fs *FileStore) infoPath(id string) string {
+	return filepath.Join(fs.dir, id+".info")
+}
+
+func (fs *FileStore) dataPath(id string) string {
+	return filepath.Join(fs.dir, id+".bin")
+}
+
+// newID returns a random id that can not be guessed
+func newID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// validID tells if the id is made by newID so it
+// can be used in the paths of the files
+func validID(id string) bool {
+	if len(id) != 32 {
+		return false
+	}
+	_, err := hex.DecodeString(id)
+	return err == nil
+}
+
+// ParseMetadata parses the Upload-Metadata header. it is a comma
+// separated list of the keys and their base64 values. the value
+// can be left out
+func ParseMetadata(header string) (map[string]string, error) {
+	metadata := map[string]string{}
+	if strings.TrimSpace(header) == "" {
+		return metadata, nil
+	}
+
+	for _, pair := range strings.Split(header, ",") {
+		parts := strings.Fields(pair)
+		if len(parts) == 0 || len(parts) > 2 {
+			return nil, ErrInvalidMetadata
+		}
+		if _, found := metadata[parts[0]]; found {
+			return nil, ErrInvalidMetadata
+		}
+
+		value := ""
+		if len(parts) == 2 {
+			decoded, err := base64.StdEncoding.DecodeString(parts[1])
+			if err != nil {
+				return nil, ErrInvalidMetadata
+			}
+			value = string(decoded)
+		}
+		metadata[parts[0]] = value
+	}
+	return metadata, nil
+}
@@ -0,0 +1,117 @@
+package tus_test
+
+import (
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/abanoub-fathy/bebo-gallery/pkg/tus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// failingReader returns the content and then fails
+// like a request whose connection is cut
+type failingReader struct {
+	content io.Reader
+}
+
+func (r failingReader) Read(p []byte) (int, error) {
+	n, err := r.content.Read(p)
+	if err == io.EOF {
+		return n, errors.New("connection reset")
+	}
+	return n, err
+}
+
+func TestFileStore(t *testing.T) {
+	store := tus.NewFileStore(t.TempDir())
+
+	upload := &tus.Upload{Owner: "owner", Length: 10, Metadata: map[string]string{"filename": "cake.jpg"}}
+	require.NoError(t, store.Create(upload))
+	require.Len(t, upload.ID, 32)
+
+	found, err := store.Find(upload.ID)
+	require.NoError(t, err)
+	assert.Equal(t, int64(0), found.Offset)
+	assert.Equal(t, "cake.jpg", found.Metadata["filename"])
+	assert.False(t, found.Done())
+
+	// the bytes received before the connection is cut are kept
+	written, err := store.Write(upload.ID, 0, failingReader{strings.NewReader("0123")})
+	assert.Error(t, err)
+	assert.Equal(t, int64(4), written.Offset)
+
+	_, err = store.Write(upload.ID, 2, strings.NewReader("xx"))
+	assert.Equal(t, tus.ErrOffsetMismatch, err)
+
+	// the bytes after the length are not read
+	written, err = store.Write(upload.ID, 4, strings.NewReader("456789extra"))
+	require.NoError(t, err)
+	assert.True(t, written.Done())
+
+	file, err := store.Open(upload.ID)
+	require.NoError(t, err)
+	content, _ := io.ReadAll(file)
+	file.Close()
+	assert.Equal(t, "0123456789", string(content))
+
+	// the finished uploads are done without their bytes
+	require.NoError(t, store.Finish(written, "image-id"))
+	found, err = store.Find(upload.ID)
+	require.NoError(t, err)
+	assert.True(t, found.Done())
+	assert.Equal(t, "image-id", found.Result)
+	_, err = store.Open(upload.ID)
+	assert.Equal(t, tus.ErrNotFound, err)
+	_, err = store.Write(upload.ID, 10, strings.NewReader(""))
+	assert.Equal(t, tus.ErrOffsetMismatch, err)
+
+	require.NoError(t, store.Delete(upload.ID))
+	_, err = store.Find(upload.ID)
+	assert.Equal(t, tus.ErrNotFound, err)
+	assert.Equal(t, tus.ErrNotFound, store.Delete(upload.ID))
+
+	// the ids are never used as paths unless they are valid
+	_, err = store.Find("../" + upload.ID[3:])
+	assert.Equal(t, tus.ErrNotFound, err)
+}
+
+func TestFileStoreExpired(t *testing.T) {
+	store := tus.NewFileStore(t.TempDir())
+	ids, err := store.Expired(time.Now())
+	require.NoError(t, err)
+	assert.Empty(t, ids)
+
+	upload := &tus.Upload{Length: 1}
+	require.NoError(t, store.Create(upload))
+
+	ids, err = store.Expired(time.Now().Add(-time.Hour))
+	require.NoError(t, err)
+	assert.Empty(t, ids)
+	ids, err = store.Expired(time.Now().Add(time.Second))
+	require.NoError(t, err)
+	assert.Equal(t, []string{upload.ID}, ids)
+
+	// the store without a dir has no uploads
+	ids, err = tus.NewFileStore(t.TempDir() + "/missing").Expired(time.Now())
+	require.NoError(t, err)
+	assert.Empty(t, ids)
+}
+
+func TestParseMetadata(t *testing.T) {
+	metadata, err := tus.ParseMetadata("filename Y2FrZS5qcGc=, is_confidential,filetype aW1hZ2UvanBlZw==")
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"filename": "cake.jpg", "is_confidential": "", "filetype": "image/jpeg"}, metadata)
+
+	metadata, err = tus.ParseMetadata("")
+	require.NoError(t, err)
+	assert.Empty(t, metadata)
+
+	for _, header := range []string{"filename not-base64!", "a b c", "a,,b", "a YQ==,a Yg=="} {
+		_, err := tus.ParseMetadata(header)
+		assert.Equal(t, tus.ErrInvalidMetadata, err, header)
+	}
+}
@@ -0,0 +1,234 @@
+package zipimport
+
+import (
+	"archive/zip"
+	"crypto/rand"
+	"encoding/hex"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// keepFinished is how long the finished jobs are kept
+// so their progress pages can still be opened
+const keepFinished = time.Hour
+
+// ImportFunc saves a file of the archive with the name
+type ImportFunc func(name string, r io.Reader) error
+
+// Progress is the state of an import at some time
+type Progress struct {
+	// Total is the number of the files that are checked
+	Total int
+
+	Accepted []string
+	Rejected []Rejection
+
+	Done       bool
+	FinishedAt time.Time
+}
+
+// Processed is the number of the accepted and the rejected files
+func (p Progress) Processed() int {
+	return len(p.Accepted) + len(p.Rejected)
+}
+
+// Percent is the processed files out of 100
+func (p Progress) Percent() int {
+	if p.Total == 0 {
+		return 100
+	}
+	return p.Processed() * 100 / p.Total
+}
+
+// Job is an import that runs in the background
+type Job struct {
+	ID string
+
+	// Owner and Target are set by the caller to
+	// check who can see the job and where it imports
+	Owner  string
+	Target string
+
+	mu       sync.RWMutex
+	progress Progress
+	done     chan struct{}
+}
+
+// Progress returns a copy of the current progress
+func (j *Job) Progress() Progress {
+	j.mu.RLock()
+	defer j.mu.RUnlock()
+
+	progress := j.progress
+	progress.Accepted = append([]string{}, j.progress.Accepted...)
+	progress.Rejected = append([]Rejection{}, j.progress.Rejected...)
+	return progress
+}
+
+// Done is closed when the job is finished
+func (j *Job) Done() <-chan struct{} {
+	return j.done
+}
+
+func (j *Job) accept(name string) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.progress.Accepted = append(j.progress.Accepted, name)
+}
+
+func (j *Job) reject(rejection Rejection) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.progress.Rejected = append(j.progress.Rejected, rejection)
+}
+
+func (j *Job) finish(now time.Time) {
+	j.mu.Lock()
+	j.progress.Done = true
+	j.progress.FinishedAt = now
+	j.mu.Unlock()
+	close(j.done)
+}
+
+// run imports the entries one after the other
+func (j *Job) run(entries []Entry, fn ImportFunc) {
+	for _, entry := range entries {
+		if reason := importEntry(entry, fn); reason != "" {
+			j.reject(Rejection{Name: entry.file.Name, Reason: reason})
+			continue
+		}
+		j.accept(entry.Name)
+	}
+}
+
+// importEntry returns the reason the entry is rejected
+// or an empty string if it is imported
+func importEntry(entry Entry, fn ImportFunc) string {
+	r, err := entry.open()
+	if err != nil {
+		return ReasonDamaged
+	}
+	defer r.Close()
+
+	if err := fn(entry.Name, r); err != nil {
+		if r.err != nil {
+			return ReasonDamaged
+		}
+		return ReasonNotSaved
+	}
+	return ""
+}
+
+// Importer runs the imports and keeps their jobs in memory so
+// every replica of the app knows only its own jobs. a few jobs
+// run at the same time and the others wait for their turn
+type Importer struct {
+	limits Limits
+	slots  chan struct{}
+
+	mu   sync.Mutex
+	jobs map[string]*Job
+
+	// now is replaced by the tests
+	now func() time.Time
+}
+
+// NewImporter creates an Importer that runs the workers
+// number of jobs at the same time
+func NewImporter(limits Limits, workers int) *Importer {
+	return &Importer{
+		limits: limits,
+		slots:  make(chan struct{}, workers),
+		jobs:   map[string]*Job{},
+		now:    time.Now,
+	}
+}
+
+// Start scans the archive in the file with the name and imports
+// its entries with fn in the background. the file is owned by the
+// importer and it is removed when the job is finished or when the
+// archive is rejected
+func (im *Importer) Start(name, owner, target string, fn ImportFunc) (*Job, error) {
+	archive, err := zip.OpenReader(name)
+	if err != nil {
+		os.Remove(name)
+		return nil, ErrNotZip
+	}
+
+	entries, rejected, err := Scan(&archive.Reader, im.limits)
+	if err != nil {
+		archive.Close()
+		os.Remove(name)
+		return nil, err
+	}
+	id, err := newJobID()
+	if err != nil {
+		archive.Close()
+		os.Remove(name)
+		return nil, err
+	}
+
+	job := &Job{
+		ID:     id,
+		Owner:  owner,
+		Target: target,
+		done:   make(chan struct{}),
+		progress: Progress{
+			Total:    len(entries) + len(rejected),
+			Rejected: rejected,
+		},
+	}
+	im.add(job)
+	go im.run(job, archive, name, entries, fn)
+	return job, nil
+}
+
+// run waits for a free slot and runs the job
+func (im *Importer) run(job *Job, archive *zip.ReadCloser, name string, entries []Entry, fn ImportFunc) {
+	im.slots <- struct{}{}
+	job.run(entries, fn)
+	<-im.slots
+
+	archive.Close()
+	os.Remove(name)
+	job.finish(im.now())
+}
+
+// Find returns the job with the id
+func (im *Importer) Find(id string) (*Job, bool) {
+	im.mu.Lock()
+	defer im.mu.Unlock()
+
+	im.prune()
+	job, found := im.jobs[id]
+	return job, found
+}
+
+func (im *Importer) add(job *Job) {
+	im.mu.Lock()
+	defer im.mu.Unlock()
+
+	im.prune()
+	im.jobs[job.ID] = job
+}
+
+// prune removes the jobs that finished long ago
+func (im *Importer) prune() {
+	for id, job := range im.jobs {
+		progress := job.Progress()
+		if progress.Done && im.now().Sub(progress.FinishedAt) > keepFinished {
+			delete(im.jobs, id)
+		}
+	}
+}
+
+// newJobID returns a random id that can not be guessed
+func newJobID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,201 @@
+// Package zipimport unpacks the images of the uploaded zip
+// archives in the background and keeps the progress of the
+// imports so it can be shown while they run
+package zipimport
+
+import (
+	"archive/zip"
+	"errors"
+	"io"
+	"path"
+	"strings"
+)
+
+var (
+	// ErrNotZip is returned when the archive can not be read
+	ErrNotZip = errors.New("the file is not a zip archive")
+
+	// ErrTooManyFiles is returned when the archive
+	// has more files than the limit
+	ErrTooManyFiles = errors.New("the zip archive has too many files")
+
+	// ErrTooLarge is returned when the files of the
+	// archive are too large after they are unpacked
+	ErrTooLarge = errors.New("the zip archive is too large when it is unpacked")
+
+	// errSizeMismatch is returned when an entry has
+	// more bytes than its header says
+	errSizeMismatch = errors.New("zipimport: the entry is larger than its header")
+)
+
+// the reasons the files are rejected for
+const (
+	ReasonUnsafePath  = "the path is outside of the archive"
+	ReasonNotRegular  = "it is not a regular file"
+	ReasonNotImage    = "it is not an image"
+	ReasonTooLarge    = "the file is too large"
+	ReasonCompression = "the file is compressed too much"
+	ReasonDuplicate   = "another file has the same name"
+	ReasonDamaged     = "the file is damaged"
+	ReasonNotSaved    = "the file could not be saved"
+)
+
+// imageExts are the extensions of the files that are imported.
+// the raw formats of the cameras are images too
+var imageExts = map[string]bool{
+	".jpg": true, ".jpeg": true, ".png": true, ".gif": true,
+	".webp": true, ".bmp": true, ".tif": true, ".tiff": true,
+	".heic": true, ".heif": true, ".avif": true,
+	".cr2": true, ".cr3": true, ".nef": true, ".arw": true,
+	".dng": true, ".raf": true, ".orf": true, ".rw2": true,
+}
+
+// Limits guard against the zip bombs. the sizes are the
+// sizes in the headers and the reads are stopped when an
+// entry has more bytes than its header says
+type Limits struct {
+	// MaxFiles is the max number of files in the archive
+	MaxFiles int
+
+	// MaxFileBytes is the max unpacked size of a file
+	MaxFileBytes int64
+
+	// MaxTotalBytes is the max unpacked size of all the files
+	MaxTotalBytes int64
+
+	// MaxRatio is the max unpacked size of a file
+	// divided by its compressed size
+	MaxRatio int64
+}
+
+// Entry is a file of the archive that passed the checks
+type Entry struct {
+	// Name is the base name the file is imported as
+	Name string
+
+	file *zip.File
+}
+
+// Rejection is a file that is not imported and the reason
+type Rejection struct {
+	Name   string
+	Reason string
+}
+
+// Scan checks the files of the archive against the limits before
+// anything is unpacked. the directories, the hidden files and the
+// metadata of the macOS archiver are skipped. an error is returned
+// if the whole archive is rejected
+func Scan(archive *zip.Reader, limits Limits) ([]Entry, []Rejection, error) {
+	files := 0
+	for _, file := range archive.File {
+		if !file.FileInfo().IsDir() {
+			files++
+		}
+	}
+	if files > limits.MaxFiles {
+		return nil, nil, ErrTooManyFiles
+	}
+
+	entries := []Entry{}
+	rejected := []Rejection{}
+	names := map[string]bool{}
+	var total uint64
+	for _, file := range archive.File {
+		if file.FileInfo().IsDir() {
+			continue
+		}
+
+		name, ok := entryName(file.Name)
+		if !ok {
+			rejected = append(rejected, Rejection{Name: file.Name, Reason: ReasonUnsafePath})
+			continue
+		}
+		if skipped(file.Name, name) {
+			continue
+		}
+
+		reason := ""
+		switch {
+		case !file.Mode().IsRegular():
+			reason = ReasonNotRegular
+		case !imageExts[strings.ToLower(path.Ext(name))]:
+			reason = ReasonNotImage
+		case file.UncompressedSize64 > uint64(limits.MaxFileBytes):
+			reason = ReasonTooLarge
+		case file.UncompressedSize64 > file.CompressedSize64*uint64(limits.MaxRatio):
+			reason = ReasonCompression
+		case names[name]:
+			reason = ReasonDuplicate
+		}
+		if reason != "" {
+			rejected = append(rejected, Rejection{Name: file.Name, Reason: reason})
+			continue
+		}
+
+		total += file.UncompressedSize64
+		if total > uint64(limits.MaxTotalBytes) {
+			return nil, nil, ErrTooLarge
+		}
+		names[name] = true
+		entries = append(entries, Entry{Name: name, file: file})
+	}
+	return entries, rejected, nil
+}
+
+// entryName returns the base name of the file. it is not ok if
+// the path is absolute or it goes up out of the archive since
+// such archives are made to overwrite the files of the server
+func entryName(name string) (string, bool) {
+	name = strings.ReplaceAll(name, `\`, "/")
+	if path.IsAbs(name) || (len(name) > 1 && name[1] == ':') {
+		return "", false
+	}
+	for _, part := range strings.Split(name, "/") {
+		if part == ".." {
+			return "", false
+		}
+	}
+	return path.Base(path.Clean(name)), true
+}
+
+// skipped tells if the file is a hidden file or the metadata
+// added by the macOS archiver that nobody wants imported
+func skipped(fullName, name string) bool {
+	return strings.HasPrefix(name, ".") || strings.HasPrefix(fullName, "__MACOSX/")
+}
+
+// open returns the reader of the unpacked file
+func (e Entry) open() (*entryReader, error) {
+	file, err := e.file.Open()
+	if err != nil {
+		return nil, err
+	}
+	return &entryReader{r: file, size: int64(e.file.UncompressedSize64)}, nil
+}
+
+// entryReader fails when the file has more bytes than its header
+// says and it keeps the read error so the damaged files can be
+// told apart from the files that could not be saved
+type entryReader struct {
+	r    io.ReadCloser
+	size int64
+	read int64
+	err  error
+}
+
+func (er *entryReader) Read(p []byte) (int, error) {
+	n, err := er.r.Read(p)
+	er.read += int64(n)
+	if er.read > er.size {
+		err = errSizeMismatch
+	}
+	if err != nil && err != io.EOF {
+		er.err = err
+	}
+	return n, err
+}
+
+func (er *entryReader) Close() error {
+	return er.r.Close()
+}
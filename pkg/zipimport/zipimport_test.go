@@ -0,0 +1,234 @@
+package zipimport
+
+import (
+	"archive/zip"
+	"bytes"
+	"errors"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var testLimits = Limits{MaxFiles: 20, MaxFileBytes: 1000, MaxTotalBytes: 5000, MaxRatio: 10}
+
+// testFile is a file of the test archives
+type testFile struct {
+	name string
+	body string
+	mode os.FileMode
+}
+
+// newZip returns the zip of the files. the image bodies are
+// random looking so they are not compressed much
+func newZip(t *testing.T, files ...testFile) []byte {
+	var b bytes.Buffer
+	w := zip.NewWriter(&b)
+	for _, file := range files {
+		header := &zip.FileHeader{Name: file.name, Method: zip.Deflate}
+		if file.mode != 0 {
+			header.SetMode(file.mode)
+		}
+		entry, err := w.CreateHeader(header)
+		require.NoError(t, err)
+		_, err = entry.Write([]byte(file.body))
+		require.NoError(t, err)
+	}
+	require.NoError(t, w.Close())
+	return b.Bytes()
+}
+
+// image returns a body that does not compress
+func image(seed string) string {
+	var b strings.Builder
+	for i := 0; b.Len() < 200; i++ {
+		b.WriteString(seed)
+		b.WriteByte(byte(crc32.ChecksumIEEE([]byte{byte(i)})))
+	}
+	return b.String()
+}
+
+func scan(t *testing.T, data []byte) ([]Entry, []Rejection, error) {
+	archive, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	require.NoError(t, err)
+	return Scan(archive, testLimits)
+}
+
+func TestScan(t *testing.T) {
+	data := newZip(t,
+		testFile{name: "trip/"},
+		testFile{name: "trip/beach.jpg", body: image("beach")},
+		testFile{name: "trip/sea.PNG", body: image("sea")},
+		testFile{name: "other/beach.jpg", body: image("other")},
+		testFile{name: "../../etc/evil.jpg", body: image("evil")},
+		testFile{name: "/root/evil.jpg", body: image("evil")},
+		testFile{name: `C:\evil.jpg`, body: image("evil")},
+		testFile{name: "notes.txt", body: "notes"},
+		testFile{name: "link.jpg", body: "/etc/passwd", mode: os.ModeSymlink | 0777},
+		testFile{name: "zeros.jpg", body: strings.Repeat("0", 900)},
+		testFile{name: "huge.raw.dng", body: image("huge") + image("huge2") + image("huge3") + image("huge4") + image("huge5") + image("huge6")},
+		testFile{name: "__MACOSX/trip/._beach.jpg", body: "meta"},
+		testFile{name: "trip/.DS_Store", body: "meta"},
+	)
+
+	entries, rejected, err := scan(t, data)
+	require.NoError(t, err)
+
+	names := []string{}
+	for _, entry := range entries {
+		names = append(names, entry.Name)
+	}
+	assert.Equal(t, []string{"beach.jpg", "sea.PNG"}, names)
+	assert.Equal(t, []Rejection{
+		{"other/beach.jpg", ReasonDuplicate},
+		{"../../etc/evil.jpg", ReasonUnsafePath},
+		{"/root/evil.jpg", ReasonUnsafePath},
+		{`C:\evil.jpg`, ReasonUnsafePath},
+		{"notes.txt", ReasonNotImage},
+		{"link.jpg", ReasonNotRegular},
+		{"zeros.jpg", ReasonCompression},
+		{"huge.raw.dng", ReasonTooLarge},
+	}, rejected)
+}
+
+func TestScanLimits(t *testing.T) {
+	files := []testFile{}
+	for i := 0; i < 21; i++ {
+		files = append(files, testFile{name: strings.Repeat("a", i+1) + ".jpg", body: image("a")})
+	}
+	_, _, err := scan(t, newZip(t, files...))
+	assert.Equal(t, ErrTooManyFiles, err)
+
+	// every file is under the limit but all of them are not
+	_, _, err = scan(t, newZip(t, files[:20]...))
+	assert.NoError(t, err)
+	for i := range files {
+		files[i].body = image(files[i].name) + image("b")
+	}
+	_, _, err = scan(t, newZip(t, files[:20]...))
+	assert.Equal(t, ErrTooLarge, err)
+}
+
+// writeTemp writes the data to a temp file and returns its name
+func writeTemp(t *testing.T, data []byte) string {
+	name := filepath.Join(t.TempDir(), "archive.zip")
+	require.NoError(t, os.WriteFile(name, data, 0600))
+	return name
+}
+
+func wait(t *testing.T, job *Job) Progress {
+	select {
+	case <-job.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("the job did not finish")
+	}
+	return job.Progress()
+}
+
+func TestImporter(t *testing.T) {
+	importer := NewImporter(testLimits, 1)
+	name := writeTemp(t, newZip(t,
+		testFile{name: "a.jpg", body: image("a")},
+		testFile{name: "b.jpg", body: image("b")},
+		testFile{name: "c.jpg", body: image("c")},
+		testFile{name: "notes.txt", body: "notes"},
+	))
+
+	saved := map[string]string{}
+	job, err := importer.Start(name, "owner", "target", func(name string, r io.Reader) error {
+		body, err := io.ReadAll(r)
+		if err != nil {
+			return err
+		}
+		if name == "b.jpg" {
+			return errors.New("disk is full")
+		}
+		saved[name] = string(body)
+		return nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "owner", job.Owner)
+	assert.Equal(t, "target", job.Target)
+
+	progress := wait(t, job)
+	assert.True(t, progress.Done)
+	assert.Equal(t, 4, progress.Total)
+	assert.Equal(t, 100, progress.Percent())
+	assert.Equal(t, []string{"a.jpg", "c.jpg"}, progress.Accepted)
+	assert.Equal(t, []Rejection{{"notes.txt", ReasonNotImage}, {"b.jpg", ReasonNotSaved}}, progress.Rejected)
+	assert.Equal(t, image("a"), saved["a.jpg"])
+
+	// the archive is removed when the job is finished
+	_, err = os.Stat(name)
+	assert.True(t, os.IsNotExist(err))
+
+	found, ok := importer.Find(job.ID)
+	assert.True(t, ok)
+	assert.Equal(t, job, found)
+	_, ok = importer.Find("unknown")
+	assert.False(t, ok)
+
+	// the finished jobs are removed after a while
+	importer.now = func() time.Time { return time.Now().Add(2 * keepFinished) }
+	_, ok = importer.Find(job.ID)
+	assert.False(t, ok)
+}
+
+func TestImporterDamagedEntry(t *testing.T) {
+	// the header says the file is shorter than it is
+	var b bytes.Buffer
+	w := zip.NewWriter(&b)
+	body := []byte(image("lying"))
+	entry, err := w.CreateRaw(&zip.FileHeader{
+		Name:               "lying.jpg",
+		Method:             zip.Store,
+		CRC32:              crc32.ChecksumIEEE(body[:10]),
+		CompressedSize64:   uint64(len(body)),
+		UncompressedSize64: 10,
+	})
+	require.NoError(t, err)
+	_, err = entry.Write(body)
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+
+	importer := NewImporter(testLimits, 1)
+	read := 0
+	job, err := importer.Start(writeTemp(t, b.Bytes()), "owner", "target", func(name string, r io.Reader) error {
+		body, err := io.ReadAll(r)
+		read = len(body)
+		return err
+	})
+	require.NoError(t, err)
+
+	progress := wait(t, job)
+	assert.Empty(t, progress.Accepted)
+	assert.Equal(t, []Rejection{{"lying.jpg", ReasonDamaged}}, progress.Rejected)
+	assert.LessOrEqual(t, read, 10)
+}
+
+func TestImporterRejectsArchive(t *testing.T) {
+	importer := NewImporter(testLimits, 1)
+	noop := func(name string, r io.Reader) error { return nil }
+
+	name := writeTemp(t, []byte("not a zip"))
+	_, err := importer.Start(name, "owner", "target", noop)
+	assert.Equal(t, ErrNotZip, err)
+	_, statErr := os.Stat(name)
+	assert.True(t, os.IsNotExist(statErr))
+
+	files := []testFile{}
+	for i := 0; i < 21; i++ {
+		files = append(files, testFile{name: strings.Repeat("a", i+1) + ".jpg", body: image("a")})
+	}
+	name = writeTemp(t, newZip(t, files...))
+	_, err = importer.Start(name, "owner", "target", noop)
+	assert.Equal(t, ErrTooManyFiles, err)
+	_, statErr = os.Stat(name)
+	assert.True(t, os.IsNotExist(statErr))
+}
@@ -0,0 +1,271 @@
+package router
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/abanoub-fathy/bebo-gallery/config"
+	"github.com/abanoub-fathy/bebo-gallery/controllers"
+	"github.com/abanoub-fathy/bebo-gallery/middlewares"
+	"github.com/abanoub-fathy/bebo-gallery/model"
+	"github.com/abanoub-fathy/bebo-gallery/pkg/email"
+	"github.com/abanoub-fathy/bebo-gallery/pkg/ratelimit"
+	"github.com/abanoub-fathy/bebo-gallery/pkg/tus"
+	"github.com/gorilla/csrf"
+	"github.com/gorilla/mux"
+)
+
+// New creates the http handler of the app with all
+// the routes and the middlewares applied to them
+func New(service *model.Service, mailer *email.Mailer, cfg *config.Config) http.Handler {
+	// creat middleware
+	requireUserMiddleWare := middlewares.RequireUser{
+		Service: service,
+	}
+
+	userMiddleWare := middlewares.UserMiddleware{
+		Service: service,
+	}
+
+	// the uploads of the website and the api share their limit
+	rateLimitStore := newRateLimitStore(service, cfg)
+	uploadsRateLimit := middlewares.RateLimit{
+		Store:  rateLimitStore,
+		Policy: ratePolicy(cfg.RateLimits.Uploads),
+		Name:   "uploads",
+	}
+	apiRateLimit := middlewares.RateLimit{
+		Store:  rateLimitStore,
+		Policy: ratePolicy(cfg.RateLimits.API),
+		Name:   "api",
+		Key:    middlewares.KeyByAccessToken,
+	}
+
+	// set router
+	r := mux.NewRouter()
+
+	// serve static assets
+	assetsServerHandler := http.FileServer(noDirFS{http.Dir("./views/assets/")})
+	r.PathPrefix("/assets/").Handler(http.StripPrefix("/assets/", assetsServerHandler))
+
+	// create StaticController
+	staticController := controllers.NewStatic()
+
+	// static routes
+	r.Handle("/contact", staticController.Contact).Methods("GET")
+	r.NotFoundHandler = staticController.NotFound
+
+	// create new user controller
+	userController := controllers.NewUser(service.UserService, r, mailer)
+
+	// user routes
+	r.HandleFunc("/signup", userController.NewUser).Methods("GET")
+	r.HandleFunc("/new", userController.CreateNewUser).Methods("POST")
+	r.HandleFunc("/login", userController.LoginPage).Methods("GET")
+	r.HandleFunc("/login", userController.Login).Methods("POST")
+	r.HandleFunc("/login/link", userController.SendLoginLink).Methods("POST")
+	r.HandleFunc("/login/link", userController.LoginLinkPage).Methods("GET")
+	r.HandleFunc("/login/link/confirm", userController.LoginWithLink).Methods("POST")
+	r.HandleFunc("/password/forget", userController.ForgetPasswordPage).Methods("GET")
+	r.HandleFunc("/password/forget", userController.ForgetPassword).Methods("POST")
+	r.HandleFunc("/password/reset", userController.ResetPasswordPage).Methods("GET")
+	r.HandleFunc("/password/reset", userController.ResetPassword).Methods("POST")
+	r.HandleFunc("/logout", requireUserMiddleWare.ApplyFunc(userController.Logout)).Methods("POST")
+
+	// create gallery controllers
+	galleryController := controllers.NewGallery(service.GalleryService, service.ImageService, service.TagService, service.ShareLinkService, r, cfg.Limits)
+
+	// gallery routes
+	r.Handle("/galleries/new", requireUserMiddleWare.Apply(galleryController.CreateGalleryView)).Methods("GET").Name(controllers.ViewCreateGalleryEndpoint)
+	r.HandleFunc("/galleries/{galleryID}", galleryController.ViewGallery).Methods("GET").Name(controllers.ViewGalleryEndpoint)
+	r.HandleFunc("/galleries", requireUserMiddleWare.ApplyFunc(galleryController.CreateNewGallery)).Methods("POST")
+	r.HandleFunc("/galleries", requireUserMiddleWare.ApplyFunc(galleryController.ShowUserGalleriesPage)).Methods("GET").Name(controllers.ViewGalleriesEndpoint)
+	r.HandleFunc("/galleries/{galleryID}/edit", requireUserMiddleWare.ApplyFunc(galleryController.EditGalleryPage)).Methods("GET").Name(controllers.EditGalleryPageEndpoint)
+	r.HandleFunc("/galleries/{galleryID}/edit", requireUserMiddleWare.ApplyFunc(galleryController.EditGallery)).Methods("POST")
+	r.HandleFunc("/galleries/{galleryID}/images", requireUserMiddleWare.ApplyFunc(uploadsRateLimit.ApplyFunc(galleryController.UploadImage))).Methods("POST")
+	r.HandleFunc("/galleries/{galleryID}/import", requireUserMiddleWare.ApplyFunc(uploadsRateLimit.ApplyFunc(galleryController.ImportImages))).Methods("POST")
+	r.HandleFunc("/galleries/{galleryID}/imports/{jobID}", requireUserMiddleWare.ApplyFunc(galleryController.ImportProgress)).Methods("GET")
+	r.HandleFunc("/galleries/{galleryID}/images/details", requireUserMiddleWare.ApplyFunc(galleryController.EditImagesPage)).Methods("GET")
+	r.HandleFunc("/galleries/{galleryID}/images/details", requireUserMiddleWare.ApplyFunc(galleryController.UpdateImages)).Methods("POST")
+	r.HandleFunc("/galleries/{galleryID}/images/{imageID:[0-9a-fA-F-]{36}}", galleryController.ViewImage).Methods("GET")
+	r.HandleFunc("/galleries/{galleryID}/download", galleryController.DownloadImages).Methods("GET")
+	r.HandleFunc("/images/galleries/{galleryID}/{fileName}", galleryController.ServeImage).Methods("GET")
+	r.HandleFunc("/galleries/{galleryID}/images/tags", requireUserMiddleWare.ApplyFunc(galleryController.TagImages)).Methods("POST")
+	r.HandleFunc("/galleries/{galleryID}/images/order", requireUserMiddleWare.ApplyFunc(galleryController.ReorderImages)).Methods("POST")
+	r.HandleFunc("/galleries/{galleryID}/cover", requireUserMiddleWare.ApplyFunc(galleryController.SetCover)).Methods("POST")
+	r.HandleFunc("/galleries/{galleryID}/images/{fileName}/delete", requireUserMiddleWare.ApplyFunc(galleryController.DeleteImage)).Methods("POST")
+	r.HandleFunc("/galleries/{galleryID}/delete", requireUserMiddleWare.ApplyFunc(galleryController.DeleteGallery)).Methods("POST")
+	r.HandleFunc("/galleries/{galleryID}/share", requireUserMiddleWare.ApplyFunc(galleryController.SharePage)).Methods("GET")
+	r.HandleFunc("/galleries/{galleryID}/share", requireUserMiddleWare.ApplyFunc(galleryController.CreateShareLink)).Methods("POST")
+	r.HandleFunc("/galleries/{galleryID}/share/{linkID}/delete", requireUserMiddleWare.ApplyFunc(galleryController.DeleteShareLink)).Methods("POST")
+	r.HandleFunc("/tags/{tag}", galleryController.ViewTag).Methods("GET")
+
+	// create search controller
+	searchController := controllers.NewSearch(service.SearchService, service.ImageService, service.TagService)
+
+	// search routes
+	r.HandleFunc("/search", searchController.SearchPage).Methods("GET")
+
+	// create explore controller
+	exploreController := controllers.NewExplore(service.UserService, service.GalleryService, service.ImageService, service.TagService)
+
+	// explore routes
+	r.HandleFunc("/", exploreController.Home).Methods("GET")
+	r.HandleFunc("/u/{handle}", exploreController.Profile).Methods("GET")
+
+	// create oidc controller
+	oidcController := controllers.NewOIDC(service, cfg, r)
+	userController.LoginProviders = oidcController.LoginProviders()
+
+	// oidc routes
+	r.HandleFunc("/auth/{provider}/login", oidcController.Login).Methods("GET")
+	r.HandleFunc("/auth/{provider}/callback", oidcController.Callback).Methods("GET")
+	r.HandleFunc("/account/identities/{identityID}/disconnect", requireUserMiddleWare.ApplyFunc(oidcController.Disconnect)).Methods("POST")
+
+	// create account controller
+	accountController := controllers.NewAccount(service.AccessTokenService, service.IdentityService, r)
+	accountController.LoginProviders = oidcController.LoginProviders()
+
+	// account routes
+	r.HandleFunc("/account", requireUserMiddleWare.ApplyFunc(accountController.ShowAccountPage)).Methods("GET").Name(controllers.ViewAccountEndpoint)
+	r.HandleFunc("/account/tokens", requireUserMiddleWare.ApplyFunc(accountController.CreateAccessToken)).Methods("POST")
+	r.HandleFunc("/account/tokens/{tokenID}/revoke", requireUserMiddleWare.ApplyFunc(accountController.RevokeAccessToken)).Methods("POST")
+
+	// create oauth controller
+	oauthController := controllers.NewOAuth(service, r)
+
+	// oauth routes
+	r.HandleFunc("/oauth/apps", requireUserMiddleWare.ApplyFunc(oauthController.ShowAppsPage)).Methods("GET").Name(controllers.ViewOAuthAppsEndpoint)
+	r.HandleFunc("/oauth/apps", requireUserMiddleWare.ApplyFunc(oauthController.CreateApp)).Methods("POST")
+	r.HandleFunc("/oauth/apps/{appID}/delete", requireUserMiddleWare.ApplyFunc(oauthController.DeleteApp)).Methods("POST")
+	r.HandleFunc("/oauth/authorize", requireUserMiddleWare.ApplyFunc(oauthController.Authorize)).Methods("GET")
+	r.HandleFunc("/oauth/authorize", requireUserMiddleWare.ApplyFunc(oauthController.Approve)).Methods("POST")
+	r.HandleFunc("/oauth/token", oauthController.Token).Methods("POST")
+	r.HandleFunc("/oauth/revoke", oauthController.Revoke).Methods("POST")
+	r.HandleFunc("/oauth/introspect", oauthController.Introspect).Methods("POST")
+
+	// create api controller
+	apiController := controllers.NewAPI(service.GalleryService, service.ImageService, service.TagService, service.SearchService, service.AccessTokenService, cfg.Limits)
+	apiController.Uploads = tus.NewFileStore(cfg.Storage.UploadsDir)
+
+	// the tus clients discover the server without authentication
+	r.HandleFunc("/api/v1/galleries/{galleryID}/uploads", apiController.UploadOptions).Methods("OPTIONS")
+	r.HandleFunc("/api/v1/galleries/{galleryID}/uploads/{uploadID}", apiController.UploadOptions).Methods("OPTIONS")
+
+	// api routes
+	requireAPIUserMiddleWare := middlewares.RequireAPIUser{}
+	r.HandleFunc("/api/v1/openapi.yaml", apiController.OpenAPISpec).Methods("GET")
+	api := r.PathPrefix("/api/v1").Subrouter()
+	api.Use(requireAPIUserMiddleWare.Apply)
+	api.Use(apiRateLimit.Apply)
+	api.HandleFunc("/me", apiController.Me).Methods("GET")
+	api.HandleFunc("/galleries", apiController.ListGalleries).Methods("GET")
+	api.HandleFunc("/galleries", apiController.CreateGallery).Methods("POST")
+	api.HandleFunc("/galleries/{galleryID}", apiController.GetGallery).Methods("GET")
+	api.HandleFunc("/galleries/{galleryID}", apiController.UpdateGallery).Methods("PATCH")
+	api.HandleFunc("/galleries/{galleryID}", apiController.DeleteGallery).Methods("DELETE")
+	api.HandleFunc("/galleries/{galleryID}/images", apiController.ListImages).Methods("GET")
+	api.HandleFunc("/galleries/{galleryID}/images", uploadsRateLimit.ApplyFunc(apiController.UploadImages)).Methods("POST")
+	api.HandleFunc("/galleries/{galleryID}/images", apiController.UpdateImages).Methods("PATCH")
+	api.HandleFunc("/galleries/{galleryID}/images/tags", apiController.TagImages).Methods("POST")
+	api.HandleFunc("/galleries/{galleryID}/images/order", apiController.ReorderImages).Methods("PUT")
+	api.HandleFunc("/galleries/{galleryID}/images/{fileName}", apiController.DeleteImage).Methods("DELETE")
+	api.HandleFunc("/galleries/{galleryID}/uploads", uploadsRateLimit.ApplyFunc(apiController.CreateUpload)).Methods("POST")
+	api.HandleFunc("/galleries/{galleryID}/uploads/{uploadID}", apiController.UploadOffset).Methods("HEAD")
+	api.HandleFunc("/galleries/{galleryID}/uploads/{uploadID}", apiController.WriteUpload).Methods("PATCH")
+	api.HandleFunc("/galleries/{galleryID}/uploads/{uploadID}", apiController.TerminateUpload).Methods("DELETE")
+	api.HandleFunc("/tags", apiController.SuggestTags).Methods("GET")
+	api.HandleFunc("/tags/{tag}", apiController.GetTag).Methods("GET")
+	api.HandleFunc("/search", apiController.Search).Methods("GET")
+
+	// the tokens api needs the admin scope
+	requireAPIAdminMiddleWare := middlewares.RequireAPIUser{Scope: model.ScopeAdmin}
+	tokensAPI := api.PathPrefix("/tokens").Subrouter()
+	tokensAPI.Use(requireAPIAdminMiddleWare.Apply)
+	tokensAPI.HandleFunc("", apiController.ListAccessTokens).Methods("GET")
+	tokensAPI.HandleFunc("/{tokenID}", apiController.RevokeAccessToken).Methods("DELETE")
+
+	// CSRF Protection
+	CSRF := csrf.Protect(
+		[]byte(cfg.Security.CSRFKey),
+		csrf.Secure(cfg.IsProductionEnv),
+		csrf.ErrorHandler(http.HandlerFunc(csrfErrorHandler)),
+	)
+
+	// the access tokens are checked before the csrf
+	// middleware because their requests skip the check
+	return skipOAuthCSRF(userMiddleWare.AccessTokenApply(CSRF(userMiddleWare.UserInCtxApply(r))))
+}
+
+// newRateLimitStore returns the store of the rate limits chosen
+// by the configurations. it falls back to the memory store if
+// the service has no database
+func newRateLimitStore(service *model.Service, cfg *config.Config) ratelimit.Store {
+	if cfg.RateLimits.Store == "database" {
+		store, err := service.RateLimitStore()
+		if err == nil {
+			return store
+		}
+		fmt.Println("error while creating the database rate limit store", err)
+	}
+	return ratelimit.NewMemoryStore()
+}
+
+// ratePolicy converts the rate limit configurations to a policy
+func ratePolicy(rl config.RateLimit) ratelimit.Policy {
+	return ratelimit.Policy{
+		Algorithm: ratelimit.Algorithm(rl.Algorithm),
+		Limit:     rl.Limit,
+		Window:    time.Duration(rl.WindowSeconds) * time.Second,
+	}
+}
+
+// noDirFS refuses to open the directories so
+// the file servers do not list them
+type noDirFS struct {
+	http.FileSystem
+}
+
+func (fs noDirFS) Open(name string) (http.File, error) {
+	file, err := fs.FileSystem.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	if info.IsDir() {
+		file.Close()
+		return nil, os.ErrNotExist
+	}
+	return file, nil
+}
+
+// skipOAuthCSRF skips the csrf check of the oauth endpoints
+// called by the apps. they authenticate with their client
+// credentials and never with the cookies of the user
+func skipOAuthCSRF(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/oauth/token", "/oauth/revoke", "/oauth/introspect":
+			r = csrf.UnsafeSkipCheck(r)
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// csrfErrorHandler responds to the requests that failed
+// the csrf check with a json error for the api requests
+func csrfErrorHandler(w http.ResponseWriter, r *http.Request) {
+	message := "CSRF token invalid: " + csrf.FailureReason(r).Error()
+	if strings.HasPrefix(r.URL.Path, "/api/") {
+		controllers.WriteJSONError(w, http.StatusForbidden, "invalid_csrf_token", message)
+		return
+	}
+	http.Error(w, "Forbidden - "+message, http.StatusForbidden)
+}
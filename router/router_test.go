@@ -0,0 +1,1242 @@
+package router_test
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"html"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/abanoub-fathy/bebo-gallery/config"
+	"github.com/abanoub-fathy/bebo-gallery/model"
+	"github.com/abanoub-fathy/bebo-gallery/pkg/email"
+	"github.com/abanoub-fathy/bebo-gallery/pkg/oidc"
+	"github.com/abanoub-fathy/bebo-gallery/pkg/oidc/oidctest"
+	"github.com/abanoub-fathy/bebo-gallery/router"
+	"github.com/sendgrid/rest"
+	"github.com/sendgrid/sendgrid-go/helpers/mail"
+	"github.com/stretchr/testify/suite"
+)
+
+func TestMain(m *testing.M) {
+	// the views are parsed relative to the root of the repo
+	if err := os.Chdir(".."); err != nil {
+		panic(err)
+	}
+	os.Exit(m.Run())
+}
+
+// mailRecorder is an email.Client that keeps the sent messages
+type mailRecorder struct {
+	mu       sync.Mutex
+	messages []*mail.SGMailV3
+}
+
+func (m *mailRecorder) Send(message *mail.SGMailV3) (*rest.Response, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.messages = append(m.messages, message)
+	return &rest.Response{StatusCode: http.StatusAccepted}, nil
+}
+
+// lastHTML returns the html content of the last message sent to address
+func (m *mailRecorder) lastHTML(address string) string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for i := len(m.messages) - 1; i >= 0; i-- {
+		message := m.messages[i]
+		if message.Personalizations[0].To[0].Address == address {
+			return message.Content[len(message.Content)-1].Value
+		}
+	}
+	return ""
+}
+
+var csrfTokenRegex = regexp.MustCompile(`name="gorilla.csrf.Token" value="([^"]+)"`)
+
+// testClient is a browser like client of the app server
+// it keeps the cookies and follows the redirects
+type testClient struct {
+	*suite.Suite
+	server *httptest.Server
+	client *http.Client
+}
+
+// get requests the path and returns the final response and its body
+func (c *testClient) get(path string) (*http.Response, string) {
+	res, err := c.client.Get(c.server.URL + path)
+	c.Require().NoError(err)
+	return res, c.readBody(res)
+}
+
+// csrfToken returns the csrf token of the form inside the page
+func (c *testClient) csrfToken(path string) string {
+	_, body := c.get(path)
+	matches := csrfTokenRegex.FindStringSubmatch(body)
+	c.Require().NotNil(matches, "page %v should contain a csrf token", path)
+	return html.UnescapeString(matches[1])
+}
+
+// postForm submits the form of the page formPath to the path
+func (c *testClient) postForm(formPath, path string, values url.Values) (*http.Response, string) {
+	if values == nil {
+		values = url.Values{}
+	}
+	values.Set("gorilla.csrf.Token", c.csrfToken(formPath))
+
+	res, err := c.client.PostForm(c.server.URL+path, values)
+	c.Require().NoError(err)
+	return res, c.readBody(res)
+}
+
+// upload submits the files as the images field of a multipart form
+func (c *testClient) upload(formPath, path string, files map[string]string) (*http.Response, string) {
+	return c.uploadField(formPath, path, "images", files)
+}
+
+// uploadField submits the files as the field of a multipart form
+func (c *testClient) uploadField(formPath, path, field string, files map[string]string) (*http.Response, string) {
+	body := &bytes.Buffer{}
+	form := multipart.NewWriter(body)
+	form.WriteField("gorilla.csrf.Token", c.csrfToken(formPath))
+	for name, content := range files {
+		part, err := form.CreateFormFile(field, name)
+		c.Require().NoError(err)
+		part.Write([]byte(content))
+	}
+	c.Require().NoError(form.Close())
+
+	res, err := c.client.Post(c.server.URL+path, form.FormDataContentType(), body)
+	c.Require().NoError(err)
+	return res, c.readBody(res)
+}
+
+// apiRequest sends a json api request with the csrf token header
+// and decodes the json response body into dst if it is not nil
+func (c *testClient) apiRequest(method, path, csrfToken string, body, dst interface{}) *http.Response {
+	return c.apiRequestWithHeader(method, path, "X-CSRF-Token", csrfToken, body, dst)
+}
+
+// bearerRequest sends a json api request authenticated by the access token
+func (c *testClient) bearerRequest(method, path, token string, body, dst interface{}) *http.Response {
+	return c.apiRequestWithHeader(method, path, "Authorization", "Bearer "+token, body, dst)
+}
+
+func (c *testClient) apiRequestWithHeader(method, path, header, value string, body, dst interface{}) *http.Response {
+	var reader io.Reader
+	if body != nil {
+		content, err := json.Marshal(body)
+		c.Require().NoError(err)
+		reader = bytes.NewReader(content)
+	}
+
+	req, err := http.NewRequest(method, c.server.URL+path, reader)
+	c.Require().NoError(err)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(header, value)
+
+	res, err := c.client.Do(req)
+	c.Require().NoError(err)
+	defer res.Body.Close()
+	if dst != nil {
+		c.Require().NoError(json.NewDecoder(res.Body).Decode(dst))
+	}
+	return res
+}
+
+// tusRequest sends a request of the tus protocol with the
+// headers. the Tus-Resumable header is set unless it is empty
+func (c *testClient) tusRequest(method, path string, headers map[string]string, body string) *http.Response {
+	req, err := http.NewRequest(method, c.server.URL+path, strings.NewReader(body))
+	c.Require().NoError(err)
+	req.Header.Set("Tus-Resumable", "1.0.0")
+	for name, value := range headers {
+		req.Header.Set(name, value)
+	}
+	if req.Header.Get("Tus-Resumable") == "" {
+		req.Header.Del("Tus-Resumable")
+	}
+
+	res, err := c.client.Do(req)
+	c.Require().NoError(err)
+	c.readBody(res)
+	return res
+}
+
+func (c *testClient) readBody(res *http.Response) string {
+	defer res.Body.Close()
+	body, err := io.ReadAll(res.Body)
+	c.Require().NoError(err)
+	return string(body)
+}
+
+type RouterSuite struct {
+	suite.Suite
+	cfg     *config.Config
+	service *model.Service
+	mails   *mailRecorder
+	server  *httptest.Server
+}
+
+func (s *RouterSuite) SetupTest() {
+	dir := s.T().TempDir()
+
+	s.cfg = config.Default()
+	s.cfg.Database.URI = "sqlite://" + filepath.Join(dir, "test.db")
+	s.cfg.Storage.ImagesDir = filepath.Join(dir, "images")
+	s.cfg.Storage.UploadsDir = filepath.Join(dir, "uploads")
+	s.cfg.Security.HashSecretKey = "test-hash-secret-key"
+	s.cfg.Security.CSRFKey = "test-csrf-key-with-32-bytes-long"
+
+	service, err := model.NewService(s.cfg)
+	s.Require().NoError(err)
+	s.Require().NoError(service.Migrate())
+	s.service = service
+
+	s.mails = &mailRecorder{}
+	s.startServer()
+}
+
+// startServer starts the app server with s.cfg
+// the base url is set to the url of the server
+func (s *RouterSuite) startServer() {
+	if s.server != nil {
+		s.server.Close()
+	}
+
+	mailer := email.NewClient(s.cfg.Mail)
+	mailer.Client = s.mails
+
+	s.server = httptest.NewUnstartedServer(nil)
+	s.cfg.Mail.BaseURL = "http://" + s.server.Listener.Addr().String()
+	s.server.Config.Handler = router.New(s.service, mailer, s.cfg)
+	s.server.Start()
+}
+
+func (s *RouterSuite) TearDownTest() {
+	s.server.Close()
+	s.server = nil
+	s.service.Close()
+}
+
+func (s *RouterSuite) newClient() *testClient {
+	jar, err := cookiejar.New(nil)
+	s.Require().NoError(err)
+	return &testClient{
+		Suite:  &s.Suite,
+		server: s.server,
+		client: &http.Client{Jar: jar},
+	}
+}
+
+func (s *RouterSuite) signup(c *testClient, emailAddress string) {
+	res, body := c.postForm("/signup", "/new", url.Values{
+		"firstName": {"Abanoub"},
+		"lastName":  {"Fathy"},
+		"email":     {emailAddress},
+		"password":  {"12212154554554asdsa"},
+	})
+	s.Require().Equal("/galleries/new", res.Request.URL.Path)
+	s.Require().Contains(body, "Welcome to bebo gallery", "the alert should be shown after the redirect")
+}
+
+func (s *RouterSuite) TestGalleryFlow() {
+	c := s.newClient()
+	s.signup(c, "aop4ever@gmail.com")
+
+	// the alert is shown only once
+	_, body := c.get("/galleries/new")
+	s.Assert().NotContains(body, "Welcome to bebo gallery")
+
+	// create a gallery
+	res, body := c.postForm("/galleries/new", "/galleries", url.Values{"title": {"Wedding"}})
+	s.Require().Equal("/galleries", res.Request.URL.Path)
+	s.Require().Contains(body, "Wedding")
+
+	matches := regexp.MustCompile(`href="/galleries/([0-9a-f-]+)/edit"`).FindStringSubmatch(body)
+	s.Require().NotNil(matches, "the galleries page should link to the edit page")
+	galleryPath := "/galleries/" + matches[1]
+
+	// upload an image
+	res, body = c.upload(galleryPath+"/edit", galleryPath+"/images", map[string]string{"first.jpg": "image content"})
+	s.Require().Equal(galleryPath+"/edit", res.Request.URL.Path)
+	s.Require().Contains(body, "/images/galleries/"+matches[1]+"/first.jpg")
+
+	res, body = c.get("/images/galleries/" + matches[1] + "/first.jpg")
+	s.Require().Equal(http.StatusOK, res.StatusCode)
+	s.Assert().Equal("image content", body)
+
+	// the unlisted gallery is seen only by its owner
+	res, body = c.get(galleryPath)
+	s.Require().Equal(http.StatusOK, res.StatusCode)
+	s.Assert().Contains(body, "first.jpg")
+	res, body = s.newClient().get(galleryPath)
+	s.Assert().Equal("/notFound", res.Request.URL.Path)
+	s.Assert().NotContains(body, "first.jpg")
+
+	// the image dirs are not listed and the originals of
+	// the unlisted gallery are not served to the visitors
+	_, body = s.newClient().get("/images/galleries/")
+	s.Assert().NotContains(body, matches[1])
+	res, body = s.newClient().get("/images/galleries/" + matches[1] + "/first.jpg")
+	s.Assert().Equal(http.StatusNotFound, res.StatusCode)
+	s.Assert().NotContains(body, "image content")
+
+	// delete the image
+	_, body = c.postForm(galleryPath+"/edit", galleryPath+"/images/first.jpg/delete", nil)
+	s.Assert().NotContains(body, "first.jpg")
+
+	// delete the gallery
+	res, body = c.postForm(galleryPath+"/edit", galleryPath+"/delete", nil)
+	s.Require().Equal("/galleries", res.Request.URL.Path)
+	s.Assert().NotContains(body, matches[1])
+}
+
+func (s *RouterSuite) TestLoginAndLogout() {
+	c := s.newClient()
+	s.signup(c, "aop4ever@gmail.com")
+
+	res, _ := c.postForm("/galleries", "/logout", nil)
+	s.Require().Equal("/", res.Request.URL.Path)
+
+	// the galleries need a logged in user
+	res, _ = c.get("/galleries")
+	s.Require().Equal("/login", res.Request.URL.Path)
+
+	_, body := c.postForm("/login", "/login", url.Values{
+		"email":    {"aop4ever@gmail.com"},
+		"password": {"wrong-password"},
+	})
+	s.Assert().Contains(body, model.ErrInvalidCredentials.PublicErrMsg())
+
+	// the unknown emails get the same error
+	_, body = c.postForm("/login", "/login", url.Values{
+		"email":    {"unknown@gmail.com"},
+		"password": {"wrong-password"},
+	})
+	s.Assert().Contains(body, model.ErrInvalidCredentials.PublicErrMsg())
+
+	res, body = c.postForm("/login", "/login", url.Values{
+		"email":    {"aop4ever@gmail.com"},
+		"password": {"12212154554554asdsa"},
+	})
+	s.Require().Equal("/galleries", res.Request.URL.Path)
+	s.Assert().Contains(body, "welcome back")
+}
+
+func (s *RouterSuite) TestResetPassword() {
+	s.signup(s.newClient(), "aop4ever@gmail.com")
+
+	c := s.newClient()
+	res, body := c.postForm("/password/forget", "/password/forget", url.Values{"email": {"aop4ever@gmail.com"}})
+	s.Require().Equal("/password/reset", res.Request.URL.Path)
+	s.Assert().Contains(body, "Reset Password instructions sent")
+
+	// the email is sent in the background
+	var matches []string
+	s.Require().Eventually(func() bool {
+		matches = regexp.MustCompile(`href="([^"]+)"`).FindStringSubmatch(s.mails.lastHTML("aop4ever@gmail.com"))
+		return matches != nil
+	}, time.Second, 10*time.Millisecond, "the email should contain the reset link")
+	resetURL, err := url.Parse(matches[1])
+	s.Require().NoError(err)
+
+	res, body = c.postForm(resetURL.RequestURI(), "/password/reset", url.Values{
+		"token":    {resetURL.Query().Get("token")},
+		"password": {"the-new-password"},
+	})
+	s.Require().Equal("/galleries", res.Request.URL.Path)
+	s.Assert().Contains(body, "password is changed")
+}
+
+func (s *RouterSuite) TestCSRFProtection() {
+	c := s.newClient()
+	res, err := c.client.PostForm(s.server.URL+"/login", url.Values{
+		"email":    {"aop4ever@gmail.com"},
+		"password": {"12212154554554asdsa"},
+	})
+	s.Require().NoError(err)
+	res.Body.Close()
+	s.Assert().Equal(http.StatusForbidden, res.StatusCode)
+}
+
+func (s *RouterSuite) TestAPI() {
+	c := s.newClient()
+
+	// the api needs a logged in user
+	var apiErr struct {
+		Error struct {
+			Code string `json:"code"`
+		} `json:"error"`
+	}
+	res := c.apiRequest("GET", "/api/v1/galleries", "", nil, &apiErr)
+	s.Require().Equal(http.StatusUnauthorized, res.StatusCode)
+	s.Assert().Equal("unauthorized", apiErr.Error.Code)
+
+	s.signup(c, "aop4ever@gmail.com")
+
+	var me struct {
+		Email string `json:"email"`
+	}
+	res = c.apiRequest("GET", "/api/v1/me", "", nil, &me)
+	s.Require().Equal(http.StatusOK, res.StatusCode)
+	s.Assert().Equal("aop4ever@gmail.com", me.Email)
+	token := res.Header.Get("X-CSRF-Token")
+	s.Require().NotEmpty(token)
+
+	// the unsafe requests need the csrf token
+	res = c.apiRequest("POST", "/api/v1/galleries", "", map[string]string{"title": "Wedding"}, &apiErr)
+	s.Require().Equal(http.StatusForbidden, res.StatusCode)
+	s.Assert().Equal("invalid_csrf_token", apiErr.Error.Code)
+
+	// the validation errors have a stable code
+	res = c.apiRequest("POST", "/api/v1/galleries", token, map[string]string{"title": ""}, &apiErr)
+	s.Require().Equal(http.StatusUnprocessableEntity, res.StatusCode)
+	s.Assert().Equal(model.ErrGalleryTitleRequired.Code(), apiErr.Error.Code)
+
+	var gallery struct {
+		ID    string `json:"id"`
+		Title string `json:"title"`
+	}
+	for _, title := range []string{"Wedding", "Birthday", "Graduation"} {
+		res = c.apiRequest("POST", "/api/v1/galleries", token, map[string]string{"title": title}, &gallery)
+		s.Require().Equal(http.StatusCreated, res.StatusCode)
+	}
+
+	var list struct {
+		Data       []json.RawMessage `json:"data"`
+		Pagination struct {
+			Page    int `json:"page"`
+			PerPage int `json:"per_page"`
+			Total   int `json:"total"`
+		} `json:"pagination"`
+	}
+	res = c.apiRequest("GET", "/api/v1/galleries?page=2&per_page=2", "", nil, &list)
+	s.Require().Equal(http.StatusOK, res.StatusCode)
+	s.Assert().Len(list.Data, 1)
+	s.Assert().Equal(3, list.Pagination.Total)
+	s.Assert().Equal(2, list.Pagination.Page)
+
+	galleryPath := "/api/v1/galleries/" + gallery.ID
+	res = c.apiRequest("PATCH", galleryPath, token, map[string]string{"title": "Party"}, &gallery)
+	s.Require().Equal(http.StatusOK, res.StatusCode)
+	s.Assert().Equal("Party", gallery.Title)
+
+	// other users can not change the gallery
+	other := s.newClient()
+	s.signup(other, "other@gmail.com")
+	res = other.apiRequest("GET", "/api/v1/me", "", nil, nil)
+	otherToken := res.Header.Get("X-CSRF-Token")
+	res = other.apiRequest("DELETE", galleryPath, otherToken, nil, &apiErr)
+	s.Require().Equal(http.StatusNotFound, res.StatusCode)
+	s.Assert().Equal(model.ErrNotFound.Code(), apiErr.Error.Code)
+
+	res = c.apiRequest("DELETE", galleryPath, token, nil, nil)
+	s.Require().Equal(http.StatusNoContent, res.StatusCode)
+	res = c.apiRequest("GET", galleryPath, "", nil, &apiErr)
+	s.Require().Equal(http.StatusNotFound, res.StatusCode)
+
+	res, body := c.get("/api/v1/openapi.yaml")
+	s.Require().Equal(http.StatusOK, res.StatusCode)
+	s.Assert().Contains(body, "openapi: 3")
+}
+
+func (s *RouterSuite) TestImageOrderAndCover() {
+	c := s.newClient()
+	s.signup(c, "aop4ever@gmail.com")
+	res := c.apiRequest("GET", "/api/v1/me", "", nil, nil)
+	token := res.Header.Get("X-CSRF-Token")
+
+	type imageData struct {
+		ID       string `json:"id"`
+		FileName string `json:"file_name"`
+		Position int    `json:"position"`
+	}
+	var gallery struct {
+		ID           string      `json:"id"`
+		CoverImageID *string     `json:"cover_image_id"`
+		Images       []imageData `json:"images"`
+	}
+	res = c.apiRequest("POST", "/api/v1/galleries", token, map[string]string{"title": "Wedding"}, &gallery)
+	s.Require().Equal(http.StatusCreated, res.StatusCode)
+
+	galleryPath := "/galleries/" + gallery.ID
+	for _, name := range []string{"a.jpg", "b.jpg", "c.jpg"} {
+		c.upload(galleryPath+"/edit", galleryPath+"/images", map[string]string{name: "image " + name})
+	}
+
+	apiPath := "/api/v1" + galleryPath
+	res = c.apiRequest("GET", apiPath, "", nil, &gallery)
+	s.Require().Equal(http.StatusOK, res.StatusCode)
+	s.Require().Len(gallery.Images, 3)
+	s.Assert().Nil(gallery.CoverImageID)
+
+	// the order should list every image
+	var apiErr struct {
+		Error struct {
+			Code string `json:"code"`
+		} `json:"error"`
+	}
+	ids := []string{gallery.Images[2].ID, gallery.Images[0].ID}
+	res = c.apiRequest("PUT", apiPath+"/images/order", token, map[string][]string{"image_ids": ids}, &apiErr)
+	s.Require().Equal(http.StatusUnprocessableEntity, res.StatusCode)
+	s.Assert().Equal(model.ErrImageOrderInvalid.Code(), apiErr.Error.Code)
+
+	var images []imageData
+	ids = append(ids, gallery.Images[1].ID)
+	res = c.apiRequest("PUT", apiPath+"/images/order", token, map[string][]string{"image_ids": ids}, &images)
+	s.Require().Equal(http.StatusOK, res.StatusCode)
+	s.Require().Len(images, 3)
+	for i, name := range []string{"c.jpg", "a.jpg", "b.jpg"} {
+		s.Assert().Equal(name, images[i].FileName)
+		s.Assert().Equal(i, images[i].Position)
+	}
+
+	// the first image is the cover until one is chosen
+	_, body := c.get("/galleries")
+	s.Assert().Contains(body, `src="/images/galleries/`+gallery.ID+`/c.jpg"`)
+
+	cover := images[2].ID
+	res = c.apiRequest("PATCH", apiPath, token, map[string]interface{}{"title": "Wedding", "cover_image_id": cover}, &gallery)
+	s.Require().Equal(http.StatusOK, res.StatusCode)
+	s.Require().NotNil(gallery.CoverImageID)
+	s.Assert().Equal(cover, *gallery.CoverImageID)
+
+	_, body = c.get("/galleries")
+	s.Assert().Contains(body, `src="/images/galleries/`+gallery.ID+`/b.jpg"`)
+
+	// the cover is unset when its image is deleted
+	c.postForm(galleryPath+"/edit", galleryPath+"/images/b.jpg/delete", nil)
+	res = c.apiRequest("GET", apiPath, "", nil, &gallery)
+	s.Require().Equal(http.StatusOK, res.StatusCode)
+	s.Assert().Nil(gallery.CoverImageID)
+}
+
+func (s *RouterSuite) TestImageDetails() {
+	c := s.newClient()
+	s.signup(c, "aop4ever@gmail.com")
+	res := c.apiRequest("GET", "/api/v1/me", "", nil, nil)
+	token := res.Header.Get("X-CSRF-Token")
+
+	var gallery struct {
+		ID string `json:"id"`
+	}
+	res = c.apiRequest("POST", "/api/v1/galleries", token, map[string]string{"title": "Wedding"}, &gallery)
+	s.Require().Equal(http.StatusCreated, res.StatusCode)
+	galleryPath := "/galleries/" + gallery.ID
+	c.upload(galleryPath+"/edit", galleryPath+"/images", map[string]string{"cake.jpg": "cake"})
+
+	type imageData struct {
+		ID      string `json:"id"`
+		Title   string `json:"title"`
+		Caption string `json:"caption"`
+		AltText string `json:"alt_text"`
+	}
+	var images []imageData
+	var list struct {
+		Data []imageData `json:"data"`
+	}
+	res = c.apiRequest("GET", "/api/v1"+galleryPath+"/images", "", nil, &list)
+	s.Require().Equal(http.StatusOK, res.StatusCode)
+	s.Require().Len(list.Data, 1)
+
+	// only the sent details are changed
+	changes := []map[string]string{{"id": list.Data[0].ID, "title": "The cake", "caption": "So **sweet**"}}
+	res = c.apiRequest("PATCH", "/api/v1"+galleryPath+"/images", token, changes, &images)
+	s.Require().Equal(http.StatusOK, res.StatusCode)
+	changes = []map[string]string{{"id": list.Data[0].ID, "alt_text": "A white cake"}}
+	res = c.apiRequest("PATCH", "/api/v1"+galleryPath+"/images", token, changes, &images)
+	s.Require().Equal(http.StatusOK, res.StatusCode)
+	s.Require().Len(images, 1)
+	s.Assert().Equal(imageData{ID: list.Data[0].ID, Title: "The cake", Caption: "So **sweet**", AltText: "A white cake"}, images[0])
+
+	var apiErr struct {
+		Error struct {
+			Code string `json:"code"`
+		} `json:"error"`
+	}
+	changes = []map[string]string{{"id": list.Data[0].ID, "title": strings.Repeat("a", model.MaxImageTitleLength+1)}}
+	res = c.apiRequest("PATCH", "/api/v1"+galleryPath+"/images", token, changes, &apiErr)
+	s.Require().Equal(http.StatusUnprocessableEntity, res.StatusCode)
+	s.Assert().Equal(model.ErrImageTitleTooLong.Code(), apiErr.Error.Code)
+
+	_, body := c.get(galleryPath)
+	s.Assert().Contains(body, `alt="A white cake"`)
+	s.Assert().Contains(body, "So <strong>sweet</strong>")
+
+	// the bulk edit page lists the images
+	res, body = c.get(galleryPath + "/images/details")
+	s.Require().Equal(http.StatusOK, res.StatusCode)
+	s.Assert().Contains(body, `value="The cake"`)
+}
+
+func (s *RouterSuite) TestTagsAPI() {
+	c := s.newClient()
+	s.signup(c, "aop4ever@gmail.com")
+	res := c.apiRequest("GET", "/api/v1/me", "", nil, nil)
+	token := res.Header.Get("X-CSRF-Token")
+
+	var gallery struct {
+		ID   string   `json:"id"`
+		Tags []string `json:"tags"`
+	}
+	body := map[string]interface{}{"title": "Wedding", "tags": []string{"Family", "#Summer Party"}}
+	res = c.apiRequest("POST", "/api/v1/galleries", token, body, &gallery)
+	s.Require().Equal(http.StatusCreated, res.StatusCode)
+	s.Assert().Equal([]string{"family", "summer-party"}, gallery.Tags)
+
+	var apiErr struct {
+		Error struct {
+			Code string `json:"code"`
+		} `json:"error"`
+	}
+	body = map[string]interface{}{"title": "Wedding", "tags": []string{"not/valid"}}
+	res = c.apiRequest("PATCH", "/api/v1/galleries/"+gallery.ID, token, body, &apiErr)
+	s.Require().Equal(http.StatusUnprocessableEntity, res.StatusCode)
+	s.Assert().Equal(model.ErrTagInvalid.Code(), apiErr.Error.Code)
+
+	galleryPath := "/galleries/" + gallery.ID
+	c.upload(galleryPath+"/edit", galleryPath+"/images", map[string]string{"cake.jpg": "cake"})
+	var list struct {
+		Data []struct {
+			ID string `json:"id"`
+		} `json:"data"`
+	}
+	c.apiRequest("GET", "/api/v1"+galleryPath+"/images", "", nil, &list)
+	s.Require().Len(list.Data, 1)
+
+	var images []struct {
+		Tags []string `json:"tags"`
+	}
+	body = map[string]interface{}{"image_ids": []string{list.Data[0].ID}, "add": []string{"Cake", "sweet"}, "remove": []string{"sweet"}}
+	res = c.apiRequest("POST", "/api/v1"+galleryPath+"/images/tags", token, body, &images)
+	s.Require().Equal(http.StatusOK, res.StatusCode)
+	s.Require().Len(images, 1)
+	s.Assert().Equal([]string{"cake"}, images[0].Tags)
+
+	// the tags of the user are suggested
+	var suggestions struct {
+		Data []string `json:"data"`
+	}
+	res = c.apiRequest("GET", "/api/v1/tags?q=S", "", nil, &suggestions)
+	s.Require().Equal(http.StatusOK, res.StatusCode)
+	s.Assert().Equal([]string{"summer-party"}, suggestions.Data)
+
+	var tag struct {
+		Tag       string            `json:"tag"`
+		Galleries []json.RawMessage `json:"galleries"`
+		Images    []json.RawMessage `json:"images"`
+	}
+	res = c.apiRequest("GET", "/api/v1/tags/CAKE", "", nil, &tag)
+	s.Require().Equal(http.StatusOK, res.StatusCode)
+	s.Assert().Equal("cake", tag.Tag)
+	s.Assert().Empty(tag.Galleries)
+	s.Assert().Len(tag.Images, 1)
+
+	// the unlisted galleries are listed only for their owner
+	visitor := s.newClient()
+	res, page := visitor.get("/tags/family")
+	s.Require().Equal(http.StatusOK, res.StatusCode)
+	s.Assert().NotContains(page, "Wedding")
+	other := s.newClient()
+	s.signup(other, "other@gmail.com")
+	res = other.apiRequest("GET", "/api/v1/tags/cake", "", nil, &tag)
+	s.Require().Equal(http.StatusOK, res.StatusCode)
+	s.Assert().Empty(tag.Images)
+	_, page = c.get("/tags/family")
+	s.Assert().Contains(page, "Wedding")
+
+	// everyone can see the public galleries on the tag pages
+	res = c.apiRequest("PATCH", "/api/v1/galleries/"+gallery.ID, token, map[string]interface{}{"title": "Wedding", "public": true}, nil)
+	s.Require().Equal(http.StatusOK, res.StatusCode)
+	res, page = visitor.get("/tags/family")
+	s.Require().Equal(http.StatusOK, res.StatusCode)
+	s.Assert().Contains(page, "Wedding")
+}
+
+func (s *RouterSuite) TestSearchAPI() {
+	c := s.newClient()
+	s.signup(c, "aop4ever@gmail.com")
+	res := c.apiRequest("GET", "/api/v1/me", "", nil, nil)
+	token := res.Header.Get("X-CSRF-Token")
+
+	var gallery struct {
+		ID          string `json:"id"`
+		Description string `json:"description"`
+	}
+	body := map[string]interface{}{"title": "Wedding", "description": "at the old church", "tags": []string{"family"}}
+	res = c.apiRequest("POST", "/api/v1/galleries", token, body, &gallery)
+	s.Require().Equal(http.StatusCreated, res.StatusCode)
+	s.Assert().Equal("at the old church", gallery.Description)
+
+	galleryPath := "/galleries/" + gallery.ID
+	c.upload(galleryPath+"/edit", galleryPath+"/images", map[string]string{"IMG_2040.jpg": "cake"})
+
+	var results struct {
+		Galleries []struct {
+			ID string `json:"id"`
+		} `json:"galleries"`
+		Images []struct {
+			FileName string `json:"file_name"`
+		} `json:"images"`
+	}
+	res = c.apiRequest("GET", "/api/v1/search?q=church+fam", "", nil, &results)
+	s.Require().Equal(http.StatusOK, res.StatusCode)
+	s.Require().Len(results.Galleries, 1)
+	s.Assert().Equal(gallery.ID, results.Galleries[0].ID)
+	s.Assert().Empty(results.Images)
+
+	res = c.apiRequest("GET", "/api/v1/search?q=img+2040&owner=me&from=2000-01-01", "", nil, &results)
+	s.Require().Equal(http.StatusOK, res.StatusCode)
+	s.Assert().Empty(results.Galleries)
+	s.Require().Len(results.Images, 1)
+	s.Assert().Equal("IMG_2040.jpg", results.Images[0].FileName)
+
+	var apiErr struct {
+		Error struct {
+			Code string `json:"code"`
+		} `json:"error"`
+	}
+	res = c.apiRequest("GET", "/api/v1/search?q=", "", nil, &apiErr)
+	s.Require().Equal(http.StatusUnprocessableEntity, res.StatusCode)
+	s.Assert().Equal(model.ErrSearchTextRequired.Code(), apiErr.Error.Code)
+
+	res = c.apiRequest("GET", "/api/v1/search?q=cake&owner=nobody", "", nil, &apiErr)
+	s.Require().Equal(http.StatusBadRequest, res.StatusCode)
+	s.Assert().Equal("invalid_search", apiErr.Error.Code)
+
+	// the unlisted galleries are found only by their owner
+	other := s.newClient()
+	s.signup(other, "other@gmail.com")
+	res = other.apiRequest("GET", "/api/v1/search?q=church+fam", "", nil, &results)
+	s.Require().Equal(http.StatusOK, res.StatusCode)
+	s.Assert().Empty(results.Galleries)
+	visitor := s.newClient()
+	res, page := visitor.get("/search?q=wedding")
+	s.Require().Equal(http.StatusOK, res.StatusCode)
+	s.Assert().NotContains(page, "/galleries/"+gallery.ID)
+
+	// the search is in the navbar of the pages
+	res = c.apiRequest("PATCH", "/api/v1/galleries/"+gallery.ID, token, map[string]interface{}{"title": "Wedding", "public": true}, nil)
+	s.Require().Equal(http.StatusOK, res.StatusCode)
+	res, page = visitor.get("/search?q=wedding")
+	s.Require().Equal(http.StatusOK, res.StatusCode)
+	s.Assert().Contains(page, `action="/search"`)
+	s.Assert().Contains(page, "/galleries/"+gallery.ID)
+}
+
+var newTokenRegex = regexp.MustCompile(`<code id="newToken">([^<]+)</code>`)
+
+// createAccessToken creates a token from the account page and returns it
+func (s *RouterSuite) createAccessToken(c *testClient, name, scope string) string {
+	_, body := c.postForm("/account", "/account/tokens", url.Values{
+		"name":          {name},
+		"scope":         {scope},
+		"expiresInDays": {"30"},
+	})
+	matches := newTokenRegex.FindStringSubmatch(body)
+	s.Require().NotNil(matches, "the account page should show the new token")
+	return html.UnescapeString(matches[1])
+}
+
+func (s *RouterSuite) TestAccessTokens() {
+	c := s.newClient()
+	s.signup(c, "aop4ever@gmail.com")
+
+	readToken := s.createAccessToken(c, "reader", "read")
+	writeToken := s.createAccessToken(c, "writer", "write")
+
+	// the token is shown only once
+	_, body := c.get("/account")
+	s.Assert().Contains(body, "reader")
+	s.Assert().NotContains(body, readToken)
+
+	// the bearer requests do not use the cookies nor the csrf token
+	api := s.newClient()
+	var apiErr struct {
+		Error struct {
+			Code string `json:"code"`
+		} `json:"error"`
+	}
+	res := api.bearerRequest("POST", "/api/v1/galleries", readToken, map[string]string{"title": "Wedding"}, &apiErr)
+	s.Require().Equal(http.StatusForbidden, res.StatusCode)
+	s.Assert().Equal("insufficient_scope", apiErr.Error.Code)
+
+	res = api.bearerRequest("POST", "/api/v1/galleries", writeToken, map[string]string{"title": "Wedding"}, nil)
+	s.Require().Equal(http.StatusCreated, res.StatusCode)
+
+	var list struct {
+		Pagination struct {
+			Total int `json:"total"`
+		} `json:"pagination"`
+	}
+	res = api.bearerRequest("GET", "/api/v1/galleries", readToken, nil, &list)
+	s.Require().Equal(http.StatusOK, res.StatusCode)
+	s.Assert().Equal(1, list.Pagination.Total)
+
+	// managing the tokens needs the admin scope
+	res = api.bearerRequest("GET", "/api/v1/tokens", writeToken, nil, &apiErr)
+	s.Require().Equal(http.StatusForbidden, res.StatusCode)
+
+	res = api.bearerRequest("GET", "/api/v1/galleries", "bebo_not-a-token", nil, &apiErr)
+	s.Require().Equal(http.StatusUnauthorized, res.StatusCode)
+	s.Assert().Equal("invalid_token", apiErr.Error.Code)
+
+	// revoke the read token from the account page
+	matches := regexp.MustCompile(`action="(/account/tokens/[0-9a-f-]+/revoke)"`).FindAllStringSubmatch(body, -1)
+	s.Require().Len(matches, 2)
+	for _, match := range matches {
+		res, body = c.postForm("/account", match[1], nil)
+		s.Require().Equal("/account", res.Request.URL.Path)
+		s.Assert().Contains(body, "the token is revoked")
+	}
+
+	res = api.bearerRequest("GET", "/api/v1/galleries", readToken, nil, nil)
+	s.Require().Equal(http.StatusUnauthorized, res.StatusCode)
+}
+
+func (s *RouterSuite) TestRateLimit() {
+	s.cfg.RateLimits.Store = "database"
+	s.cfg.RateLimits.API = config.RateLimit{Algorithm: "token_bucket", Limit: 2, WindowSeconds: 60}
+	s.startServer()
+
+	c := s.newClient()
+	s.signup(c, "aop4ever@gmail.com")
+	firstToken := s.createAccessToken(c, "first", "read")
+	secondToken := s.createAccessToken(c, "second", "read")
+
+	api := s.newClient()
+	for i := 0; i < 2; i++ {
+		res := api.bearerRequest("GET", "/api/v1/me", firstToken, nil, nil)
+		s.Require().Equal(http.StatusOK, res.StatusCode)
+		s.Assert().Equal("2", res.Header.Get("RateLimit-Limit"))
+		s.Assert().Equal(strconv.Itoa(1-i), res.Header.Get("RateLimit-Remaining"))
+		s.Assert().Equal("2;w=60", res.Header.Get("RateLimit-Policy"))
+	}
+
+	var apiErr struct {
+		Error struct {
+			Code string `json:"code"`
+		} `json:"error"`
+	}
+	res := api.bearerRequest("GET", "/api/v1/me", firstToken, nil, &apiErr)
+	s.Require().Equal(http.StatusTooManyRequests, res.StatusCode)
+	s.Assert().Equal("rate_limited", apiErr.Error.Code)
+	s.Assert().Equal("30", res.Header.Get("Retry-After"))
+	s.Assert().Equal("60", res.Header.Get("RateLimit-Reset"))
+
+	// every token has its own limit
+	res = api.bearerRequest("GET", "/api/v1/me", secondToken, nil, nil)
+	s.Assert().Equal(http.StatusOK, res.StatusCode)
+
+	// the pages of the website are not limited
+	res, _ = c.get("/account")
+	s.Assert().Equal(http.StatusOK, res.StatusCode)
+	s.Assert().Empty(res.Header.Get("RateLimit-Limit"))
+}
+
+func (s *RouterSuite) TestOIDCLogin() {
+	issuer := oidctest.NewServer("bebo", "secret")
+	defer issuer.Close()
+
+	s.cfg.OIDC = []config.OIDCProvider{{
+		Name:         "corporate",
+		DisplayName:  "Corporate",
+		Issuer:       issuer.Issuer(),
+		ClientID:     "bebo",
+		ClientSecret: "secret",
+	}}
+	s.startServer()
+
+	// the existing user is linked by the verified email
+	s.signup(s.newClient(), "aop4ever@gmail.com")
+
+	c := s.newClient()
+	_, body := c.get("/login")
+	s.Require().Contains(body, `href="/auth/corporate/login"`)
+
+	issuer.SetIdentity(oidctest.Identity{Subject: "1", Email: "aop4ever@gmail.com", EmailVerified: false})
+	res, body := c.get("/auth/corporate/login")
+	s.Require().Equal("/login", res.Request.URL.Path)
+	s.Assert().Contains(body, model.ErrIdentityEmailNotVerified.PublicErrMsg())
+
+	issuer.SetIdentity(oidctest.Identity{Subject: "1", Email: "aop4ever@gmail.com", EmailVerified: true})
+	res, body = c.get("/auth/corporate/login")
+	s.Require().Equal("/galleries", res.Request.URL.Path)
+	s.Assert().Contains(body, "welcome back")
+
+	user, err := s.service.UserService.FindByEmail("aop4ever@gmail.com")
+	s.Require().NoError(err)
+	identities, err := s.service.IdentityService.FindByUserID(user.ID)
+	s.Require().NoError(err)
+	s.Require().Len(identities, 1)
+
+	// the flow can not be replayed without the flow cookie
+	res, _ = s.newClient().get("/auth/corporate/callback?code=x&state=y")
+	s.Require().Equal("/login", res.Request.URL.Path)
+
+	// a new user is created for an unknown email
+	issuer.SetIdentity(oidctest.Identity{Subject: "2", Email: "new@gmail.com", EmailVerified: true, GivenName: "New", FamilyName: "User"})
+	res, _ = s.newClient().get("/auth/corporate/login")
+	s.Require().Equal("/galleries", res.Request.URL.Path)
+	newUser, err := s.service.UserService.FindByEmail("new@gmail.com")
+	s.Require().NoError(err)
+	s.Assert().Equal("New", newUser.FirstName)
+
+	// disconnect the provider from the account page
+	_, body = c.get("/account")
+	matches := regexp.MustCompile(`action="(/account/identities/[0-9a-f-]+/disconnect)"`).FindStringSubmatch(body)
+	s.Require().NotNil(matches)
+	res, body = c.postForm("/account", matches[1], nil)
+	s.Require().Equal("/account", res.Request.URL.Path)
+	s.Assert().Contains(body, "the provider is disconnected")
+	s.Assert().Contains(body, `href="/auth/corporate/login">Connect Corporate`)
+
+	// connect it again while logged in. the email does not matter
+	issuer.SetIdentity(oidctest.Identity{Subject: "1", Email: "other@corp.example.com"})
+	res, body = c.get("/auth/corporate/login")
+	s.Require().Equal("/account", res.Request.URL.Path)
+	s.Assert().Contains(body, "Corporate is connected")
+
+	// the account of another user can not be connected
+	issuer.SetIdentity(oidctest.Identity{Subject: "2"})
+	res, body = c.get("/auth/corporate/login")
+	s.Require().Equal("/account", res.Request.URL.Path)
+	s.Assert().Contains(body, model.ErrIdentityIsLinked.PublicErrMsg())
+}
+
+func (s *RouterSuite) TestOAuthFlow() {
+	// the app only receives the redirects of the authorization
+	app := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer app.Close()
+	redirectURI := app.URL + "/callback"
+
+	c := s.newClient()
+	s.signup(c, "aop4ever@gmail.com")
+
+	_, body := c.postForm("/oauth/apps", "/oauth/apps", url.Values{
+		"name":         {"Photo Printer"},
+		"redirectURIs": {redirectURI},
+		"confidential": {"true"},
+	})
+	clientID := regexp.MustCompile(`id="newClientID">([^<]+)<`).FindStringSubmatch(body)
+	secret := regexp.MustCompile(`id="newClientSecret">([^<]+)<`).FindStringSubmatch(body)
+	s.Require().NotNil(clientID)
+	s.Require().NotNil(secret)
+
+	verifier, err := oidc.NewVerifier()
+	s.Require().NoError(err)
+	authorize := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {clientID[1]},
+		"redirect_uri":          {redirectURI},
+		"scope":                 {"read write"},
+		"state":                 {"xyz"},
+		"code_challenge":        {oidc.S256Challenge(verifier)},
+		"code_challenge_method": {"S256"},
+	}
+	authorizePath := "/oauth/authorize?" + authorize.Encode()
+
+	// the unknown redirect uris are never used
+	_, body = c.get("/oauth/authorize?" + strings.Replace(authorize.Encode(), "callback", "other", 1))
+	s.Assert().Contains(body, "the redirect uri is not registered for the app")
+
+	// the user denies the request
+	_, body = c.get(authorizePath)
+	s.Require().Contains(body, "Photo Printer wants to access your account")
+	denied := url.Values{}
+	for key := range authorize {
+		denied.Set(key, authorize.Get(key))
+	}
+	denied.Set("approve", "no")
+	res, _ := c.postForm(authorizePath, "/oauth/authorize", denied)
+	s.Require().Equal("/callback", res.Request.URL.Path)
+	s.Assert().Equal("access_denied", res.Request.URL.Query().Get("error"))
+	s.Assert().Equal("xyz", res.Request.URL.Query().Get("state"))
+
+	// the user approves the request
+	authorize.Set("approve", "yes")
+	res, _ = c.postForm(authorizePath, "/oauth/authorize", authorize)
+	s.Require().Equal("/callback", res.Request.URL.Path)
+	s.Assert().Equal("xyz", res.Request.URL.Query().Get("state"))
+	code := res.Request.URL.Query().Get("code")
+	s.Require().NotEmpty(code)
+
+	type tokenResponse struct {
+		AccessToken  string `json:"access_token"`
+		RefreshToken string `json:"refresh_token"`
+		Scope        string `json:"scope"`
+		Error        string `json:"error"`
+		Active       bool   `json:"active"`
+		TokenType    string `json:"token_type"`
+	}
+	// the app calls the endpoints with its credentials and without any cookies
+	oauthRequest := func(path string, values url.Values, withSecret bool) (*http.Response, tokenResponse) {
+		req, err := http.NewRequest("POST", s.server.URL+path, strings.NewReader(values.Encode()))
+		s.Require().NoError(err)
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		if withSecret {
+			req.SetBasicAuth(clientID[1], secret[1])
+		}
+		res, err := http.DefaultClient.Do(req)
+		s.Require().NoError(err)
+		defer res.Body.Close()
+
+		var token tokenResponse
+		if res.Header.Get("Content-Type") == "application/json" {
+			s.Require().NoError(json.NewDecoder(res.Body).Decode(&token))
+		}
+		return res, token
+	}
+
+	exchange := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {redirectURI},
+		"code_verifier": {"wrong-verifier"},
+	}
+	res, token := oauthRequest("/oauth/token", exchange, false)
+	s.Require().Equal(http.StatusUnauthorized, res.StatusCode)
+	s.Assert().Equal("invalid_client", token.Error)
+
+	// the code is used once even if the verifier is wrong
+	res, token = oauthRequest("/oauth/token", exchange, true)
+	s.Require().Equal(http.StatusBadRequest, res.StatusCode)
+	s.Assert().Equal("invalid_grant", token.Error)
+
+	res, _ = c.postForm(authorizePath, "/oauth/authorize", authorize)
+	exchange.Set("code", res.Request.URL.Query().Get("code"))
+	exchange.Set("code_verifier", verifier)
+	res, token = oauthRequest("/oauth/token", exchange, true)
+	s.Require().Equal(http.StatusOK, res.StatusCode)
+	s.Assert().Equal("no-store", res.Header.Get("Cache-Control"))
+	s.Assert().Equal("write", token.Scope)
+	s.Require().NotEmpty(token.AccessToken)
+	s.Require().NotEmpty(token.RefreshToken)
+
+	// the token is used on the api
+	api := s.newClient()
+	res = api.bearerRequest("POST", "/api/v1/galleries", token.AccessToken, map[string]string{"title": "Wedding"}, nil)
+	s.Require().Equal(http.StatusCreated, res.StatusCode)
+	res = api.bearerRequest("GET", "/api/v1/tokens", token.AccessToken, nil, nil)
+	s.Require().Equal(http.StatusForbidden, res.StatusCode)
+
+	_, introspection := oauthRequest("/oauth/introspect", url.Values{"token": {token.AccessToken}}, true)
+	s.Assert().True(introspection.Active)
+	s.Assert().Equal("access_token", introspection.TokenType)
+
+	// the refresh token is rotated
+	res, refreshed := oauthRequest("/oauth/token", url.Values{
+		"grant_type":    {"refresh_token"},
+		"refresh_token": {token.RefreshToken},
+	}, true)
+	s.Require().Equal(http.StatusOK, res.StatusCode)
+	s.Assert().NotEqual(token.AccessToken, refreshed.AccessToken)
+
+	_, introspection = oauthRequest("/oauth/introspect", url.Values{"token": {token.AccessToken}}, true)
+	s.Assert().False(introspection.Active)
+	res = api.bearerRequest("GET", "/api/v1/galleries", token.AccessToken, nil, nil)
+	s.Require().Equal(http.StatusUnauthorized, res.StatusCode)
+
+	// the app is listed on the account page of the user
+	_, body = c.get("/account")
+	s.Assert().Contains(body, "Photo Printer")
+
+	res, _ = oauthRequest("/oauth/revoke", url.Values{"token": {refreshed.RefreshToken}}, true)
+	s.Require().Equal(http.StatusOK, res.StatusCode)
+	res = api.bearerRequest("GET", "/api/v1/galleries", refreshed.AccessToken, nil, nil)
+	s.Require().Equal(http.StatusUnauthorized, res.StatusCode)
+}
+
+func TestRouterSuite(t *testing.T) {
+	suite.Run(t, new(RouterSuite))
+}
+
+func (s *RouterSuite) TestExploreAndProfile() {
+	c := s.newClient()
+	s.signup(c, "aop4ever@gmail.com")
+	var me struct {
+		Handle string `json:"handle"`
+	}
+	res := c.apiRequest("GET", "/api/v1/me", "", nil, &me)
+	token := res.Header.Get("X-CSRF-Token")
+	s.Require().Equal("aop4ever", me.Handle)
+
+	var gallery struct {
+		ID          string  `json:"id"`
+		Public      bool    `json:"public"`
+		PublishedAt *string `json:"published_at"`
+	}
+	res = c.apiRequest("POST", "/api/v1/galleries", token, map[string]interface{}{"title": "Wedding", "public": true}, &gallery)
+	s.Require().Equal(http.StatusCreated, res.StatusCode)
+	s.Assert().True(gallery.Public)
+	s.Assert().NotNil(gallery.PublishedAt)
+	c.postForm("/galleries/new", "/galleries", url.Values{"title": {"Private Party"}})
+
+	// the feed and the profile are public
+	visitor := s.newClient()
+	for _, path := range []string{"/", "/u/aop4ever"} {
+		res, body := visitor.get(path)
+		s.Require().Equal(http.StatusOK, res.StatusCode, path)
+		s.Assert().Contains(body, `href="/galleries/`+gallery.ID+`"`, path)
+		s.Assert().NotContains(body, "Private Party", path)
+	}
+
+	// unlisting the gallery removes it from the feed
+	res = c.apiRequest("PATCH", "/api/v1/galleries/"+gallery.ID, token, map[string]interface{}{"title": "Wedding", "public": false}, &gallery)
+	s.Require().Equal(http.StatusOK, res.StatusCode)
+	s.Assert().Nil(gallery.PublishedAt)
+	_, body := visitor.get("/")
+	s.Assert().NotContains(body, gallery.ID)
+	res, _ = visitor.get("/galleries/" + gallery.ID)
+	s.Assert().Equal("/notFound", res.Request.URL.Path)
+}
+
+func (s *RouterSuite) TestImportArchive() {
+	c := s.newClient()
+	s.signup(c, "aop4ever@gmail.com")
+	res := c.apiRequest("GET", "/api/v1/me", "", nil, nil)
+	token := res.Header.Get("X-CSRF-Token")
+
+	var gallery struct {
+		ID string `json:"id"`
+	}
+	res = c.apiRequest("POST", "/api/v1/galleries", token, map[string]string{"title": "Wedding"}, &gallery)
+	s.Require().Equal(http.StatusCreated, res.StatusCode)
+	galleryPath := "/galleries/" + gallery.ID
+
+	var archive bytes.Buffer
+	zw := zip.NewWriter(&archive)
+	entry, err := zw.Create("photos/cake.jpg")
+	s.Require().NoError(err)
+	entry.Write([]byte("cake"))
+	s.Require().NoError(zw.Close())
+
+	// the upload is sent to the progress page
+	res, body := c.uploadField(galleryPath+"/edit", galleryPath+"/import", "archive", map[string]string{"photos.zip": archive.String()})
+	s.Require().Equal(http.StatusOK, res.StatusCode)
+	progressPath := res.Request.URL.Path
+	s.Require().True(strings.HasPrefix(progressPath, galleryPath+"/imports/"), progressPath)
+	for i := 0; i < 100 && !strings.Contains(body, "The import is done."); i++ {
+		time.Sleep(20 * time.Millisecond)
+		_, body = c.get(progressPath)
+	}
+	s.Require().Contains(body, "1 of 1 files checked: 1 accepted and 0 rejected.")
+
+	res, body = c.get("/images" + galleryPath + "/cake.jpg")
+	s.Require().Equal(http.StatusOK, res.StatusCode)
+	s.Assert().Equal("cake", body)
+
+	// the other users can not see the progress
+	other := s.newClient()
+	s.signup(other, "other@gmail.com")
+	res, _ = other.get(progressPath)
+	s.Assert().Equal("/notFound", res.Request.URL.Path)
+}
+
+func (s *RouterSuite) TestResumableUploads() {
+	c := s.newClient()
+	s.signup(c, "aop4ever@gmail.com")
+	res := c.apiRequest("GET", "/api/v1/me", "", nil, nil)
+	token := res.Header.Get("X-CSRF-Token")
+
+	var gallery struct {
+		ID string `json:"id"`
+	}
+	res = c.apiRequest("POST", "/api/v1/galleries", token, map[string]string{"title": "Wedding"}, &gallery)
+	s.Require().Equal(http.StatusCreated, res.StatusCode)
+	uploadsPath := "/api/v1/galleries/" + gallery.ID + "/uploads"
+
+	// the features are found without authentication
+	res = s.newClient().tusRequest("OPTIONS", uploadsPath, nil, "")
+	s.Require().Equal(http.StatusNoContent, res.StatusCode)
+	s.Assert().Equal("1.0.0", res.Header.Get("Tus-Version"))
+	s.Assert().Equal("creation,termination", res.Header.Get("Tus-Extension"))
+
+	create := map[string]string{
+		"X-CSRF-Token":    token,
+		"Upload-Length":   "10",
+		"Upload-Metadata": "filename Y2FrZS5qcGc=,filetype aW1hZ2UvanBlZw==",
+	}
+	res = c.tusRequest("POST", uploadsPath, map[string]string{"X-CSRF-Token": token, "Tus-Resumable": ""}, "")
+	s.Require().Equal(http.StatusPreconditionFailed, res.StatusCode)
+	res = c.tusRequest("POST", uploadsPath, map[string]string{"X-CSRF-Token": token, "Upload-Length": strconv.FormatInt(s.cfg.Limits.MaxUploadBytes+1, 10), "Upload-Metadata": create["Upload-Metadata"]}, "")
+	s.Require().Equal(http.StatusRequestEntityTooLarge, res.StatusCode)
+
+	res = c.tusRequest("POST", uploadsPath, create, "")
+	s.Require().Equal(http.StatusCreated, res.StatusCode)
+	uploadPath := res.Header.Get("Location")
+	s.Require().True(strings.HasPrefix(uploadPath, uploadsPath+"/"), uploadPath)
+
+	chunk := func(offset, body string) *http.Response {
+		return c.tusRequest("PATCH", uploadPath, map[string]string{
+			"X-CSRF-Token":  token,
+			"Content-Type":  "application/offset+octet-stream",
+			"Upload-Offset": offset,
+		}, body)
+	}
+	res = chunk("0", "01234")
+	s.Require().Equal(http.StatusNoContent, res.StatusCode)
+	s.Assert().Equal("5", res.Header.Get("Upload-Offset"))
+
+	// the chunk sent again after a lost response is rejected
+	res = chunk("0", "01234")
+	s.Require().Equal(http.StatusConflict, res.StatusCode)
+	s.Assert().Equal("5", res.Header.Get("Upload-Offset"))
+
+	res = c.tusRequest("HEAD", uploadPath, nil, "")
+	s.Require().Equal(http.StatusOK, res.StatusCode)
+	s.Assert().Equal("5", res.Header.Get("Upload-Offset"))
+	s.Assert().Equal("10", res.Header.Get("Upload-Length"))
+
+	// the uploads of the other users are not found
+	other := s.newClient()
+	s.signup(other, "other@gmail.com")
+	res = other.tusRequest("HEAD", uploadPath, nil, "")
+	s.Require().Equal(http.StatusNotFound, res.StatusCode)
+
+	// the image is created with the last chunk
+	res = chunk("5", "56789")
+	s.Require().Equal(http.StatusNoContent, res.StatusCode)
+	s.Assert().Equal("10", res.Header.Get("Upload-Offset"))
+	imageID := res.Header.Get("Upload-Image-ID")
+	s.Require().NotEmpty(imageID)
+
+	res, body := c.get("/images/galleries/" + gallery.ID + "/cake.jpg")
+	s.Require().Equal(http.StatusOK, res.StatusCode)
+	s.Assert().Equal("0123456789", body)
+
+	res = c.tusRequest("HEAD", uploadPath, nil, "")
+	s.Require().Equal(http.StatusOK, res.StatusCode)
+	s.Assert().Equal("10", res.Header.Get("Upload-Offset"))
+	s.Assert().Equal(imageID, res.Header.Get("Upload-Image-ID"))
+	res = chunk("10", "")
+	s.Require().Equal(http.StatusNoContent, res.StatusCode)
+
+	// the access tokens can upload and terminate the uploads
+	api := s.newClient()
+	writeToken := s.createAccessToken(c, "uploader", "write")
+	bearer := "Bearer " + writeToken
+	res = api.tusRequest("POST", uploadsPath, map[string]string{"Authorization": bearer, "Upload-Length": "4", "Upload-Metadata": "filename ZG9nLmpwZw=="}, "")
+	s.Require().Equal(http.StatusCreated, res.StatusCode)
+	uploadPath = res.Header.Get("Location")
+
+	res = api.tusRequest("DELETE", uploadPath, map[string]string{"Authorization": bearer}, "")
+	s.Require().Equal(http.StatusNoContent, res.StatusCode)
+	res = api.tusRequest("HEAD", uploadPath, map[string]string{"Authorization": bearer}, "")
+	s.Require().Equal(http.StatusNotFound, res.StatusCode)
+}
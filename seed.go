@@ -0,0 +1,115 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+
+	"github.com/abanoub-fathy/bebo-gallery/config"
+	"github.com/abanoub-fathy/bebo-gallery/model"
+)
+
+// seedCommand creates demo users and galleries with sample images
+//
+// running it again reuses the users that already exist
+func seedCommand(cfg *config.Config, args []string) error {
+	fs := flag.NewFlagSet("seed", flag.ExitOnError)
+	users := fs.Int("users", 2, "number of demo users")
+	galleries := fs.Int("galleries", 3, "number of galleries for each user")
+	images := fs.Int("images", 6, "number of images in each gallery")
+	password := fs.String("password", "pictures-in-bloom", "password of the demo users")
+	fs.Parse(args)
+
+	service, err := model.NewService(cfg)
+	if err != nil {
+		return err
+	}
+	defer service.Close()
+
+	for u := 1; u <= *users; u++ {
+		user, err := seedUser(service, u, *password)
+		if err != nil {
+			return err
+		}
+
+		for g := 1; g <= *galleries; g++ {
+			gallery := &model.Gallery{
+				Title:  fmt.Sprintf("Demo Gallery %v", g),
+				UserID: user.ID,
+			}
+			if err := service.GalleryService.CreateGallery(gallery); err != nil {
+				return err
+			}
+
+			for i := 1; i <= *images; i++ {
+				content, err := sampleImage(u*100 + g*10 + i)
+				if err != nil {
+					return err
+				}
+				fileName := fmt.Sprintf("sample-%02d.png", i)
+				if _, err := service.ImageService.CreateImage(io.NopCloser(content), gallery.ID, fileName); err != nil {
+					return err
+				}
+			}
+		}
+		fmt.Printf("seeded user %v with %v galleries\n", user.Email, *galleries)
+	}
+	return nil
+}
+
+func seedUser(service *model.Service, n int, password string) (*model.User, error) {
+	email := fmt.Sprintf("demo%v@example.com", n)
+
+	user, err := service.UserService.FindByEmail(email)
+	switch err {
+	case nil:
+		return user, nil
+	case model.ErrNotFound:
+	default:
+		return nil, err
+	}
+
+	user = &model.User{
+		FirstName: "Demo",
+		LastName:  fmt.Sprintf("User %v", n),
+		Email:     email,
+		Password:  password,
+	}
+	if err := service.UserService.CreateUser(user); err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// sampleImage draws a png gradient image
+// its colors are picked from the seed
+func sampleImage(seed int) (*bytes.Buffer, error) {
+	const width, height = 640, 480
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	base := color.RGBA{
+		R: uint8(seed * 53),
+		G: uint8(seed * 97),
+		B: uint8(seed * 29),
+		A: 255,
+	}
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			img.Set(x, y, color.RGBA{
+				R: base.R + uint8(x*255/width/2),
+				G: base.G + uint8(y*255/height/2),
+				B: base.B,
+				A: 255,
+			})
+		}
+	}
+
+	buffer := &bytes.Buffer{}
+	if err := png.Encode(buffer, img); err != nil {
+		return nil, err
+	}
+	return buffer, nil
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"net/http"
+
+	"github.com/abanoub-fathy/bebo-gallery/config"
+	"github.com/abanoub-fathy/bebo-gallery/model"
+	"github.com/abanoub-fathy/bebo-gallery/pkg/email"
+	"github.com/abanoub-fathy/bebo-gallery/router"
+)
+
+// serveCommand starts the web server
+func serveCommand(cfg *config.Config, args []string) error {
+	fs := flag.NewFlagSet("serve", flag.ExitOnError)
+	migrate := fs.Bool("migrate", true, "migrate the database before serving")
+	fs.Parse(args)
+
+	// create new email client
+	emailClient := email.NewClient(cfg.Mail)
+
+	// create new service
+	service, err := model.NewService(cfg)
+	if err != nil {
+		return err
+	}
+
+	// defer closing the services
+	defer service.Close()
+
+	// migrate all the models to the DB
+	if *migrate {
+		if err := service.Migrate(); err != nil {
+			return err
+		}
+	}
+
+	// create the app handler
+	handler := router.New(service, emailClient, cfg)
+
+	// start the app
+	fmt.Printf("🚀🚀 Server is working on http://localhost:%v\n", cfg.Port)
+	return http.ListenAndServe(fmt.Sprintf(":%v", cfg.Port), handler)
+}
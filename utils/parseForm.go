@@ -30,6 +30,10 @@ func parseValues(values url.Values, dst interface{}) error {
 	// ignore unknown keys
 	decoder.IgnoreUnknownKeys(true)
 
+	// keep the empty values of the slices so the slices
+	// of the same rows of a form stay aligned
+	decoder.ZeroEmpty(true)
+
 	// decode the values in the destination
 	err := decoder.Decode(dst, values)
 	if err != nil {
@@ -0,0 +1,30 @@
+// the links with data-load-more fetch the next page and append
+// its rows to the element of the selector instead of leaving
+// the page. the links still work as page links without js
+document.addEventListener("click", async (event) => {
+  const link = event.target.closest("a[data-load-more]");
+  if (!link) {
+    return;
+  }
+  event.preventDefault();
+
+  const selector = link.dataset.loadMore;
+  const response = await fetch(link.href, { credentials: "same-origin" });
+  if (!response.ok) {
+    window.location = link.href;
+    return;
+  }
+  const page = new DOMParser().parseFromString(await response.text(), "text/html");
+
+  const rows = page.querySelector(selector);
+  if (rows) {
+    document.querySelector(selector).append(...rows.children);
+  }
+
+  const next = page.querySelector(`a[data-load-more="${selector}"]`);
+  if (next) {
+    link.href = next.href;
+  } else {
+    link.remove();
+  }
+});
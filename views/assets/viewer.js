@@ -0,0 +1,170 @@
+// the image pages work without js as pages linked by their
+// previous and next links. the viewer moves between them
+// without reloading so the slideshow and the full screen
+// mode keep going. the url is updated on every image so
+// it can be shared with the slideshow state
+(() => {
+  const viewer = document.getElementById("viewer");
+  if (!viewer) {
+    return;
+  }
+
+  let timer = null;
+  let interval = Number(viewer.dataset.interval) || 5;
+
+  const find = (name) => viewer.querySelector(`[data-viewer-${name}]`);
+
+  // pageURL returns the url of the image page with
+  // the interval if the slideshow is playing
+  const pageURL = (href) => {
+    const url = new URL(href, window.location.href);
+    url.searchParams.delete("slideshow");
+    if (timer) {
+      url.searchParams.set("slideshow", interval);
+    }
+    return url.pathname + url.search;
+  };
+
+  // setup shows the controls and preloads the neighbour
+  // images so they are shown at once
+  const setup = () => {
+    viewer.querySelectorAll("[data-viewer-controls]").forEach((el) => {
+      el.hidden = false;
+    });
+    const play = find("play");
+    play.textContent = timer ? "Pause" : "Play";
+    play.setAttribute("aria-pressed", timer ? "true" : "false");
+    find("interval").value = String(interval);
+
+    for (const name of ["prev", "next"]) {
+      const link = find(name);
+      if (link && link.dataset.src) {
+        new Image().src = link.dataset.src;
+      }
+    }
+  };
+
+  // show replaces the viewer with the one of the page
+  // it falls back to loading the page if it fails
+  const show = async (href, push) => {
+    try {
+      const response = await fetch(pageURL(href), { credentials: "same-origin" });
+      if (!response.ok) {
+        throw new Error(response.statusText);
+      }
+      const page = new DOMParser().parseFromString(await response.text(), "text/html");
+      const next = page.getElementById("viewer");
+      if (!next) {
+        throw new Error("the page has no viewer");
+      }
+      viewer.innerHTML = next.innerHTML;
+      viewer.dataset.galleryUrl = next.dataset.galleryUrl;
+      setup();
+      if (push) {
+        window.history.pushState(null, "", pageURL(href));
+      }
+    } catch (err) {
+      window.location.href = href;
+    }
+  };
+
+  // go shows the previous or the next image
+  // it returns false at the ends of the gallery
+  const go = (name) => {
+    const link = find(name);
+    if (!link) {
+      return false;
+    }
+    show(link.href, true);
+    return true;
+  };
+
+  const stop = () => {
+    clearInterval(timer);
+    timer = null;
+    setup();
+    window.history.replaceState(null, "", pageURL(window.location.href));
+  };
+
+  // the slideshow stops at the last image
+  const play = () => {
+    clearInterval(timer);
+    timer = setInterval(() => {
+      if (!go("next")) {
+        stop();
+      }
+    }, interval * 1000);
+    setup();
+    window.history.replaceState(null, "", pageURL(window.location.href));
+  };
+
+  const toggleFullscreen = () => {
+    if (document.fullscreenElement) {
+      document.exitFullscreen();
+    } else if (viewer.requestFullscreen) {
+      viewer.requestFullscreen();
+    }
+  };
+
+  viewer.addEventListener("click", (event) => {
+    const target = event.target.closest("a, button");
+    if (!target) {
+      return;
+    }
+    if (target.matches("[data-viewer-prev], [data-viewer-next]")) {
+      event.preventDefault();
+      go(target.matches("[data-viewer-prev]") ? "prev" : "next");
+    } else if (target.matches("[data-viewer-play]")) {
+      timer ? stop() : play();
+    } else if (target.matches("[data-viewer-fullscreen]")) {
+      toggleFullscreen();
+    }
+  });
+
+  viewer.addEventListener("change", (event) => {
+    if (event.target.matches("[data-viewer-interval]")) {
+      interval = Number(event.target.value) || interval;
+      if (timer) {
+        play();
+      }
+    }
+  });
+
+  document.addEventListener("keydown", (event) => {
+    if (event.altKey || event.ctrlKey || event.metaKey || event.target.closest("input, select, textarea")) {
+      return;
+    }
+    switch (event.key) {
+      case "ArrowLeft":
+        go("prev");
+        break;
+      case "ArrowRight":
+        go("next");
+        break;
+      case " ":
+        timer ? stop() : play();
+        break;
+      case "f":
+        toggleFullscreen();
+        break;
+      case "Escape":
+        // the escape key leaves the full screen mode first
+        if (!document.fullscreenElement) {
+          window.location.href = viewer.dataset.galleryUrl;
+        }
+        break;
+      default:
+        return;
+    }
+    event.preventDefault();
+  });
+
+  window.addEventListener("popstate", () => {
+    show(window.location.href, false);
+  });
+
+  setup();
+  if ("playing" in viewer.dataset) {
+    play();
+  }
+})();
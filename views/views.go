@@ -7,9 +7,11 @@ import (
 	"log"
 	"net/http"
 	"path/filepath"
+	"strings"
 	"time"
 
 	"github.com/abanoub-fathy/bebo-gallery/pkg/context"
+	"github.com/abanoub-fathy/bebo-gallery/pkg/markdown"
 	"github.com/gorilla/csrf"
 )
 
@@ -47,6 +49,8 @@ func NewView(layout string, files ...string) *View {
 			const layout = "Monday, January 2, 2006 3:04 PM"
 			return t.In(time.Local).Format(layout)
 		},
+		"markdown": markdown.Render,
+		"join":     strings.Join,
 	}
 
 	// parse template file with layout files
@@ -169,17 +173,21 @@ func persistAlert(w http.ResponseWriter, alert Alert) {
 }
 
 func clearAlert(w http.ResponseWriter) {
+	// the cookies should have the same path
+	// of the persisted ones to replace them
 	levelCookie := &http.Cookie{
 		Name:     "alert_level",
+		Path:     "/",
 		Value:    "",
-		Expires:  time.Now(),
+		MaxAge:   -1,
 		HttpOnly: true,
 	}
 
 	msgCookie := &http.Cookie{
 		Name:     "alert_msg",
+		Path:     "/",
 		Value:    "",
-		Expires:  time.Now(),
+		MaxAge:   -1,
 		HttpOnly: true,
 	}
 